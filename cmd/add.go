@@ -42,6 +42,15 @@ var (
 	buildCommand string
 	startCommand string
 	postCommand  string
+	deployKey    bool
+	gitUsername  string
+	gitDepth     int
+	partialClone bool
+	submodules   bool
+	appPath      string
+	buildOutputs []string
+	pathFilters  []string
+	execPolicy   commands.Policy
 )
 
 // addCmd represents the add command
@@ -60,10 +69,12 @@ Required information:
   - Application port (--port)
 
 Optional customizations:
-  - Custom build commands (--build)
+  - Custom build commands (--build), dependencies are installed automatically when the lockfile changes
   - Custom start commands (--start, defaults to "npm start" for Node.js)
   - Post-deployment commands (--post)
   - Git branch and remote settings
+  - Shallow/partial clones and submodules for large repositories
+  - App path and path filters for apps living in a subfolder of a monorepo
 
 Examples:
   # Add a basic Node.js application
@@ -71,7 +82,7 @@ Examples:
 
   # Add with custom commands
   stackjet add --tech nodejs --port 8080 --repo https://github.com/username/api.git \
-    --build "npm install && npm run build" \
+    --build "npm run build" \
     --start "npm run prod" \
     --post "npm run migrate"
 
@@ -79,6 +90,25 @@ Examples:
   stackjet add --tech nodejs --port 3000 --repo https://github.com/username/app.git \
     --branch production
 
+  # Add a private repository with a generated deploy key
+  stackjet add --tech nodejs --port 3000 --repo git@github.com:username/private-app.git --deploy-key
+
+  # Add a private repository with an HTTPS access token (read from STACKJET_GIT_TOKEN or prompted)
+  stackjet add --tech nodejs --port 3000 --repo https://github.com/username/private-app.git \
+    --git-username username
+
+  # Add a large repository with a shallow, partial clone and its submodules
+  stackjet add --tech nodejs --port 3000 --repo https://github.com/username/monorepo.git \
+    --depth 1 --partial-clone --submodules
+
+  # Add an app from a subfolder of a monorepo, deployed only when it or a shared package changes
+  stackjet add --tech nodejs --port 4000 --repo https://github.com/username/monorepo.git \
+    --app-path apps/api --paths apps/api --paths packages/shared
+
+  # Run install, build and post commands as a dedicated user in a sandbox with resource limits
+  stackjet add --tech nodejs --port 3000 --repo https://github.com/username/app.git \
+    --run-as stack --sandbox auto --cpus 2 --memory 2048 --max-procs 512 --allow-env NODE_ENV
+
 After adding an application, deploy it with:
   stackjet deploy --dir /path/to/deployed/app`,
 
@@ -97,6 +127,12 @@ After adding an application, deploy it with:
 		if err := commands.ValidatePort(port); err != nil {
 			return err
 		}
+		if gitDepth < 0 {
+			return fmt.Errorf("⭕ Invalid depth: %d. Use 0 for the full history", gitDepth)
+		}
+		if err := execPolicy.Validate(); err != nil {
+			return fmt.Errorf("⭕ %s", err)
+		}
 		// validate start commands
 		startCommand = strings.TrimSpace(startCommand)
 		if startCommand != "" {
@@ -122,10 +158,19 @@ After adding an application, deploy it with:
 		dbConn := database.Connect()
 		defer dbConn.Close()
 		stackService := services.NewStackService(dbConn)
+		secretService := services.NewSecretService(dbConn)
+
+		// private repo credentials
+		creds, err := promptGitCredentials(repoUrl, deployKey, gitUsername)
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
 
 		// deploy stack logic
 		appCommands := models.StackCommands{
-			Start: startCommand,
+			Start:        startCommand,
+			BuildOutputs: buildOutputs,
 		}
 		if buildCommand != "" {
 			appCommands.Build = buildCommand
@@ -134,13 +179,22 @@ After adding an application, deploy it with:
 			appCommands.Post = postCommand
 		}
 
-		if err := stack.CreateNewStack(os.Stdout, context.Background(), *stackService, &dto.Stack_Create_Request{
-			Type:     stackType,
-			RepoUrl:  repoUrl,
-			Branch:   branch,
-			Remote:   remote,
-			Port:     port,
-			Commands: appCommands,
+		if err := stack.CreateNewStack(os.Stdout, context.Background(), *stackService, *secretService, &dto.Stack_Create_Request{
+			Type:           stackType,
+			RepoUrl:        repoUrl,
+			Branch:         branch,
+			Remote:         remote,
+			Port:           port,
+			Commands:       appCommands,
+			GitCredentials: creds,
+			AppPath:        appPath,
+			PathFilters:    pathFilters,
+			ExecPolicy:     execPolicy,
+			GitOptions: models.GitOptions{
+				Depth:        gitDepth,
+				PartialClone: partialClone,
+				Submodules:   submodules,
+			},
 		}); err != nil {
 			fmt.Printf("⭕ Failed to deploy stack: %s\n", err)
 			return
@@ -158,8 +212,22 @@ func init() {
 	addCmd.Flags().IntVarP(&port, "port", "p", 0, "Port number for the application")
 	addCmd.Flags().StringVar(&branch, "branch", "", "Git branch name (default master)")
 	addCmd.Flags().StringVar(&remote, "git-remote", "", "Git remote name (default origin)")
-	addCmd.Flags().StringVar(&buildCommand, "build", "", "Build commands (e.g. 'npm i && npm run build', 'mvn clean package', 'gradle build', etc...)")
+	addCmd.Flags().StringVar(&buildCommand, "build", "", "Build commands (e.g. 'npm run build', 'mvn clean package', 'gradle build', etc...)")
+	addCmd.Flags().StringSliceVar(&buildOutputs, "build-output", nil, "Build output folders cached per commit (default dist, build, .next, out)")
 	addCmd.Flags().StringVar(&startCommand, "start", "", "App start commands (e.g. 'npm start', 'mvn spring-boot:run', 'gradle bootRun', etc...)")
+	addCmd.Flags().BoolVar(&deployKey, "deploy-key", false, "Generate an SSH deploy key for a private repository")
+	addCmd.Flags().StringVar(&gitUsername, "git-username", "", "Username for HTTPS access to a private repository (token read from STACKJET_GIT_TOKEN or prompted)")
+	addCmd.Flags().IntVar(&gitDepth, "depth", 0, "Clone and fetch only the last n commits (default full history)")
+	addCmd.Flags().BoolVar(&partialClone, "partial-clone", false, "Clone without file contents of old commits (--filter=blob:none)")
+	addCmd.Flags().BoolVar(&submodules, "submodules", false, "Initialize and update git submodules recursively on every deploy")
+	addCmd.Flags().StringVar(&appPath, "app-path", "", "Subfolder of the repo the app lives in (monorepos)")
+	addCmd.Flags().StringSliceVar(&pathFilters, "paths", nil, "Repo paths that trigger a deploy, deploys without changes in them are skipped (repeatable)")
+	addCmd.Flags().StringVar(&execPolicy.User, "run-as", "", "Run install, build and post commands as this user, 'stack' for a dedicated user per app (requires root)")
+	addCmd.Flags().StringVar(&execPolicy.Sandbox, "sandbox", "", "Run install, build and post commands in a bubblewrap sandbox: 'bwrap', or 'auto' when installed")
+	addCmd.Flags().Float64Var(&execPolicy.CPUs, "cpus", 0, "Limit install, build and post commands to this many CPU cores (cgroup v2)")
+	addCmd.Flags().IntVar(&execPolicy.MemoryMB, "memory", 0, "Limit the memory of install, build and post commands in MB (cgroup v2)")
+	addCmd.Flags().IntVar(&execPolicy.MaxProcesses, "max-procs", 0, "Limit the processes of install, build and post commands (cgroup v2)")
+	addCmd.Flags().StringSliceVar(&execPolicy.AllowEnv, "allow-env", nil, "Environment variables passed to install, build and post commands, all if not set (PATH is always passed)")
 	addCmd.Flags().StringVar(&postCommand, "post", "", "Post deployment commands (e.g. 'npm run post-deploy', 'mvn post-deploy', 'gradle post-deploy', etc...)")
 
 	// register auto completion for stack flag
@@ -0,0 +1,132 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var (
+	auditActor  string
+	auditSource string
+	auditAction string
+	auditStack  string
+	auditResult string
+	auditSince  string
+	auditUntil  string
+	auditLimit  uint64
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit log of changes, deployments and logins",
+	Long: `Show the audit log, newest events first.
+
+Every change made through the CLI, the API, webhooks or scheduled jobs is recorded with who made it,
+from where and whether it succeeded. Secret values are never recorded, only their names.
+
+Examples:
+  # Show the last 100 events
+  stackjet audit
+
+  # Show failed logins since a date
+  stackjet audit --action auth. --result failure --since 2025-01-01
+
+  # Show the deployments of an app
+  stackjet audit --stack my-app --action deployment.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		switch auditSource {
+		case "", "cli", "api", "webhook", "scheduler":
+		default:
+			return fmt.Errorf("⭕ Source must be one of cli, api, webhook or scheduler")
+		}
+		switch auditResult {
+		case "", "success", "failure", "blocked":
+		default:
+			return fmt.Errorf("⭕ Result must be one of success, failure or blocked")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		auditService := services.NewAuditService(dbConn)
+		ctx := context.Background()
+
+		filter := &dto.AuditEvent_List_Request{
+			Actor:  auditActor,
+			Source: auditSource,
+			Action: auditAction,
+			Result: auditResult,
+			Since:  auditSince,
+			Until:  auditUntil,
+			Limit:  auditLimit,
+		}
+		if auditStack != "" {
+			app, err := findStack(ctx, services.NewStackService(dbConn), auditStack)
+			if err != nil {
+				fmt.Printf("⭕ %s\n", err)
+				return
+			}
+			filter.StackID = app.ID
+		}
+
+		events, err := auditService.ListEvents(ctx, filter)
+		if err != nil {
+			fmt.Printf("⭕ Failed to list audit events: %s\n", err)
+			return
+		}
+		if len(events) == 0 {
+			fmt.Println("No audit events found.")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTIME\tSOURCE\tACTOR\tACTION\tSTACK\tRESULT\tIP\tSUMMARY")
+		for _, event := range events {
+			stackID := "-"
+			if event.StackID != nil {
+				stackID = strconv.FormatInt(*event.StackID, 10)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", event.ID, event.CreatedAt, event.Source, event.Actor, event.Action, stackID, event.Result, event.IP, event.Summary)
+		}
+		tw.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().StringVar(&auditActor, "actor", "", "Only show events of this actor, the email of a user or a system user")
+	auditCmd.Flags().StringVar(&auditSource, "source", "", "Only show events from cli, api, webhook or scheduler")
+	auditCmd.Flags().StringVar(&auditAction, "action", "", "Only show actions starting with this, e.g. deployment. or secret.set")
+	auditCmd.Flags().StringVarP(&auditStack, "stack", "s", "", "Only show events of this app, by ID, UUID, name or directory")
+	auditCmd.Flags().StringVar(&auditResult, "result", "", "Only show events with this result: success, failure or blocked")
+	auditCmd.Flags().StringVar(&auditSince, "since", "", "Only show events at or after this RFC3339 time or date")
+	auditCmd.Flags().StringVar(&auditUntil, "until", "", "Only show events before this RFC3339 time or up to and including this date")
+	auditCmd.Flags().Uint64VarP(&auditLimit, "limit", "n", 100, "Maximum number of events to show")
+}
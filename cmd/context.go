@@ -0,0 +1,147 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/satnamSandhu2001/stackjet/internal/core/apiclient"
+	"github.com/spf13/cobra"
+)
+
+// contextCmd represents the context command
+var contextCmd = &cobra.Command{
+	Use:   "context",
+	Short: "Manage the StackJet servers this machine is logged in to",
+	Long: `Manage the contexts saved by 'stackjet login', one per StackJet server.
+
+Commands supporting other servers run on the current context, unless one is selected with --context
+or $STACKJET_CONTEXT. Without a current context they run on this server.
+
+Examples:
+  # List contexts, the current one is marked with *
+  stackjet context list
+
+  # Switch to another server
+  stackjet context use staging
+
+  # Run commands on this server again
+  stackjet context unset`,
+}
+
+var contextListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List contexts",
+	Run: func(cmd *cobra.Command, args []string) {
+		contexts, err := apiclient.LoadContexts()
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+		if len(contexts.Contexts) == 0 {
+			fmt.Println("No contexts, log in to a server with 'stackjet login <server-url>'.")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CURRENT\tNAME\tSERVER\tUSER")
+		for _, name := range contexts.Names() {
+			current := ""
+			if name == contexts.Current {
+				current = "*"
+			}
+			serverContext := contexts.Contexts[name]
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", current, name, serverContext.Server, serverContext.User)
+		}
+		tw.Flush()
+	},
+}
+
+var contextUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Make a context the current context",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		contexts, err := apiclient.LoadContexts()
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+		name, serverContext, err := contexts.Select(args[0])
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+		contexts.Current = name
+		if err := contexts.Save(); err != nil {
+			fmt.Printf("⭕ Failed to save contexts: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ Context %s (%s) is now current\n", name, serverContext.Server)
+	},
+}
+
+var contextUnsetCmd = &cobra.Command{
+	Use:   "unset",
+	Short: "Clear the current context, commands run on this server again",
+	Run: func(cmd *cobra.Command, args []string) {
+		contexts, err := apiclient.LoadContexts()
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+		contexts.Current = ""
+		if err := contexts.Save(); err != nil {
+			fmt.Printf("⭕ Failed to save contexts: %s\n", err)
+			return
+		}
+		fmt.Println("✅ No context is current, commands run on this server")
+	},
+}
+
+var contextDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a context without logging out",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		contexts, err := apiclient.LoadContexts()
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+		name, _, err := contexts.Select(args[0])
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+		delete(contexts.Contexts, name)
+		if contexts.Current == name {
+			contexts.Current = ""
+		}
+		if err := contexts.Save(); err != nil {
+			fmt.Printf("⭕ Failed to save contexts: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ Context %s deleted\n", name)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(contextCmd)
+	contextCmd.AddCommand(contextListCmd, contextUseCmd, contextUnsetCmd, contextDeleteCmd)
+}
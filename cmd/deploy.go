@@ -21,11 +21,15 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/satnamSandhu2001/stackjet/database"
 	"github.com/satnamSandhu2001/stackjet/internal/core/stack"
 	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
 	"github.com/satnamSandhu2001/stackjet/internal/services"
 	"github.com/satnamSandhu2001/stackjet/pkg"
 	"github.com/spf13/cobra"
@@ -33,23 +37,32 @@ import (
 
 // flags
 var (
-	dir string
+	dir    string
+	appRef string
 
 	gitBranch string
 	gitRemote string
 	gitReset  bool
 	gitHash   string
+	force     bool
+	gitRef    string
+	gitTag    string
+	verifySig bool
+	dryRun    bool
+	noCache   bool
 )
 
 // deployCmd represents the deploy command
 var deployCmd = &cobra.Command{
-	Use:   "deploy",
-	Short: "Deploy your app with Git sync, NGINX, SSL, service restarts and more",
+	Use:         "deploy",
+	Annotations: remoteCommand,
+	Short:       "Deploy your app with Git sync, NGINX, SSL, service restarts and more",
 	Long: `Deploy your application end-to-end with automated Git synchronization and process management.
 
 This command handles the complete deployment workflow:
   - Pulls the latest code from your Git repository
-  - Executes build commands if specified
+  - Installs dependencies when the lockfile changed
+  - Executes build commands if specified, or restores the cached build of the commit
   - Manages application processes (PM2 for Node.js applications)
   - Executes post-deployment commands
   - Provides rollback capabilities to specific commits
@@ -73,56 +86,187 @@ Examples:
   # Rollback to specific commit
   stackjet deploy --git-hash "abc123def456"
 
+  # Deploy a release tag and verify its signature
+  stackjet deploy --tag "v1.4.2" --verify-signature
+
+  # Deploy another branch, tag or commit without changing the app's branch
+  stackjet deploy --ref "hotfix/login"
+
+  # Show what a deploy would do without changing anything
+  stackjet deploy --dry-run
+
+  # Deploy even if none of the app's path filters changed
+  stackjet deploy --force
+
   # Deploy without git reset (preserve local changes)
   stackjet deploy --git-reset=false
 
+  # Deploy an app on the server of the current context, see 'stackjet login'
+  stackjet deploy --app my-app
+
 Note: The directory must contain a StackJet-managed application (added via 'stackjet add').`,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		// set default values
-		if !cmd.Flags().Changed("git-reset") {
+		targets := 0
+		for _, target := range []string{gitTag, gitRef, gitHash} {
+			if target != "" {
+				targets++
+			}
+		}
+		if targets > 1 {
+			return fmt.Errorf("⭕ Only one of --tag, --ref or --git-hash can be used")
+		}
+		if apiClient != nil && cmd.Flags().Changed("dir") {
+			return fmt.Errorf("⭕ --dir selects apps on this server, use -a or --app on context %s", apiClient.Name)
+		}
+		if apiClient != nil && cmd.Flags().Changed("git-reset") {
+			return fmt.Errorf("⭕ --git-reset is set by the GIT_RESET config of the server of context %s", apiClient.Name)
+		}
+		// set default values, servers of other contexts use their own config
+		if !cmd.Flags().Changed("git-reset") && apiClient == nil {
 			gitReset = pkg.Config().GIT_RESET
 		}
 		return nil
 
 	},
 	Run: func(cmd *cobra.Command, args []string) {
+		// commands run in their own process groups, so ctrl+c has to cancel them explicitly
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// closing the stream of a deploy on another server cancels it there
+		if apiClient != nil {
+			app, err := findRemoteStack(ctx, apiClient, appRef)
+			if err != nil {
+				fmt.Printf("⭕ %s\n", err)
+				return
+			}
+			streamDeployment(ctx, apiClient, fmt.Sprintf("/stack/deploy/%d", app.ID), &dto.Stack_Deploy_Request{
+				ID:      app.ID,
+				Remote:  gitRemote,
+				Branch:  gitBranch,
+				GitHash: gitHash,
+				Ref:     gitRef,
+				Tag:     gitTag,
+				Force:   force,
+
+				VerifySignature: verifySig,
+				DryRun:          dryRun,
+				NoCache:         noCache,
+			})
+			return
+		}
+
 		dbConn := database.Connect()
 		defer dbConn.Close()
 		stackService := services.NewStackService(dbConn)
+		secretService := services.NewSecretService(dbConn)
 
-		var logBuf strings.Builder
-		multiWriter := io.MultiWriter(os.Stdout, &logBuf)
+		if appRef != "" {
+			app, err := findStack(ctx, stackService, appRef)
+			if err != nil {
+				fmt.Printf("⭕ %s\n", err)
+				return
+			}
+			dir = app.Directory
+		}
 
 		// deploy stack logic
-		deploymentID, err := stack.DeployStack(multiWriter, context.Background(), *stackService, &dto.Stack_Deploy_Request{
-			Directory: dir,
-			Remote:    gitRemote,
-			Branch:    gitBranch,
+		runDeployment(stackService, func(w io.Writer) (int64, error) {
+			return stack.DeployStack(w, ctx, *stackService, *secretService, &dto.Stack_Deploy_Request{
+				Directory: dir,
+				Remote:    gitRemote,
+				Branch:    gitBranch,
+				GitHash:   gitHash,
+				GitReset:  gitReset,
+				Ref:       gitRef,
+				Tag:       gitTag,
+				Force:     force,
+
+				VerifySignature: verifySig,
+				DryRun:          dryRun,
+				NoCache:         noCache,
+			})
 		})
-		if err != nil {
-			multiWriter.Write([]byte("__ERROR__: " + err.Error()))
-			fmt.Printf("\033[31m⚠️ Deployment failed: %v \033[0m", err)
-			return
+	}}
+
+// runDeployment runs a deployment on this server, printing its log and saving it with the deployment
+func runDeployment(stackService *services.StackService, deploy func(w io.Writer) (int64, error)) {
+	var logBuf strings.Builder
+	multiWriter := io.MultiWriter(os.Stdout, &logBuf)
+
+	deploymentID, err := deploy(multiWriter)
+	if err != nil {
+		logBuf.WriteString("__ERROR__: " + err.Error())
+	}
+	// Save logs to DB, also of failed and cancelled deployments
+	if deploymentID != 0 {
+		_, logErr := stackService.CreateDeploymentLog(context.Background(), &dto.DeploymentLog_Create_Request{
+			DeploymentID: deploymentID,
+			Log:          logBuf.String(),
+		})
+		if logErr != nil {
+			fmt.Println("⚠️ Failed to save logs to DB:", logErr)
 		}
-		// Save logs to DB
-		if deploymentID != 0 {
-			_, err := stackService.CreateDeploymentLog(context.Background(), &dto.DeploymentLog_Create_Request{
-				DeploymentID: deploymentID,
-				Log:          logBuf.String(),
-			})
-			if err != nil {
-				fmt.Println("⚠️ Failed to save logs to DB:", err)
-			}
+		printStepSummary(stackService, deploymentID)
+	}
+	if err != nil {
+		fmt.Printf("\033[31m⚠️ Deployment failed: %v \033[0m\n", err)
+	}
+}
+
+// prints the steps of a deployment with their status and duration
+func printStepSummary(stackService *services.StackService, deploymentID int64) {
+	steps, err := stackService.GetDeploymentSteps(context.Background(), deploymentID)
+	if err != nil {
+		return
+	}
+	printSteps(steps)
+}
+
+func printSteps(steps []models.DeploymentStep) {
+	if len(steps) == 0 {
+		return
+	}
+	icons := map[string]string{
+		models.DEPLOYMENT_STATUS_SUCCESS:   "✅",
+		models.DEPLOYMENT_STATUS_SKIPPED:   "⏭️",
+		models.DEPLOYMENT_STATUS_FAILED:    "❌",
+		models.DEPLOYMENT_STATUS_CANCELLED: "🛑",
+		models.DEPLOYMENT_STATUS_TIMED_OUT: "⏰",
+	}
+	var total time.Duration
+	fmt.Println()
+	fmt.Println("📋 Steps:")
+	for _, step := range steps {
+		duration := time.Duration(step.DurationMs) * time.Millisecond
+		total += duration
+		icon, ok := icons[step.Status]
+		if !ok {
+			icon = "⏳"
 		}
-	}}
+		line := fmt.Sprintf("  %s %-8s %-10s %8s", icon, step.Name, step.Status, duration.Round(100*time.Millisecond))
+		if step.ExitCode != nil && *step.ExitCode != 0 {
+			line += fmt.Sprintf("  (exit code %d)", *step.ExitCode)
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("  Total: %s\n", total.Round(100*time.Millisecond))
+}
 
 func init() {
 	rootCmd.AddCommand(deployCmd)
 
 	deployCmd.Flags().StringVarP(&dir, "dir", "d", "./", "Root directory of the project to deploy")
+	deployCmd.Flags().StringVarP(&appRef, "app", "a", "", "ID, UUID or name of the app to deploy, required on other servers")
 	deployCmd.Flags().StringVar(&gitBranch, "branch", "", "Git branch name to deploy")
 	deployCmd.Flags().StringVar(&gitRemote, "git-remote", "", "Git remote name (e.g., 'origin', 'upstream')")
 	deployCmd.Flags().StringVar(&gitHash, "git-hash", "", "Rollback to specific commit hash")
+	deployCmd.Flags().StringVar(&gitRef, "ref", "", "Branch, tag or commit to deploy instead of the head of the app's branch")
+	deployCmd.Flags().StringVar(&gitTag, "tag", "", "Tag to deploy (e.g. 'v1.4.2')")
+	deployCmd.Flags().BoolVar(&verifySig, "verify-signature", false, "Require a valid GPG/SSH signature of an allowed signer on the deployed tag or commit")
+	deployCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Fetch and print the incoming commits, changed files and steps of the deploy without changing anything")
+	deployCmd.Flags().BoolVar(&noCache, "no-cache", false, "Rebuild even if a build of the commit is cached")
+	deployCmd.Flags().BoolVar(&force, "force", false, "Deploy even if none of the app's path filters changed")
 	deployCmd.Flags().BoolVar(&gitReset, "git-reset", true, "Force reset Git state before deployment")
 
 }
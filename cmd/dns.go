@@ -0,0 +1,167 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/core/dns"
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/spf13/cobra"
+)
+
+// dnsCmd represents the dns command
+var dnsCmd = &cobra.Command{
+	Use:   "dns",
+	Short: "Sync DNS records of your domains with the DNS provider",
+	Long: `Sync the DNS records of domains attached with 'stackjet domain add' through the configured DNS provider.
+
+Currently supported providers:
+  - cloudflare: store the API token with 'stackjet secret set cloudflare_api_token'
+
+Set "dns_provider", "dns_ipv4" and optionally "dns_ipv6", "dns_ttl" and "dns_proxied" in
+~/.stackjet/config.json. Records are then created automatically when a domain is attached.
+
+Examples:
+  # Show records and detect drift at the provider
+  stackjet dns status
+
+  # Re-sync a record, fixing any drift
+  stackjet dns sync example.com
+
+  # Switch a record to a proxied CNAME
+  stackjet dns sync www.example.com --type CNAME --content example.com --proxied`,
+}
+
+var dnsSyncCmd = &cobra.Command{
+	Use:   "sync [domain]",
+	Short: "Create or update DNS records at the provider",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		stackService := services.NewStackService(dbConn)
+		secretService := services.NewSecretService(dbConn)
+		ctx := context.Background()
+
+		if len(args) == 1 {
+			if err := dns.SyncDomain(os.Stdout, ctx, *stackService, *secretService, dnsSyncRequest(cmd, args[0])); err != nil {
+				fmt.Printf("⭕ Failed to sync DNS record: %s\n", err)
+			}
+			return
+		}
+
+		records, err := stackService.GetDNSRecordList(ctx)
+		if err != nil {
+			fmt.Printf("⭕ Failed to list DNS records: %s\n", err)
+			return
+		}
+		for _, r := range records {
+			if err := dns.SyncDomain(os.Stdout, ctx, *stackService, *secretService, &dto.DNSRecord_Sync_Request{Domain: r.Domain}); err != nil {
+				fmt.Printf("⭕ Failed to sync DNS record of %s: %s\n", r.Domain, err)
+			}
+		}
+	},
+}
+
+var dnsStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show DNS records and detect drift at the provider",
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		stackService := services.NewStackService(dbConn)
+		secretService := services.NewSecretService(dbConn)
+		ctx := context.Background()
+
+		records, err := stackService.GetDNSRecordList(ctx)
+		if err != nil {
+			fmt.Printf("⭕ Failed to list DNS records: %s\n", err)
+			return
+		}
+		if len(records) == 0 {
+			fmt.Println("No DNS records found.")
+			return
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "DOMAIN\tTYPE\tCONTENT\tTTL\tPROXIED\tPROVIDER\tSTATUS")
+		for _, r := range records {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%t\t%s\t%s\n", r.Domain, r.Type, r.Content, r.TTL, r.Proxied, r.Provider, driftStatus(ctx, stackService, secretService, &r))
+		}
+		tw.Flush()
+	},
+}
+
+// flags
+var (
+	dnsType    string
+	dnsContent string
+	dnsTTL     int
+	dnsProxied bool
+	dnsSkip    bool
+)
+
+// builds a sync request from the dns flags of a command
+func dnsSyncRequest(cmd *cobra.Command, domain string) *dto.DNSRecord_Sync_Request {
+	req := &dto.DNSRecord_Sync_Request{
+		Domain:  domain,
+		Type:    dnsType,
+		Content: dnsContent,
+		TTL:     dnsTTL,
+	}
+	if cmd.Flags().Changed("proxied") {
+		req.Proxied = &dnsProxied
+	}
+	return req
+}
+
+func driftStatus(ctx context.Context, stackService *services.StackService, secretService *services.SecretService, record *models.DNSRecord) string {
+	drift, err := dns.CheckDrift(ctx, *stackService, *secretService, record)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	if drift.Missing {
+		return "missing"
+	}
+	if !drift.InSync() {
+		return "drift: " + strings.Join(drift.Differences, ", ")
+	}
+	return "in sync"
+}
+
+// registers the record flags shared by 'dns sync' and 'domain add'
+func addDNSFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&dnsType, "type", "", "DNS record type: A, AAAA or CNAME (default A)")
+	cmd.Flags().StringVar(&dnsContent, "content", "", `Record content, IP address or CNAME target (default "dns_ipv4"/"dns_ipv6" from config)`)
+	cmd.Flags().IntVar(&dnsTTL, "ttl", 0, `Record TTL in seconds, 1 is automatic (default "dns_ttl" from config)`)
+	cmd.Flags().BoolVar(&dnsProxied, "proxied", false, `Proxy traffic through the provider CDN (default "dns_proxied" from config)`)
+}
+
+func init() {
+	rootCmd.AddCommand(dnsCmd)
+	dnsCmd.AddCommand(dnsSyncCmd, dnsStatusCmd)
+
+	addDNSFlags(dnsSyncCmd)
+}
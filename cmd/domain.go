@@ -0,0 +1,220 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/core/dns"
+	"github.com/satnamSandhu2001/stackjet/internal/core/nginx"
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var (
+	domainDir        string
+	domainPort       int
+	domainHeaders    []string
+	domainCustomConf string
+)
+
+// domainCmd represents the domain command
+var domainCmd = &cobra.Command{
+	Use:   "domain",
+	Short: "Manage NGINX reverse-proxy domains of your apps",
+	Long: `Attach domains to your applications and let StackJet manage the NGINX reverse-proxy config.
+
+StackJet renders one config file per app into the NGINX sites-available directory, enables it
+in sites-enabled, validates it with 'nginx -t' and reloads NGINX. If validation fails the previous
+config is restored and NGINX keeps running untouched.
+
+When a DNS provider is configured (see 'stackjet dns --help'), the DNS record of the domain is
+created or updated at the provider too, and deleted again when the domain is removed.
+
+Examples:
+  # Attach a domain to the app in the current directory
+  stackjet domain add example.com
+
+  # Attach a domain with extra proxy headers
+  stackjet domain add api.example.com --dir /var/www/sites/my-api \
+    --header "X-Frame-Options: DENY"
+
+  # List all domains
+  stackjet domain list
+
+  # Detach a domain
+  stackjet domain remove example.com`,
+}
+
+var domainAddCmd = &cobra.Command{
+	Use:   "add <domain>",
+	Short: "Attach a domain to an app and reload NGINX",
+	Args:  cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if domainPort != 0 && (domainPort < 1 || domainPort > 65535) {
+			return fmt.Errorf("⭕ Port must be between 1 and 65535")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		stackService := services.NewStackService(dbConn)
+
+		stack, err := findStackByDir(context.Background(), stackService, domainDir)
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+		headers, err := parseHeaders(domainHeaders)
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+
+		if err := nginx.AddDomain(os.Stdout, context.Background(), *stackService, stack, &dto.Nginx_Create_Request{
+			Domain:     args[0],
+			Port:       domainPort,
+			Headers:    headers,
+			CustomConf: domainCustomConf,
+		}); err != nil {
+			fmt.Printf("⭕ Failed to add domain: %s\n", err)
+			return
+		}
+
+		if dnsSkip || (pkg.Config().DNS_PROVIDER == "" && !cmd.Flags().Changed("type")) {
+			return
+		}
+		secretService := services.NewSecretService(dbConn)
+		if err := dns.SyncDomain(os.Stdout, context.Background(), *stackService, *secretService, dnsSyncRequest(cmd, args[0])); err != nil {
+			fmt.Printf("⭕ Domain added but DNS sync failed: %s\n", err)
+			fmt.Println("   Fix the issue and run \033[1;34mstackjet dns sync " + args[0] + "\033[0m")
+			return
+		}
+	},
+}
+
+var domainRemoveCmd = &cobra.Command{
+	Use:   "remove <domain>",
+	Short: "Detach a domain from its app and reload NGINX",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		stackService := services.NewStackService(dbConn)
+		secretService := services.NewSecretService(dbConn)
+
+		if !dnsSkip {
+			if err := dns.RemoveDomainRecord(os.Stdout, context.Background(), *stackService, *secretService, strings.ToLower(strings.TrimSpace(args[0]))); err != nil {
+				fmt.Printf("⭕ Failed to remove DNS record: %s\n", err)
+				fmt.Println("   Use --skip-dns to remove the domain anyway")
+				return
+			}
+		}
+		if err := nginx.RemoveDomain(os.Stdout, context.Background(), *stackService, args[0]); err != nil {
+			fmt.Printf("⭕ Failed to remove domain: %s\n", err)
+			return
+		}
+	},
+}
+
+var domainListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List domains managed by StackJet",
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		stackService := services.NewStackService(dbConn)
+		ctx := context.Background()
+
+		var configs []models.NginxConfig
+		var err error
+		if cmd.Flags().Changed("dir") {
+			stack, err := findStackByDir(ctx, stackService, domainDir)
+			if err != nil {
+				fmt.Printf("⭕ %s\n", err)
+				return
+			}
+			configs, err = stackService.GetNginxConfigsByStackID(ctx, stack.ID)
+		} else {
+			configs, err = stackService.GetNginxConfigList(ctx)
+		}
+		if err != nil {
+			fmt.Printf("⭕ Failed to list domains: %s\n", err)
+			return
+		}
+		if len(configs) == 0 {
+			fmt.Println("No domains found.")
+			return
+		}
+
+		stacks, err := stackService.GetStackList(ctx)
+		if err != nil {
+			fmt.Printf("⭕ Failed to list domains: %s\n", err)
+			return
+		}
+		stackNames := make(map[int64]string, len(stacks))
+		for _, s := range stacks {
+			stackNames[s.ID] = s.Name
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "DOMAIN\tAPP\tPORT\tSSL")
+		for _, c := range configs {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%t\n", c.Domain, stackNames[c.StackID], c.Port, c.SSLEnabled)
+		}
+		tw.Flush()
+	},
+}
+
+// parses "Name: value" header flags
+func parseHeaders(raw []string) (models.NginxHeaders, error) {
+	headers := models.NginxHeaders{}
+	for _, h := range raw {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf(`invalid header %q, expected "Name: value"`, h)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+func init() {
+	rootCmd.AddCommand(domainCmd)
+	domainCmd.AddCommand(domainAddCmd, domainRemoveCmd, domainListCmd)
+
+	domainAddCmd.Flags().StringVarP(&domainDir, "dir", "d", "./", "Root directory of the app")
+	domainAddCmd.Flags().IntVarP(&domainPort, "port", "p", 0, "Port to proxy to (default app port)")
+	domainAddCmd.Flags().StringArrayVar(&domainHeaders, "header", nil, `Extra header passed to the app, repeatable (e.g. "X-Frame-Options: DENY")`)
+	domainAddCmd.Flags().StringVar(&domainCustomConf, "conf", "", `Custom NGINX directives for the location block (e.g. "client_max_body_size 50m;")`)
+
+	addDNSFlags(domainAddCmd)
+	domainAddCmd.Flags().BoolVar(&dnsSkip, "skip-dns", false, "Do not create a DNS record at the DNS provider")
+	domainRemoveCmd.Flags().BoolVar(&dnsSkip, "skip-dns", false, "Do not delete the DNS record at the DNS provider")
+
+	domainListCmd.Flags().StringVarP(&domainDir, "dir", "d", "./", "Only list domains of the app in this directory")
+}
@@ -0,0 +1,156 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/internal/core/git"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+)
+
+// findStackByDir resolves a (possibly relative) directory to the stack registered for it
+func findStackByDir(ctx context.Context, service *services.StackService, dir string) (*models.Stack, error) {
+	absDir, err := filepath.Abs(strings.TrimSpace(dir))
+	if err != nil {
+		return nil, err
+	}
+	stack, err := service.GetStackByDirectory(ctx, absDir)
+	if err != nil {
+		return nil, err
+	}
+	if stack == nil {
+		return nil, fmt.Errorf("no StackJet app found in directory %s", absDir)
+	}
+	return stack, nil
+}
+
+// findStack resolves a stack by its ID, UUID, name or directory
+func findStack(ctx context.Context, service *services.StackService, ref string) (*models.Stack, error) {
+	ref = strings.TrimSpace(ref)
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		if stack, err := service.GetStackByID(ctx, id); err != nil || stack != nil {
+			return stack, err
+		}
+	}
+	if stack, err := service.GetStackByUuid(ctx, ref); err != nil || stack != nil {
+		return stack, err
+	}
+	stacks, err := service.GetStackList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var found *models.Stack
+	for i := range stacks {
+		if stacks[i].Name == ref {
+			if found != nil {
+				return nil, fmt.Errorf("multiple apps are named %s, use the app directory or uuid instead", ref)
+			}
+			found = &stacks[i]
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+	return findStackByDir(ctx, service, ref)
+}
+
+// promptGitCredentials builds private repo credentials from the add flags, prompting where needed
+func promptGitCredentials(repoUrl string, withDeployKey bool, username string) (*models.GitCredentials, error) {
+	if !withDeployKey && username == "" {
+		return nil, nil
+	}
+	creds := &models.GitCredentials{}
+	reader := bufio.NewReader(os.Stdin)
+
+	if withDeployKey {
+		privateKey, publicKey, err := git.GenerateDeployKey("stackjet-deploy-key")
+		if err != nil {
+			return nil, err
+		}
+		creds.SSHPrivateKey = privateKey
+		fmt.Println("🔑 Add this public key as a read-only deploy key of the repository:")
+		fmt.Printf("\n%s\n\n", publicKey)
+		fmt.Print("Press Enter once the key is added...")
+		reader.ReadString('\n')
+	}
+
+	if username != "" {
+		token := os.Getenv("STACKJET_GIT_TOKEN")
+		if token == "" {
+			fmt.Printf("Enter access token for %s: ", repoUrl)
+			line, _ := reader.ReadString('\n')
+			token = strings.TrimSpace(line)
+		}
+		if token == "" {
+			return nil, errors.New("git access token is required with --git-username")
+		}
+		creds.Username = username
+		creds.Password = token
+	}
+	return creds, nil
+}
+
+// stdinReader is shared by prompts so that piped input is not lost between them
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// promptPassword reads a password from stdin, without echoing it when stdin is a terminal
+func promptPassword(prompt string) string {
+	fmt.Print(prompt)
+	noEcho := exec.Command("stty", "-echo")
+	noEcho.Stdin = os.Stdin
+	if noEcho.Run() == nil {
+		defer func() {
+			echo := exec.Command("stty", "echo")
+			echo.Stdin = os.Stdin
+			echo.Run()
+			fmt.Println()
+		}()
+	}
+	line, _ := stdinReader.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// minPasswordLength matches the min binding of the password fields in the user dtos
+const minPasswordLength = 12
+
+// promptNewPassword asks for a new password twice and checks it has the length the API accepts
+func promptNewPassword() (string, error) {
+	password := promptPassword("Enter password: ")
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters long", minPasswordLength)
+	}
+	if promptPassword("Confirm password: ") != password {
+		return "", errors.New("passwords do not match")
+	}
+	return password, nil
+}
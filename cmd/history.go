@@ -0,0 +1,102 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var (
+	historyLimit uint64
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:         "history",
+	Annotations: remoteCommand,
+	Short:       "List the deployments of an app",
+	Long: `List the latest deployments of an application, newest first.
+
+Examples:
+  # List the deployments of the app in the current directory
+  stackjet history
+
+  # List the deployments of an app on another server, see 'stackjet login'
+  stackjet history --app my-app --context production`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		deployments := []models.Deployment{}
+		if apiClient != nil {
+			app, err := findRemoteStack(ctx, apiClient, appRef)
+			if err != nil {
+				fmt.Printf("⭕ %s\n", err)
+				return
+			}
+			if err := apiClient.Do(ctx, http.MethodGet, fmt.Sprintf("/stack/%d/deployments?limit=%d", app.ID, historyLimit), nil, &deployments); err != nil {
+				fmt.Printf("⭕ Failed to list deployments: %s\n", err)
+				return
+			}
+		} else {
+			dbConn := database.Connect()
+			defer dbConn.Close()
+			stackService := services.NewStackService(dbConn)
+			app, err := findStack(ctx, stackService, localAppRef())
+			if err != nil {
+				fmt.Printf("⭕ %s\n", err)
+				return
+			}
+			if deployments, err = stackService.GetDeploymentList(ctx, app.ID, historyLimit); err != nil {
+				fmt.Printf("⭕ Failed to list deployments: %s\n", err)
+				return
+			}
+		}
+		if len(deployments) == 0 {
+			fmt.Println("No deployments found.")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSTATUS\tCOMMIT\tREF\tTRIGGERED BY\tDEPLOYED AT\tNOTE")
+		for _, deployment := range deployments {
+			note := strings.SplitN(deployment.CommitMessage, "\n", 2)[0]
+			if deployment.RolledBackFromID != 0 {
+				note = fmt.Sprintf("rollback of #%d", deployment.RolledBackFromID)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", deployment.ID, deployment.Status, shortCommit(deployment.CommitHash),
+				deployment.Ref, deployment.TriggeredBy, deployment.DeployedAt, note)
+		}
+		tw.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().StringVarP(&appRef, "app", "a", "", "ID, UUID or name of the app, the app in the current directory by default")
+	historyCmd.Flags().Uint64VarP(&historyLimit, "limit", "n", 20, "Maximum number of deployments to show")
+}
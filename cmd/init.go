@@ -18,12 +18,20 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/satnamSandhu2001/stackjet/pkg/initializer"
 	"github.com/spf13/cobra"
 )
 
-var forceRecreateConfig bool
+// flags
+var (
+	forceRecreateConfig bool
+	initAdminEmail      string
+	initAdminPassword   string
+	initGeneratePass    bool
+)
 
 // initCmd represents the init command
 var initCmd = &cobra.Command{
@@ -41,10 +49,49 @@ Examples:
   # Force recreate configuration (overwrites existing config)
   stackjet init --force
 
+  # Create the admin without prompts, with a one-time password that is printed once
+  stackjet init --admin-email you@example.com --generate-password
+
+The admin password can also be given in the STACKJET_ADMIN_PASSWORD environment variable.
+
 After initialization, you can add your first application:
   stackjet add --tech nodejs --port 3000 --repo https://github.com/username/my-app.git`,
 	Run: func(cmd *cobra.Command, args []string) {
-		initializer.InitializeApp(forceRecreateConfig)
+		admin := initializer.AdminSetup{Email: initAdminEmail, Password: initAdminPassword}
+		if admin.Password == "" {
+			admin.Password = os.Getenv("STACKJET_ADMIN_PASSWORD")
+		}
+		if (forceRecreateConfig || !initializer.IsInitialized()) && isTerminal(os.Stdin) {
+			if admin.Email == "" {
+				fmt.Printf("Admin email [%s]: ", initializer.DefaultAdminEmail)
+				line, _ := stdinReader.ReadString('\n')
+				admin.Email = strings.TrimSpace(line)
+			}
+			if admin.Password == "" && !initGeneratePass {
+				fmt.Println("Choose the admin password, or leave it empty to generate a one-time password.")
+				password := promptPassword("Admin password: ")
+				if password != "" {
+					if promptPassword("Confirm password: ") != password {
+						fmt.Println("⭕ Passwords do not match")
+						return
+					}
+				}
+				admin.Password = password
+			}
+		}
+		if initGeneratePass {
+			admin.Password = ""
+		}
+		if admin.Password != "" && len(admin.Password) < minPasswordLength {
+			fmt.Printf("⭕ Password must be at least %d characters long\n", minPasswordLength)
+			return
+		}
+		if admin.Email != "" && !strings.Contains(admin.Email, "@") {
+			fmt.Printf("⭕ Invalid admin email %s\n", admin.Email)
+			return
+		}
+
+		initializer.InitializeApp(forceRecreateConfig, admin)
 		fmt.Println("✅ StackJet initialized successfully.")
 		fmt.Print("\nRun \033[1;34mstackjet add --tech nodejs --port 3000 --repo <git repo url>\033[0m to add new app.\n\n")
 		fmt.Print("\nOr \033[1;34mstackjet add --help\033[0m for more information.\n\n")
@@ -53,5 +100,8 @@ After initialization, you can add your first application:
 
 func init() {
 	rootCmd.AddCommand(initCmd)
+	initCmd.Flags().StringVar(&initAdminEmail, "admin-email", "", "Email of the admin user (prompted when omitted, default "+initializer.DefaultAdminEmail+")")
+	initCmd.Flags().StringVar(&initAdminPassword, "admin-password", "", "Password of the admin user (prompted when omitted)")
+	initCmd.Flags().BoolVar(&initGeneratePass, "generate-password", false, "Generate a one-time admin password that must be changed on first login")
 	initCmd.Flags().BoolVarP(&forceRecreateConfig, "force", "f", false, "Force recreate config. Use with caution! This will overwrite existing config and and remove all apps data from StackJet (except app folders)")
 }
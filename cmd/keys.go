@@ -0,0 +1,184 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/core/git"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var (
+	keysUsername string
+)
+
+// keysCmd represents the keys command
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage per-app deploy keys and access tokens for private repositories",
+	Long: `Manage the credentials StackJet uses to access private git repositories of an app.
+
+Each app can have its own ed25519 SSH deploy key and/or HTTPS access token. Credentials are stored
+encrypted in the StackJet secrets store, passed to git only while it runs and never written to logs.
+
+<app> can be the app ID, UUID, name or directory.
+
+Examples:
+  # Generate a deploy key and print its public key
+  stackjet keys generate my-app
+
+  # Use an HTTPS access token (read from STACKJET_GIT_TOKEN or prompted)
+  stackjet keys set-token my-app --username deploy-bot
+
+  # Show configured credentials
+  stackjet keys show my-app`,
+}
+
+var keysGenerateCmd = &cobra.Command{
+	Use:   "generate <app>",
+	Short: "Generate a new SSH deploy key for an app",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withCredentials(args[0], func(app *models.Stack, creds *models.GitCredentials) (*models.GitCredentials, error) {
+			privateKey, publicKey, err := git.GenerateDeployKey("stackjet-" + app.Name)
+			if err != nil {
+				return nil, err
+			}
+			creds.SSHPrivateKey = privateKey
+			fmt.Printf("🔑 Deploy key generated for \033[1m%s\033[0m. Add this public key as a read-only deploy key of %s:\n", app.Name, app.RepoUrl)
+			fmt.Printf("\n%s\n\n", publicKey)
+			return creds, nil
+		})
+	},
+}
+
+var keysSetTokenCmd = &cobra.Command{
+	Use:   "set-token <app>",
+	Short: "Set the HTTPS access token of an app",
+	Args:  cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if strings.TrimSpace(keysUsername) == "" {
+			return fmt.Errorf("⭕ Username is required. Use --username to specify it")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		withCredentials(args[0], func(app *models.Stack, creds *models.GitCredentials) (*models.GitCredentials, error) {
+			token := os.Getenv("STACKJET_GIT_TOKEN")
+			if token == "" {
+				fmt.Printf("Enter access token for %s: ", app.RepoUrl)
+				line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				token = strings.TrimSpace(line)
+			}
+			if token == "" {
+				return nil, fmt.Errorf("access token is empty")
+			}
+			creds.Username = strings.TrimSpace(keysUsername)
+			creds.Password = token
+			fmt.Printf("✅ Access token saved for \033[1m%s\033[0m\n", app.Name)
+			return creds, nil
+		})
+	},
+}
+
+var keysShowCmd = &cobra.Command{
+	Use:   "show <app>",
+	Short: "Show the deploy key and access token username of an app",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withCredentials(args[0], func(app *models.Stack, creds *models.GitCredentials) (*models.GitCredentials, error) {
+			if creds.SSHPrivateKey == "" && creds.Password == "" {
+				fmt.Printf("No credentials configured for %s, the default credentials of the server user are used.\n", app.Name)
+				return nil, nil
+			}
+			if creds.SSHPrivateKey != "" {
+				publicKey, err := git.PublicKey(creds.SSHPrivateKey)
+				if err != nil {
+					return nil, err
+				}
+				fmt.Printf("🔑 Deploy key:\n\n%s\n\n", publicKey)
+			}
+			if creds.Password != "" {
+				fmt.Printf("🔑 HTTPS access token for user %s\n", creds.Username)
+			}
+			return nil, nil
+		})
+	},
+}
+
+var keysRemoveCmd = &cobra.Command{
+	Use:   "remove <app>",
+	Short: "Remove all git credentials of an app",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withCredentials(args[0], func(app *models.Stack, creds *models.GitCredentials) (*models.GitCredentials, error) {
+			fmt.Printf("✅ Credentials removed for \033[1m%s\033[0m\n", app.Name)
+			return &models.GitCredentials{}, nil
+		})
+	},
+}
+
+// loads the credentials of an app, applies fn and saves the returned credentials unless nil
+func withCredentials(ref string, fn func(app *models.Stack, creds *models.GitCredentials) (*models.GitCredentials, error)) {
+	dbConn := database.Connect()
+	defer dbConn.Close()
+	stackService := services.NewStackService(dbConn)
+	secretService := services.NewSecretService(dbConn)
+	ctx := context.Background()
+
+	app, err := findStack(ctx, stackService, ref)
+	if err != nil {
+		fmt.Printf("⭕ %s\n", err)
+		return
+	}
+	creds, err := git.LoadCredentials(ctx, *secretService, app)
+	if err != nil {
+		fmt.Printf("⭕ Failed to load credentials: %s\n", err)
+		return
+	}
+	if creds == nil {
+		creds = &models.GitCredentials{}
+	}
+
+	updated, err := fn(app, creds)
+	if err != nil {
+		fmt.Printf("⭕ %s\n", err)
+		return
+	}
+	if updated == nil {
+		return
+	}
+	if err := git.SaveCredentials(ctx, *secretService, app, updated); err != nil {
+		fmt.Printf("⭕ Failed to save credentials: %s\n", err)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(keysCmd)
+	keysCmd.AddCommand(keysGenerateCmd, keysSetTokenCmd, keysShowCmd, keysRemoveCmd)
+
+	keysSetTokenCmd.Flags().StringVarP(&keysUsername, "username", "u", "", "Username of the access token")
+}
@@ -0,0 +1,83 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/spf13/cobra"
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:         "list",
+	Aliases:     []string{"ls"},
+	Annotations: remoteCommand,
+	Short:       "List the apps of the server",
+	Long: `List the applications added with 'stackjet add'.
+
+Examples:
+  # List the apps of this server
+  stackjet list
+
+  # List the apps of another server, see 'stackjet login'
+  stackjet list --context production`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		stacks := []models.Stack{}
+		if apiClient != nil {
+			if err := apiClient.Do(ctx, http.MethodGet, "/stack/list", nil, &stacks); err != nil {
+				fmt.Printf("⭕ Failed to list apps: %s\n", err)
+				return
+			}
+		} else {
+			dbConn := database.Connect()
+			defer dbConn.Close()
+			var err error
+			if stacks, err = services.NewStackService(dbConn).GetStackList(ctx); err != nil {
+				fmt.Printf("⭕ Failed to list apps: %s\n", err)
+				return
+			}
+		}
+		if len(stacks) == 0 {
+			fmt.Println("No apps found, add one with 'stackjet add'.")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tTYPE\tBRANCH\tPORT\tSTATUS\tDIRECTORY")
+		for _, app := range stacks {
+			status := "ready"
+			if !app.CreatedSuccessfully {
+				status = "incomplete"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%s\t%s\n", app.ID, app.Name, app.Type, app.Branch, app.Port, status, app.Directory)
+		}
+		tw.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+}
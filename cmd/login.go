@@ -0,0 +1,199 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/internal/core/apiclient"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var (
+	loginName  string
+	loginEmail string
+	loginToken string
+)
+
+// loginCmd represents the login command
+var loginCmd = &cobra.Command{
+	Use:   "login <server-url>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Log in to a StackJet server to deploy from this machine",
+	Long: `Log in to the API of a StackJet server and save it as a context.
+
+The logged in context becomes the current context, after which deploy, list, history, logs and
+rollback run on that server. Select another context with --context or $STACKJET_CONTEXT, switch
+with 'stackjet context use' or return to this server with 'stackjet context unset'.
+
+Contexts and their tokens are saved in contexts.json of the user config directory
+(~/.config/stackjet on Linux), or the file in $STACKJET_CONTEXTS.
+
+Examples:
+  # Log in with email and password, prompted for
+  stackjet login https://panel.example.com
+
+  # Log in to a second server under its own name
+  stackjet login https://staging.example.com --name staging --email dev@example.com
+
+  # Log in with an API token, e.g. in CI
+  STACKJET_TOKEN=... stackjet login https://panel.example.com --name ci`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		server, err := apiclient.NormalizeServer(args[0])
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+		contexts, err := apiclient.LoadContexts()
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+		name := loginName
+		if name == "" {
+			u, _ := url.Parse(server)
+			name = u.Host
+		}
+
+		serverContext := &apiclient.Context{Server: server}
+		client := apiclient.NewClient(nil, name, serverContext)
+		token := loginToken
+		if token == "" {
+			token = os.Getenv("STACKJET_TOKEN")
+		}
+		if token != "" {
+			serverContext.Token = token
+			var user models.User
+			if err := client.Do(ctx, http.MethodGet, "/users/me", nil, &user); err != nil {
+				fmt.Printf("⭕ Login failed: %s\n", err)
+				return
+			}
+			serverContext.User = user.Email
+		} else if err := loginWithPassword(ctx, client); err != nil {
+			fmt.Printf("⭕ Login failed: %s\n", err)
+			return
+		}
+
+		contexts.Contexts[name] = serverContext
+		contexts.Current = name
+		if err := contexts.Save(); err != nil {
+			fmt.Printf("⭕ Failed to save context: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ Logged in to %s as %s, context %s is now current\n", server, serverContext.User, name)
+	},
+}
+
+// loginWithPassword starts a session with the email and password, and the two-factor code if the user needs one
+func loginWithPassword(ctx context.Context, client *apiclient.Client) error {
+	email := strings.TrimSpace(loginEmail)
+	if email == "" {
+		fmt.Print("Email: ")
+		line, _ := stdinReader.ReadString('\n')
+		email = strings.TrimSpace(line)
+	}
+	password := promptPassword("Password: ")
+
+	var session struct {
+		Token             string       `json:"token"`
+		RefreshToken      string       `json:"refresh_token"`
+		User              *models.User `json:"user"`
+		TwoFactorRequired bool         `json:"two_factor_required"`
+		TwoFactorToken    string       `json:"two_factor_token"`
+	}
+	if err := client.Do(ctx, http.MethodPost, "/auth/login", map[string]string{"email": email, "password": password}, &session); err != nil {
+		return err
+	}
+	if session.TwoFactorRequired {
+		fmt.Print("Two-factor code (or a recovery code): ")
+		line, _ := stdinReader.ReadString('\n')
+		code := strings.TrimSpace(line)
+		body := map[string]string{"two_factor_token": session.TwoFactorToken, "code": code}
+		if len(code) != 6 || strings.Trim(code, "0123456789") != "" {
+			body = map[string]string{"two_factor_token": session.TwoFactorToken, "recovery_code": code}
+		}
+		if err := client.Do(ctx, http.MethodPost, "/auth/2fa/verify", body, &session); err != nil {
+			return err
+		}
+	}
+	client.Context.User = email
+	if session.User != nil {
+		client.Context.User = session.User.Email
+	}
+	client.Context.Token = session.Token
+	client.Context.RefreshToken = session.RefreshToken
+	return nil
+}
+
+// logoutCmd represents the logout command
+var logoutCmd = &cobra.Command{
+	Use:         "logout",
+	Annotations: remoteCommand,
+	Short:       "Log out of the server of a context and delete the context",
+	Long: `Log out of the server of the current context, or the context selected with --context, and delete it.
+
+Examples:
+  # Log out of the current context
+  stackjet logout
+
+  # Log out of a context
+  stackjet logout --context staging`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if apiClient == nil {
+			fmt.Println("⭕ Not logged in to any server, no context is selected")
+			return
+		}
+		// API tokens stay valid, they are revoked with 'stackjet token revoke' on the server
+		if apiClient.Context.RefreshToken != "" {
+			if err := apiClient.Do(context.Background(), http.MethodPost, "/auth/logout", map[string]string{"refresh_token": apiClient.Context.RefreshToken}, nil); err != nil {
+				fmt.Printf("⚠️ Failed to end the session on %s: %s\n", apiClient.Context.Server, err)
+			}
+		}
+
+		contexts, err := apiclient.LoadContexts()
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+		delete(contexts.Contexts, apiClient.Name)
+		if contexts.Current == apiClient.Name {
+			contexts.Current = ""
+		}
+		if err := contexts.Save(); err != nil {
+			fmt.Printf("⭕ Failed to save contexts: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ Logged out of %s, context %s deleted\n", apiClient.Context.Server, apiClient.Name)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd, logoutCmd)
+
+	loginCmd.Flags().StringVarP(&loginName, "name", "n", "", "Name of the context, the host of the server by default")
+	loginCmd.Flags().StringVarP(&loginEmail, "email", "e", "", "Email to log in with, prompted for if not set")
+	loginCmd.Flags().StringVar(&loginToken, "token", "", "API token to log in with instead of a password, or set $STACKJET_TOKEN")
+}
@@ -0,0 +1,164 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/spf13/cobra"
+)
+
+// deploymentLogs is a deployment with its steps and log
+type deploymentLogs struct {
+	Deployment *models.Deployment      `json:"deployment"`
+	Steps      []models.DeploymentStep `json:"steps"`
+	Log        string                  `json:"log"`
+}
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:         "logs [deployment-id]",
+	Annotations: remoteCommand,
+	Args:        cobra.MaximumNArgs(1),
+	Short:       "Show the log of a deployment",
+	Long: `Show the log and steps of a deployment, the latest deployment of the app by default.
+
+The log of a running deployment is saved when it finishes, until then the logs of its finished steps are shown.
+
+Examples:
+  # Show the log of the latest deployment of the app in the current directory
+  stackjet logs
+
+  # Show the log of a deployment on another server, see 'stackjet login'
+  stackjet logs 42 --context production`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		var deploymentID int64
+		if len(args) == 1 {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				fmt.Printf("⭕ Invalid deployment ID %s\n", args[0])
+				return
+			}
+			deploymentID = id
+		}
+
+		var logs deploymentLogs
+		if apiClient != nil {
+			if deploymentID == 0 {
+				app, err := findRemoteStack(ctx, apiClient, appRef)
+				if err != nil {
+					fmt.Printf("⭕ %s\n", err)
+					return
+				}
+				deployments := []models.Deployment{}
+				if err := apiClient.Do(ctx, http.MethodGet, fmt.Sprintf("/stack/%d/deployments?limit=1", app.ID), nil, &deployments); err != nil {
+					fmt.Printf("⭕ Failed to get deployments: %s\n", err)
+					return
+				}
+				if len(deployments) == 0 {
+					fmt.Println("No deployments found.")
+					return
+				}
+				deploymentID = deployments[0].ID
+			}
+			if err := apiClient.Do(ctx, http.MethodGet, fmt.Sprintf("/deployments/%d/logs", deploymentID), nil, &logs); err != nil {
+				fmt.Printf("⭕ Failed to get deployment logs: %s\n", err)
+				return
+			}
+		} else {
+			dbConn := database.Connect()
+			defer dbConn.Close()
+			stackService := services.NewStackService(dbConn)
+
+			if deploymentID == 0 {
+				app, err := findStack(ctx, stackService, localAppRef())
+				if err != nil {
+					fmt.Printf("⭕ %s\n", err)
+					return
+				}
+				deployments, err := stackService.GetDeploymentList(ctx, app.ID, 1)
+				if err != nil {
+					fmt.Printf("⭕ Failed to get deployments: %s\n", err)
+					return
+				}
+				if len(deployments) == 0 {
+					fmt.Println("No deployments found.")
+					return
+				}
+				deploymentID = deployments[0].ID
+			}
+			var err error
+			if logs.Deployment, err = stackService.GetDeploymentByID(ctx, deploymentID); err != nil {
+				fmt.Printf("⭕ Failed to get deployment: %s\n", err)
+				return
+			}
+			if logs.Deployment == nil {
+				fmt.Printf("⭕ Deployment #%d not found\n", deploymentID)
+				return
+			}
+			if logs.Steps, err = stackService.GetDeploymentSteps(ctx, deploymentID); err != nil {
+				fmt.Printf("⭕ Failed to get deployment steps: %s\n", err)
+				return
+			}
+			if logs.Log, err = stackService.GetDeploymentLog(ctx, deploymentID); err != nil {
+				fmt.Printf("⭕ Failed to get deployment log: %s\n", err)
+				return
+			}
+		}
+		printDeploymentLogs(&logs)
+	},
+}
+
+func printDeploymentLogs(logs *deploymentLogs) {
+	d := logs.Deployment
+	fmt.Printf("📜 Deployment #%d: %s", d.ID, d.Status)
+	if d.CommitHash != "" {
+		fmt.Printf(" at %s", shortCommit(d.CommitHash))
+	}
+	if d.TriggeredBy != "" {
+		fmt.Printf(", triggered by %s", d.TriggeredBy)
+	}
+	fmt.Printf(" on %s\n\n", d.DeployedAt)
+
+	log := logs.Log
+	if log == "" {
+		var stepLogs []string
+		for _, step := range logs.Steps {
+			if step.Log != "" {
+				stepLogs = append(stepLogs, step.Log)
+			}
+		}
+		log = strings.Join(stepLogs, "\n")
+	}
+	fmt.Println(strings.TrimRight(log, "\n"))
+	printSteps(logs.Steps)
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().StringVarP(&appRef, "app", "a", "", "ID, UUID or name of the app, the app in the current directory by default")
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/internal/core/apiclient"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+)
+
+// remoteAnnotation marks the commands that run on the server of the selected context through its API
+const remoteAnnotation = "remote"
+
+var remoteCommand = map[string]string{remoteAnnotation: "true"}
+
+// apiClient is the client of the selected context for remote commands, nil when they run on this server
+var apiClient *apiclient.Client
+
+// remoteClient returns the client of the context selected by --context, $STACKJET_CONTEXT or the current context.
+// It returns nil when none is selected and commands run on this server.
+func remoteClient() (*apiclient.Client, error) {
+	contexts, err := apiclient.LoadContexts()
+	if err != nil {
+		return nil, err
+	}
+	name := contextName
+	if name == "" {
+		name = os.Getenv("STACKJET_CONTEXT")
+	}
+	name, serverContext, err := contexts.Select(name)
+	if err != nil || serverContext == nil {
+		return nil, err
+	}
+	return apiclient.NewClient(contexts, name, serverContext), nil
+}
+
+// findRemoteStack resolves a stack of the server by its ID, UUID or name
+func findRemoteStack(ctx context.Context, client *apiclient.Client, ref string) (*models.Stack, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil, fmt.Errorf("app is required on context %s, use -a or --app with its ID, UUID or name", client.Name)
+	}
+	stacks := []models.Stack{}
+	if err := client.Do(ctx, http.MethodGet, "/stack/list", nil, &stacks); err != nil {
+		return nil, err
+	}
+	id, _ := strconv.ParseInt(ref, 10, 64)
+	var found *models.Stack
+	for i := range stacks {
+		if stacks[i].ID == id || stacks[i].Uuid == ref {
+			return &stacks[i], nil
+		}
+		if stacks[i].Name == ref {
+			if found != nil {
+				return nil, fmt.Errorf("multiple apps are named %s, use the app ID or uuid instead", ref)
+			}
+			found = &stacks[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no app %s found on %s", ref, client.Context.Server)
+	}
+	return found, nil
+}
+
+// streamDeployment runs a deployment on the server and prints its log as it streams, then its steps
+func streamDeployment(ctx context.Context, client *apiclient.Client, path string, body any) {
+	var steps []models.DeploymentStep
+	var done struct {
+		DeploymentID int64  `json:"deployment_id"`
+		Status       string `json:"status"`
+		Error        string `json:"error"`
+	}
+	err := client.Stream(ctx, http.MethodPost, path, body, func(event string, data string) {
+		switch event {
+		case "log":
+			fmt.Println(data)
+		case "step":
+			var step models.DeploymentStep
+			if json.Unmarshal([]byte(data), &step) != nil {
+				return
+			}
+			// a step is sent when it starts and again when it finishes
+			for i := range steps {
+				if steps[i].ID == step.ID {
+					steps[i] = step
+					return
+				}
+			}
+			steps = append(steps, step)
+		case "done":
+			json.Unmarshal([]byte(data), &done)
+		}
+	})
+	printSteps(steps)
+	if err != nil {
+		fmt.Printf("\033[31m⚠️ Deployment failed: %v \033[0m\n", err)
+		return
+	}
+	if done.Error != "" {
+		fmt.Printf("\033[31m⚠️ Deployment failed: %s \033[0m\n", done.Error)
+	}
+}
+
+// localAppRef returns the app selected with --app on this server, the app in the current directory by default
+func localAppRef() string {
+	if appRef == "" {
+		return "./"
+	}
+	return appRef
+}
+
+func shortCommit(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
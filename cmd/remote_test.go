@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/satnamSandhu2001/stackjet/internal/core/apiclient"
+)
+
+func TestRemoteClientSelection(t *testing.T) {
+	t.Setenv("STACKJET_CONTEXTS", filepath.Join(t.TempDir(), "contexts.json"))
+	t.Setenv("STACKJET_CONTEXT", "")
+	t.Cleanup(func() { contextName = "" })
+
+	// without a context file commands run on this server
+	if client, err := remoteClient(); err != nil || client != nil {
+		t.Fatalf("remoteClient without contexts = %v %v, want nil", client, err)
+	}
+
+	contexts, err := apiclient.LoadContexts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contexts.Contexts["production"] = &apiclient.Context{Server: "https://panel.example.com", Token: "sjt_production"}
+	contexts.Contexts["staging"] = &apiclient.Context{Server: "https://staging.example.com", Token: "sjt_staging"}
+	contexts.Contexts["preview"] = &apiclient.Context{Server: "https://preview.example.com", Token: "sjt_preview"}
+	if err := contexts.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	selected := func(flag, env string) string {
+		t.Helper()
+		contextName = flag
+		t.Setenv("STACKJET_CONTEXT", env)
+		client, err := remoteClient()
+		if err != nil {
+			t.Fatalf("remoteClient with --context %q and STACKJET_CONTEXT %q: %v", flag, env, err)
+		}
+		if client == nil {
+			return ""
+		}
+		return client.Name
+	}
+
+	// no current context is local mode
+	if name := selected("", ""); name != "" {
+		t.Fatalf("selected %q without a current context, want local mode", name)
+	}
+	if name := selected("", "staging"); name != "staging" {
+		t.Fatalf("selected %q, want STACKJET_CONTEXT staging", name)
+	}
+	if name := selected("preview", "staging"); name != "preview" {
+		t.Fatalf("selected %q, want --context preview over STACKJET_CONTEXT", name)
+	}
+
+	contexts.Current = "production"
+	if err := contexts.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if name := selected("", ""); name != "production" {
+		t.Fatalf("selected %q, want the current context production", name)
+	}
+	if name := selected("", "staging"); name != "staging" {
+		t.Fatalf("selected %q, want STACKJET_CONTEXT staging over the current context", name)
+	}
+	if name := selected("preview", "staging"); name != "preview" {
+		t.Fatalf("selected %q, want --context preview over the current context", name)
+	}
+
+	contextName = "missing"
+	if _, err := remoteClient(); err == nil || !strings.Contains(err.Error(), "context missing not found") {
+		t.Fatalf("remoteClient with an unknown context = %v", err)
+	}
+}
+
+func TestContextFlagOnServerCommands(t *testing.T) {
+	t.Setenv("STACKJET_CONTEXTS", filepath.Join(t.TempDir(), "contexts.json"))
+	t.Setenv("STACKJET_CONTEXT", "")
+	t.Cleanup(func() {
+		contextName = ""
+		apiClient = nil
+	})
+
+	contexts, err := apiclient.LoadContexts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contexts.Contexts["production"] = &apiclient.Context{Server: "https://panel.example.com", Token: "sjt_production"}
+	if err := contexts.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	contextName = "production"
+	if err := rootCmd.PersistentPreRunE(initCmd, nil); err == nil || !strings.Contains(err.Error(), "does not support --context") {
+		t.Fatalf("init with --context = %v, want an error", err)
+	}
+	if err := rootCmd.PersistentPreRunE(deployCmd, nil); err != nil {
+		t.Fatalf("deploy with --context: %v", err)
+	}
+	if apiClient == nil || apiClient.Name != "production" {
+		t.Fatalf("deploy client = %+v, want context production", apiClient)
+	}
+
+	// without --context server commands run as before
+	contextName = ""
+	if err := rootCmd.PersistentPreRunE(initCmd, nil); err != nil {
+		t.Fatalf("init without --context: %v", err)
+	}
+}
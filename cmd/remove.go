@@ -0,0 +1,94 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/core/stack"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var (
+	removeDir   string
+	removePurge bool
+	removeYes   bool
+)
+
+// removeCmd represents the remove command
+var removeCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove an application from StackJet",
+	Long: `Remove an application from StackJet.
+
+This command:
+  - Deletes the DNS records of its domains at the DNS provider
+  - Removes its NGINX config and reloads NGINX
+  - Deletes its PM2 process
+  - Deletes its data and deployment history from StackJet
+
+The application directory is kept unless --purge is given.
+
+Examples:
+  # Remove the app in the current directory
+  stackjet remove
+
+  # Remove an app and delete its directory without confirmation
+  stackjet remove --dir /var/www/sites/my-app --purge --yes`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		stackService := services.NewStackService(dbConn)
+		secretService := services.NewSecretService(dbConn)
+
+		app, err := findStackByDir(context.Background(), stackService, removeDir)
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+
+		if !removeYes {
+			fmt.Printf("⚠️ This will remove \033[1m%s\033[0m (%s) from StackJet.\n", app.Name, app.Directory)
+			fmt.Print("Type the app name to confirm: ")
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			if strings.TrimSpace(answer) != app.Name {
+				fmt.Println("⭕ Aborted.")
+				return
+			}
+		}
+
+		if err := stack.RemoveStack(os.Stdout, context.Background(), *stackService, *secretService, app, removePurge); err != nil {
+			fmt.Printf("⭕ Failed to remove stack: %s\n", err)
+			return
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(removeCmd)
+
+	removeCmd.Flags().StringVarP(&removeDir, "dir", "d", "./", "Root directory of the app to remove")
+	removeCmd.Flags().BoolVar(&removePurge, "purge", false, "Also delete the app directory")
+	removeCmd.Flags().BoolVarP(&removeYes, "yes", "y", false, "Skip confirmation")
+}
@@ -0,0 +1,110 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/core/stack"
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var (
+	rollbackTo int64
+)
+
+// rollbackCmd represents the rollback command
+var rollbackCmd = &cobra.Command{
+	Use:         "rollback",
+	Annotations: remoteCommand,
+	Short:       "Deploy the commit of an earlier deployment again",
+	Long: `Roll an application back by deploying the commit of an earlier successful deployment again.
+
+By default the app returns to the last successful deployment of another commit than the one deployed.
+Use 'stackjet history' to find the deployment to roll back to.
+
+Examples:
+  # Roll back the app in the current directory
+  stackjet rollback
+
+  # Roll back to a deployment on another server, see 'stackjet login'
+  stackjet rollback --app my-app --to 41 --context production`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if apiClient != nil && cmd.Flags().Changed("git-reset") {
+			return fmt.Errorf("⭕ --git-reset is set by the GIT_RESET config of the server of context %s", apiClient.Name)
+		}
+		// set default values, servers of other contexts use their own config
+		if !cmd.Flags().Changed("git-reset") && apiClient == nil {
+			gitReset = pkg.Config().GIT_RESET
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		// commands run in their own process groups, so ctrl+c has to cancel them explicitly
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if apiClient != nil {
+			app, err := findRemoteStack(ctx, apiClient, appRef)
+			if err != nil {
+				fmt.Printf("⭕ %s\n", err)
+				return
+			}
+			streamDeployment(ctx, apiClient, fmt.Sprintf("/stack/rollback/%d", app.ID), &dto.Stack_Rollback_Request{
+				ID:           app.ID,
+				DeploymentID: rollbackTo,
+			})
+			return
+		}
+
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		stackService := services.NewStackService(dbConn)
+		secretService := services.NewSecretService(dbConn)
+
+		app, err := findStack(ctx, stackService, localAppRef())
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+		runDeployment(stackService, func(w io.Writer) (int64, error) {
+			return stack.RollbackStack(w, ctx, *stackService, *secretService, &dto.Stack_Rollback_Request{
+				ID:           app.ID,
+				DeploymentID: rollbackTo,
+				GitReset:     gitReset,
+			})
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+
+	rollbackCmd.Flags().StringVarP(&appRef, "app", "a", "", "ID, UUID or name of the app, the app in the current directory by default")
+	rollbackCmd.Flags().Int64Var(&rollbackTo, "to", 0, "ID of the deployment to roll back to")
+	rollbackCmd.Flags().BoolVar(&gitReset, "git-reset", true, "Force reset Git state before deployment")
+}
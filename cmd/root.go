@@ -23,6 +23,11 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// flags
+var (
+	contextName string
+)
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "stackjet",
@@ -47,9 +52,24 @@ Get started:
   1. Run 'stackjet init' to initialize StackJet
   2. Add your first app with 'stackjet add --tech nodejs -p 3000 --repo <your-git-repo>'
   3. Deploy with 'stackjet deploy'
+
+Deploy from another machine with 'stackjet login <server-url>', after which deploy, list, history,
+logs and rollback run on that server through its API.
 `,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		printBanner()
+		if cmd.Annotations[remoteAnnotation] == "" {
+			if contextName != "" {
+				return fmt.Errorf("⭕ %s runs on the server only and does not support --context", cmd.CommandPath())
+			}
+			return nil
+		}
+		client, err := remoteClient()
+		if err != nil {
+			return fmt.Errorf("⭕ %s", err)
+		}
+		apiClient = client
+		return nil
 	},
 }
 
@@ -61,7 +81,7 @@ func Execute() {
 }
 
 func init() {
-
+	rootCmd.PersistentFlags().StringVar(&contextName, "context", "", "Server context to run the command on, see 'stackjet context list' (defaults to $STACKJET_CONTEXT or the current context)")
 }
 
 func printBanner() {
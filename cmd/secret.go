@@ -0,0 +1,124 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/spf13/cobra"
+)
+
+// secretCmd represents the secret command
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Manage encrypted secrets like API tokens",
+	Long: `Manage secrets used by StackJet integrations, like the Cloudflare API token.
+
+Secrets are encrypted with a key stored in ~/.stackjet/secret.key and are never printed back.
+
+Examples:
+  # Store the Cloudflare API token (value is read from stdin when omitted)
+  stackjet secret set cloudflare_api_token
+
+  # List stored secret names
+  stackjet secret list
+
+  # Remove a secret
+  stackjet secret remove cloudflare_api_token`,
+}
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set <name> [value]",
+	Short: "Store a secret",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		secretService := services.NewSecretService(dbConn)
+
+		value := ""
+		if len(args) == 2 {
+			value = args[1]
+		} else {
+			fmt.Printf("Enter value for %s: ", args[0])
+			line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			value = line
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			fmt.Println("⭕ Secret value is empty")
+			return
+		}
+
+		if err := secretService.SetSecret(context.Background(), args[0], value); err != nil {
+			fmt.Printf("⭕ Failed to store secret: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ Secret %s stored\n", args[0])
+	},
+}
+
+var secretListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List stored secret names",
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		secretService := services.NewSecretService(dbConn)
+
+		names, err := secretService.ListSecretNames(context.Background())
+		if err != nil {
+			fmt.Printf("⭕ Failed to list secrets: %s\n", err)
+			return
+		}
+		if len(names) == 0 {
+			fmt.Println("No secrets found.")
+			return
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	},
+}
+
+var secretRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a secret",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		secretService := services.NewSecretService(dbConn)
+
+		if err := secretService.DeleteSecret(context.Background(), args[0]); err != nil {
+			fmt.Printf("⭕ Failed to remove secret: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ Secret %s removed\n", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(secretCmd)
+	secretCmd.AddCommand(secretSetCmd, secretListCmd, secretRemoveCmd)
+}
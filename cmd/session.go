@@ -0,0 +1,153 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var (
+	sessionUser string
+)
+
+// sessionCmd represents the session command
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "Manage login sessions of the StackJet API",
+	Long: `Manage login sessions of the StackJet API.
+
+Logins get a short-lived access token and a refresh token tied to a session. Revoking a session
+ends its access token right away.
+
+Examples:
+  # List active sessions
+  stackjet session list
+
+  # Log a user out everywhere
+  stackjet session revoke --user dev@example.com
+
+  # Rotate the key signing access tokens, the previous key is accepted for jwt_key_grace_minutes
+  stackjet session rotate-key`,
+}
+
+var sessionListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List active sessions",
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		userService := services.NewUserService(dbConn)
+		ctx := context.Background()
+
+		users, err := userService.ListUsers(ctx)
+		if err != nil {
+			fmt.Printf("⭕ Failed to list users: %s\n", err)
+			return
+		}
+		emails := map[int64]string{}
+		var userID int64
+		for _, user := range users {
+			emails[user.ID] = user.Email
+			if sessionUser != "" && strings.EqualFold(user.Email, strings.TrimSpace(sessionUser)) {
+				userID = user.ID
+			}
+		}
+		if sessionUser != "" && userID == 0 {
+			fmt.Printf("⭕ User %s not found\n", sessionUser)
+			return
+		}
+
+		sessions, err := userService.ListSessions(ctx, userID)
+		if err != nil {
+			fmt.Printf("⭕ Failed to list sessions: %s\n", err)
+			return
+		}
+		if len(sessions) == 0 {
+			fmt.Println("No active sessions.")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tUSER\tIP\tLAST USED\tEXPIRES\tUSER AGENT")
+		for _, session := range sessions {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", session.ID, emails[session.UserID], session.IP, session.LastUsedAt, session.ExpiresAt, session.UserAgent)
+		}
+		tw.Flush()
+	},
+}
+
+var sessionRevokeCmd = &cobra.Command{
+	Use:   "revoke",
+	Short: "Revoke all sessions of a user",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if sessionUser == "" {
+			return fmt.Errorf("⭕ User is required. Use -u or --user to specify the email of the user")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		userService := services.NewUserService(dbConn)
+		ctx := context.Background()
+
+		user, err := userService.GetUserByEmail(ctx, strings.TrimSpace(sessionUser))
+		if err != nil {
+			fmt.Printf("⭕ Failed to get user: %s\n", err)
+			return
+		}
+		if user == nil {
+			fmt.Printf("⭕ User %s not found\n", sessionUser)
+			return
+		}
+		revoked, err := userService.RevokeUserSessions(ctx, user.ID, 0)
+		if err != nil {
+			fmt.Printf("⭕ Failed to revoke sessions: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ %d sessions of %s revoked\n", revoked, user.Email)
+	},
+}
+
+var sessionRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Rotate the key signing access tokens",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := pkg.RotateSigningKey(); err != nil {
+			fmt.Printf("⭕ Failed to rotate the signing key: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ Signing key rotated, tokens signed by the previous key are accepted for %d more minutes\n", pkg.Config().JWT_KEY_GRACE_MINUTES)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sessionCmd)
+	sessionCmd.AddCommand(sessionListCmd, sessionRevokeCmd, sessionRotateKeyCmd)
+
+	sessionListCmd.Flags().StringVarP(&sessionUser, "user", "u", "", "Only list the sessions of this user")
+	sessionRevokeCmd.Flags().StringVarP(&sessionUser, "user", "u", "", "Email of the user to log out")
+}
@@ -0,0 +1,144 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/core/ssl"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var (
+	sslForceRenew bool
+)
+
+// sslCmd represents the ssl command
+var sslCmd = &cobra.Command{
+	Use:   "ssl",
+	Short: "Issue and renew Let's Encrypt certificates for your domains",
+	Long: `Issue and renew TLS certificates through ACME (Let's Encrypt by default) for domains attached with 'stackjet domain add'.
+
+Domains are validated with the http-01 challenge served by the StackJet-managed NGINX config, so the
+domain must already point to this server. Once issued, HTTPS is enabled and HTTP is redirected to HTTPS.
+
+Certificates are renewed automatically by the StackJet server before they expire. On CLI-only setups
+add 'stackjet ssl renew' to cron.
+
+Examples:
+  # Issue a certificate and enable HTTPS
+  stackjet ssl issue example.com
+
+  # Renew all certificates that are due
+  stackjet ssl renew
+
+  # Force renewal of a single certificate
+  stackjet ssl renew example.com --force
+
+  # Show certificate status
+  stackjet ssl status`,
+}
+
+var sslIssueCmd = &cobra.Command{
+	Use:   "issue <domain>",
+	Short: "Issue a certificate for a domain and enable HTTPS",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		stackService := services.NewStackService(dbConn)
+
+		if err := ssl.IssueCertificate(os.Stdout, context.Background(), *stackService, args[0]); err != nil {
+			fmt.Printf("⭕ Failed to issue certificate: %s\n", err)
+			return
+		}
+	},
+}
+
+var sslRenewCmd = &cobra.Command{
+	Use:   "renew [domain]",
+	Short: "Renew certificates that are about to expire",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		stackService := services.NewStackService(dbConn)
+
+		var err error
+		if len(args) == 1 {
+			err = ssl.RenewCertificate(os.Stdout, context.Background(), *stackService, args[0], sslForceRenew)
+		} else {
+			err = ssl.RenewDueCertificates(os.Stdout, context.Background(), *stackService)
+		}
+		if err != nil {
+			fmt.Printf("⭕ Failed to renew certificates: %s\n", err)
+			return
+		}
+	},
+}
+
+var sslStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show certificates and their expiry",
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		stackService := services.NewStackService(dbConn)
+
+		certs, err := stackService.GetCertificateList(context.Background())
+		if err != nil {
+			fmt.Printf("⭕ Failed to list certificates: %s\n", err)
+			return
+		}
+		if len(certs) == 0 {
+			fmt.Println("No certificates found.")
+			return
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "DOMAIN\tISSUER\tEXPIRES\tDAYS LEFT\tRENEWAL\tLAST ERROR")
+		for _, c := range certs {
+			expires, daysLeft := c.ExpiresAt, "-"
+			if t, err := ssl.ParseTime(c.ExpiresAt); err == nil {
+				expires = t.Format(time.DateOnly)
+				daysLeft = fmt.Sprintf("%d", int(time.Until(t).Hours()/24))
+			}
+			renewal := "ok"
+			if ssl.IsDueForRenewal(&c) {
+				renewal = "due"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Domain, c.Issuer, expires, daysLeft, renewal, c.LastError)
+		}
+		tw.Flush()
+		fmt.Printf("\nCertificates are renewed %d days before expiry.\n", pkg.Config().ACME_RENEW_BEFORE_DAYS)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sslCmd)
+	sslCmd.AddCommand(sslIssueCmd, sslRenewCmd, sslStatusCmd)
+
+	sslRenewCmd.Flags().BoolVarP(&sslForceRenew, "force", "f", false, "Renew even if the certificate is not due yet")
+}
@@ -0,0 +1,202 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var (
+	tokenUser          string
+	tokenName          string
+	tokenScopes        []string
+	tokenExpiresInDays int
+)
+
+// tokenCmd represents the token command
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage API tokens for scripts and CI",
+	Long: `Manage API tokens in the StackJet database.
+
+API tokens act as their user, limited by their scopes, and are sent as "Authorization: Bearer <token>".
+Scopes are read, deploy, manage or admin, optionally limited to one app with :stack:<id>.
+
+Examples:
+  # Create a token that can only deploy app 3, valid for 90 days
+  stackjet token create --user ci@example.com --name github-actions --scope deploy:stack:3 --expires-in-days 90
+
+  # List tokens with their last use
+  stackjet token list
+
+  # Revoke a token
+  stackjet token revoke 4`,
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an API token",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if tokenUser == "" {
+			return fmt.Errorf("⭕ User is required. Use -u or --user to specify the email of the user")
+		}
+		if strings.TrimSpace(tokenName) == "" {
+			return fmt.Errorf("⭕ Name is required. Use -n or --name to name the token")
+		}
+		if err := models.TokenScopes(tokenScopes).Validate(); err != nil {
+			return fmt.Errorf("⭕ %s. Use -s or --scope to specify the scopes", err)
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		userService := services.NewUserService(dbConn)
+		ctx := context.Background()
+
+		user, err := userService.GetUserByEmail(ctx, strings.TrimSpace(tokenUser))
+		if err != nil {
+			fmt.Printf("⭕ Failed to get user: %s\n", err)
+			return
+		}
+		if user == nil {
+			fmt.Printf("⭕ User %s not found\n", tokenUser)
+			return
+		}
+
+		_, token, err := userService.CreateAPIToken(ctx, &dto.APIToken_Create_Request{
+			UserID:        user.ID,
+			Name:          tokenName,
+			Scopes:        tokenScopes,
+			ExpiresInDays: tokenExpiresInDays,
+		})
+		if err != nil {
+			fmt.Printf("⭕ Failed to create token: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ Token %s created for %s, it is shown only once:\n\n%s\n\n", tokenName, user.Email, token)
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API tokens",
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		userService := services.NewUserService(dbConn)
+		ctx := context.Background()
+
+		users, err := userService.ListUsers(ctx)
+		if err != nil {
+			fmt.Printf("⭕ Failed to list users: %s\n", err)
+			return
+		}
+		emails := map[int64]string{}
+		var userID int64
+		for _, user := range users {
+			emails[user.ID] = user.Email
+			if tokenUser != "" && strings.EqualFold(user.Email, strings.TrimSpace(tokenUser)) {
+				userID = user.ID
+			}
+		}
+		if tokenUser != "" && userID == 0 {
+			fmt.Printf("⭕ User %s not found\n", tokenUser)
+			return
+		}
+
+		tokens, err := userService.ListAPITokens(ctx, userID)
+		if err != nil {
+			fmt.Printf("⭕ Failed to list tokens: %s\n", err)
+			return
+		}
+		if len(tokens) == 0 {
+			fmt.Println("No tokens found.")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tUSER\tTOKEN\tSCOPES\tEXPIRES\tLAST USED")
+		for _, token := range tokens {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s…\t%s\t%s\t%s\n", token.ID, token.Name, emails[token.UserID], token.Prefix,
+				strings.Join(token.Scopes, ","), valueOr(token.ExpiresAt, "never"), valueOr(token.LastUsedAt, "never"))
+		}
+		tw.Flush()
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Revoke an API token",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			fmt.Println("⭕ Invalid token id")
+			return
+		}
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		userService := services.NewUserService(dbConn)
+		ctx := context.Background()
+
+		token, err := userService.GetAPITokenByID(ctx, id)
+		if err != nil {
+			fmt.Printf("⭕ Failed to get token: %s\n", err)
+			return
+		}
+		if token == nil {
+			fmt.Printf("⭕ Token %d not found\n", id)
+			return
+		}
+		if err := userService.DeleteAPIToken(ctx, id); err != nil {
+			fmt.Printf("⭕ Failed to revoke token: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ Token %s revoked\n", token.Name)
+	},
+}
+
+// valueOr returns the value of a nullable column, fallback when it is NULL
+func valueOr(value *string, fallback string) string {
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
+
+func init() {
+	rootCmd.AddCommand(tokenCmd)
+	tokenCmd.AddCommand(tokenCreateCmd, tokenListCmd, tokenRevokeCmd)
+
+	tokenCreateCmd.Flags().StringVarP(&tokenUser, "user", "u", "", "Email of the user the token acts as")
+	tokenCreateCmd.Flags().StringVarP(&tokenName, "name", "n", "", "Name of the token, e.g. the CI system using it")
+	tokenCreateCmd.Flags().StringSliceVarP(&tokenScopes, "scope", "s", nil, "Scopes of the token: read, deploy, manage, admin, optionally followed by :stack:<id> (repeatable)")
+	tokenCreateCmd.Flags().IntVar(&tokenExpiresInDays, "expires-in-days", 0, "Days until the token expires, it never expires when 0")
+	tokenListCmd.Flags().StringVarP(&tokenUser, "user", "u", "", "Only list the tokens of this user")
+}
@@ -0,0 +1,316 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var (
+	userRole      string
+	userRemoveYes bool
+)
+
+// userCmd represents the user command
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage users of the StackJet API",
+	Long: `Manage users of the StackJet API directly in the StackJet database.
+
+Signup through the API is disabled by default, use these commands or the admin API to create accounts.
+Passwords are read from stdin.
+
+Examples:
+  # Add a deployer
+  stackjet user add dev@example.com --role deployer
+
+  # List users
+  stackjet user list
+
+  # Reset a password
+  stackjet user passwd dev@example.com
+
+  # Remove a user
+  stackjet user remove dev@example.com
+
+  # Turn off two-factor authentication of a user who lost their authenticator app
+  stackjet user reset-2fa dev@example.com
+
+  # Unlock an account locked after too many failed logins
+  stackjet user unlock dev@example.com
+
+  # Let an admin log in through OIDC, with the subject of their identity at the provider
+  stackjet user link-oidc admin@example.com 248289761001`,
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add <email>",
+	Short: "Add a user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !models.Role(userRole).IsValid() {
+			fmt.Printf("⭕ Invalid role %s, use admin, maintainer, deployer, viewer or member\n", userRole)
+			return
+		}
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		userService := services.NewUserService(dbConn)
+		ctx := context.Background()
+
+		email := strings.TrimSpace(args[0])
+		existing, err := userService.GetUserByEmail(ctx, email)
+		if err != nil {
+			fmt.Printf("⭕ Failed to add user: %s\n", err)
+			return
+		}
+		if existing != nil {
+			fmt.Printf("⭕ User %s already exists\n", email)
+			return
+		}
+		password, err := promptNewPassword()
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+
+		if err := userService.CreateUser(ctx, &dto.User_RegisterRequest{Email: email, Password: password, Role: userRole}); err != nil {
+			fmt.Printf("⭕ Failed to add user: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ User %s added as %s\n", email, userRole)
+	},
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List users",
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		userService := services.NewUserService(dbConn)
+
+		users, err := userService.ListUsers(context.Background())
+		if err != nil {
+			fmt.Printf("⭕ Failed to list users: %s\n", err)
+			return
+		}
+		if len(users) == 0 {
+			fmt.Println("No users found.")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tEMAIL\tROLE\tSTATUS")
+		for _, user := range users {
+			status := "active"
+			if user.Disabled {
+				status = "disabled"
+			} else if user.IsLocked(time.Now()) {
+				status = "locked"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", user.ID, user.Email, user.Role, status)
+		}
+		tw.Flush()
+	},
+}
+
+var userPasswdCmd = &cobra.Command{
+	Use:   "passwd <email>",
+	Short: "Set the password of a user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		userService := services.NewUserService(dbConn)
+		ctx := context.Background()
+
+		user, err := userService.GetUserByEmail(ctx, strings.TrimSpace(args[0]))
+		if err != nil {
+			fmt.Printf("⭕ Failed to get user: %s\n", err)
+			return
+		}
+		if user == nil {
+			fmt.Printf("⭕ User %s not found\n", args[0])
+			return
+		}
+		password, err := promptNewPassword()
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+
+		if err := userService.SetPassword(ctx, user.ID, password, false); err != nil {
+			fmt.Printf("⭕ Failed to set password: %s\n", err)
+			return
+		}
+		if _, err := userService.RevokeUserSessions(ctx, user.ID, 0); err != nil {
+			fmt.Printf("⭕ Failed to log out the sessions of %s: %s\n", user.Email, err)
+			return
+		}
+		fmt.Printf("✅ Password of %s changed\n", user.Email)
+	},
+}
+
+var userRemoveCmd = &cobra.Command{
+	Use:   "remove <email>",
+	Short: "Remove a user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		userService := services.NewUserService(dbConn)
+		ctx := context.Background()
+
+		user, err := userService.GetUserByEmail(ctx, strings.TrimSpace(args[0]))
+		if err != nil {
+			fmt.Printf("⭕ Failed to get user: %s\n", err)
+			return
+		}
+		if user == nil {
+			fmt.Printf("⭕ User %s not found\n", args[0])
+			return
+		}
+		if !userRemoveYes {
+			fmt.Printf("⚠️ This will remove the user \033[1m%s\033[0m (%s).\n", user.Email, user.Role)
+			fmt.Print("Continue? [y/N]: ")
+			answer, _ := stdinReader.ReadString('\n')
+			if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+				fmt.Println("⭕ Aborted.")
+				return
+			}
+		}
+
+		if err := userService.DeleteUser(ctx, user.ID); err != nil {
+			fmt.Printf("⭕ Failed to remove user: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ User %s removed\n", user.Email)
+	},
+}
+
+var userResetTwoFactorCmd = &cobra.Command{
+	Use:   "reset-2fa <email>",
+	Short: "Turn off two-factor authentication of a user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		userService := services.NewUserService(dbConn)
+		ctx := context.Background()
+
+		user, err := userService.GetUserByEmail(ctx, strings.TrimSpace(args[0]))
+		if err != nil {
+			fmt.Printf("⭕ Failed to get user: %s\n", err)
+			return
+		}
+		if user == nil {
+			fmt.Printf("⭕ User %s not found\n", args[0])
+			return
+		}
+		if err := userService.DisableTOTP(ctx, user.ID); err != nil {
+			fmt.Printf("⭕ Failed to reset two-factor authentication: %s\n", err)
+			return
+		}
+		if _, err := userService.RevokeUserSessions(ctx, user.ID, 0); err != nil {
+			fmt.Printf("⭕ Failed to log out the sessions of %s: %s\n", user.Email, err)
+			return
+		}
+		fmt.Printf("✅ Two-factor authentication of %s turned off\n", user.Email)
+	},
+}
+
+var userUnlockCmd = &cobra.Command{
+	Use:   "unlock <email>",
+	Short: "Unlock an account locked after too many failed logins",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		userService := services.NewUserService(dbConn)
+		ctx := context.Background()
+
+		user, err := userService.GetUserByEmail(ctx, strings.TrimSpace(args[0]))
+		if err != nil {
+			fmt.Printf("⭕ Failed to get user: %s\n", err)
+			return
+		}
+		if user == nil {
+			fmt.Printf("⭕ User %s not found\n", args[0])
+			return
+		}
+		if err := userService.UnlockUser(ctx, user.ID); err != nil {
+			fmt.Printf("⭕ Failed to unlock user: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ User %s unlocked\n", user.Email)
+	},
+}
+
+var userLinkOIDCCmd = &cobra.Command{
+	Use:   "link-oidc <email> <subject>",
+	Short: "Link a user to its identity at the OIDC provider",
+	Long: `Link a user to the subject of its identity at the OIDC provider.
+
+Users are linked on their first OIDC login by their verified email, except admins, which are linked with this command.
+Refused admin logins are recorded in the audit log with their subject.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		userService := services.NewUserService(dbConn)
+		ctx := context.Background()
+
+		subject := strings.TrimSpace(args[1])
+		if subject == "" {
+			fmt.Println("⭕ Subject is required")
+			return
+		}
+		user, err := userService.GetUserByEmail(ctx, strings.TrimSpace(args[0]))
+		if err != nil {
+			fmt.Printf("⭕ Failed to get user: %s\n", err)
+			return
+		}
+		if user == nil {
+			fmt.Printf("⭕ User %s not found\n", args[0])
+			return
+		}
+		if err := userService.LinkOIDCSubject(ctx, user.ID, subject); err != nil {
+			fmt.Printf("⭕ Failed to link user: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ User %s linked to OIDC subject %s\n", user.Email, subject)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(userCmd)
+	userCmd.AddCommand(userAddCmd, userListCmd, userPasswdCmd, userRemoveCmd, userResetTwoFactorCmd, userUnlockCmd, userLinkOIDCCmd)
+
+	userAddCmd.Flags().StringVarP(&userRole, "role", "r", string(models.RoleMember), "Role of the user: admin, maintainer, deployer, viewer or member")
+	userRemoveCmd.Flags().BoolVarP(&userRemoveYes, "yes", "y", false, "Skip confirmation")
+}
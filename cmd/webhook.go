@@ -0,0 +1,106 @@
+/*
+Copyright © 2025 Satnam Sandhu <satnamsandhu70002@gmail.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/core/webhook"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var (
+	webhookDir     string
+	webhookRotate  bool
+	webhookDisable bool
+)
+
+// webhookCmd represents the webhook command
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Show the push-to-deploy webhook URL and secret of an app",
+	Long: `Show the webhook URL and secret used to deploy an application on every git push.
+
+Add the URL as a push webhook in your git provider (GitHub, GitLab, Gitea or Bitbucket) with the
+secret below, using content type application/json. Only pushes to the branch of the app trigger a
+deployment.
+
+The secret is created on first use. Use --rotate to replace it or --disable to turn the webhook off.
+
+Examples:
+  # Show webhook of the app in the current directory
+  stackjet webhook
+
+  # Rotate the webhook secret
+  stackjet webhook --dir /var/www/sites/my-app --rotate`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dbConn := database.Connect()
+		defer dbConn.Close()
+		stackService := services.NewStackService(dbConn)
+		secretService := services.NewSecretService(dbConn)
+		ctx := context.Background()
+
+		app, err := findStackByDir(ctx, stackService, webhookDir)
+		if err != nil {
+			fmt.Printf("⭕ %s\n", err)
+			return
+		}
+		secretName := webhook.SecretName(app.Uuid)
+
+		if webhookDisable {
+			if err := secretService.DeleteSecret(ctx, secretName); err != nil {
+				fmt.Printf("⭕ Failed to disable webhook: %s\n", err)
+				return
+			}
+			fmt.Println("✅ Webhook disabled")
+			return
+		}
+
+		secret, err := secretService.GetSecret(ctx, secretName)
+		if err != nil {
+			fmt.Printf("⭕ Failed to read webhook secret: %s\n", err)
+			return
+		}
+		if secret == "" || webhookRotate {
+			if secret, err = webhook.GenerateSecret(); err != nil {
+				fmt.Printf("⭕ Failed to generate webhook secret: %s\n", err)
+				return
+			}
+			if err := secretService.SetSecret(ctx, secretName, secret); err != nil {
+				fmt.Printf("⭕ Failed to save webhook secret: %s\n", err)
+				return
+			}
+		}
+
+		fmt.Printf("🔗 Webhook for \033[1m%s\033[0m (branch %s)\n\n", app.Name, app.Branch)
+		fmt.Printf("   URL:    http://<your-server>:%d/api/v1/hooks/%s\n", pkg.Config().PORT, app.Uuid)
+		fmt.Printf("   Secret: %s\n\n", secret)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(webhookCmd)
+
+	webhookCmd.Flags().StringVarP(&webhookDir, "dir", "d", "./", "Root directory of the app")
+	webhookCmd.Flags().BoolVar(&webhookRotate, "rotate", false, "Generate a new webhook secret")
+	webhookCmd.Flags().BoolVar(&webhookDisable, "disable", false, "Disable the webhook by deleting its secret")
+}
@@ -11,31 +11,37 @@ func RunInitSQL() error {
 	conn := Connect()
 	defer conn.Close()
 
-	_, err := conn.Exec(string(InitSQL))
-	if err != nil {
-		return fmt.Errorf("init.sql execution failed: %w", err)
+	if err := migrateSchema(conn); err != nil {
+		return err
 	}
+	return nil
+}
 
-	// Insert default admin
-	email := "admin@stackjet.com"
-	password := "admin123"
+// CreateAdmin inserts the first admin unless an admin already exists, reporting whether it was created.
+// With mustChangePassword the password has to be changed on first login.
+func CreateAdmin(email string, password string, mustChangePassword bool) (bool, error) {
+	conn := Connect()
+	defer conn.Close()
+
+	var admins int
+	if err := conn.Get(&admins, `SELECT COUNT(*) FROM users WHERE role IN ('admin', 'superadmin')`); err != nil {
+		return false, fmt.Errorf("admin lookup failed: %w", err)
+	}
+	if admins > 0 {
+		return false, nil
+	}
 
 	hashed, err := pkg.GenerateHash(password)
 	if err != nil {
-		return err
+		return false, err
 	}
 	_, err = conn.Exec(`
-		INSERT INTO users (email, password, role)
-		VALUES (?, ?, 'superadmin')
-	`, email, hashed)
+		INSERT INTO users (email, password, role, must_change_password)
+		VALUES (?, ?, 'admin', ?)
+	`, email, hashed, mustChangePassword)
 
 	if err != nil {
-		return fmt.Errorf("admin insert failed: %w", err)
+		return false, fmt.Errorf("admin insert failed: %w", err)
 	}
-
-	fmt.Println("\033[1;34m🔐 Admin user created with the following credentials:\033[0m")
-	fmt.Printf("\033[34m      email:    %s\033[0m\n", email)
-	fmt.Printf("\033[34m      password: %s\033[0m\n\n", password)
-
-	return nil
+	return true, nil
 }
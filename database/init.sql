@@ -8,6 +8,70 @@ CREATE TABLE
         role VARCHAR(20) NOT NULL
     );
 
+-- single use invitations to create an account while signup is disabled
+CREATE TABLE
+    IF NOT EXISTS user_invitations (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        token_hash VARCHAR(64) NOT NULL UNIQUE,
+        email VARCHAR(255) NOT NULL DEFAULT '',
+        role VARCHAR(20) NOT NULL,
+        created_by INTEGER,
+        expires_at DATETIME NOT NULL,
+        used_at DATETIME,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE SET NULL
+    );
+
+-- single use codes to log in without the TOTP app
+CREATE TABLE
+    IF NOT EXISTS user_recovery_codes (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        code_hash VARCHAR(64) NOT NULL,
+        used_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
+
+-- login sessions, access tokens are only valid while their session is
+CREATE TABLE
+    IF NOT EXISTS sessions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        refresh_hash VARCHAR(64) NOT NULL UNIQUE,
+        auth_method VARCHAR(20) NOT NULL DEFAULT 'password',
+        user_agent TEXT NOT NULL DEFAULT '',
+        ip VARCHAR(64) NOT NULL DEFAULT '',
+        expires_at DATETIME NOT NULL,
+        revoked_at DATETIME,
+        last_used_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
+
+-- refresh tokens a session was rotated away from, presenting one again revokes the session
+CREATE TABLE
+    IF NOT EXISTS rotated_refresh_tokens (
+        refresh_hash VARCHAR(64) PRIMARY KEY,
+        session_id INTEGER NOT NULL,
+        rotated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE
+    );
+
+-- named tokens of users for scripts and CI, limited by scopes
+CREATE TABLE
+    IF NOT EXISTS api_tokens (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        name VARCHAR(100) NOT NULL,
+        token_hash VARCHAR(64) NOT NULL UNIQUE,
+        prefix VARCHAR(20) NOT NULL,
+        scopes TEXT NOT NULL DEFAULT '[]',
+        expires_at DATETIME,
+        last_used_at DATETIME,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
+
 -- master table
 CREATE TABLE
     IF NOT EXISTS stacks (
@@ -26,6 +90,18 @@ CREATE TABLE
         created_at DATETIME DEFAULT CURRENT_TIMESTAMP
     );
 
+-- per-stack roles of users, in addition to their role on all stacks
+CREATE TABLE
+    IF NOT EXISTS stack_members (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        stack_id INTEGER NOT NULL,
+        user_id INTEGER NOT NULL,
+        role VARCHAR(20) NOT NULL,
+        UNIQUE (stack_id, user_id),
+        FOREIGN KEY (stack_id) REFERENCES stacks (id) ON DELETE CASCADE,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
+
 -- pm2-specific configuration for nodejs apps
 CREATE TABLE
     IF NOT EXISTS pm2_configs (
@@ -50,6 +126,44 @@ CREATE TABLE
         FOREIGN KEY (stack_id) REFERENCES stacks (id) ON DELETE CASCADE
     );
 
+-- TLS certificates issued through ACME
+CREATE TABLE
+    IF NOT EXISTS certificates (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        domain VARCHAR(255) NOT NULL UNIQUE,
+        issuer VARCHAR(255) NOT NULL DEFAULT '',
+        cert_path TEXT NOT NULL,
+        key_path TEXT NOT NULL,
+        not_before DATETIME NOT NULL,
+        expires_at DATETIME NOT NULL,
+        last_error TEXT NOT NULL DEFAULT '',
+        issued_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );
+
+-- DNS records synced with the configured DNS provider
+CREATE TABLE
+    IF NOT EXISTS dns_records (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        domain VARCHAR(255) NOT NULL UNIQUE,
+        provider VARCHAR(50) NOT NULL,
+        zone_id VARCHAR(255) NOT NULL DEFAULT '',
+        record_id VARCHAR(255) NOT NULL DEFAULT '',
+        type VARCHAR(10) NOT NULL,
+        content VARCHAR(255) NOT NULL,
+        ttl INTEGER NOT NULL DEFAULT 1,
+        proxied BOOLEAN DEFAULT 0,
+        synced_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );
+
+-- Encrypted secrets like api tokens and credentials
+CREATE TABLE
+    IF NOT EXISTS secrets (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name VARCHAR(150) NOT NULL UNIQUE,
+        value TEXT NOT NULL,
+        updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );
+
 -- Deployment history with rollback support
 CREATE TABLE
     IF NOT EXISTS deployments (
@@ -71,3 +185,33 @@ CREATE TABLE
         log TEXT NOT NULL,
         FOREIGN KEY (deployment_id) REFERENCES deployments (id) ON DELETE CASCADE
     );
+
+-- Timed steps of a deployment with the log slice each step wrote
+CREATE TABLE
+    IF NOT EXISTS deployment_steps (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        deployment_id INTEGER NOT NULL,
+        name VARCHAR(20) NOT NULL,
+        status VARCHAR(20) NOT NULL,
+        started_at DATETIME NOT NULL,
+        finished_at DATETIME,
+        duration_ms INTEGER NOT NULL DEFAULT 0,
+        exit_code INTEGER,
+        log TEXT NOT NULL DEFAULT '',
+        FOREIGN KEY (deployment_id) REFERENCES deployments (id) ON DELETE CASCADE
+    );
+
+-- who did what, actor and stack are kept as plain values so that events outlive them
+CREATE TABLE
+    IF NOT EXISTS audit_events (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        actor_id INTEGER,
+        actor VARCHAR(255) NOT NULL DEFAULT '',
+        source VARCHAR(20) NOT NULL,
+        action VARCHAR(100) NOT NULL,
+        stack_id INTEGER,
+        ip VARCHAR(64) NOT NULL DEFAULT '',
+        summary TEXT NOT NULL DEFAULT '',
+        result VARCHAR(20) NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// columnMigration adds a column introduced after its table was released. init.sql only creates
+// missing tables, so databases of older versions get their new columns through these.
+type columnMigration struct {
+	table      string
+	column     string
+	definition string
+	// after runs once the column was added, to fill or index it
+	after []string
+}
+
+// columnMigrations run in order, a column that already exists is skipped
+var columnMigrations = []columnMigration{
+	{
+		table:      "nginx_configs",
+		column:     "headers",
+		definition: "TEXT NOT NULL DEFAULT '{}'",
+		after:      []string{`UPDATE nginx_configs SET custom_conf = '' WHERE custom_conf IS NULL`},
+	},
+	{table: "deployments", column: "commit_message", definition: "TEXT NOT NULL DEFAULT ''"},
+	{table: "deployments", column: "pusher", definition: "VARCHAR(255) NOT NULL DEFAULT ''"},
+	{table: "stacks", column: "git_options", definition: "TEXT NOT NULL DEFAULT '{}'"},
+	{table: "stacks", column: "app_path", definition: "TEXT NOT NULL DEFAULT ''"},
+	{table: "stacks", column: "path_filters", definition: "TEXT NOT NULL DEFAULT '[]'"},
+	{table: "deployments", column: "ref", definition: "VARCHAR(255) NOT NULL DEFAULT ''"},
+	{table: "deployments", column: "runtime_version", definition: "VARCHAR(50) NOT NULL DEFAULT ''"},
+	{table: "stacks", column: "exec_policy", definition: "TEXT NOT NULL DEFAULT '{}'"},
+	{table: "users", column: "disabled", definition: "BOOLEAN NOT NULL DEFAULT 0"},
+	{
+		table:      "users",
+		column:     "created_at",
+		definition: "DATETIME",
+		after: []string{
+			`UPDATE users SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL`,
+			`CREATE TRIGGER IF NOT EXISTS users_created_at AFTER INSERT ON users WHEN NEW.created_at IS NULL BEGIN UPDATE users SET created_at = CURRENT_TIMESTAMP WHERE id = NEW.id; END`,
+		},
+	},
+	{table: "users", column: "must_change_password", definition: "BOOLEAN NOT NULL DEFAULT 0"},
+	{table: "users", column: "totp_secret", definition: "TEXT NOT NULL DEFAULT ''"},
+	{table: "users", column: "totp_enabled", definition: "BOOLEAN NOT NULL DEFAULT 0"},
+	{table: "users", column: "totp_last_step", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{table: "users", column: "failed_logins", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{table: "users", column: "locked_until", definition: "DATETIME"},
+	{
+		table:      "users",
+		column:     "oidc_subject",
+		definition: "VARCHAR(255)",
+		after: []string{
+			`CREATE UNIQUE INDEX IF NOT EXISTS users_oidc_subject ON users (oidc_subject)`,
+		},
+	},
+	{table: "deployments", column: "triggered_by", definition: "VARCHAR(255) NOT NULL DEFAULT ''"},
+}
+
+// MigrateSchema brings the database of an older version up to date, it is safe to run on every start
+func MigrateSchema() error {
+	conn := Connect()
+	defer conn.Close()
+	return migrateSchema(conn)
+}
+
+// migrateSchema creates the missing tables, then adds the missing columns and indexes
+func migrateSchema(conn *sqlx.DB) error {
+	if _, err := conn.Exec(string(InitSQL)); err != nil {
+		return fmt.Errorf("init.sql execution failed: %w", err)
+	}
+	if err := migrateColumns(conn); err != nil {
+		return fmt.Errorf("column migration failed: %w", err)
+	}
+	return createDomainIndex(conn)
+}
+
+// migrateColumns adds the missing columns of columnMigrations, it is safe to run on every start
+func migrateColumns(conn *sqlx.DB) error {
+	for _, m := range columnMigrations {
+		var found int
+		if err := conn.Get(&found, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, m.table, m.column); err != nil {
+			return fmt.Errorf("%s.%s lookup failed: %w", m.table, m.column, err)
+		}
+		if found > 0 {
+			continue
+		}
+
+		tx, err := conn.Beginx()
+		if err != nil {
+			return err
+		}
+		statements := append([]string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)}, m.after...)
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("adding %s.%s failed: %w", m.table, m.column, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("adding %s.%s failed: %w", m.table, m.column, err)
+		}
+	}
+	return nil
+}
+
+// createDomainIndex makes a domain proxied to one stack only. Older versions allowed a domain on
+// several stacks, those have to be removed by the user rather than dropped here.
+func createDomainIndex(conn *sqlx.DB) error {
+	var duplicates []string
+	if err := conn.Select(&duplicates, `SELECT domain FROM nginx_configs GROUP BY domain HAVING COUNT(*) > 1 ORDER BY domain`); err != nil {
+		return fmt.Errorf("domain lookup failed: %w", err)
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("domains attached to more than one stack: %s. Keep one stack per domain with 'stackjet domain remove' and start again", strings.Join(duplicates, ", "))
+	}
+	if _, err := conn.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS nginx_configs_domain ON nginx_configs (domain)`); err != nil {
+		return fmt.Errorf("domain index creation failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// openTestDB opens an empty database file, a file instead of :memory: so all pool connections share it
+func openTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	conn, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "stackjet.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func columnNames(t *testing.T, conn *sqlx.DB, table string) map[string]bool {
+	t.Helper()
+	var names []string
+	if err := conn.Select(&names, `SELECT name FROM pragma_table_info(?)`, table); err != nil {
+		t.Fatal(err)
+	}
+	columns := map[string]bool{}
+	for _, name := range names {
+		columns[name] = true
+	}
+	return columns
+}
+
+func TestMigrateSchemaUpgradesOldDatabase(t *testing.T) {
+	conn := openTestDB(t)
+	// nginx_configs as the first release created it
+	if _, err := conn.Exec(`
+		CREATE TABLE stacks (id INTEGER PRIMARY KEY AUTOINCREMENT);
+		CREATE TABLE nginx_configs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			stack_id INTEGER NOT NULL,
+			domain VARCHAR(255) NOT NULL,
+			port INTEGER NOT NULL,
+			ssl_enabled BOOLEAN DEFAULT 0,
+			custom_conf TEXT,
+			FOREIGN KEY (stack_id) REFERENCES stacks (id) ON DELETE CASCADE
+		);
+		INSERT INTO stacks (id) VALUES (1);
+		INSERT INTO nginx_configs (stack_id, domain, port) VALUES (1, 'app.example.com', 3000);
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second run has to find the columns and leave them alone
+	for run := 1; run <= 2; run++ {
+		if err := migrateSchema(conn); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+
+	var row struct {
+		Headers    string `db:"headers"`
+		CustomConf string `db:"custom_conf"`
+	}
+	if err := conn.Get(&row, `SELECT headers, custom_conf FROM nginx_configs WHERE domain = 'app.example.com'`); err != nil {
+		t.Fatal(err)
+	}
+	if row.Headers != "{}" || row.CustomConf != "" {
+		t.Fatalf("existing row = %+v, want empty headers and custom conf", row)
+	}
+	if _, err := conn.Exec(`INSERT INTO nginx_configs (stack_id, domain, port) VALUES (1, 'app.example.com', 3001)`); err == nil {
+		t.Fatal("a domain could be added twice")
+	}
+}
+
+func TestCreateDomainIndexRejectsDuplicates(t *testing.T) {
+	conn := openTestDB(t)
+	if _, err := conn.Exec(string(InitSQL)); err != nil {
+		t.Fatal(err)
+	}
+	// older versions let two stacks claim the same domain
+	if _, err := conn.Exec(`
+		INSERT INTO stacks (id, uuid, name, directory, type, repo_url, port, commands) VALUES
+			(1, 'a', 'a', '/a', 'nodejs', 'repo', 3000, '{}'),
+			(2, 'b', 'b', '/b', 'nodejs', 'repo', 3001, '{}');
+		INSERT INTO nginx_configs (stack_id, domain, port) VALUES
+			(1, 'app.example.com', 3000), (2, 'app.example.com', 3001), (2, 'api.example.com', 3001);
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	err := createDomainIndex(conn)
+	if err == nil || !strings.Contains(err.Error(), "app.example.com") || strings.Contains(err.Error(), "api.example.com") {
+		t.Fatalf("error = %v, want the duplicated domain named", err)
+	}
+	var configs int
+	if err := conn.Get(&configs, `SELECT COUNT(*) FROM nginx_configs`); err != nil || configs != 3 {
+		t.Fatalf("nginx configs = %d %v, want all 3 kept", configs, err)
+	}
+
+	if _, err := conn.Exec(`DELETE FROM nginx_configs WHERE stack_id = 2 AND domain = 'app.example.com'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := createDomainIndex(conn); err != nil {
+		t.Fatalf("index after removing the duplicate: %v", err)
+	}
+}
+
+func TestMigrateSchemaOnFreshDatabase(t *testing.T) {
+	conn := openTestDB(t)
+	if err := migrateSchema(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range columnMigrations {
+		if !columnNames(t, conn, m.table)[m.column] {
+			t.Errorf("%s.%s is missing", m.table, m.column)
+		}
+	}
+}
+
+func TestMigrateSchemaStampsNewUsers(t *testing.T) {
+	conn := openTestDB(t)
+	if err := migrateSchema(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	// an added column can not default to CURRENT_TIMESTAMP, the trigger fills it
+	if _, err := conn.Exec(`INSERT INTO users (email, password, role) VALUES ('dev@example.com', 'x', 'viewer')`); err != nil {
+		t.Fatal(err)
+	}
+	var createdAt string
+	if err := conn.Get(&createdAt, `SELECT created_at FROM users WHERE email = 'dev@example.com'`); err != nil {
+		t.Fatal(err)
+	}
+	if createdAt == "" {
+		t.Fatal("created_at was not set")
+	}
+}
@@ -1,18 +1,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/core/ssl"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
 	"github.com/satnamSandhu2001/stackjet/internal/routers"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
 	"github.com/satnamSandhu2001/stackjet/pkg"
 	"github.com/satnamSandhu2001/stackjet/pkg/initializer"
 )
 
 func init() {
-	initializer.InitializeApp(false)
+	initializer.InitializeApp(false, initializer.AdminSetup{})
 }
 
 func main() {
@@ -20,11 +25,27 @@ func main() {
 	conn := database.Connect()
 	defer conn.Close()
 
+	// refuse to serve while an account can be taken over with a published password
+	defaults, err := services.NewUserService(conn).FindDefaultCredentials(context.Background())
+	if err != nil {
+		log.Fatalf("failed to check for default credentials: %v", err)
+	}
+	if len(defaults) > 0 {
+		for _, user := range defaults {
+			log.Printf("user %s still has the default password, change it with: stackjet user passwd %s", user.Email, user.Email)
+		}
+		log.Fatal("refusing to start while default credentials exist")
+	}
+
 	r := gin.Default()
 	r.SetTrustedProxies(nil)
 
 	routers.InitRouter(r, conn)
 
+	// renew certificates in the background before they expire
+	renewCtx := services.WithActor(context.Background(), models.AuditActor{Source: models.AUDIT_SOURCE_SCHEDULER, Name: "ssl-renew"})
+	go ssl.StartAutoRenew(renewCtx, *services.NewStackService(conn), 12*time.Hour)
+
 	if err := r.Run(fmt.Sprintf(":%v", pkg.Config().PORT)); err != nil {
 		panic(err)
 	}
@@ -0,0 +1,222 @@
+package apiclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const apiPrefix = "/api/v1"
+
+// requestTimeout limits requests except streams, which last as long as their deployment
+const requestTimeout = 30 * time.Second
+
+// Client calls the API of the server of a context as its user
+type Client struct {
+	HTTPClient *http.Client
+	Name       string
+	Context    *Context
+
+	// contexts saves the tokens of refreshed sessions, nil for contexts that are not saved yet
+	contexts *Contexts
+}
+
+// NewClient returns a client of the context name of contexts
+func NewClient(contexts *Contexts, name string, context *Context) *Client {
+	return &Client{
+		HTTPClient: &http.Client{},
+		Name:       name,
+		Context:    context,
+		contexts:   contexts,
+	}
+}
+
+// Error is an API request that did not succeed
+type Error struct {
+	Status  int
+	Message string
+	// Fields are the validation errors of the request body by field
+	Fields map[string]string
+}
+
+func (e *Error) Error() string {
+	message := e.Message
+	if len(e.Fields) > 0 {
+		fields := make([]string, 0, len(e.Fields))
+		for _, field := range e.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		message = strings.TrimPrefix(message+": "+strings.Join(fields, ", "), ": ")
+	}
+	if message == "" {
+		message = http.StatusText(e.Status)
+	}
+	return message
+}
+
+// response is the envelope of API responses
+type response struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// NormalizeServer checks a server URL and strips its trailing slash
+func NormalizeServer(server string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(server))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid server URL %q, use e.g. https://panel.example.com", server)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(u.String(), "/"), apiPrefix), nil
+}
+
+// Do sends body as JSON to the API path and decodes the data of the response into data, if not nil
+func (c *Client) Do(ctx context.Context, method string, path string, body any, data any) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	res, err := c.send(ctx, method, path, body, "application/json")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return decodeResponse(res, data)
+}
+
+// Stream sends body as JSON to an API path answering with server-sent events and calls handle for each event
+// until the stream ends. Cancelling ctx closes the stream, which cancels deployments.
+func (c *Client) Stream(ctx context.Context, method string, path string, body any, handle func(event string, data string)) error {
+	res, err := c.send(ctx, method, path, body, "text/event-stream")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/event-stream") {
+		return decodeResponse(res, nil)
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event != "" || len(data) > 0 {
+				if event == "" {
+					event = "message"
+				}
+				handle(event, strings.Join(data, "\n"))
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			value := strings.TrimPrefix(line, "data:")
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("stream of %s closed: %w", c.Context.Server, err)
+	}
+	return ctx.Err()
+}
+
+// send sends a request, renewing the session of the context once when its access token expired
+func (c *Client) send(ctx context.Context, method string, path string, body any, accept string) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	res, err := c.request(ctx, method, path, payload, accept)
+	if err != nil || res.StatusCode != http.StatusUnauthorized || c.Context.RefreshToken == "" || strings.HasPrefix(path, "/auth/") {
+		return res, err
+	}
+	res.Body.Close()
+	if err := c.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return c.request(ctx, method, path, payload, accept)
+}
+
+func (c *Client) request(ctx context.Context, method string, path string, payload []byte, accept string) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.Context.Server+apiPrefix+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", accept)
+	if c.Context.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Context.Token)
+	}
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s: %w", c.Context.Server, err)
+	}
+	return res, nil
+}
+
+// refresh renews the access token of the session of the context and saves the new tokens
+func (c *Client) refresh(ctx context.Context) error {
+	var session struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := c.Do(ctx, http.MethodPost, "/auth/refresh", map[string]string{"refresh_token": c.Context.RefreshToken}, &session)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized {
+		return fmt.Errorf("session of context %s expired, log in again with: stackjet login %s --name %s", c.Name, c.Context.Server, c.Name)
+	}
+	if err != nil {
+		return err
+	}
+	c.Context.Token = session.Token
+	c.Context.RefreshToken = session.RefreshToken
+	if c.contexts == nil {
+		return nil
+	}
+	return c.contexts.Save()
+}
+
+func decodeResponse(res *http.Response, data any) error {
+	raw, err := io.ReadAll(io.LimitReader(res.Body, 64<<20))
+	if err != nil {
+		return err
+	}
+	var envelope response
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		if res.StatusCode >= 300 {
+			return &Error{Status: res.StatusCode}
+		}
+		return fmt.Errorf("unexpected response of status %d, is this a StackJet server?", res.StatusCode)
+	}
+	if !envelope.Success || res.StatusCode >= 300 {
+		apiErr := &Error{Status: res.StatusCode, Message: envelope.Message}
+		json.Unmarshal(envelope.Data, &apiErr.Fields)
+		return apiErr
+	}
+	if data == nil || len(envelope.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(envelope.Data, data)
+}
@@ -0,0 +1,176 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/satnamSandhu2001/stackjet/pkg/API"
+)
+
+func TestNormalizeServer(t *testing.T) {
+	tests := map[string]string{
+		"https://panel.example.com":        "https://panel.example.com",
+		" https://panel.example.com/ ":     "https://panel.example.com",
+		"https://panel.example.com/api/v1": "https://panel.example.com",
+		"http://10.0.0.2:8080/":            "http://10.0.0.2:8080",
+		"https://example.com/stackjet/":    "https://example.com/stackjet",
+		"panel.example.com":                "",
+		"ftp://panel.example.com":          "",
+		"https://":                         "",
+	}
+	for server, want := range tests {
+		got, err := NormalizeServer(server)
+		if got != want || (err == nil) != (want != "") {
+			t.Errorf("NormalizeServer(%q) = %q, %v, want %q", server, got, err, want)
+		}
+	}
+}
+
+// newTestServer answers like the StackJet API, accepting the access token "fresh" only
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{"success": false, "message": "token expired"})
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("POST /api/v1/auth/refresh", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.RefreshToken != "refresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{"success": false, "message": "session is invalid or expired"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "data": map[string]string{"token": "fresh", "refresh_token": "rotated"}})
+	})
+	mux.HandleFunc("GET /api/v1/stack/list", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			json.NewEncoder(w).Encode(map[string]any{"success": true, "data": []map[string]any{{"id": 3, "name": "app"}}})
+		}
+	})
+	mux.HandleFunc("POST /api/v1/stack/new", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]any{"success": false, "message": "validation failed", "data": map[string]string{"port": "port is required", "repo": "repo is required"}})
+		}
+	})
+	mux.HandleFunc("POST /api/v1/stack/deploy/3", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		// the SSE writer of the server, a log line may hold several lines
+		sse := API.NewSSEWriter(w)
+		sse.Write([]byte("Installing...\n"))
+		sse.WriteEvent("step", map[string]any{"id": 1, "name": "install", "status": "in_progress"})
+		sse.Write([]byte("line one\nline two\r\n"))
+		sse.WriteEvent("done", map[string]any{"deployment_id": 9, "status": "success"})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestClient(t *testing.T, server *httptest.Server, token string, refreshToken string) (*Client, *Contexts) {
+	t.Helper()
+	t.Setenv("STACKJET_CONTEXTS", filepath.Join(t.TempDir(), "contexts.json"))
+	contexts, err := LoadContexts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contexts.Contexts["production"] = &Context{Server: server.URL, Token: token, RefreshToken: refreshToken}
+	return NewClient(contexts, "production", contexts.Contexts["production"]), contexts
+}
+
+func TestClientRefreshesExpiredSession(t *testing.T) {
+	server := newTestServer(t)
+	client, _ := newTestClient(t, server, "expired", "refresh")
+
+	var stacks []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := client.Do(context.Background(), http.MethodGet, "/stack/list", nil, &stacks); err != nil {
+		t.Fatal(err)
+	}
+	if len(stacks) != 1 || stacks[0].Name != "app" {
+		t.Fatalf("stacks = %+v", stacks)
+	}
+	// the rotated tokens are saved for the next command
+	saved, err := LoadContexts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.Contexts["production"]; got == nil || got.Token != "fresh" || got.RefreshToken != "rotated" {
+		t.Fatalf("saved context = %+v, want the refreshed tokens", got)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	server := newTestServer(t)
+
+	client, _ := newTestClient(t, server, "expired", "stolen")
+	err := client.Do(context.Background(), http.MethodGet, "/stack/list", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "stackjet login "+server.URL+" --name production") {
+		t.Fatalf("expired session = %v, want a login hint", err)
+	}
+
+	// API tokens have no session to refresh
+	client, _ = newTestClient(t, server, "sjt_revoked", "")
+	var apiErr *Error
+	if err := client.Do(context.Background(), http.MethodGet, "/stack/list", nil, nil); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized || apiErr.Message != "token expired" {
+		t.Fatalf("revoked API token = %v", err)
+	}
+
+	client, _ = newTestClient(t, server, "fresh", "")
+	err = client.Do(context.Background(), http.MethodPost, "/stack/new", map[string]any{}, nil)
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnprocessableEntity || err.Error() != "validation failed: port is required, repo is required" {
+		t.Fatalf("validation error = %v", err)
+	}
+
+	client.Context.Server = "http://127.0.0.1:1"
+	if err := client.Do(context.Background(), http.MethodGet, "/stack/list", nil, nil); err == nil || !strings.Contains(err.Error(), "failed to reach") {
+		t.Fatalf("unreachable server = %v", err)
+	}
+}
+
+func TestClientStream(t *testing.T) {
+	server := newTestServer(t)
+	client, _ := newTestClient(t, server, "expired", "refresh")
+
+	var events []string
+	err := client.Stream(context.Background(), http.MethodPost, "/stack/deploy/3", map[string]any{}, func(event string, data string) {
+		events = append(events, event+": "+data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"log: Installing...",
+		`step: {"id":1,"name":"install","status":"in_progress"}`,
+		"log: line one\nline two",
+		`done: {"deployment_id":9,"status":"success"}`,
+	}
+	if strings.Join(events, "|") != strings.Join(want, "|") {
+		t.Fatalf("events = %q, want %q", events, want)
+	}
+
+	// errors before the stream starts are API errors
+	client, _ = newTestClient(t, server, "sjt_revoked", "")
+	var apiErr *Error
+	if err := client.Stream(context.Background(), http.MethodPost, "/stack/deploy/3", nil, func(string, string) {}); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Fatalf("stream with a revoked token = %v", err)
+	}
+}
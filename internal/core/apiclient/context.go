@@ -0,0 +1,104 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Context is a StackJet server the CLI is logged in to
+type Context struct {
+	Server string `json:"server"`
+	User   string `json:"user"`
+	Token  string `json:"token"`
+	// RefreshToken renews Token when it expired, it is empty for API tokens
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// Contexts is the context file, the current context is used when none is selected
+type Contexts struct {
+	Current  string              `json:"current_context"`
+	Contexts map[string]*Context `json:"contexts"`
+
+	path string
+}
+
+// ContextsPath returns the context file, STACKJET_CONTEXTS or contexts.json in the user config directory.
+// It is kept apart from ~/.stackjet, so that machines without a StackJet server can log in.
+func ContextsPath() (string, error) {
+	if path := os.Getenv("STACKJET_CONTEXTS"); path != "" {
+		return path, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "stackjet", "contexts.json"), nil
+}
+
+// LoadContexts reads the context file, which is empty until the first login
+func LoadContexts() (*Contexts, error) {
+	path, err := ContextsPath()
+	if err != nil {
+		return nil, err
+	}
+	contexts := &Contexts{Contexts: map[string]*Context{}, path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return contexts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, contexts); err != nil {
+		return nil, fmt.Errorf("context file %s is invalid: %w", path, err)
+	}
+	if contexts.Contexts == nil {
+		contexts.Contexts = map[string]*Context{}
+	}
+	return contexts, nil
+}
+
+// Save writes the context file readable by its owner only, it holds tokens
+func (c *Contexts) Save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// Names returns the names of the contexts in order
+func (c *Contexts) Names() []string {
+	names := make([]string, 0, len(c.Contexts))
+	for name := range c.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select returns the context name, or the current context when name is empty. Both empty is local mode and returns nil.
+func (c *Contexts) Select(name string) (string, *Context, error) {
+	if name == "" {
+		name = c.Current
+	}
+	if name == "" {
+		return "", nil, nil
+	}
+	context, ok := c.Contexts[name]
+	if !ok {
+		return "", nil, fmt.Errorf("context %s not found, log in with: stackjet login <server-url> --name %s", name, name)
+	}
+	return name, context, nil
+}
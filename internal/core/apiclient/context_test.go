@@ -0,0 +1,77 @@
+package apiclient
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContextsPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/home/dev/.config")
+	t.Setenv("STACKJET_CONTEXTS", "")
+	if path, err := ContextsPath(); err != nil || path != "/home/dev/.config/stackjet/contexts.json" {
+		t.Fatalf("ContextsPath = %q %v", path, err)
+	}
+	t.Setenv("STACKJET_CONTEXTS", "/tmp/contexts.json")
+	if path, err := ContextsPath(); err != nil || path != "/tmp/contexts.json" {
+		t.Fatalf("ContextsPath with STACKJET_CONTEXTS = %q %v", path, err)
+	}
+}
+
+func TestContextsSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stackjet", "contexts.json")
+	t.Setenv("STACKJET_CONTEXTS", path)
+
+	contexts, err := LoadContexts()
+	if err != nil || len(contexts.Contexts) != 0 || contexts.Current != "" {
+		t.Fatalf("contexts before the first login = %+v %v", contexts, err)
+	}
+	contexts.Contexts["production"] = &Context{Server: "https://panel.example.com", User: "dev@example.com", Token: "access", RefreshToken: "refresh"}
+	contexts.Contexts["staging"] = &Context{Server: "https://staging.example.com", Token: "sjt_token"}
+	contexts.Current = "staging"
+	if err := contexts.Save(); err != nil {
+		t.Fatal(err)
+	}
+	// the file holds tokens
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("context file mode = %v %v, want 0600", info.Mode(), err)
+	}
+
+	loaded, err := LoadContexts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Current != "staging" || strings.Join(loaded.Names(), ",") != "production,staging" || *loaded.Contexts["production"] != *contexts.Contexts["production"] {
+		t.Fatalf("loaded contexts = %+v", loaded)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadContexts(); err == nil || !strings.Contains(err.Error(), path) {
+		t.Fatalf("invalid context file = %v, want an error naming it", err)
+	}
+}
+
+func TestContextsSelect(t *testing.T) {
+	contexts := &Contexts{Contexts: map[string]*Context{
+		"production": {Server: "https://panel.example.com"},
+		"staging":    {Server: "https://staging.example.com"},
+	}}
+
+	// without a current context commands run on this server
+	if name, context, err := contexts.Select(""); name != "" || context != nil || err != nil {
+		t.Fatalf("Select without a current context = %q %v %v, want local mode", name, context, err)
+	}
+	contexts.Current = "staging"
+	if name, context, err := contexts.Select(""); name != "staging" || context != contexts.Contexts["staging"] || err != nil {
+		t.Fatalf("Select of the current context = %q %v %v", name, context, err)
+	}
+	if name, context, err := contexts.Select("production"); name != "production" || context != contexts.Contexts["production"] || err != nil {
+		t.Fatalf("Select of a named context = %q %v %v", name, context, err)
+	}
+	if _, context, err := contexts.Select("prod"); err == nil || context != nil || !strings.Contains(err.Error(), "stackjet login <server-url> --name prod") {
+		t.Fatalf("Select of an unknown context = %v %v, want a login hint", context, err)
+	}
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/satnamSandhu2001/stackjet/pkg/commands"
+	"github.com/satnamSandhu2001/stackjet/pkg/logger"
+)
+
+// DefaultOutputs are the build output folders cached when a stack does not configure its own
+var DefaultOutputs = []string{"dist", "build", ".next", "out"}
+
+// Path returns the build cache archive of a stack commit.
+// The key includes the build command, so changing it invalidates the cache.
+func Path(stack *models.Stack, commit string) string {
+	sum := sha256.Sum256([]byte(stack.Commands.Build))
+	key := fmt.Sprintf("%s-%s.tar.gz", commit, hex.EncodeToString(sum[:])[:8])
+	return filepath.Join(pkg.Config().STACKJET_DIR, "cache", stack.Uuid, key)
+}
+
+// Exists reports whether a build of the commit is cached
+func Exists(stack *models.Stack, commit string) bool {
+	return commands.FileExists(Path(stack, commit)) == nil
+}
+
+// Restore replaces the build outputs in the app directory with the cached build of a commit
+func Restore(w io.Writer, stack *models.Stack, commit string) error {
+	archive := Path(stack, commit)
+	logger.EmitLog(w, "")
+	logger.EmitLog(w, fmt.Sprintf("♻️ Restoring cached build of %s...", commit))
+	// only the outputs in the archive are replaced
+	listing, err := commands.RunCommand(commands.RunCommandArgs{Logger: io.Discard, Name: "tar", Args: []string{"-tzf", archive}})
+	if err != nil {
+		return fmt.Errorf("failed to read build cache: %w", err)
+	}
+	entries := strings.Split(listing, "\n")
+	for i := range entries {
+		entries[i] = strings.TrimSuffix(strings.TrimSpace(entries[i]), "/")
+	}
+	for _, output := range outputs(stack) {
+		if !slices.Contains(entries, output) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(stack.AppDir(), output)); err != nil {
+			return err
+		}
+	}
+	if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "tar", Args: []string{"-xzf", archive, "-C", stack.AppDir()}}); err != nil {
+		return fmt.Errorf("failed to restore build cache: %w", err)
+	}
+	// mark as recently used so it is pruned last
+	os.Chtimes(archive, time.Now(), time.Now())
+	return nil
+}
+
+// Save archives the build outputs of a commit and prunes the oldest archives of the stack
+func Save(w io.Writer, stack *models.Stack, commit string) error {
+	var existing []string
+	for _, output := range outputs(stack) {
+		if commands.FileExists(filepath.Join(stack.AppDir(), output)) == nil {
+			existing = append(existing, output)
+		}
+	}
+	if len(existing) == 0 {
+		logger.EmitLog(w, "ℹ️ No build outputs found to cache")
+		return nil
+	}
+
+	archive := Path(stack, commit)
+	if err := commands.CreateDir(filepath.Dir(archive)); err != nil {
+		return err
+	}
+	logger.EmitLog(w, "")
+	logger.EmitLog(w, fmt.Sprintf("💾 Caching build outputs %s...", strings.Join(existing, ", ")))
+	// write to a temp file first so a failed build never leaves a partial archive
+	args := append([]string{"-czf", archive + ".tmp", "-C", stack.AppDir()}, existing...)
+	if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "tar", Args: args}); err != nil {
+		os.Remove(archive + ".tmp")
+		return fmt.Errorf("failed to cache build: %w", err)
+	}
+	if err := os.Rename(archive+".tmp", archive); err != nil {
+		return err
+	}
+	return prune(stack)
+}
+
+// Clear deletes all cached builds of a stack
+func Clear(stack *models.Stack) error {
+	return os.RemoveAll(filepath.Dir(Path(stack, "")))
+}
+
+// keeps the most recently used archives of a stack
+func prune(stack *models.Stack) error {
+	dir := filepath.Dir(Path(stack, ""))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	type archive struct {
+		path    string
+		modTime int64
+	}
+	var archives []archive
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !strings.HasSuffix(entry.Name(), ".tar.gz") {
+			continue
+		}
+		archives = append(archives, archive{filepath.Join(dir, entry.Name()), info.ModTime().UnixNano()})
+	}
+	slices.SortFunc(archives, func(a, b archive) int { return cmp.Compare(b.modTime, a.modTime) })
+
+	keep := pkg.Config().BUILD_CACHE_KEEP
+	for i := keep; i < len(archives); i++ {
+		if err := os.Remove(archives[i].path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func outputs(stack *models.Stack) []string {
+	if len(stack.Commands.BuildOutputs) > 0 {
+		return stack.Commands.BuildOutputs
+	}
+	return DefaultOutputs
+}
@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+)
+
+// newStack returns a stack in a temporary directory named after the test
+func newStack(t *testing.T) *models.Stack {
+	t.Helper()
+	stack := &models.Stack{Uuid: filepath.Base(t.Name()), Directory: t.TempDir()}
+	stack.Commands.Build = "npm run build"
+	t.Cleanup(func() { Clear(stack) })
+	return stack
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestPath(t *testing.T) {
+	stack := newStack(t)
+	path := Path(stack, "abc1234")
+	if Path(stack, "abc1234") != path {
+		t.Fatal("the path of a commit changed between calls")
+	}
+	if Path(stack, "def5678") == path {
+		t.Fatal("two commits share a cache path")
+	}
+
+	// the build command is part of the key
+	stack.Commands.Build = "npm run build:prod"
+	if Path(stack, "abc1234") == path {
+		t.Fatal("changing the build command kept the cache path")
+	}
+	other := newStack(t)
+	other.Uuid += "-other"
+	if Path(other, "abc1234") == Path(stack, "abc1234") {
+		t.Fatal("two stacks share a cache path")
+	}
+}
+
+func TestSaveAndRestore(t *testing.T) {
+	stack := newStack(t)
+	dir := stack.AppDir()
+	writeFile(t, filepath.Join(dir, "dist", "index.js"), "built")
+	writeFile(t, filepath.Join(dir, "src", "index.ts"), "source")
+
+	if Exists(stack, "abc1234") {
+		t.Fatal("a build is cached before it was saved")
+	}
+	if err := Save(io.Discard, stack, "abc1234"); err != nil {
+		t.Fatal(err)
+	}
+	if !Exists(stack, "abc1234") {
+		t.Fatal("the saved build is not cached")
+	}
+
+	// the next build changes the outputs and leaves a file the cached build did not have
+	writeFile(t, filepath.Join(dir, "dist", "index.js"), "rebuilt")
+	writeFile(t, filepath.Join(dir, "dist", "stale.js"), "stale")
+	writeFile(t, filepath.Join(dir, "build", "other.js"), "not cached")
+	writeFile(t, filepath.Join(dir, "src", "index.ts"), "changed source")
+
+	if err := Restore(io.Discard, stack, "abc1234"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "dist", "index.js")); got != "built" {
+		t.Errorf("dist/index.js = %q, want the cached build", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dist", "stale.js")); !os.IsNotExist(err) {
+		t.Errorf("a file of a newer build was kept in dist: %v", err)
+	}
+	// outputs missing from the archive and sources are left alone
+	if got := readFile(t, filepath.Join(dir, "build", "other.js")); got != "not cached" {
+		t.Errorf("build/other.js = %q, want it kept", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "src", "index.ts")); got != "changed source" {
+		t.Errorf("src/index.ts = %q, want it kept", got)
+	}
+}
+
+func TestSaveConfiguredOutputs(t *testing.T) {
+	stack := newStack(t)
+	stack.Commands.BuildOutputs = []string{"public/assets"}
+	writeFile(t, filepath.Join(stack.AppDir(), "public", "assets", "app.css"), "css")
+	writeFile(t, filepath.Join(stack.AppDir(), "dist", "index.js"), "built")
+
+	if err := Save(io.Discard, stack, "abc1234"); err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(filepath.Join(stack.AppDir(), "public"))
+	os.RemoveAll(filepath.Join(stack.AppDir(), "dist"))
+	if err := Restore(io.Discard, stack, "abc1234"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(stack.AppDir(), "public", "assets", "app.css")); got != "css" {
+		t.Errorf("public/assets/app.css = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(stack.AppDir(), "dist")); !os.IsNotExist(err) {
+		t.Errorf("dist was cached although the stack configures its outputs: %v", err)
+	}
+}
+
+func TestSaveWithoutOutputs(t *testing.T) {
+	stack := newStack(t)
+	if err := Save(io.Discard, stack, "abc1234"); err != nil {
+		t.Fatal(err)
+	}
+	if Exists(stack, "abc1234") {
+		t.Fatal("a build without outputs was cached")
+	}
+}
+
+func TestSavePrunesLeastRecentlyUsed(t *testing.T) {
+	stack := newStack(t)
+	writeFile(t, filepath.Join(stack.AppDir(), "dist", "index.js"), "built")
+
+	// the config of the tests keeps 2 builds, archives are aged so their order does not depend on the clock
+	age := func(commit string, minutes int) {
+		at := time.Now().Add(-time.Duration(minutes) * time.Minute)
+		if err := os.Chtimes(Path(stack, commit), at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, commit := range []string{"aaaaaaa", "bbbbbbb"} {
+		if err := Save(io.Discard, stack, commit); err != nil {
+			t.Fatal(err)
+		}
+		age(commit, 10-i)
+	}
+	// restoring the oldest build makes it the most recently used
+	if err := Restore(io.Discard, stack, "aaaaaaa"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(io.Discard, stack, "ccccccc"); err != nil {
+		t.Fatal(err)
+	}
+
+	for commit, want := range map[string]bool{"aaaaaaa": true, "bbbbbbb": false, "ccccccc": true} {
+		if Exists(stack, commit) != want {
+			t.Errorf("build of %s cached = %v, want %v", commit, !want, want)
+		}
+	}
+}
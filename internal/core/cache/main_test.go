@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "stackjet-cache")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	code := func() int {
+		defer os.RemoveAll(home)
+		os.Setenv("HOME", home)
+		dir := filepath.Join(home, ".stackjet")
+		files := map[string]string{"init.lock": "", "jwt.token": "test-signing-key", "config.json": `{"build_cache_keep": 2}`}
+		if err := os.Mkdir(dir, 0700); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+		}
+		return m.Run()
+	}()
+	os.Exit(code)
+}
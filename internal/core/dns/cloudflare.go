@@ -0,0 +1,207 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	CloudflareProviderName = "cloudflare"
+	CloudflareTokenSecret  = "cloudflare_api_token"
+	cloudflareAPIURL       = "https://api.cloudflare.com/client/v4"
+)
+
+// Cloudflare manages records through the Cloudflare v4 api
+type Cloudflare struct {
+	// BaseURL of the api, can point to a stand-in server
+	BaseURL    string
+	HTTPClient *http.Client
+	token      string
+	zones      map[string]string // zone name -> zone id
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+}
+
+func NewCloudflare(token string) *Cloudflare {
+	return &Cloudflare{
+		BaseURL:    cloudflareAPIURL,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		token:      token,
+		zones:      map[string]string{},
+	}
+}
+
+func (c *Cloudflare) Name() string {
+	return CloudflareProviderName
+}
+
+func (c *Cloudflare) FindRecords(ctx context.Context, name string) ([]Record, error) {
+	zoneID, err := c.zoneID(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []cloudflareRecord
+	if err := c.request(ctx, http.MethodGet, fmt.Sprintf("/zones/%s/dns_records?name=%s", zoneID, url.QueryEscape(name)), nil, &result); err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, len(result))
+	for _, r := range result {
+		switch r.Type {
+		case "A", "AAAA", "CNAME":
+			records = append(records, fromCloudflare(zoneID, r))
+		}
+	}
+	return records, nil
+}
+
+func (c *Cloudflare) CreateRecord(ctx context.Context, record Record) (*Record, error) {
+	zoneID, err := c.zoneID(ctx, record.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var result cloudflareRecord
+	if err := c.request(ctx, http.MethodPost, fmt.Sprintf("/zones/%s/dns_records", zoneID), toCloudflare(record), &result); err != nil {
+		return nil, err
+	}
+	created := fromCloudflare(zoneID, result)
+	return &created, nil
+}
+
+func (c *Cloudflare) UpdateRecord(ctx context.Context, record Record) (*Record, error) {
+	if record.ID == "" || record.ZoneID == "" {
+		return nil, errors.New("record id and zone id are required")
+	}
+
+	var result cloudflareRecord
+	if err := c.request(ctx, http.MethodPut, fmt.Sprintf("/zones/%s/dns_records/%s", record.ZoneID, record.ID), toCloudflare(record), &result); err != nil {
+		return nil, err
+	}
+	updated := fromCloudflare(record.ZoneID, result)
+	return &updated, nil
+}
+
+func (c *Cloudflare) DeleteRecord(ctx context.Context, record Record) error {
+	if record.ID == "" || record.ZoneID == "" {
+		return errors.New("record id and zone id are required")
+	}
+	return c.request(ctx, http.MethodDelete, fmt.Sprintf("/zones/%s/dns_records/%s", record.ZoneID, record.ID), nil, nil)
+}
+
+// finds the zone of a host name by trying each parent domain, longest first
+func (c *Cloudflare) zoneID(ctx context.Context, name string) (string, error) {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		zoneName := strings.Join(labels[i:], ".")
+		if id, ok := c.zones[zoneName]; ok {
+			return id, nil
+		}
+
+		var zones []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		}
+		if err := c.request(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(zoneName), nil, &zones); err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			c.zones[zoneName] = zones[0].ID
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("no cloudflare zone found for %s", name)
+}
+
+func (c *Cloudflare) request(ctx context.Context, method string, path string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.BaseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cloudflare request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return ErrRecordNotFound
+	}
+
+	var parsed cloudflareResponse
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return fmt.Errorf("invalid cloudflare response (status %d): %w", res.StatusCode, err)
+	}
+	if !parsed.Success {
+		messages := make([]string, 0, len(parsed.Errors))
+		for _, e := range parsed.Errors {
+			messages = append(messages, fmt.Sprintf("%s (code %d)", e.Message, e.Code))
+		}
+		return fmt.Errorf("cloudflare api error: %s", strings.Join(messages, ", "))
+	}
+	if result != nil {
+		if err := json.Unmarshal(parsed.Result, result); err != nil {
+			return fmt.Errorf("invalid cloudflare response: %w", err)
+		}
+	}
+	return nil
+}
+
+func toCloudflare(record Record) cloudflareRecord {
+	return cloudflareRecord{
+		Type:    record.Type,
+		Name:    record.Name,
+		Content: record.Content,
+		TTL:     record.TTL,
+		Proxied: record.Proxied,
+	}
+}
+
+func fromCloudflare(zoneID string, r cloudflareRecord) Record {
+	return Record{
+		ID:      r.ID,
+		ZoneID:  zoneID,
+		Type:    r.Type,
+		Name:    r.Name,
+		Content: r.Content,
+		TTL:     r.TTL,
+		Proxied: r.Proxied,
+	}
+}
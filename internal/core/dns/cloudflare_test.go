@@ -0,0 +1,287 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+)
+
+const testToken = "test-token"
+
+// cloudflareStandIn serves the parts of the Cloudflare v4 api the provider uses
+type cloudflareStandIn struct {
+	mu          sync.Mutex
+	zones       map[string]string // zone name -> zone id
+	records     map[string]cloudflareRecord
+	nextID      int
+	zoneQueries []string
+}
+
+func newCloudflareStandIn(t *testing.T, zones map[string]string) (*cloudflareStandIn, *Cloudflare) {
+	t.Helper()
+	standIn := &cloudflareStandIn{zones: zones, records: map[string]cloudflareRecord{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /zones", standIn.listZones)
+	mux.HandleFunc("GET /zones/{zone}/dns_records", standIn.listRecords)
+	mux.HandleFunc("POST /zones/{zone}/dns_records", standIn.writeRecord)
+	mux.HandleFunc("PUT /zones/{zone}/dns_records/{id}", standIn.writeRecord)
+	mux.HandleFunc("DELETE /zones/{zone}/dns_records/{id}", standIn.deleteRecord)
+	mux.HandleFunc("GET /broken/", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>bad gateway</html>", http.StatusBadGateway)
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			respond(w, http.StatusForbidden, nil, 10000, "Authentication error")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewCloudflare(testToken)
+	client.BaseURL = server.URL
+	return standIn, client
+}
+
+func respond(w http.ResponseWriter, status int, result any, code int, message string) {
+	body := map[string]any{"success": code == 0, "errors": []any{}, "result": result}
+	if code != 0 {
+		body["errors"] = []map[string]any{{"code": code, "message": message}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (s *cloudflareStandIn) listZones(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := r.URL.Query().Get("name")
+	s.zoneQueries = append(s.zoneQueries, name)
+	zones := []map[string]string{}
+	if id, ok := s.zones[name]; ok {
+		zones = append(zones, map[string]string{"id": id, "name": name})
+	}
+	respond(w, http.StatusOK, zones, 0, "")
+}
+
+func (s *cloudflareStandIn) listRecords(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := []cloudflareRecord{}
+	for _, record := range s.records {
+		if record.Name == r.URL.Query().Get("name") {
+			records = append(records, record)
+		}
+	}
+	respond(w, http.StatusOK, records, 0, "")
+}
+
+func (s *cloudflareStandIn) writeRecord(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var record cloudflareRecord
+	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+		respond(w, http.StatusBadRequest, nil, 9207, "Request body is invalid")
+		return
+	}
+	if ip := net.ParseIP(record.Content); record.Type == "A" && (ip == nil || ip.To4() == nil) {
+		respond(w, http.StatusBadRequest, nil, 9005, "Content for A record is invalid. Must be a valid IPv4 address")
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		s.nextID++
+		id = fmt.Sprintf("record-%d", s.nextID)
+	} else if _, ok := s.records[id]; !ok {
+		respond(w, http.StatusNotFound, nil, 81044, "Record does not exist")
+		return
+	}
+	record.ID = id
+	s.records[id] = record
+	respond(w, http.StatusOK, record, 0, "")
+}
+
+func (s *cloudflareStandIn) deleteRecord(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[r.PathValue("id")]; !ok {
+		respond(w, http.StatusNotFound, nil, 81044, "Record does not exist")
+		return
+	}
+	delete(s.records, r.PathValue("id"))
+	respond(w, http.StatusOK, map[string]string{"id": r.PathValue("id")}, 0, "")
+}
+
+func TestCloudflareZoneLookup(t *testing.T) {
+	standIn, client := newCloudflareStandIn(t, map[string]string{"example.com": "zone-1", "app.example.org": "zone-2"})
+	ctx := context.Background()
+
+	zoneID, err := client.zoneID(ctx, "api.app.example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zoneID != "zone-1" {
+		t.Errorf("zone = %s, want zone-1", zoneID)
+	}
+	if want := []string{"api.app.example.com", "app.example.com", "example.com"}; strings.Join(standIn.zoneQueries, ",") != strings.Join(want, ",") {
+		t.Errorf("zone queries = %v, want the longest parent first %v", standIn.zoneQueries, want)
+	}
+
+	// found zones are cached
+	standIn.zoneQueries = nil
+	if zoneID, err := client.zoneID(ctx, "example.com"); err != nil || zoneID != "zone-1" {
+		t.Errorf("zone = %s, %v, want cached zone-1", zoneID, err)
+	}
+	if len(standIn.zoneQueries) != 0 {
+		t.Errorf("cached zone was queried again: %v", standIn.zoneQueries)
+	}
+	if zoneID, err := client.zoneID(ctx, "www.app.example.org"); err != nil || zoneID != "zone-2" {
+		t.Errorf("zone = %s, %v, want zone-2", zoneID, err)
+	}
+
+	if _, err := client.zoneID(ctx, "app.example.net"); err == nil || !strings.Contains(err.Error(), "no cloudflare zone found") {
+		t.Errorf("err = %v, want no zone found", err)
+	}
+}
+
+func TestCloudflareRecords(t *testing.T) {
+	standIn, client := newCloudflareStandIn(t, map[string]string{"example.com": "zone-1"})
+	ctx := context.Background()
+	standIn.records["txt"] = cloudflareRecord{ID: "txt", Type: "TXT", Name: "app.example.com", Content: "v=spf1 -all"}
+
+	created, err := client.CreateRecord(ctx, Record{Type: "A", Name: "app.example.com", Content: "203.0.113.10", TTL: 1, Proxied: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.ZoneID != "zone-1" || !created.Proxied || created.TTL != 1 {
+		t.Errorf("created = %+v", created)
+	}
+
+	// TXT records are not managed
+	records, err := client.FindRecords(ctx, "app.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0] != *created {
+		t.Fatalf("records = %+v, want the created record", records)
+	}
+
+	update := *created
+	update.Content, update.TTL, update.Proxied = "203.0.113.20", 300, false
+	updated, err := client.UpdateRecord(ctx, update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *updated != update {
+		t.Errorf("updated = %+v, want %+v", updated, update)
+	}
+	if stored := standIn.records[created.ID]; stored.Content != "203.0.113.20" || stored.TTL != 300 || stored.Proxied {
+		t.Errorf("stand-in record = %+v, want the update", stored)
+	}
+	if _, err := client.UpdateRecord(ctx, Record{Type: "A", Name: "app.example.com"}); err == nil {
+		t.Error("record without id was updated")
+	}
+
+	if err := client.DeleteRecord(ctx, *updated); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteRecord(ctx, *updated); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("err = %v, want ErrRecordNotFound for a deleted record", err)
+	}
+}
+
+func TestCloudflareErrors(t *testing.T) {
+	_, client := newCloudflareStandIn(t, map[string]string{"example.com": "zone-1"})
+	ctx := context.Background()
+
+	_, err := client.CreateRecord(ctx, Record{Type: "A", Name: "app.example.com", Content: "not-an-ip", TTL: 1})
+	if err == nil || !strings.Contains(err.Error(), "cloudflare api error: Content for A record is invalid. Must be a valid IPv4 address (code 9005)") {
+		t.Errorf("err = %v, want the error of the envelope", err)
+	}
+
+	// the errors of the envelope are returned for any status
+	unauthorized := NewCloudflare("wrong-token")
+	unauthorized.BaseURL = client.BaseURL
+	if _, err := unauthorized.FindRecords(ctx, "app.example.com"); err == nil || !strings.Contains(err.Error(), "Authentication error (code 10000)") {
+		t.Errorf("err = %v, want an authentication error", err)
+	}
+
+	if err := client.request(ctx, http.MethodGet, "/broken/", nil, nil); err == nil || !strings.Contains(err.Error(), "invalid cloudflare response (status 502)") {
+		t.Errorf("err = %v, want an invalid response", err)
+	}
+}
+
+func TestSyncRecord(t *testing.T) {
+	standIn, client := newCloudflareStandIn(t, map[string]string{"example.com": "zone-1"})
+	ctx := context.Background()
+	desired := &dto.DNSRecord_Upsert_Request{Domain: "app.example.com", Type: "A", Content: "203.0.113.10", TTL: 1, Proxied: true}
+
+	created, err := syncRecord(io.Discard, ctx, client, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(standIn.records) != 1 {
+		t.Fatalf("stand-in has %d records, want the created one", len(standIn.records))
+	}
+
+	// the existing record is updated, not duplicated
+	desired.RecordID, desired.Content = created.ID, "203.0.113.20"
+	updated, err := syncRecord(io.Discard, ctx, client, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != created.ID || len(standIn.records) != 1 || standIn.records[created.ID].Content != "203.0.113.20" {
+		t.Errorf("records = %+v, want %s updated", standIn.records, created.ID)
+	}
+
+	cname := &dto.DNSRecord_Upsert_Request{Domain: "app.example.com", Type: "CNAME", Content: "lb.example.net", TTL: 1}
+	if _, err := syncRecord(io.Discard, ctx, client, cname); err == nil || !strings.Contains(err.Error(), "conflicting A record") {
+		t.Errorf("err = %v, want a conflict with the A record", err)
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	standIn, client := newCloudflareStandIn(t, map[string]string{"example.com": "zone-1"})
+	ctx := context.Background()
+	standIn.records["record-1"] = cloudflareRecord{ID: "record-1", Type: "A", Name: "app.example.com", Content: "203.0.113.10", TTL: 1, Proxied: true}
+	stored := &models.DNSRecord{Domain: "app.example.com", RecordID: "record-1", ZoneID: "zone-1", Type: "A", Content: "203.0.113.10", TTL: 1, Proxied: true}
+
+	drift, err := checkDrift(ctx, client, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !drift.InSync() {
+		t.Errorf("drift = %+v, want in sync", drift)
+	}
+
+	// changed in the Cloudflare dashboard
+	standIn.records["record-1"] = cloudflareRecord{ID: "record-1", Type: "A", Name: "app.example.com", Content: "198.51.100.7", TTL: 120, Proxied: false}
+	if drift, err = checkDrift(ctx, client, stored); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"content: 198.51.100.7 (expected 203.0.113.10)", "ttl: 120 (expected 1)", "proxied: false (expected true)"}
+	if strings.Join(drift.Differences, "; ") != strings.Join(want, "; ") {
+		t.Errorf("differences = %v, want %v", drift.Differences, want)
+	}
+
+	delete(standIn.records, "record-1")
+	if drift, err = checkDrift(ctx, client, stored); err != nil {
+		t.Fatal(err)
+	}
+	if !drift.Missing {
+		t.Errorf("drift = %+v, want the record missing", drift)
+	}
+}
@@ -0,0 +1,255 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/satnamSandhu2001/stackjet/pkg/logger"
+)
+
+// Drift describes the difference between the stored record of a domain and the provider
+type Drift struct {
+	Domain      string
+	Missing     bool
+	Differences []string
+}
+
+// InSync reports whether the provider record matches the stored record
+func (d *Drift) InSync() bool {
+	return !d.Missing && len(d.Differences) == 0
+}
+
+// SyncDomain creates or updates the dns record of a domain attached to a stack.
+// Empty fields of opts fall back to the stored record of the domain and then to the config defaults.
+func SyncDomain(w io.Writer, ctx context.Context, service services.StackService, secrets services.SecretService, opts *dto.DNSRecord_Sync_Request) error {
+	opts.Domain = strings.ToLower(strings.TrimSpace(opts.Domain))
+	config, err := service.GetNginxConfigByDomain(ctx, opts.Domain)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		return fmt.Errorf("domain %s is not attached to any stack", opts.Domain)
+	}
+
+	stored, err := service.GetDNSRecordByDomain(ctx, opts.Domain)
+	if err != nil {
+		return err
+	}
+	desired, err := desiredRecord(opts, stored)
+	if err != nil {
+		return err
+	}
+
+	provider, err := NewProvider(ctx, secrets, desired.Provider)
+	if err != nil {
+		return err
+	}
+
+	logger.EmitLog(w, fmt.Sprintf("🌍 Syncing %s record %s -> %s via %s...", desired.Type, desired.Domain, desired.Content, provider.Name()))
+	synced, err := syncRecord(w, ctx, provider, desired)
+	if err != nil {
+		return err
+	}
+
+	desired.ZoneID, desired.RecordID = synced.ZoneID, synced.ID
+	if err := service.UpsertDNSRecord(ctx, desired); err != nil {
+		return err
+	}
+	logger.EmitLog(w, fmt.Sprintf("✅ DNS record for %s synced", desired.Domain))
+	return nil
+}
+
+// syncRecord creates the desired record at the provider, or updates the record of the domain StackJet manages
+func syncRecord(w io.Writer, ctx context.Context, provider Provider, desired *dto.DNSRecord_Upsert_Request) (*Record, error) {
+	records, err := provider.FindRecords(ctx, desired.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	record := Record{
+		Name:    desired.Domain,
+		Type:    desired.Type,
+		Content: desired.Content,
+		TTL:     desired.TTL,
+		Proxied: desired.Proxied,
+	}
+	existing := matchRecord(records, desired)
+	var synced *Record
+	if existing != nil {
+		record.ID, record.ZoneID = existing.ID, existing.ZoneID
+		if recordEquals(*existing, record) {
+			logger.EmitLog(w, "✅ DNS record already up to date")
+			synced = existing
+		} else if synced, err = provider.UpdateRecord(ctx, record); err != nil {
+			return nil, err
+		}
+	} else {
+		// CNAME records can't coexist with other records of the same name
+		for _, r := range records {
+			if r.Type == "CNAME" || desired.Type == "CNAME" {
+				return nil, fmt.Errorf("conflicting %s record exists for %s, remove it first", r.Type, desired.Domain)
+			}
+		}
+		if synced, err = provider.CreateRecord(ctx, record); err != nil {
+			return nil, err
+		}
+	}
+	return synced, nil
+}
+
+// CheckDrift compares the stored record of a domain with the record at the provider
+func CheckDrift(ctx context.Context, service services.StackService, secrets services.SecretService, stored *models.DNSRecord) (*Drift, error) {
+	provider, err := NewProvider(ctx, secrets, stored.Provider)
+	if err != nil {
+		return nil, err
+	}
+	return checkDrift(ctx, provider, stored)
+}
+
+// checkDrift compares the stored record of a domain with the record at the provider
+func checkDrift(ctx context.Context, provider Provider, stored *models.DNSRecord) (*Drift, error) {
+	records, err := provider.FindRecords(ctx, stored.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	drift := &Drift{Domain: stored.Domain}
+	actual := matchRecord(records, &dto.DNSRecord_Upsert_Request{RecordID: stored.RecordID, Type: stored.Type})
+	if actual == nil {
+		drift.Missing = true
+		return drift, nil
+	}
+	if actual.Type != stored.Type {
+		drift.Differences = append(drift.Differences, fmt.Sprintf("type: %s (expected %s)", actual.Type, stored.Type))
+	}
+	if actual.Content != stored.Content {
+		drift.Differences = append(drift.Differences, fmt.Sprintf("content: %s (expected %s)", actual.Content, stored.Content))
+	}
+	if actual.TTL != stored.TTL {
+		drift.Differences = append(drift.Differences, fmt.Sprintf("ttl: %d (expected %d)", actual.TTL, stored.TTL))
+	}
+	if actual.Proxied != stored.Proxied {
+		drift.Differences = append(drift.Differences, fmt.Sprintf("proxied: %t (expected %t)", actual.Proxied, stored.Proxied))
+	}
+	return drift, nil
+}
+
+// RemoveDomainRecord deletes the dns record of a domain at the provider and from db.
+// Domains without a synced record are ignored.
+func RemoveDomainRecord(w io.Writer, ctx context.Context, service services.StackService, secrets services.SecretService, domain string) error {
+	stored, err := service.GetDNSRecordByDomain(ctx, domain)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return nil
+	}
+
+	provider, err := NewProvider(ctx, secrets, stored.Provider)
+	if err != nil {
+		return err
+	}
+	logger.EmitLog(w, fmt.Sprintf("🌍 Removing %s record of %s via %s...", stored.Type, domain, provider.Name()))
+	if stored.RecordID != "" {
+		err := provider.DeleteRecord(ctx, Record{ID: stored.RecordID, ZoneID: stored.ZoneID, Name: domain})
+		if err != nil && !errors.Is(err, ErrRecordNotFound) {
+			return err
+		}
+	}
+	return service.DeleteDNSRecord(ctx, domain)
+}
+
+// merges requested values with the stored record and config defaults
+func desiredRecord(opts *dto.DNSRecord_Sync_Request, stored *models.DNSRecord) (*dto.DNSRecord_Upsert_Request, error) {
+	desired := dto.DNSRecord_Upsert_Request{
+		Domain:   opts.Domain,
+		Provider: opts.Provider,
+		Type:     strings.ToUpper(strings.TrimSpace(opts.Type)),
+		Content:  strings.TrimSpace(opts.Content),
+		TTL:      opts.TTL,
+		Proxied:  pkg.Config().DNS_PROXIED,
+	}
+	if opts.Proxied != nil {
+		desired.Proxied = *opts.Proxied
+	} else if stored != nil {
+		desired.Proxied = stored.Proxied
+	}
+	if stored != nil {
+		if desired.Provider == "" {
+			desired.Provider = stored.Provider
+		}
+		if desired.Type == "" {
+			desired.Type = stored.Type
+		}
+		if desired.Content == "" && desired.Type == stored.Type {
+			desired.Content = stored.Content
+		}
+		if desired.TTL == 0 {
+			desired.TTL = stored.TTL
+		}
+		desired.RecordID = stored.RecordID
+		desired.ZoneID = stored.ZoneID
+	}
+	if desired.Provider == "" {
+		desired.Provider = pkg.Config().DNS_PROVIDER
+	}
+	if desired.TTL == 0 {
+		desired.TTL = pkg.Config().DNS_TTL
+	}
+	if desired.Type == "" {
+		desired.Type = "A"
+	}
+
+	switch desired.Type {
+	case "A":
+		if desired.Content == "" {
+			desired.Content = pkg.Config().DNS_IPV4
+		}
+		if ip := net.ParseIP(desired.Content); ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf(`invalid IPv4 address %q. Pass one or set "dns_ipv4" in config`, desired.Content)
+		}
+	case "AAAA":
+		if desired.Content == "" {
+			desired.Content = pkg.Config().DNS_IPV6
+		}
+		if ip := net.ParseIP(desired.Content); ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf(`invalid IPv6 address %q. Pass one or set "dns_ipv6" in config`, desired.Content)
+		}
+	case "CNAME":
+		if desired.Content == "" {
+			return nil, errors.New("CNAME target is required")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported record type %s (A, AAAA or CNAME)", desired.Type)
+	}
+	return &desired, nil
+}
+
+// finds the provider record managed by StackJet, by id first and then by type
+func matchRecord(records []Record, desired *dto.DNSRecord_Upsert_Request) *Record {
+	if desired.RecordID != "" {
+		for i := range records {
+			if records[i].ID == desired.RecordID {
+				return &records[i]
+			}
+		}
+	}
+	for i := range records {
+		if records[i].Type == desired.Type {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
+func recordEquals(a Record, b Record) bool {
+	return a.Type == b.Type && a.Content == b.Content && a.TTL == b.TTL && a.Proxied == b.Proxied
+}
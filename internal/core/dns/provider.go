@@ -0,0 +1,52 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+)
+
+// ErrRecordNotFound is returned by providers when a record does not exist anymore
+var ErrRecordNotFound = errors.New("dns record not found")
+
+// Record is a dns record as known by a provider
+type Record struct {
+	ID      string
+	ZoneID  string
+	Type    string
+	Name    string
+	Content string
+	TTL     int
+	Proxied bool
+}
+
+// Provider manages dns records of a dns hosting service
+type Provider interface {
+	// Name returns the provider name stored with each record
+	Name() string
+	// FindRecords returns the A, AAAA and CNAME records of a host name
+	FindRecords(ctx context.Context, name string) ([]Record, error)
+	CreateRecord(ctx context.Context, record Record) (*Record, error)
+	UpdateRecord(ctx context.Context, record Record) (*Record, error)
+	DeleteRecord(ctx context.Context, record Record) error
+}
+
+// NewProvider returns the provider with the given name using api credentials from the secrets store
+func NewProvider(ctx context.Context, secrets services.SecretService, name string) (Provider, error) {
+	switch name {
+	case CloudflareProviderName:
+		token, err := secrets.GetSecret(ctx, CloudflareTokenSecret)
+		if err != nil {
+			return nil, err
+		}
+		if token == "" {
+			return nil, fmt.Errorf("cloudflare api token not found. Run 'stackjet secret set %s' first", CloudflareTokenSecret)
+		}
+		return NewCloudflare(token), nil
+	case "":
+		return nil, errors.New(`dns provider not configured. Set "dns_provider" in ~/.stackjet/config.json`)
+	}
+	return nil, fmt.Errorf("unsupported dns provider: %s", name)
+}
@@ -0,0 +1,149 @@
+package git
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/satnamSandhu2001/stackjet/pkg/commands"
+	"golang.org/x/crypto/ssh"
+)
+
+// credential helper answering git with the username and password from the (unlogged) environment
+const credentialHelper = `!f() { test "$1" = get && echo "username=${STACKJET_GIT_USERNAME}" && echo "password=${STACKJET_GIT_PASSWORD}"; }; f`
+
+// CredentialsSecretName returns the name of the secret holding the git credentials of a stack
+func CredentialsSecretName(stackUuid string) string {
+	return "git:" + stackUuid
+}
+
+// LoadCredentials returns the git credentials of a stack, or nil if it has none
+func LoadCredentials(ctx context.Context, secrets services.SecretService, stack *models.Stack) (*models.GitCredentials, error) {
+	value, err := secrets.GetSecret(ctx, CredentialsSecretName(stack.Uuid))
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, nil
+	}
+	var creds models.GitCredentials
+	if err := json.Unmarshal([]byte(value), &creds); err != nil {
+		return nil, fmt.Errorf("invalid git credentials of stack %s: %w", stack.Name, err)
+	}
+	return &creds, nil
+}
+
+// SaveCredentials stores the git credentials of a stack encrypted in the secrets store
+func SaveCredentials(ctx context.Context, secrets services.SecretService, stack *models.Stack, creds *models.GitCredentials) error {
+	if creds == nil || (creds.SSHPrivateKey == "" && creds.Password == "") {
+		return secrets.DeleteSecret(ctx, CredentialsSecretName(stack.Uuid))
+	}
+	value, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	return secrets.SetSecret(ctx, CredentialsSecretName(stack.Uuid), string(value))
+}
+
+// GenerateDeployKey creates an ed25519 key pair and returns the OpenSSH private key and the authorized_keys line
+func GenerateDeployKey(comment string) (string, string, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	block, err := ssh.MarshalPrivateKey(privateKey, comment)
+	if err != nil {
+		return "", "", err
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return "", "", err
+	}
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublicKey))) + " " + comment
+	return string(pem.EncodeToMemory(block)), authorizedKey, nil
+}
+
+// PublicKey returns the authorized_keys line of an OpenSSH private key
+func PublicKey(privateKey string) (string, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		return "", fmt.Errorf("invalid deploy key: %w", err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))), nil
+}
+
+// session runs git commands with the credentials of a stack
+type session struct {
+	w         io.Writer
+	ctx       context.Context
+	args      []string
+	env       map[string]string
+	secretEnv map[string]string
+	keyFile   string
+}
+
+// newSession prepares the ssh key file and credential helper of a stack. Close must be called when done.
+func newSession(w io.Writer, ctx context.Context, creds *models.GitCredentials) (*session, error) {
+	// lfs objects are pulled explicitly after checkout instead of by the smudge filter
+	s := &session{w: w, ctx: ctx, env: map[string]string{"GIT_TERMINAL_PROMPT": "0", "GIT_LFS_SKIP_SMUDGE": "1"}, secretEnv: map[string]string{}}
+	if creds == nil {
+		return s, nil
+	}
+
+	if creds.SSHPrivateKey != "" {
+		// the key is only written to disk while git runs
+		file, err := os.CreateTemp("", "stackjet-key-*")
+		if err != nil {
+			return nil, err
+		}
+		s.keyFile = file.Name()
+		if err := file.Chmod(0600); err != nil {
+			file.Close()
+			s.Close()
+			return nil, err
+		}
+		if _, err := file.WriteString(creds.SSHPrivateKey); err != nil {
+			file.Close()
+			s.Close()
+			return nil, err
+		}
+		file.Close()
+		s.env["GIT_SSH_COMMAND"] = fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new", s.keyFile)
+	}
+
+	if creds.Password != "" {
+		s.args = []string{"-c", "credential.helper=", "-c", "credential.helper=" + credentialHelper}
+		s.secretEnv["STACKJET_GIT_USERNAME"] = creds.Username
+		s.secretEnv["STACKJET_GIT_PASSWORD"] = creds.Password
+	}
+	return s, nil
+}
+
+// run runs a git command in the current directory. It is killed after the git step timeout or when the session context is cancelled.
+func (s *session) run(args ...string) (string, error) {
+	return commands.RunCommand(commands.RunCommandArgs{
+		Logger:    s.w,
+		Name:      "git",
+		Args:      append(append([]string{}, s.args...), args...),
+		Env:       s.env,
+		SecretEnv: s.secretEnv,
+		Ctx:       s.ctx,
+		Timeout:   pkg.Config().StepTimeout("git"),
+	})
+}
+
+// Close removes the temporary key file
+func (s *session) Close() {
+	if s.keyFile != "" {
+		os.Remove(s.keyFile)
+	}
+}
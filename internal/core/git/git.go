@@ -4,57 +4,88 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
 	"github.com/satnamSandhu2001/stackjet/internal/services"
 	"github.com/satnamSandhu2001/stackjet/pkg/commands"
 	"github.com/satnamSandhu2001/stackjet/pkg/logger"
 )
 
 // Verifies access to git repo
-func VerifyAccess(w io.Writer, repoUrl string) error {
+func VerifyAccess(w io.Writer, ctx context.Context, repoUrl string, creds *models.GitCredentials) error {
 	repoUrl = strings.TrimSpace(repoUrl)
+	git, err := newSession(w, ctx, creds)
+	if err != nil {
+		return err
+	}
+	defer git.Close()
+
 	logger.EmitLog(w, "")
 	logger.EmitLog(w, "📡 Verifying Git Repo Access ...")
-	if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "git", Args: []string{"ls-remote", repoUrl}, Env: map[string]string{"GIT_TERMINAL_PROMPT": "0"}}); err != nil {
+	if _, err := git.run("ls-remote", "--end-of-options", repoUrl); err != nil {
 		return err
 	}
 	return nil
 }
 
-func CloneRepo(w io.Writer, gitRepo string, gitBranch string, gitRemote string) error {
+func CloneRepo(w io.Writer, ctx context.Context, gitRepo string, gitBranch string, gitRemote string, options models.GitOptions, creds *models.GitCredentials) error {
 	// trim whitespace from input strings
 	gitRepo = strings.TrimSpace(gitRepo)
 	gitBranch = strings.TrimSpace(gitBranch)
 	gitRemote = strings.TrimSpace(gitRemote)
+	git, err := newSession(w, ctx, creds)
+	if err != nil {
+		return err
+	}
+	defer git.Close()
 
 	// clone git repo
 	logger.EmitLog(w, "")
 	logger.EmitLog(w, "📡 Cloning Repository ...")
-	if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "git", Args: []string{"clone", "-b", gitBranch, "-o", gitRemote, gitRepo, "."}}); err != nil {
+	args := []string{"clone", "-b", gitBranch, "-o", gitRemote}
+	if options.Depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", options.Depth))
+	}
+	if options.PartialClone {
+		args = append(args, "--filter=blob:none")
+	}
+	if _, err := git.timed("Clone", append(args, "--end-of-options", gitRepo, ".")...); err != nil {
 		return err
 	}
 
 	// switch to specified branch
 
 	logger.EmitLog(w, fmt.Sprintf("⛓ Changing git branch to %v \n", gitBranch))
-	if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "git", Args: []string{"checkout", gitBranch}}); err != nil {
+	if _, err := git.run("checkout", gitBranch); err != nil {
 		return err
 	}
 
-	return nil
+	return syncWorkingTree(git, gitRemote, options)
 }
 
-// Updates the local git-repo to specific version from remote-repo and returns error if failed
-func UpdateRepo(w io.Writer, ctx context.Context, service services.StackService, deploymentID int64, gitBranch string, gitRemote string, gitReset bool, gitHash string) error {
+// Updates the local git-repo to specific version from remote-repo and returns error if failed.
+// Names and hashes of the request follow --end-of-options. reset and checkout don't accept it, they
+// get branch and remote names checked by dto.ValidGitRef or hashes resolved by rev-parse.
+func UpdateRepo(w io.Writer, ctx context.Context, service services.StackService, deploymentID int64, gitBranch string, gitRemote string, gitReset bool, gitHash string, gitRef string, verify bool, options models.GitOptions, creds *models.GitCredentials) error {
 	// trim whitespace from input strings
 	gitBranch = strings.TrimSpace(gitBranch)
 	gitRemote = strings.TrimSpace(gitRemote)
 	gitHash = strings.TrimSpace(gitHash)
+	gitRef = strings.TrimSpace(gitRef)
+	git, err := newSession(w, ctx, creds)
+	if err != nil {
+		return err
+	}
+	defer git.Close()
+	shallow := options.Depth > 0
+	depth := fmt.Sprintf("--depth=%d", options.Depth)
 
 	// get current active branch
-	activeBranch, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "git", Args: []string{"branch", "--show-current"}})
+	activeBranch, err := git.run("branch", "--show-current")
 	if err != nil {
 		return err
 	}
@@ -63,7 +94,16 @@ func UpdateRepo(w io.Writer, ctx context.Context, service services.StackService,
 	if strings.TrimSpace(activeBranch) != gitBranch {
 		logger.EmitLog(w, "")
 		logger.EmitLog(w, fmt.Sprintf("⛓ Changing git branch to %v \n", gitBranch))
-		if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "git", Args: []string{"checkout", gitBranch}}); err != nil {
+		if shallow {
+			// shallow clones only track the cloned branch
+			if _, err := git.run("remote", "set-branches", "--add", "--end-of-options", gitRemote, gitBranch); err != nil {
+				return err
+			}
+			if _, err := git.timed("Fetch branch", "fetch", depth, "--end-of-options", gitRemote, gitBranch); err != nil {
+				return err
+			}
+		}
+		if _, err := git.run("checkout", gitBranch); err != nil {
 			return err
 		}
 	}
@@ -71,32 +111,88 @@ func UpdateRepo(w io.Writer, ctx context.Context, service services.StackService,
 	// fetch git status
 	logger.EmitLog(w, "")
 	logger.EmitLog(w, "🖇 Checking Git Status")
-	if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "git", Args: []string{"fetch", "--all", "--tags"}}); err != nil {
+	if shallow {
+		if _, err := git.timed("Fetch", "fetch", depth, "--tags", "--end-of-options", gitRemote); err != nil {
+			return err
+		}
+	} else if _, err := git.timed("Fetch", "fetch", "--all", "--tags"); err != nil {
 		return err
 	}
 
-	// reset to specific commit if gitHash is provided
-	if gitHash != "" {
-		logger.EmitLog(w, "🎯 Resetting git to specific commit...")
-		if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "git", Args: []string{"reset", "--hard", gitHash}}); err != nil {
+	// deploy a branch, tag or commit other than the head of the stack branch
+	if gitRef != "" {
+		if shallow {
+			// shallow clones only know the fetched branch and tags. Errors are ignored,
+			// servers may refuse to fetch commits by hash and the ref may be known already.
+			git.timed("Fetch ref", "fetch", depth, "--end-of-options", gitRemote, strings.TrimPrefix(gitRef, "refs/heads/"))
+		}
+		hash, refName, err := git.resolveRef(gitRemote, gitRef, shallow)
+		if err != nil {
 			return err
 		}
-		// update hash
-		if err := updateHashToDB(w, ctx, service, deploymentID); err != nil {
+		logger.EmitLog(w, fmt.Sprintf("🎯 Resolved %s to %s", gitRef, hash))
+		if verify {
+			target := refName
+			if !strings.HasPrefix(refName, "refs/tags/") {
+				target = hash
+			}
+			if err := git.verifySignature(target); err != nil {
+				return err
+			}
+		}
+		if refName != "" {
+			if _, err := service.UpdateDeployment(ctx, &dto.Deployment_Update_Request{ID: deploymentID, Ref: refName}); err != nil {
+				return err
+			}
+		}
+		logger.EmitLog(w, fmt.Sprintf("🎯 Resetting git to %s...", gitRef))
+		if _, err := git.timed("Reset", "reset", "--hard", hash); err != nil {
 			return err
 		}
-		return nil // no need to pull latest
+		return finishUpdate(w, ctx, service, deploymentID, git, gitRemote, options)
+	}
+
+	// verify the commit before checking it out. The branch is resolved to a commit once and that
+	// commit is deployed, a push landing between verification and reset is never checked out.
+	if verify {
+		if gitHash == "" {
+			if gitHash, err = query("rev-parse", "--verify", "--quiet", "--end-of-options", gitRemote+"/"+gitBranch+"^{commit}"); err != nil {
+				return fmt.Errorf("branch %s not found on remote %s", gitBranch, gitRemote)
+			}
+			logger.EmitLog(w, fmt.Sprintf("🎯 Resolved %s/%s to %s", gitRemote, gitBranch, gitHash))
+		} else if shallow {
+			if _, err := git.timed("Fetch commit", "fetch", depth, "--end-of-options", gitRemote, gitHash); err != nil {
+				return err
+			}
+		}
+		if err := git.verifySignature(gitHash); err != nil {
+			return err
+		}
+	}
+
+	// reset to specific commit if gitHash is provided or the verified commit of the branch
+	if gitHash != "" {
+		if shallow && !verify {
+			if _, err := git.timed("Fetch commit", "fetch", depth, "--end-of-options", gitRemote, gitHash); err != nil {
+				return err
+			}
+		}
+		logger.EmitLog(w, "🎯 Resetting git to specific commit...")
+		if _, err := git.timed("Reset", "reset", "--hard", gitHash); err != nil {
+			return err
+		}
+		return finishUpdate(w, ctx, service, deploymentID, git, gitRemote, options) // no need to pull latest
 
 	} else if gitReset { // force reset git state if gitReset is true
 		logger.EmitLog(w, "")
 		logger.EmitLog(w, "🧹 Forcing clean state with git reset...")
-		if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "git", Args: []string{"reset", "--hard", "origin/" + gitBranch}}); err != nil {
+		if _, err := git.timed("Reset", "reset", "--hard", gitRemote+"/"+gitBranch); err != nil {
 			return err
 		}
 	}
 
 	// check if there are any commits behind the remote branch
-	gitStatus, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "git", Args: []string{"rev-list", "--count", fmt.Sprintf("HEAD...%s/%s", gitRemote, gitBranch)}})
+	gitStatus, err := git.run("rev-list", "--count", "--end-of-options", fmt.Sprintf("HEAD...%s/%s", gitRemote, gitBranch))
 	if err != nil {
 		return err
 	}
@@ -104,27 +200,98 @@ func UpdateRepo(w io.Writer, ctx context.Context, service services.StackService,
 	if strings.TrimSpace(gitStatus) == "0" {
 		logger.EmitLog(w, "")
 		logger.EmitLog(w, "✅ Repo Already up to date.")
-		// update hash
-		if err := updateHashToDB(w, ctx, service, deploymentID); err != nil {
-			return err
-		}
-		return nil
+		return finishUpdate(w, ctx, service, deploymentID, git, gitRemote, options)
 	}
 
 	// pull latest changes from remote branch
 	logger.EmitLog(w, "")
 	logger.EmitLog(w, "🔄 Pulling latest changes...")
-	if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "git", Args: []string{"pull", gitRemote, gitBranch}}); err != nil {
+	if shallow {
+		// the fetched history may not reach the current commit, so a merge is not possible
+		if _, err := git.timed("Reset", "reset", "--hard", gitRemote+"/"+gitBranch); err != nil {
+			return err
+		}
+	} else if _, err := git.timed("Pull", "pull", "--end-of-options", gitRemote, gitBranch); err != nil {
 		return err
 	}
-	// update hash
-	if err := updateHashToDB(w, ctx, service, deploymentID); err != nil {
+
+	return finishUpdate(w, ctx, service, deploymentID, git, gitRemote, options)
+}
+
+// syncs submodules and lfs objects, then saves the current hash
+func finishUpdate(w io.Writer, ctx context.Context, service services.StackService, deploymentID int64, git *session, gitRemote string, options models.GitOptions) error {
+	if err := syncWorkingTree(git, gitRemote, options); err != nil {
 		return err
 	}
+	// update hash
+	return updateHashToDB(w, ctx, service, deploymentID)
+}
 
+// updates submodules and pulls lfs objects of the checked out commit
+func syncWorkingTree(git *session, gitRemote string, options models.GitOptions) error {
+	if options.Submodules {
+		logger.EmitLog(git.w, "")
+		logger.EmitLog(git.w, "📦 Updating submodules...")
+		if _, err := git.run("submodule", "sync", "--recursive"); err != nil {
+			return err
+		}
+		args := []string{"submodule", "update", "--init", "--recursive"}
+		if options.Depth > 0 {
+			args = append(args, fmt.Sprintf("--depth=%d", options.Depth))
+		}
+		if _, err := git.timed("Submodule update", args...); err != nil {
+			return err
+		}
+	}
+
+	if usesLFS() {
+		logger.EmitLog(git.w, "")
+		logger.EmitLog(git.w, "📦 Pulling Git LFS objects...")
+		if _, err := git.run("lfs", "install", "--local"); err != nil {
+			return fmt.Errorf("git lfs is required by this repo but not available: %w", err)
+		}
+		if _, err := git.timed("LFS pull", "lfs", "pull", gitRemote); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// reports whether the .gitattributes of the repo tracks files with lfs
+func usesLFS() bool {
+	attributes, err := os.ReadFile(".gitattributes")
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(attributes), "filter=lfs")
+}
+
+// HeadCommit returns the hash of the checked out commit
+func HeadCommit() (string, error) {
+	return query("rev-parse", "HEAD")
+}
+
+// ChangedFiles returns the files matching the pathspecs that changed between two commits
+func ChangedFiles(w io.Writer, fromHash string, toHash string, paths []string) ([]string, error) {
+	args := append([]string{"diff", "--name-only", "--end-of-options", strings.TrimSpace(fromHash), strings.TrimSpace(toHash), "--"}, paths...)
+	out, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "git", Args: args})
+	if err != nil {
+		return nil, err
+	}
+	return lines(out), nil
+}
+
+// runs a git command and logs how long it took
+func (s *session) timed(step string, args ...string) (string, error) {
+	start := time.Now()
+	out, err := s.run(args...)
+	if err != nil {
+		return out, err
+	}
+	logger.EmitLog(s.w, fmt.Sprintf("⏱ %s took %s", step, time.Since(start).Round(time.Millisecond)))
+	return out, nil
+}
+
 // Fetch current hash from local repo and updates it to DB
 func updateHashToDB(w io.Writer, ctx context.Context, service services.StackService, deploymentID int64) error {
 	currentHash, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "git", Args: []string{"rev-parse", "HEAD"}})
@@ -0,0 +1,118 @@
+package git
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+)
+
+// gitIn runs git in a directory and returns its trimmed output
+func gitIn(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// newDeployment returns an upstream repo with one commit, a clone of it as the working
+// directory and the id of a deployment to record the update in
+func newDeployment(t *testing.T) (string, string, int64) {
+	t.Helper()
+	upstream := filepath.Join(t.TempDir(), "upstream")
+	gitIn(t, t.TempDir(), "init", "-q", upstream)
+	gitIn(t, upstream, "commit", "-q", "--allow-empty", "-S", "-m", "initial")
+
+	app := filepath.Join(t.TempDir(), "app")
+	gitIn(t, t.TempDir(), "clone", "-q", upstream, app)
+	t.Chdir(app)
+
+	result, err := testDB.Exec(`INSERT INTO stacks (uuid, name, directory, type, repo_url, port, commands) VALUES (?, ?, ?, 'nodejs', ?, 3000, ?)`,
+		t.Name(), t.Name(), app, upstream, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stackID, _ := result.LastInsertId()
+	result, err = testDB.Exec(`INSERT INTO deployments (stack_id, status) VALUES (?, ?)`, stackID, models.DEPLOYMENT_STATUS_IN_PROGRESS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deploymentID, _ := result.LastInsertId()
+	return upstream, app, deploymentID
+}
+
+func updateRepo(deploymentID int64, gitHash string, verify bool) error {
+	return UpdateRepo(io.Discard, context.Background(), *services.NewStackService(testDB), deploymentID, "main", "origin", false, gitHash, "", verify, models.GitOptions{}, nil)
+}
+
+func TestUpdateRepoDeploysVerifiedBranchCommit(t *testing.T) {
+	upstream, app, deploymentID := newDeployment(t)
+	gitIn(t, upstream, "commit", "-q", "--allow-empty", "-S", "-m", "signed")
+	signed := gitIn(t, upstream, "rev-parse", "HEAD")
+
+	// an unsigned commit lands on the remote while the signed one is verified
+	t.Setenv("STACKJET_TEST_PUSH_TO", upstream)
+	if err := updateRepo(deploymentID, "", true); err != nil {
+		t.Fatal(err)
+	}
+	if head := gitIn(t, app, "rev-parse", "HEAD"); head != signed {
+		t.Fatalf("HEAD = %s, want the verified commit %s", head, signed)
+	}
+	if pushed := gitIn(t, upstream, "rev-parse", "HEAD"); pushed == signed {
+		t.Fatal("nothing was pushed during verification")
+	}
+	var commitHash string
+	if err := testDB.Get(&commitHash, `SELECT commit_hash FROM deployments WHERE id = ?`, deploymentID); err != nil || commitHash != signed {
+		t.Fatalf("recorded hash = %q %v, want %s", commitHash, err, signed)
+	}
+}
+
+func TestUpdateRepoRejectsUnsignedBranch(t *testing.T) {
+	upstream, app, deploymentID := newDeployment(t)
+	before := gitIn(t, app, "rev-parse", "HEAD")
+	gitIn(t, upstream, "commit", "-q", "--allow-empty", "-m", "unsigned")
+
+	if err := updateRepo(deploymentID, "", true); err == nil {
+		t.Fatal("an unsigned commit was deployed")
+	}
+	if head := gitIn(t, app, "rev-parse", "HEAD"); head != before {
+		t.Fatalf("HEAD moved to %s after a failed verification", head)
+	}
+}
+
+func TestUpdateRepoVerifiesGivenHash(t *testing.T) {
+	upstream, app, deploymentID := newDeployment(t)
+	gitIn(t, upstream, "commit", "-q", "--allow-empty", "-S", "-m", "signed")
+	signed := gitIn(t, upstream, "rev-parse", "HEAD")
+	gitIn(t, upstream, "commit", "-q", "--allow-empty", "-m", "unsigned")
+	unsigned := gitIn(t, upstream, "rev-parse", "HEAD")
+
+	if err := updateRepo(deploymentID, unsigned, true); err == nil {
+		t.Fatal("an unsigned commit was deployed")
+	}
+	if err := updateRepo(deploymentID, signed, true); err != nil {
+		t.Fatal(err)
+	}
+	if head := gitIn(t, app, "rev-parse", "HEAD"); head != signed {
+		t.Fatalf("HEAD = %s, want %s", head, signed)
+	}
+}
+
+func TestUpdateRepoWithoutVerificationPullsBranch(t *testing.T) {
+	upstream, app, deploymentID := newDeployment(t)
+	gitIn(t, upstream, "commit", "-q", "--allow-empty", "-m", "unsigned")
+
+	if err := updateRepo(deploymentID, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if head, want := gitIn(t, app, "rev-parse", "HEAD"), gitIn(t, upstream, "rev-parse", "HEAD"); head != want {
+		t.Fatalf("HEAD = %s, want the branch head %s", head, want)
+	}
+}
@@ -0,0 +1,93 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/satnamSandhu2001/stackjet/database"
+)
+
+// testDB is the database of a StackJet initialized in a temporary home for the tests
+var testDB *sqlx.DB
+
+// testHome is the temporary home, its .gitconfig signs commits with an allowed ssh key
+var testHome string
+
+// fakeSSHKeygen commits to the repo in $STACKJET_TEST_PUSH_TO before verifying, like a push
+// landing on the remote while a deployment verifies the branch
+const fakeSSHKeygen = `#!/bin/sh
+if [ -n "$STACKJET_TEST_PUSH_TO" ]; then
+	env -u GIT_DIR -u GIT_WORK_TREE -u GIT_INDEX_FILE git -C "$STACKJET_TEST_PUSH_TO" commit -q --allow-empty -m "pushed during verification"
+fi
+exec %s "$@"
+`
+
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "stackjet-git")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	code := func() int {
+		defer os.RemoveAll(home)
+		testHome = home
+		dir := filepath.Join(home, ".stackjet")
+		bin := filepath.Join(home, "bin")
+		for _, d := range []string{dir, bin} {
+			if err := os.Mkdir(d, 0700); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+		}
+
+		sshKeygen, err := exec.LookPath("ssh-keygen")
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if err := os.WriteFile(filepath.Join(bin, "ssh-keygen"), []byte(fmt.Sprintf(fakeSSHKeygen, sshKeygen)), 0700); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		key := filepath.Join(home, "signing-key")
+		if out, err := exec.Command(sshKeygen, "-q", "-t", "ed25519", "-N", "", "-C", "dev@example.com", "-f", key).CombinedOutput(); err != nil {
+			fmt.Println(string(out), err)
+			return 1
+		}
+		publicKey, err := os.ReadFile(key + ".pub")
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+		os.Setenv("HOME", home)
+		os.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+		gitconfig := fmt.Sprintf("[user]\n\tname = Dev\n\temail = dev@example.com\n\tsigningkey = %s\n[gpg]\n\tformat = ssh\n[init]\n\tdefaultBranch = main\n", key)
+		files := map[string]string{
+			filepath.Join(home, ".gitconfig"):     gitconfig,
+			filepath.Join(dir, "init.lock"):       "",
+			filepath.Join(dir, "jwt.token"):       "test-signing-key",
+			filepath.Join(dir, "config.json"):     `{"git_remote": "origin", "git_branch": "main"}`,
+			filepath.Join(dir, "allowed_signers"): "dev@example.com " + string(publicKey),
+		}
+		for name, content := range files {
+			if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+		}
+		if err := database.RunInitSQL(); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		testDB = database.Connect()
+		defer testDB.Close()
+		return m.Run()
+	}()
+	os.Exit(code)
+}
@@ -0,0 +1,158 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/pkg/commands"
+	"github.com/satnamSandhu2001/stackjet/pkg/logger"
+)
+
+// Plan describes what an update of the local repo would change
+type Plan struct {
+	Current string
+	Target  string
+	// TargetRef is the full ref name of the target, empty for commits
+	TargetRef    string
+	Behind       int
+	Commits      []string
+	ChangedFiles []string
+	// Steps are the git commands the update would run
+	Steps []string
+	// SignatureError is set when verification was requested and failed
+	SignatureError error
+}
+
+// PlanUpdate fetches the remote without changing the working tree and returns what UpdateRepo would do
+func PlanUpdate(w io.Writer, ctx context.Context, gitBranch string, gitRemote string, gitReset bool, gitHash string, gitRef string, verify bool, options models.GitOptions, creds *models.GitCredentials) (*Plan, error) {
+	gitBranch = strings.TrimSpace(gitBranch)
+	gitRemote = strings.TrimSpace(gitRemote)
+	gitHash = strings.TrimSpace(gitHash)
+	gitRef = strings.TrimSpace(gitRef)
+	git, err := newSession(w, ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+	defer git.Close()
+	shallow := options.Depth > 0
+	depth := fmt.Sprintf("--depth=%d", options.Depth)
+
+	logger.EmitLog(w, "")
+	logger.EmitLog(w, "🖇 Fetching remote (dry run)...")
+	if shallow {
+		if _, err := git.timed("Fetch", "fetch", depth, "--tags", "--end-of-options", gitRemote); err != nil {
+			return nil, err
+		}
+	} else if _, err := git.timed("Fetch", "fetch", "--all", "--tags"); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	if plan.Current, err = query("rev-parse", "HEAD"); err != nil {
+		return nil, err
+	}
+	activeBranch, err := query("branch", "--show-current")
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case gitRef != "":
+		if shallow {
+			// errors are ignored like in UpdateRepo
+			git.run("fetch", depth, "--end-of-options", gitRemote, strings.TrimPrefix(gitRef, "refs/heads/"))
+		}
+		if plan.Target, plan.TargetRef, err = git.resolveRef(gitRemote, gitRef, shallow); err != nil {
+			return nil, err
+		}
+		plan.Steps = append(plan.Steps, "git reset --hard "+plan.Target)
+	case gitHash != "":
+		if shallow {
+			git.run("fetch", depth, "--end-of-options", gitRemote, gitHash)
+		}
+		if plan.Target, err = query("rev-parse", "--verify", "--end-of-options", gitHash+"^{commit}"); err != nil {
+			return nil, fmt.Errorf("commit %s not found in repo", gitHash)
+		}
+		plan.Steps = append(plan.Steps, "git reset --hard "+gitHash)
+	default:
+		target := gitRemote + "/" + gitBranch
+		if activeBranch != gitBranch {
+			plan.Steps = append(plan.Steps, "git checkout "+gitBranch)
+			if shallow {
+				if _, err := git.run("fetch", depth, "--end-of-options", gitRemote, gitBranch); err != nil {
+					return nil, err
+				}
+				target = "FETCH_HEAD"
+			}
+		}
+		if plan.Target, err = query("rev-parse", "--verify", "--end-of-options", target+"^{commit}"); err != nil {
+			return nil, fmt.Errorf("branch %s not found on remote %s", gitBranch, gitRemote)
+		}
+		plan.TargetRef = "refs/heads/" + gitBranch
+		diverged, err := query("rev-list", "--count", "HEAD..."+plan.Target)
+		if err != nil {
+			return nil, err
+		}
+		// a reset to the remote branch leaves nothing to pull
+		if verify {
+			// the verified commit is checked out, the branch is never pulled
+			plan.Steps = append(plan.Steps, "git reset --hard "+plan.Target)
+		} else if gitReset || (shallow && diverged != "0") {
+			plan.Steps = append(plan.Steps, fmt.Sprintf("git reset --hard %s/%s", gitRemote, gitBranch))
+		} else if diverged != "0" {
+			plan.Steps = append(plan.Steps, fmt.Sprintf("git pull %s %s", gitRemote, gitBranch))
+		}
+	}
+	if options.Submodules {
+		plan.Steps = append(plan.Steps, "git submodule sync --recursive", "git submodule update --init --recursive")
+	}
+	if usesLFS() {
+		plan.Steps = append(plan.Steps, "git lfs pull "+gitRemote)
+	}
+
+	if verify {
+		target := plan.Target
+		if strings.HasPrefix(plan.TargetRef, "refs/tags/") {
+			target = plan.TargetRef
+		}
+		plan.SignatureError = git.verifySignature(target)
+	}
+
+	behind, err := query("rev-list", "--count", "HEAD.."+plan.Target)
+	if err != nil {
+		return nil, err
+	}
+	plan.Behind, _ = strconv.Atoi(behind)
+	commits, err := query("log", "--oneline", "--no-decorate", "HEAD.."+plan.Target)
+	if err != nil {
+		return nil, err
+	}
+	plan.Commits = lines(commits)
+	changed, err := query("diff", "--name-only", "HEAD", plan.Target)
+	if err != nil {
+		return nil, err
+	}
+	plan.ChangedFiles = lines(changed)
+
+	return plan, nil
+}
+
+// runs a read-only git command without logging it and returns its trimmed output
+func query(args ...string) (string, error) {
+	out, err := commands.RunCommand(commands.RunCommandArgs{Logger: io.Discard, Name: "git", Args: args})
+	return strings.TrimSpace(out), err
+}
+
+func lines(out string) []string {
+	var result []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
@@ -0,0 +1,104 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/satnamSandhu2001/stackjet/pkg/logger"
+)
+
+// resolveRef resolves a branch, tag or commit to a commit hash and returns it with the full ref name.
+// Short names are tried as branch of the remote first, then as tag and finally as commit.
+// fetched resolves refs that are only known from the last fetch, like branches outside of a shallow clone.
+func (s *session) resolveRef(gitRemote string, ref string, fetched bool) (string, string, error) {
+	var candidates []string
+	switch {
+	case strings.HasPrefix(ref, "refs/heads/"):
+		candidates = []string{gitRemote + "/" + strings.TrimPrefix(ref, "refs/heads/")}
+	case strings.HasPrefix(ref, "refs/"):
+		candidates = []string{ref}
+	default:
+		candidates = []string{gitRemote + "/" + ref, "refs/tags/" + ref, ref}
+	}
+	if fetched {
+		candidates = append(candidates, "FETCH_HEAD")
+	}
+
+	for _, candidate := range candidates {
+		hash, err := query("rev-parse", "--verify", "--quiet", "--end-of-options", candidate+"^{commit}")
+		if err != nil {
+			continue
+		}
+		name := candidate
+		if branch, ok := strings.CutPrefix(candidate, gitRemote+"/"); ok {
+			name = "refs/heads/" + branch
+		} else if candidate == "FETCH_HEAD" {
+			name = ref
+		} else if candidate == ref && !strings.HasPrefix(ref, "refs/") {
+			name = "" // raw commit
+		}
+		return hash, name, nil
+	}
+	return "", "", fmt.Errorf("ref %s not found in repo", ref)
+}
+
+// verifySignature checks that a tag or commit is signed by an allowed signer.
+// SSH signatures are checked against the allowed signers file, GPG signatures against the allowed key fingerprints.
+// Lightweight tags are verified by the signature of their commit.
+func (s *session) verifySignature(ref string) error {
+	config := pkg.Config()
+	_, statErr := os.Stat(config.GIT_ALLOWED_SIGNERS)
+	if statErr != nil && len(config.GIT_ALLOWED_GPG_KEYS) == 0 {
+		return fmt.Errorf("no allowed signers configured. Add signers to %s or set \"git_allowed_gpg_keys\" in config", config.GIT_ALLOWED_SIGNERS)
+	}
+
+	command := "verify-commit"
+	if strings.HasPrefix(ref, "refs/tags/") {
+		objectType, err := s.run("cat-file", "-t", "--end-of-options", ref)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(objectType) == "tag" {
+			command = "verify-tag"
+		}
+	}
+
+	logger.EmitLog(s.w, "")
+	logger.EmitLog(s.w, fmt.Sprintf("🔏 Verifying signature of %s...", ref))
+	out, err := s.run("-c", "gpg.ssh.allowedSignersFile="+config.GIT_ALLOWED_SIGNERS, command, "--raw", "--end-of-options", ref)
+	if err != nil {
+		return fmt.Errorf("signature verification of %s failed: %w", ref, err)
+	}
+
+	// ssh signatures are checked against the allowed signers file by git itself
+	if fingerprint := gpgFingerprint(out); fingerprint != "" {
+		// the config holds full fingerprints only, checked when it is loaded
+		allowed := slices.ContainsFunc(config.GIT_ALLOWED_GPG_KEYS, func(key string) bool {
+			return strings.EqualFold(fingerprint, key)
+		})
+		if !allowed {
+			return fmt.Errorf("%s is signed by gpg key %s which is not allowed", ref, fingerprint)
+		}
+	} else if statErr != nil {
+		return errors.New("ssh signatures can't be verified without an allowed signers file")
+	}
+
+	logger.EmitLog(s.w, "✅ Signature verified")
+	return nil
+}
+
+// returns the primary key fingerprint from the gpg status output of a valid signature
+func gpgFingerprint(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == "[GNUPG:]" && fields[1] == "VALIDSIG" {
+			// the last field is the primary key fingerprint
+			return strings.ToUpper(fields[len(fields)-1])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package git
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/satnamSandhu2001/stackjet/pkg"
+)
+
+// newGPGKey creates a signing key in a temporary GNUPGHOME and returns its fingerprint
+func newGPGKey(t *testing.T) string {
+	t.Helper()
+	gnupgHome, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GNUPGHOME", gnupgHome)
+	t.Cleanup(func() { exec.Command("gpgconf", "--kill", "gpg-agent").Run() })
+	if out, err := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "Dev <dev@example.com>", "ed25519", "sign", "never").CombinedOutput(); err != nil {
+		t.Skipf("gpg can't generate keys here: %v\n%s", err, out)
+	}
+	out, err := exec.Command("gpg", "--batch", "--with-colons", "--list-secret-keys").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Split(line, ":"); fields[0] == "fpr" {
+			return fields[9]
+		}
+	}
+	t.Fatal("fingerprint of the generated key not found")
+	return ""
+}
+
+func TestVerifySignatureGPGFingerprint(t *testing.T) {
+	fingerprint := newGPGKey(t)
+	_, app, _ := newDeployment(t)
+	gitIn(t, app, "-c", "gpg.format=openpgp", "-c", "user.signingkey="+fingerprint, "commit", "-q", "--allow-empty", "-S", "-m", "gpg signed")
+
+	config := pkg.Config()
+	allowed := config.GIT_ALLOWED_GPG_KEYS
+	t.Cleanup(func() { config.GIT_ALLOWED_GPG_KEYS = allowed })
+	git, err := newSession(io.Discard, context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer git.Close()
+
+	tests := []struct {
+		name    string
+		keys    []string
+		allowed bool
+	}{
+		{"exact fingerprint", []string{fingerprint}, true},
+		{"lower case fingerprint", []string{strings.ToLower(fingerprint)}, true},
+		{"other key with the same key id", []string{strings.Repeat("0", 24) + fingerprint[24:]}, false},
+		{"no gpg keys", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.GIT_ALLOWED_GPG_KEYS = tt.keys
+			err := git.verifySignature("HEAD")
+			if tt.allowed != (err == nil) {
+				t.Fatalf("verifySignature = %v, want allowed %v", err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestGPGFingerprint(t *testing.T) {
+	out := "[GNUPG:] NEWSIG\n[GNUPG:] GOODSIG 89ABCDEF01234567 Dev <dev@example.com>\n" +
+		"[GNUPG:] VALIDSIG 1111111111111111111111111111111111111111 2026-10-19 1792368000 0 4 0 22 8 00 0123456789abcdef0123456789abcdef01234567\n"
+	if got := gpgFingerprint(out); got != "0123456789ABCDEF0123456789ABCDEF01234567" {
+		t.Fatalf("gpgFingerprint = %q, want the primary key fingerprint", got)
+	}
+	if got := gpgFingerprint("[GNUPG:] BADSIG 89ABCDEF01234567 Dev\n"); got != "" {
+		t.Fatalf("gpgFingerprint of a bad signature = %q, want none", got)
+	}
+}
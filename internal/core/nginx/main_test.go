@@ -0,0 +1,77 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/satnamSandhu2001/stackjet/database"
+)
+
+// testDB is the database of a StackJet initialized in a temporary home for the tests
+var testDB *sqlx.DB
+
+// testBin holds the fake nginx, calls is where it appends its arguments
+var testBin string
+
+// fakeNginx records every command. nginx -t fails while a fail-test file is next to it.
+const fakeNginx = `#!/bin/sh
+dir="$(dirname "$0")"
+echo "$@" >> "$dir/calls"
+if [ "$1" = "-t" ] && [ -f "$dir/fail-test" ]; then
+	echo "nginx: [emerg] unexpected \"}\"" >&2
+	exit 1
+fi
+`
+
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "stackjet-nginx")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	code := func() int {
+		defer os.RemoveAll(home)
+		testBin = filepath.Join(home, "bin")
+		for _, dir := range []string{testBin, filepath.Join(home, "sites-available"), filepath.Join(home, "sites-enabled")} {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+		}
+		if err := os.WriteFile(filepath.Join(testBin, "nginx"), []byte(fakeNginx), 0700); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		os.Setenv("PATH", testBin+string(os.PathListSeparator)+os.Getenv("PATH"))
+		os.Setenv("HOME", home)
+
+		config := fmt.Sprintf(`{
+	"acme_webroot": %q,
+	"nginx_sites_available": %q,
+	"nginx_sites_enabled": %q
+}`, "/var/www/acme", filepath.Join(home, "sites-available"), filepath.Join(home, "sites-enabled"))
+		dir := filepath.Join(home, ".stackjet")
+		files := map[string]string{"init.lock": "", "jwt.token": "test-signing-key", "config.json": config}
+		if err := os.Mkdir(dir, 0700); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+		}
+		if err := database.RunInitSQL(); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		testDB = database.Connect()
+		defer testDB.Close()
+		return m.Run()
+	}()
+	os.Exit(code)
+}
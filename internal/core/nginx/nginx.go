@@ -0,0 +1,264 @@
+package nginx
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/satnamSandhu2001/stackjet/pkg/commands"
+	"github.com/satnamSandhu2001/stackjet/pkg/helpers"
+	"github.com/satnamSandhu2001/stackjet/pkg/logger"
+)
+
+//go:embed templates/server.conf.tmpl
+var templatesFS embed.FS
+
+var serverTemplate = template.Must(template.New("server.conf.tmpl").Funcs(template.FuncMap{
+	"quote":    quote,
+	"indent":   indent,
+	"comment":  comment,
+	"certPath": func(domain string) string { cert, _ := helpers.CertificatePaths(domain); return cert },
+	"keyPath":  func(domain string) string { _, key := helpers.CertificatePaths(domain); return key },
+}).ParseFS(templatesFS, "templates/server.conf.tmpl"))
+
+type templateData struct {
+	Stack       *models.Stack
+	Servers     []models.NginxConfig
+	AcmeWebroot string
+}
+
+// AddDomain attaches a domain to the stack and applies the nginx config of the stack
+func AddDomain(w io.Writer, ctx context.Context, service services.StackService, stack *models.Stack, opts *dto.Nginx_Create_Request) error {
+	opts.Domain = strings.ToLower(strings.TrimSpace(opts.Domain))
+	if err := helpers.ValidateDomain(opts.Domain); err != nil {
+		return err
+	}
+	for name, value := range opts.Headers {
+		if err := helpers.ValidateHeader(name, value); err != nil {
+			return err
+		}
+	}
+	existing, err := service.GetNginxConfigByDomain(ctx, opts.Domain)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("domain %s is already attached to a stack", opts.Domain)
+	}
+
+	// proxy to stack port by default
+	opts.StackID = stack.ID
+	if opts.Port == 0 {
+		opts.Port = stack.Port
+	}
+
+	logger.EmitLog(w, fmt.Sprintf("🌐 Adding domain %s -> 127.0.0.1:%d ...", opts.Domain, opts.Port))
+	newID, err := service.CreateNginxConfig(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := ApplyConfig(w, ctx, service, stack); err != nil {
+		// keep db in sync with the config on disk
+		if delErr := service.DeleteNginxConfig(ctx, newID); delErr != nil {
+			return errors.Join(err, delErr)
+		}
+		return err
+	}
+
+	logger.EmitLog(w, fmt.Sprintf("✅ Domain %s added successfully", opts.Domain))
+	return nil
+}
+
+// RemoveDomain detaches a domain from its stack and applies the nginx config of the stack
+func RemoveDomain(w io.Writer, ctx context.Context, service services.StackService, domain string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	config, err := service.GetNginxConfigByDomain(ctx, domain)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		return fmt.Errorf("domain %s not found", domain)
+	}
+	stack, err := service.GetStackByID(ctx, config.StackID)
+	if err != nil {
+		return err
+	}
+	if stack == nil {
+		return errors.New("stack not found")
+	}
+
+	logger.EmitLog(w, fmt.Sprintf("🌐 Removing domain %s ...", domain))
+	if err := service.DeleteNginxConfig(ctx, config.ID); err != nil {
+		return err
+	}
+
+	if err := ApplyConfig(w, ctx, service, stack); err != nil {
+		// restore the record so db matches the config on disk
+		if _, createErr := service.CreateNginxConfig(ctx, &dto.Nginx_Create_Request{
+			StackID:    config.StackID,
+			Domain:     config.Domain,
+			Port:       config.Port,
+			SSLEnabled: config.SSLEnabled,
+			Headers:    config.Headers,
+			CustomConf: config.CustomConf,
+		}); createErr != nil {
+			return errors.Join(err, createErr)
+		}
+		return err
+	}
+
+	logger.EmitLog(w, fmt.Sprintf("✅ Domain %s removed successfully", domain))
+	return nil
+}
+
+// ApplyConfig renders the server blocks of all domains of the stack, writes them to sites-available,
+// enables them and reloads nginx. The previous config is restored if validation fails.
+func ApplyConfig(w io.Writer, ctx context.Context, service services.StackService, stack *models.Stack) error {
+	if err := verifyInstallation(w); err != nil {
+		return err
+	}
+
+	configs, err := service.GetNginxConfigsByStackID(ctx, stack.ID)
+	if err != nil {
+		return err
+	}
+
+	availablePath := ConfigPath(stack)
+	enabledPath := filepath.Join(pkg.Config().NGINX_SITES_ENABLED, filepath.Base(availablePath))
+
+	// backup current config for rollback
+	previous, readErr := os.ReadFile(availablePath)
+	hadPrevious := readErr == nil
+
+	if len(configs) == 0 {
+		logger.EmitLog(w, "🧹 No domains left, removing nginx config...")
+		if err := removeConfig(availablePath, enabledPath); err != nil {
+			return err
+		}
+	} else {
+		rendered, err := RenderConfig(stack, configs)
+		if err != nil {
+			return err
+		}
+		logger.EmitLog(w, fmt.Sprintf("📝 Writing nginx config to %s", availablePath))
+		if err := writeConfig(availablePath, enabledPath, rendered); err != nil {
+			return err
+		}
+	}
+
+	// validate before reloading
+	logger.EmitLog(w, "")
+	logger.EmitLog(w, "🔍 Validating nginx config...")
+	if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "nginx", Args: []string{"-t"}}); err != nil {
+		logger.EmitLog(w, "⏪ Invalid nginx config, rolling back...")
+		var rollbackErr error
+		if hadPrevious {
+			rollbackErr = writeConfig(availablePath, enabledPath, previous)
+		} else {
+			rollbackErr = removeConfig(availablePath, enabledPath)
+		}
+		if rollbackErr != nil {
+			return errors.Join(fmt.Errorf("nginx config validation failed: %w", err), rollbackErr)
+		}
+		return fmt.Errorf("nginx config validation failed: %w", err)
+	}
+
+	if err := Reload(w); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Reload reloads nginx with the current config
+func Reload(w io.Writer) error {
+	logger.EmitLog(w, "🔄 Reloading nginx...")
+	if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "nginx", Args: []string{"-s", "reload"}}); err != nil {
+		return fmt.Errorf("failed to reload nginx: %w", err)
+	}
+	return nil
+}
+
+// RenderConfig renders nginx server blocks for the given domains of a stack
+func RenderConfig(stack *models.Stack, configs []models.NginxConfig) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := serverTemplate.Execute(&buf, templateData{Stack: stack, Servers: configs, AcmeWebroot: pkg.Config().ACME_WEBROOT}); err != nil {
+		return nil, fmt.Errorf("failed to render nginx config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ConfigPath returns the path of the stack config inside sites-available
+func ConfigPath(stack *models.Stack) string {
+	return filepath.Join(pkg.Config().NGINX_SITES_AVAILABLE, fmt.Sprintf("stackjet-%s.conf", stack.Uuid))
+}
+
+func verifyInstallation(w io.Writer) error {
+	if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "nginx", Args: []string{"-v"}}); err != nil {
+		logger.EmitLog(w, "Please install nginx (https://nginx.org/en/docs/install.html)")
+		return fmt.Errorf("nginx is not installed: %w", err)
+	}
+	return nil
+}
+
+func writeConfig(availablePath string, enabledPath string, data []byte) error {
+	if err := os.WriteFile(availablePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write nginx config: %w", err)
+	}
+	if _, err := os.Lstat(enabledPath); err == nil {
+		return nil // already enabled
+	}
+	if err := os.Symlink(availablePath, enabledPath); err != nil {
+		return fmt.Errorf("failed to enable nginx config: %w", err)
+	}
+	return nil
+}
+
+func removeConfig(availablePath string, enabledPath string) error {
+	if err := os.Remove(enabledPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to disable nginx config: %w", err)
+	}
+	if err := os.Remove(availablePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove nginx config: %w", err)
+	}
+	return nil
+}
+
+// quotes a value for use as a single nginx directive argument
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+// strips the control characters of a value written into a comment, a line break would end the
+// comment and turn the rest of the value into directives
+func comment(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '\u2028' || r == '\u2029' {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+// indents every line of custom config to the location block level
+func indent(conf string) string {
+	lines := strings.Split(strings.TrimSpace(conf), "\n")
+	for i, line := range lines {
+		lines[i] = "        " + strings.TrimSpace(line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,190 @@
+package nginx
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/satnamSandhu2001/stackjet/pkg/helpers"
+)
+
+func TestRenderConfig(t *testing.T) {
+	stack := &models.Stack{Name: "shop", Uuid: "3f0c"}
+	cert, key := helpers.CertificatePaths("shop.example.com")
+	tests := []struct {
+		name    string
+		config  models.NginxConfig
+		want    []string
+		notWant []string
+	}{
+		{
+			name:   "http",
+			config: models.NginxConfig{Domain: "shop.example.com", Port: 3000},
+			want: []string{
+				"# Stack: shop (3f0c)",
+				"listen 80;",
+				"server_name shop.example.com;",
+				"location /.well-known/acme-challenge/ {\n        root /var/www/acme;\n    }",
+				"proxy_pass http://127.0.0.1:3000;",
+			},
+			notWant: []string{"listen 443", "return 301", "ssl_certificate"},
+		},
+		{
+			name:   "https",
+			config: models.NginxConfig{Domain: "shop.example.com", Port: 3000, SSLEnabled: true},
+			want: []string{
+				"location /.well-known/acme-challenge/ {\n        root /var/www/acme;\n    }\n\n    location / {\n        return 301 https://$host$request_uri;\n    }",
+				"listen 443 ssl;",
+				"ssl_certificate " + cert + ";",
+				"ssl_certificate_key " + key + ";",
+				"proxy_pass http://127.0.0.1:3000;",
+			},
+		},
+		{
+			name: "headers and custom config",
+			config: models.NginxConfig{Domain: "shop.example.com", Port: 3001, Headers: models.NginxHeaders{
+				"X-Tenant": `shop "eu"`,
+				"X-Env":    `prod\`,
+			}, CustomConf: "client_max_body_size 20m;\n  proxy_buffering off;"},
+			want: []string{
+				"proxy_set_header X-Env \"prod\\\\\";\n        proxy_set_header X-Tenant \"shop \\\"eu\\\"\";",
+				"        # custom config\n        client_max_body_size 20m;\n        proxy_buffering off;",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := RenderConfig(stack, []models.NginxConfig{tt.config})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(rendered), want) {
+					t.Errorf("config is missing %q:\n%s", want, rendered)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(string(rendered), notWant) {
+					t.Errorf("config contains %q:\n%s", notWant, rendered)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderConfigKeepsStackNameInComment(t *testing.T) {
+	stack := &models.Stack{Name: "shop\nserver { listen 8080; }\r\u2028return 403;", Uuid: "3f0c"}
+	rendered, err := RenderConfig(stack, []models.NginxConfig{{Domain: "shop.example.com", Port: 3000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, rest, _ := strings.Cut(string(rendered), "\n# Stack: ")
+	line, _, _ := strings.Cut(rest, "\n")
+	if !strings.HasPrefix(first, "# Managed by StackJet") || line != "shopserver { listen 8080; }return 403; (3f0c)" {
+		t.Fatalf("stack comment = %q", line)
+	}
+	if strings.Count(string(rendered), "listen 8080") != 1 || strings.Contains(string(rendered), "\nreturn 403;") {
+		t.Fatalf("stack name left its comment:\n%s", rendered)
+	}
+}
+
+// newStack inserts a stack and returns it with the paths of its nginx config
+func newStack(t *testing.T) (*models.Stack, string, string) {
+	t.Helper()
+	uuid := strings.ReplaceAll(t.Name(), "/", "-")
+	result, err := testDB.Exec(`INSERT INTO stacks (uuid, name, directory, type, repo_url, port, commands) VALUES (?, ?, ?, 'nodejs', 'repo', 3000, ?)`,
+		uuid, uuid, "/tmp/"+uuid, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	stack := &models.Stack{ID: id, Uuid: uuid, Name: uuid, Port: 3000}
+	available := ConfigPath(stack)
+	enabled := filepath.Join(pkg.Config().NGINX_SITES_ENABLED, filepath.Base(available))
+	return stack, available, enabled
+}
+
+// failNginxTest makes nginx -t of the fake nginx fail until the test ends
+func failNginxTest(t *testing.T) {
+	t.Helper()
+	marker := filepath.Join(testBin, "fail-test")
+	if err := os.WriteFile(marker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(marker) })
+}
+
+func TestAddDomainAppliesConfig(t *testing.T) {
+	service := *services.NewStackService(testDB)
+	stack, available, enabled := newStack(t)
+
+	if err := AddDomain(io.Discard, context.Background(), service, stack, &dto.Nginx_Create_Request{Domain: "Add.Example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := os.ReadFile(available)
+	if err != nil || !strings.Contains(string(conf), "server_name add.example.com;") {
+		t.Fatalf("config = %q %v, want the domain served", conf, err)
+	}
+	if target, err := os.Readlink(enabled); err != nil || target != available {
+		t.Fatalf("enabled link = %q %v, want %s", target, err, available)
+	}
+	calls, _ := os.ReadFile(filepath.Join(testBin, "calls"))
+	if !strings.HasSuffix(string(calls), "-t\n-s reload\n") {
+		t.Fatalf("nginx calls = %q, want a reload after the test", calls)
+	}
+}
+
+func TestAddDomainRollsBackInvalidConfig(t *testing.T) {
+	ctx := context.Background()
+	service := *services.NewStackService(testDB)
+	stack, available, enabled := newStack(t)
+	if err := AddDomain(io.Discard, ctx, service, stack, &dto.Nginx_Create_Request{Domain: "first.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	previous, err := os.ReadFile(available)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failNginxTest(t)
+	err = AddDomain(io.Discard, ctx, service, stack, &dto.Nginx_Create_Request{Domain: "second.example.com", CustomConf: "return 200 }"})
+	if err == nil || !strings.Contains(err.Error(), "nginx config validation failed") {
+		t.Fatalf("error = %v, want the failed validation", err)
+	}
+	if conf, _ := os.ReadFile(available); string(conf) != string(previous) {
+		t.Fatalf("config after rollback:\n%s\nwant the previous one:\n%s", conf, previous)
+	}
+	if _, err := os.Lstat(enabled); err != nil {
+		t.Fatalf("config was disabled by the rollback: %v", err)
+	}
+	configs, err := service.GetNginxConfigsByStackID(ctx, stack.ID)
+	if err != nil || len(configs) != 1 || configs[0].Domain != "first.example.com" {
+		t.Fatalf("domains = %+v %v, want only the first one kept", configs, err)
+	}
+}
+
+func TestAddDomainRemovesInvalidFirstConfig(t *testing.T) {
+	ctx := context.Background()
+	service := *services.NewStackService(testDB)
+	stack, available, enabled := newStack(t)
+
+	failNginxTest(t)
+	if err := AddDomain(io.Discard, ctx, service, stack, &dto.Nginx_Create_Request{Domain: "broken.example.com"}); err == nil {
+		t.Fatal("invalid config was applied")
+	}
+	for _, path := range []string{available, enabled} {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was left after the rollback: %v", path, err)
+		}
+	}
+	if config, err := service.GetNginxConfigByDomain(ctx, "broken.example.com"); err != nil || config != nil {
+		t.Fatalf("domain record = %+v %v, want it deleted", config, err)
+	}
+}
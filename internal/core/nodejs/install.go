@@ -0,0 +1,85 @@
+package nodejs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/internal/core/git"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/satnamSandhu2001/stackjet/pkg/commands"
+	"github.com/satnamSandhu2001/stackjet/pkg/logger"
+)
+
+// installDependencies installs dependencies from the lockfile when it changed since the last deployment
+// or the install is missing, and skips the install otherwise
+func installDependencies(w io.Writer, ctx context.Context, service services.StackService, stack *models.Stack, pm *PackageManager, env map[string]string, policy *commands.Policy) error {
+	lockfile := pm.Lockfile
+	reason := ""
+	if !pm.installed() {
+		reason = "node_modules not found"
+		if pm.PnP {
+			reason = ".pnp.cjs not found"
+		}
+	} else {
+		lastCommit, err := service.GetLastDeployedCommit(ctx, stack.ID)
+		if err != nil {
+			return err
+		}
+		if lastCommit == "" {
+			reason = "first deployment"
+		} else if changed, err := git.ChangedFiles(io.Discard, lastCommit, "HEAD", []string{lockfile}); err != nil {
+			reason = "last deployed commit not available"
+		} else if len(changed) > 0 {
+			reason = filepath.Base(lockfile) + " changed"
+		}
+	}
+
+	logger.EmitLog(w, "")
+	if reason == "" {
+		logger.EmitLog(w, fmt.Sprintf("📦 %s unchanged, skipping dependency install", filepath.Base(lockfile)))
+		logger.SkipStep(w)
+		return nil
+	}
+	name, args := pm.installCommand()
+	logger.EmitLog(w, fmt.Sprintf("📦 Installing dependencies (%s)...", reason))
+	if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: name, Args: args, Dir: pm.Dir, Env: env, Ctx: ctx, Timeout: pkg.Config().StepTimeout("install"), Policy: policy}); err != nil {
+		return fmt.Errorf("dependency install failed: %w", err)
+	}
+	return nil
+}
+
+// planInstall returns the install command a deploy to a commit with the given changed files would run, or "" if it would be skipped
+func planInstall(ctx context.Context, service services.StackService, stack *models.Stack, changedFiles []string) (string, error) {
+	pm, err := detectPackageManager(stack.Directory, stack.AppDir())
+	if err != nil {
+		return "", err
+	}
+	name, args := pm.installCommand()
+	command := fmt.Sprintf("(cd %s && %s %s)", pm.Dir, name, strings.Join(args, " "))
+	if pm.Version != "" && pm.Name != "npm" && pm.Name != "bun" {
+		command += fmt.Sprintf(" using %s through corepack", pm)
+	}
+
+	if !pm.installed() {
+		return command, nil
+	}
+	lastCommit, err := service.GetLastDeployedCommit(ctx, stack.ID)
+	if err != nil || lastCommit == "" {
+		return command, err
+	}
+	rel, err := filepath.Rel(stack.Directory, pm.Lockfile)
+	if err != nil {
+		return command, nil
+	}
+	for _, file := range changedFiles {
+		if file == rel {
+			return command, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,39 @@
+package nodejs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// installRoots are the node install roots of the config of the tests, nvm style and fnm style
+var installRoots [2]string
+
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "stackjet-nodejs")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	code := func() int {
+		defer os.RemoveAll(home)
+		os.Setenv("HOME", home)
+		installRoots = [2]string{filepath.Join(home, "nvm", "versions", "node"), filepath.Join(home, "fnm", "node-versions")}
+		config := fmt.Sprintf(`{"node_install_roots": [%q, %q]}`, installRoots[0], installRoots[1])
+		dir := filepath.Join(home, ".stackjet")
+		files := map[string]string{"init.lock": "", "jwt.token": "test-signing-key", "config.json": config}
+		if err := os.Mkdir(dir, 0700); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+		}
+		return m.Run()
+	}()
+	os.Exit(code)
+}
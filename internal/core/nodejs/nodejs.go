@@ -2,21 +2,43 @@ package nodejs
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
-	"path/filepath"
+	"strings"
 
+	"github.com/satnamSandhu2001/stackjet/internal/core/cache"
+	"github.com/satnamSandhu2001/stackjet/internal/core/git"
 	"github.com/satnamSandhu2001/stackjet/internal/core/pm2"
+	"github.com/satnamSandhu2001/stackjet/internal/core/sandbox"
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
 	"github.com/satnamSandhu2001/stackjet/internal/models"
 	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
 	"github.com/satnamSandhu2001/stackjet/pkg/commands"
 	"github.com/satnamSandhu2001/stackjet/pkg/logger"
 )
 
-func DeployStack(w io.Writer, ctx context.Context, service services.StackService, stack *models.Stack) error {
+// DeployStack installs dependencies, builds and starts a nodejs stack with the node version it requires
+// and records that version on the deployment. noCache skips the build cache.
+func DeployStack(w io.Writer, ctx context.Context, service services.StackService, stack *models.Stack, deploymentID int64, noCache bool) error {
+	logger.StartStep(w, models.DEPLOYMENT_STEP_INSTALL)
+
+	// select node version
+	toolchain, err := resolveToolchain(stack.Directory, stack.AppDir())
+	if err != nil {
+		return err
+	}
+	if toolchain != nil {
+		logger.EmitLog(w, fmt.Sprintf("🟢 Using node %s required by %s", toolchain.Version, toolchain.Source))
+	}
+	env := toolchain.Env()
+
 	// verify installation
-	if err := verifyInstallation(w); err != nil {
+	version, err := verifyInstallation(w, env)
+	if err != nil {
+		return err
+	}
+	if _, err := service.UpdateDeployment(ctx, &dto.Deployment_Update_Request{ID: deploymentID, RuntimeVersion: version}); err != nil {
 		return err
 	}
 
@@ -24,27 +46,59 @@ func DeployStack(w io.Writer, ctx context.Context, service services.StackService
 	logger.EmitLog(w, "")
 	logger.EmitLog(w, "⚓ Checking for package manager file...")
 
-	pkgManager, err := detectPackageManager(stack.Directory)
+	pm, err := detectPackageManager(stack.Directory, stack.AppDir())
+	if err != nil {
+		return err
+	}
+	if pm.Dir != stack.AppDir() {
+		logger.EmitLog(w, fmt.Sprintf("📦 Using %s workspace at %s", pm.Name, pm.Dir))
+	}
+	if env, err = pm.prepare(w, ctx, toolchain); err != nil {
+		return err
+	}
+
+	// user supplied commands run with the execution policy of the stack
+	policy, err := sandbox.Resolve(stack)
 	if err != nil {
 		return err
 	}
-	if pkgManager == "" {
-		return errors.New("no supported package manager (npm, yarn or pnpm) found in project root folder")
+	if err := sandbox.Prepare(w, policy); err != nil {
+		return err
+	}
+
+	// install dependencies
+	if err := installDependencies(w, ctx, service, stack, pm, env, policy); err != nil {
+		return err
 	}
 
-	// execute build command
+	// execute build command, or restore the cached build of the commit
 	if stack.Commands.Build != "" {
-		logger.EmitLog(w, "")
-		logger.EmitLog(w, "🛠️ Building application...")
-		if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "bash", Args: []string{"-c", stack.Commands.Build}}); err != nil {
+		logger.StartStep(w, models.DEPLOYMENT_STEP_BUILD)
+		commit, err := git.HeadCommit()
+		if err != nil {
 			return err
 		}
+		if !noCache && cache.Exists(stack, commit) {
+			if err := cache.Restore(w, stack, commit); err != nil {
+				return err
+			}
+		} else {
+			logger.EmitLog(w, "")
+			logger.EmitLog(w, "🛠️ Building application...")
+			if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "bash", Args: []string{"-c", stack.Commands.Build}, Env: env, Ctx: ctx, Timeout: pkg.Config().StepTimeout("build"), Policy: policy}); err != nil {
+				return err
+			}
+			// a failed cache write must not fail the deployment
+			if err := cache.Save(w, stack, commit); err != nil {
+				logger.EmitLog(w, fmt.Sprintf("⚠️ %s", err))
+			}
+		}
 	}
 
 	//  handle pm2 + start app
 	logger.EmitLog(w, "")
 	logger.EmitLog(w, fmt.Sprintf("🚀 Starting %v application...\n", stack.Type))
-	if err := pm2.StartProcess(w, ctx, service, stack); err != nil {
+	if err := pm2.StartProcess(w, ctx, service, stack, env, policy); err != nil {
 		return err
 	}
 
@@ -53,30 +107,50 @@ func DeployStack(w io.Writer, ctx context.Context, service services.StackService
 	return nil
 }
 
-func verifyInstallation(w io.Writer) error {
-	if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "node", Args: []string{"--version"}}); err != nil {
-		return fmt.Errorf("nodejs is not installed: %w", err)
+// PlanDeploy returns the commands a deploy of the target commit would run, without running them
+func PlanDeploy(ctx context.Context, service services.StackService, stack *models.Stack, target string, changedFiles []string, noCache bool) ([]string, error) {
+	var steps []string
+	toolchain, err := resolveToolchain(stack.Directory, stack.AppDir())
+	if err != nil {
+		return nil, err
 	}
-
-	return nil
-}
-
-func detectPackageManager(projectDir string) (string, error) {
-	tools := []struct {
-		tool     string
-		lockfile string
-	}{
-		{"npm", "package-lock.json"},
-		{"yarn", "yarn.lock"},
-		{"pnpm", "pnpm-lock.yaml"},
+	if toolchain != nil {
+		steps = append(steps, fmt.Sprintf("use node %s from %s (required by %s)", toolchain.Version, toolchain.BinDir, toolchain.Source))
 	}
-
-	for _, t := range tools {
-		lockPath := filepath.Join(projectDir, t.lockfile)
-		if err := commands.FileExists(lockPath); err == nil {
-			return t.tool, nil
+	policy, err := sandbox.Resolve(stack)
+	if err != nil {
+		return nil, err
+	}
+	if policy != nil {
+		steps = append(steps, "run install, build and post commands with "+policy.String())
+	}
+	install, err := planInstall(ctx, service, stack, changedFiles)
+	if err != nil {
+		return nil, err
+	}
+	if install != "" {
+		steps = append(steps, install)
+	}
+	if stack.Commands.Build != "" {
+		if !noCache && cache.Exists(stack, target) {
+			steps = append(steps, "restore cached build "+cache.Path(stack, target))
+		} else {
+			steps = append(steps, fmt.Sprintf("bash -c %q", stack.Commands.Build), "cache build outputs")
 		}
 	}
+	pm2Steps, err := pm2.PlanProcess(ctx, service, stack, toolchain.Env(), policy)
+	if err != nil {
+		return nil, err
+	}
+	return append(steps, pm2Steps...), nil
+}
+
+// verifies node runs with the env and returns its version
+func verifyInstallation(w io.Writer, env map[string]string) (string, error) {
+	version, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "node", Args: []string{"--version"}, Env: env})
+	if err != nil {
+		return "", fmt.Errorf("nodejs is not installed: %w", err)
+	}
 
-	return "", errors.New("no supported package manager (npm, yarn or pnpm) found in project root folder")
+	return strings.TrimSpace(version), nil
 }
@@ -0,0 +1,208 @@
+package nodejs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/satnamSandhu2001/stackjet/pkg/commands"
+	"github.com/satnamSandhu2001/stackjet/pkg/logger"
+)
+
+// supported package managers and their lockfiles
+var packageManagers = []struct {
+	tool     string
+	lockfile string
+}{
+	{"npm", "package-lock.json"},
+	{"yarn", "yarn.lock"},
+	{"pnpm", "pnpm-lock.yaml"},
+	{"bun", "bun.lock"},
+	{"bun", "bun.lockb"},
+}
+
+// PackageManager is the package manager of a nodejs app
+type PackageManager struct {
+	Name string // npm, yarn, pnpm or bun
+	// Version is pinned by the packageManager field of package.json and provided through corepack
+	Version  string
+	Lockfile string
+	// Dir is the app or workspace root holding the lockfile
+	Dir string
+	// Berry is set for yarn 2+, PnP for berry installs without node_modules
+	Berry bool
+	PnP   bool
+}
+
+// String returns the name and pinned version, e.g. pnpm@9.1.0
+func (p *PackageManager) String() string {
+	if p.Version == "" {
+		return p.Name
+	}
+	return p.Name + "@" + p.Version
+}
+
+// IsLockfile reports whether a repo file is a lockfile of a supported package manager
+func IsLockfile(path string) bool {
+	for _, t := range packageManagers {
+		if filepath.Base(path) == t.lockfile {
+			return true
+		}
+	}
+	return false
+}
+
+// detects the package manager from its lockfile in the app directory or, for workspaces, in one of its
+// parents up to the repo root. The packageManager field of package.json pins its version.
+func detectPackageManager(repoDir string, appDir string) (*PackageManager, error) {
+	var pm *PackageManager
+	dir := appDir
+	for pm == nil {
+		for _, t := range packageManagers {
+			lockPath := filepath.Join(dir, t.lockfile)
+			if err := commands.FileExists(lockPath); err == nil {
+				pm = &PackageManager{Name: t.tool, Lockfile: lockPath, Dir: dir}
+				break
+			}
+		}
+		if pm != nil {
+			break
+		}
+		if dir == repoDir || !strings.HasPrefix(dir, repoDir) {
+			return nil, errors.New("no supported package manager (npm, yarn, pnpm or bun) found in app folder or workspace root")
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	// the field is usually set in the workspace root, but may be set in the app only
+	for _, dir := range []string{pm.Dir, appDir} {
+		name, version, err := readPackageManagerField(dir)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			continue
+		}
+		if name != pm.Name {
+			return nil, fmt.Errorf(`package.json "packageManager" is %s but %s belongs to %s`, name, filepath.Base(pm.Lockfile), pm.Name)
+		}
+		pm.Version = version
+		break
+	}
+
+	if pm.Name == "yarn" {
+		linker := yarnNodeLinker(pm.Dir)
+		major, _ := strconv.Atoi(strings.Split(pm.Version, ".")[0])
+		pm.Berry = linker != "" || major >= 2
+		pm.PnP = pm.Berry && linker != "node-modules" && linker != "pnpm"
+	}
+	return pm, nil
+}
+
+// installed reports whether dependencies were installed before
+func (p *PackageManager) installed() bool {
+	if p.PnP {
+		return commands.FileExists(filepath.Join(p.Dir, ".pnp.cjs")) == nil
+	}
+	return commands.StackDirExists(filepath.Join(p.Dir, "node_modules")) == nil
+}
+
+// installCommand returns the clean install command that fails if the lockfile is out of date
+func (p *PackageManager) installCommand() (string, []string) {
+	switch p.Name {
+	case "yarn":
+		if p.Berry {
+			return "yarn", []string{"install", "--immutable"}
+		}
+		return "yarn", []string{"install", "--frozen-lockfile"}
+	case "pnpm":
+		return "pnpm", []string{"install", "--frozen-lockfile"}
+	case "bun":
+		return "bun", []string{"install", "--frozen-lockfile"}
+	}
+	return "npm", []string{"ci"}
+}
+
+// prepare makes the package manager available on PATH and returns the env to run commands with.
+// Pinned yarn and pnpm versions are provided by corepack shims, bun must be installed.
+func (p *PackageManager) prepare(w io.Writer, ctx context.Context, toolchain *Toolchain) (map[string]string, error) {
+	env := toolchain.Env()
+	if p.Name == "bun" {
+		if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "bun", Args: []string{"--version"}, Env: env}); err != nil {
+			return nil, fmt.Errorf("bun is not installed (https://bun.sh): %w", err)
+		}
+		return env, nil
+	}
+	if p.Version == "" || p.Name == "npm" {
+		return env, nil
+	}
+
+	// shims are created per node version, corepack ships with node >= 16.9
+	nodeVersion := "system"
+	if toolchain != nil {
+		nodeVersion = toolchain.Version
+	}
+	shimDir := filepath.Join(pkg.Config().STACKJET_DIR, "corepack", nodeVersion)
+	logger.EmitLog(w, fmt.Sprintf("📦 Using %s through corepack", p))
+	if err := commands.CreateDir(shimDir); err != nil {
+		return nil, err
+	}
+	if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "corepack", Args: []string{"enable", "--install-directory", shimDir, "yarn", "pnpm"}, Env: env, Ctx: ctx, Timeout: pkg.Config().StepTimeout("install")}); err != nil {
+		return nil, fmt.Errorf(`corepack is required by the "packageManager" field of package.json (node >= 16.9): %w`, err)
+	}
+	env = withPath(env, shimDir)
+	// corepack must not wait for a confirmation before downloading the pinned version
+	env["COREPACK_ENABLE_DOWNLOAD_PROMPT"] = "0"
+	return env, nil
+}
+
+// reads the "packageManager" field of package.json, e.g. "pnpm@9.1.0+sha512.abc" returns pnpm and 9.1.0+sha512.abc
+func readPackageManagerField(dir string) (string, string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return "", "", nil
+	}
+	var manifest struct {
+		PackageManager string `json:"packageManager"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", "", fmt.Errorf("invalid %s: %w", filepath.Join(dir, "package.json"), err)
+	}
+	name, version, _ := strings.Cut(strings.TrimSpace(manifest.PackageManager), "@")
+	return name, version, nil
+}
+
+// returns the nodeLinker of .yarnrc.yml, "" if the file does not exist and "pnp" if it is not set
+func yarnNodeLinker(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, ".yarnrc.yml"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "nodeLinker:"); ok {
+			return strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+	}
+	return "pnp"
+}
+
+// prepends a directory to the PATH of an env
+func withPath(env map[string]string, dir string) map[string]string {
+	result := map[string]string{}
+	for k, v := range env {
+		result[k] = v
+	}
+	path, ok := result["PATH"]
+	if !ok {
+		path = os.Getenv("PATH")
+	}
+	result["PATH"] = dir + string(os.PathListSeparator) + path
+	return result
+}
@@ -0,0 +1,86 @@
+package nodejs
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDetectPackageManager(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		want     string
+		lockfile string
+		install  []string
+		pnp      bool
+	}{
+		{"npm", map[string]string{"app/package-lock.json": "{}"}, "npm", "app/package-lock.json", []string{"npm", "ci"}, false},
+		{"yarn classic", map[string]string{"app/yarn.lock": ""}, "yarn", "app/yarn.lock", []string{"yarn", "install", "--frozen-lockfile"}, false},
+		{"yarn berry pinned", map[string]string{"app/yarn.lock": "", "app/package.json": `{"packageManager": "yarn@4.1.0"}`}, "yarn@4.1.0", "app/yarn.lock", []string{"yarn", "install", "--immutable"}, true},
+		{"yarn berry node modules", map[string]string{"app/yarn.lock": "", "app/.yarnrc.yml": "nodeLinker: \"node-modules\"\n"}, "yarn", "app/yarn.lock", []string{"yarn", "install", "--immutable"}, false},
+		{"yarn berry without linker", map[string]string{"app/yarn.lock": "", "app/.yarnrc.yml": "enableTelemetry: false\n"}, "yarn", "app/yarn.lock", []string{"yarn", "install", "--immutable"}, true},
+		{"pnpm", map[string]string{"app/pnpm-lock.yaml": "", "app/package.json": `{"packageManager": "pnpm@9.1.0+sha512.abc"}`}, "pnpm@9.1.0+sha512.abc", "app/pnpm-lock.yaml", []string{"pnpm", "install", "--frozen-lockfile"}, false},
+		{"bun", map[string]string{"app/bun.lock": ""}, "bun", "app/bun.lock", []string{"bun", "install", "--frozen-lockfile"}, false},
+		{"bun binary lockfile", map[string]string{"app/bun.lockb": ""}, "bun", "app/bun.lockb", []string{"bun", "install", "--frozen-lockfile"}, false},
+		{"workspace root", map[string]string{"pnpm-lock.yaml": "", "package.json": `{"packageManager": "pnpm@9.1.0"}`, "app/package.json": `{"name": "app"}`}, "pnpm@9.1.0", "pnpm-lock.yaml", []string{"pnpm", "install", "--frozen-lockfile"}, false},
+		{"pinned in the app only", map[string]string{"pnpm-lock.yaml": "", "app/package.json": `{"packageManager": "pnpm@8.15.0"}`}, "pnpm@8.15.0", "pnpm-lock.yaml", []string{"pnpm", "install", "--frozen-lockfile"}, false},
+		{"app lockfile before workspace", map[string]string{"yarn.lock": "", "app/package-lock.json": "{}"}, "npm", "app/package-lock.json", []string{"npm", "ci"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := t.TempDir()
+			for name, content := range tt.files {
+				writeFile(t, filepath.Join(repo, name), content)
+			}
+			pm, err := detectPackageManager(repo, filepath.Join(repo, "app"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pm.String() != tt.want || pm.Lockfile != filepath.Join(repo, tt.lockfile) || pm.Dir != filepath.Dir(pm.Lockfile) || pm.PnP != tt.pnp {
+				t.Fatalf("package manager = %+v, want %s with %s, pnp %v", pm, tt.want, tt.lockfile, tt.pnp)
+			}
+			name, args := pm.installCommand()
+			if install := append([]string{name}, args...); !slices.Equal(install, tt.install) {
+				t.Fatalf("install command = %v, want %v", install, tt.install)
+			}
+		})
+	}
+}
+
+func TestDetectPackageManagerErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"no lockfile", map[string]string{"app/package.json": `{"name": "app"}`}},
+		{"lockfile above the repo", map[string]string{"../package-lock.json": "{}"}},
+		{"pinned to another manager", map[string]string{"app/yarn.lock": "", "app/package.json": `{"packageManager": "pnpm@9.1.0"}`}},
+		{"invalid package.json", map[string]string{"app/package-lock.json": "{}", "app/package.json": "{"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := filepath.Join(t.TempDir(), "repo")
+			for name, content := range tt.files {
+				writeFile(t, filepath.Join(repo, name), content)
+			}
+			if pm, err := detectPackageManager(repo, filepath.Join(repo, "app")); err == nil {
+				t.Fatalf("package manager = %+v, want an error", pm)
+			}
+		})
+	}
+}
+
+func TestIsLockfile(t *testing.T) {
+	for path, want := range map[string]bool{
+		"package-lock.json":       true,
+		"apps/web/pnpm-lock.yaml": true,
+		"bun.lockb":               true,
+		"yarn.lock.bak":           false,
+		"package.json":            false,
+	} {
+		if got := IsLockfile(path); got != want {
+			t.Errorf("IsLockfile(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
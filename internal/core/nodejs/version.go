@@ -0,0 +1,271 @@
+package nodejs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/pkg"
+)
+
+// Toolchain is an installed node version selected for a stack
+type Toolchain struct {
+	Version string // e.g. v20.11.1
+	BinDir  string
+	// Source is the file the required version was read from
+	Source string
+}
+
+// Env puts the toolchain first on PATH, so node, npm and package binaries resolve to it
+func (t *Toolchain) Env() map[string]string {
+	if t == nil {
+		return nil
+	}
+	return map[string]string{"PATH": t.BinDir + string(os.PathListSeparator) + os.Getenv("PATH")}
+}
+
+// node lts release lines by codename
+var ltsCodenames = map[string]int{
+	"argon": 4, "boron": 6, "carbon": 8, "dubnium": 10, "erbium": 12,
+	"fermium": 14, "gallium": 16, "hydrogen": 18, "iron": 20, "jod": 22,
+}
+
+// resolveToolchain reads the node version required by the app and finds the best matching installation.
+// A nil toolchain is returned for apps that do not pin a version, node on PATH is used for them.
+func resolveToolchain(repoDir string, appDir string) (*Toolchain, error) {
+	spec, source, err := readVersionSpec(repoDir, appDir)
+	if err != nil || spec == "" {
+		return nil, err
+	}
+
+	installed := installedVersions()
+	var best *installation
+	for i := range installed {
+		if matchesSpec(installed[i].version, spec) && (best == nil || compareVersions(installed[i].version, best.version) > 0) {
+			best = &installed[i]
+		}
+	}
+	if best == nil {
+		available := make([]string, 0, len(installed))
+		for _, i := range installed {
+			available = append(available, formatVersion(i.version))
+		}
+		if len(available) == 0 {
+			available = append(available, "none")
+		}
+		return nil, fmt.Errorf("node %q required by %s is not installed in %s (installed: %s). Install it with nvm or fnm, or extract it to %s",
+			spec, source, strings.Join(pkg.Config().NODE_INSTALL_ROOTS, ", "), strings.Join(available, ", "), filepath.Join(pkg.Config().STACKJET_DIR, "node", "v<version>"))
+	}
+	return &Toolchain{Version: formatVersion(best.version), BinDir: best.binDir, Source: source}, nil
+}
+
+// readVersionSpec returns the required node version from .nvmrc, .node-version, the volta config or engines.node
+// of package.json, looked up from the app directory up to the repo root
+func readVersionSpec(repoDir string, appDir string) (string, string, error) {
+	dir := appDir
+	for {
+		for _, name := range []string{".nvmrc", ".node-version"} {
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				continue
+			}
+			// the first line without comments holds the version
+			for _, line := range strings.Split(string(data), "\n") {
+				line = strings.TrimSpace(strings.SplitN(line, "#", 2)[0])
+				if line != "" {
+					return line, filepath.Join(dir, name), nil
+				}
+			}
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+		if err == nil {
+			var manifest struct {
+				Volta struct {
+					Node string `json:"node"`
+				} `json:"volta"`
+				Engines struct {
+					Node string `json:"node"`
+				} `json:"engines"`
+			}
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				return "", "", fmt.Errorf("invalid %s: %w", filepath.Join(dir, "package.json"), err)
+			}
+			if manifest.Volta.Node != "" {
+				return manifest.Volta.Node, filepath.Join(dir, "package.json") + " (volta)", nil
+			}
+			if manifest.Engines.Node != "" {
+				return manifest.Engines.Node, filepath.Join(dir, "package.json") + " (engines)", nil
+			}
+		}
+
+		if dir == repoDir || !strings.HasPrefix(dir, repoDir) {
+			return "", "", nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+type installation struct {
+	version [3]int
+	binDir  string
+}
+
+// installedVersions lists the node versions in the install roots. nvm and the StackJet cache use <root>/v<version>/bin,
+// fnm uses <root>/v<version>/installation/bin and volta <root>/<version>/bin
+func installedVersions() []installation {
+	var result []installation
+	for _, root := range pkg.Config().NODE_INSTALL_ROOTS {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			version, ok := parseVersion(entry.Name())
+			if !ok || !entry.IsDir() {
+				continue
+			}
+			for _, bin := range []string{"bin", filepath.Join("installation", "bin")} {
+				binDir := filepath.Join(root, entry.Name(), bin)
+				if _, err := os.Stat(filepath.Join(binDir, "node")); err == nil {
+					result = append(result, installation{version: version, binDir: binDir})
+					break
+				}
+			}
+		}
+	}
+	return result
+}
+
+var versionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)$`)
+
+func parseVersion(s string) ([3]int, bool) {
+	m := versionPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return [3]int{}, false
+	}
+	var v [3]int
+	for i := range v {
+		v[i], _ = strconv.Atoi(m[i+1])
+	}
+	return v, true
+}
+
+func formatVersion(v [3]int) string {
+	return fmt.Sprintf("v%d.%d.%d", v[0], v[1], v[2])
+}
+
+func compareVersions(a [3]int, b [3]int) int {
+	return slices.Compare(a[:], b[:])
+}
+
+// matchesSpec checks a version against an nvm style version, an lts alias or a semver range like ">=18 <21 || ^22"
+func matchesSpec(v [3]int, spec string) bool {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	switch {
+	case spec == "" || spec == "*" || spec == "node" || spec == "latest" || spec == "current" || spec == "stable":
+		return true
+	case spec == "lts/*" || spec == "lts":
+		return v[0]%2 == 0
+	case strings.HasPrefix(spec, "lts/"):
+		major, ok := ltsCodenames[strings.TrimPrefix(spec, "lts/")]
+		return ok && v[0] == major
+	}
+
+	// operators may be separated from their version by spaces
+	spec = regexp.MustCompile(`([<>=~^]+)\s+`).ReplaceAllString(spec, "$1")
+	for _, set := range strings.Split(spec, "||") {
+		if matchesSet(v, strings.TrimSpace(set)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches a space separated set of comparators, all of which must match
+func matchesSet(v [3]int, set string) bool {
+	// hyphen range "1.2.3 - 2.3.4"
+	if from, to, ok := strings.Cut(set, " - "); ok {
+		return matchesComparator(v, ">="+strings.TrimSpace(from)) && matchesComparator(v, "<="+strings.TrimSpace(to))
+	}
+	for _, comparator := range strings.Fields(set) {
+		if !matchesComparator(v, comparator) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesComparator(v [3]int, comparator string) bool {
+	version := strings.TrimLeft(comparator, "<>=~^")
+	op := strings.TrimSuffix(comparator, version)
+	parts, count := parsePartial(version)
+	if count < 0 {
+		return false
+	}
+	// lower bound of the partial version and the exclusive upper bound of its last given part
+	lower := parts
+	upper := parts
+	if count == 0 {
+		return op != "<" && op != ">"
+	}
+	if count < 3 {
+		upper[count-1]++
+	} else {
+		upper[2]++
+	}
+
+	switch op {
+	case "", "=":
+		return compareVersions(v, lower) >= 0 && compareVersions(v, upper) < 0
+	case ">=":
+		return compareVersions(v, lower) >= 0
+	case ">":
+		if count < 3 {
+			return compareVersions(v, upper) >= 0
+		}
+		return compareVersions(v, lower) > 0
+	case "<":
+		return compareVersions(v, lower) < 0
+	case "<=":
+		return compareVersions(v, upper) < 0
+	case "^":
+		return compareVersions(v, lower) >= 0 && v[0] == lower[0]
+	case "~":
+		if count == 1 {
+			return v[0] == lower[0]
+		}
+		return compareVersions(v, lower) >= 0 && v[0] == lower[0] && v[1] == lower[1]
+	}
+	return false
+}
+
+// parses versions like 20, 20.11, 20.x or 20.11.1 and returns how many parts were given, -1 if invalid
+func parsePartial(s string) ([3]int, int) {
+	var v [3]int
+	s = strings.TrimPrefix(s, "v")
+	if s == "" {
+		return v, 0
+	}
+	count := 0
+	for i, part := range strings.Split(s, ".") {
+		if i > 2 {
+			return v, -1
+		}
+		if part == "x" || part == "X" || part == "*" {
+			break
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return v, -1
+		}
+		v[i] = n
+		count++
+	}
+	return v, count
+}
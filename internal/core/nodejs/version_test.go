@@ -0,0 +1,165 @@
+package nodejs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchesSpec(t *testing.T) {
+	tests := []struct {
+		version string
+		spec    string
+		want    bool
+	}{
+		{"v20.11.1", "20", true},
+		{"v20.11.1", "v20.11", true},
+		{"v20.11.1", "20.11.1", true},
+		{"v20.11.1", "20.11.0", false},
+		{"v21.0.0", "20", false},
+		{"v20.11.1", "20.x", true},
+		{"v20.11.1", "*", true},
+		{"v20.11.1", "node", true},
+		{"v20.11.1", ">=18", true},
+		{"v16.20.2", ">=18", false},
+		{"v20.11.1", ">= 18 < 21", true},
+		{"v21.6.0", ">=18 <21", false},
+		{"v22.1.0", ">=18 <21 || ^22", true},
+		{"v20.11.1", ">20", false},
+		{"v21.0.0", ">20", true},
+		{"v20.11.2", ">20.11.1", true},
+		{"v20.11.1", "<=20", true},
+		{"v21.0.0", "<=20", false},
+		{"v20.11.1", "<20.11.1", false},
+		{"v20.11.1", "^20.10", true},
+		{"v20.9.0", "^20.10", false},
+		{"v21.0.0", "^20.10", false},
+		{"v20.11.1", "~20.11.0", true},
+		{"v20.12.0", "~20.11.0", false},
+		{"v20.12.0", "~20", true},
+		{"v18.19.0", "16 - 18", true},
+		{"v19.0.0", "16 - 18.19.0", false},
+		{"v20.11.1", "lts/*", true},
+		{"v21.6.0", "lts/*", false},
+		{"v20.11.1", "lts/iron", true},
+		{"v20.11.1", "lts/Hydrogen", false},
+		{"v20.11.1", "lts/unknown", false},
+		{"v20.11.1", "20.a", false},
+		{"v20.11.1", "20.11.1.1", false},
+	}
+	for _, tt := range tests {
+		version, ok := parseVersion(tt.version)
+		if !ok {
+			t.Fatalf("parseVersion(%q) failed", tt.version)
+		}
+		if got := matchesSpec(version, tt.spec); got != tt.want {
+			t.Errorf("matchesSpec(%s, %q) = %v, want %v", tt.version, tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestReadVersionSpec(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		want   string
+		source string
+	}{
+		{"nvmrc", map[string]string{".nvmrc": "# pinned\nv20.11.1\n"}, "v20.11.1", ".nvmrc"},
+		{"node-version", map[string]string{".node-version": "18"}, "18", ".node-version"},
+		{"volta before engines", map[string]string{"package.json": `{"volta": {"node": "20.11.1"}, "engines": {"node": ">=18"}}`}, "20.11.1", "package.json (volta)"},
+		{"engines", map[string]string{"package.json": `{"engines": {"node": ">=18"}}`}, ">=18", "package.json (engines)"},
+		{"nvmrc before package.json", map[string]string{".nvmrc": "22", "package.json": `{"engines": {"node": ">=18"}}`}, "22", ".nvmrc"},
+		{"app before repo root", map[string]string{".nvmrc": "18", "app/package.json": `{"engines": {"node": "20"}}`}, "20", "app/package.json (engines)"},
+		{"repo root of an app", map[string]string{".nvmrc": "18", "app/package.json": `{"name": "app"}`}, "18", ".nvmrc"},
+		{"not pinned", map[string]string{"package.json": `{"name": "app"}`}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := t.TempDir()
+			for name, content := range tt.files {
+				writeFile(t, filepath.Join(repo, name), content)
+			}
+			// a version above the repo is not the version of the app
+			spec, source, err := readVersionSpec(repo, filepath.Join(repo, "app"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spec != tt.want || (tt.source != "" && source != filepath.Join(repo, tt.source)) {
+				t.Fatalf("readVersionSpec = %q from %s, want %q from %s", spec, source, tt.want, tt.source)
+			}
+		})
+	}
+
+	repo := t.TempDir()
+	writeFile(t, filepath.Join(repo, "package.json"), "{")
+	if _, _, err := readVersionSpec(repo, repo); err == nil {
+		t.Fatal("an invalid package.json was accepted")
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// installNode puts a node binary of version in an install root, bin is bin or installation/bin
+func installNode(t *testing.T, root string, version string, bin string) string {
+	t.Helper()
+	binDir := filepath.Join(root, version, bin)
+	writeFile(t, filepath.Join(binDir, "node"), "#!/bin/sh\n")
+	t.Cleanup(func() { os.RemoveAll(filepath.Join(root, version)) })
+	return binDir
+}
+
+func TestResolveToolchain(t *testing.T) {
+	installNode(t, installRoots[0], "v18.19.0", "bin")
+	nvm20 := installNode(t, installRoots[0], "v20.10.0", "bin")
+	fnm20 := installNode(t, installRoots[1], "v20.11.1", filepath.Join("installation", "bin"))
+	installNode(t, installRoots[0], "v21.6.0", "bin")
+	// folders without node are not installations
+	if err := os.MkdirAll(filepath.Join(installRoots[0], "v20.12.0", "bin"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(filepath.Join(installRoots[0], "v20.12.0")) })
+
+	tests := []struct {
+		spec    string
+		version string
+		binDir  string
+	}{
+		{"20", "v20.11.1", fnm20},
+		{"20.10", "v20.10.0", nvm20},
+		{"lts/*", "v20.11.1", fnm20},
+		{">=18 <20", "v18.19.0", filepath.Join(installRoots[0], "v18.19.0", "bin")},
+	}
+	for _, tt := range tests {
+		repo := t.TempDir()
+		writeFile(t, filepath.Join(repo, ".nvmrc"), tt.spec)
+		toolchain, err := resolveToolchain(repo, repo)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.spec, err)
+		}
+		if toolchain.Version != tt.version || toolchain.BinDir != tt.binDir || toolchain.Source != filepath.Join(repo, ".nvmrc") {
+			t.Errorf("%s resolved to %+v, want %s in %s", tt.spec, toolchain, tt.version, tt.binDir)
+		}
+	}
+
+	repo := t.TempDir()
+	writeFile(t, filepath.Join(repo, ".nvmrc"), "22")
+	_, err := resolveToolchain(repo, repo)
+	if err == nil || !strings.Contains(err.Error(), `"22"`) || !strings.Contains(err.Error(), "v21.6.0") {
+		t.Fatalf("missing version error = %v, want the spec and the installed versions", err)
+	}
+
+	// apps that do not pin a version use node on PATH
+	if toolchain, err := resolveToolchain(t.TempDir(), t.TempDir()); toolchain != nil || err != nil {
+		t.Fatalf("toolchain of an app without a version = %+v %v, want none", toolchain, err)
+	}
+}
@@ -0,0 +1,161 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/satnamSandhu2001/stackjet/internal/core/oidc/oidctest"
+)
+
+const clientID = "stackjet"
+
+func newProvider(t *testing.T) *oidctest.Provider {
+	t.Helper()
+	provider := oidctest.NewProvider(clientID)
+	t.Cleanup(provider.Close)
+	provider.Claims = jwt.MapClaims{"sub": "user-1", "email": "dev@example.com", "email_verified": true, "groups": []string{"ops", "dev"}}
+	return provider
+}
+
+func newClient(provider *oidctest.Provider) *Client {
+	return NewClient(Config{
+		DiscoveryURL: provider.Issuer(),
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURL:  "https://stackjet.example.com/api/v1/auth/oidc/callback",
+	})
+}
+
+// login runs the redirects of a login and returns the code and state the provider redirects back with
+func login(t *testing.T, provider *oidctest.Provider, client *Client, state string, nonce string, verifier string) (string, string) {
+	t.Helper()
+	authURL, err := client.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, provider.URL+"/authorize?") {
+		t.Fatalf("auth URL %s is not the authorization endpoint", authURL)
+	}
+	back, err := provider.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Host != "stackjet.example.com" || back.Path != "/api/v1/auth/oidc/callback" {
+		t.Fatalf("provider redirected to %s, want the callback", back)
+	}
+	return back.Query().Get("code"), back.Query().Get("state")
+}
+
+func TestExchange(t *testing.T) {
+	for _, secret := range []string{"", "s3cret/+"} {
+		provider := newProvider(t)
+		provider.ClientSecret = secret
+		client := newClient(provider)
+
+		code, state := login(t, provider, client, "state-1", "nonce-1", "verifier-1")
+		if state != "state-1" {
+			t.Errorf("state = %q, want state-1", state)
+		}
+		identity, err := client.Exchange(context.Background(), code, "verifier-1", "nonce-1")
+		if err != nil {
+			t.Fatalf("client secret %q: %v", secret, err)
+		}
+		if identity.Subject != "user-1" || identity.Email != "dev@example.com" || !identity.EmailVerified {
+			t.Errorf("identity = %+v", identity)
+		}
+		if !slices.Equal(identity.Groups, []string{"ops", "dev"}) {
+			t.Errorf("groups = %v, want ops, dev", identity.Groups)
+		}
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	provider := newProvider(t)
+	client := newClient(provider)
+
+	code, _ := login(t, provider, client, "state", "nonce", "verifier")
+	_, err := client.Exchange(context.Background(), code, "another-verifier", "nonce")
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("err = %v, want invalid_grant for a verifier not matching the challenge", err)
+	}
+
+	// the code was used
+	if _, err := client.Exchange(context.Background(), code, "verifier", "nonce"); err == nil {
+		t.Fatal("code was accepted twice")
+	}
+}
+
+func TestExchangeChecksIDToken(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		tamper func(claims jwt.MapClaims)
+		key    *rsa.PrivateKey
+		nonce  string
+		want   string
+	}{
+		{name: "issuer", tamper: func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" }, want: "invalid issuer"},
+		{name: "audience", tamper: func(claims jwt.MapClaims) { claims["aud"] = "another-client" }, want: "invalid audience"},
+		{name: "expired", tamper: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-2 * time.Minute).Unix() }, want: "expired"},
+		{name: "no expiry", tamper: func(claims jwt.MapClaims) { delete(claims, "exp") }, want: "exp claim is required"},
+		{name: "nonce", nonce: "nonce-of-another-login", want: "nonce does not match"},
+		{name: "no subject", tamper: func(claims jwt.MapClaims) { delete(claims, "sub") }, want: "no subject"},
+		{name: "signature", key: otherKey, want: "signature is invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newProvider(t)
+			provider.Tamper = tt.tamper
+			if tt.key != nil {
+				provider.SigningKey = tt.key
+			}
+			client := newClient(provider)
+
+			code, _ := login(t, provider, client, "state", "nonce", "verifier")
+			nonce := "nonce"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			_, err := client.Exchange(context.Background(), code, "verifier", nonce)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeEmailVerifiedString(t *testing.T) {
+	provider := newProvider(t)
+	provider.Claims["email_verified"] = "true"
+	provider.Claims["groups"] = "ops"
+	client := newClient(provider)
+
+	code, _ := login(t, provider, client, "state", "nonce", "verifier")
+	identity, err := client.Exchange(context.Background(), code, "verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !identity.EmailVerified {
+		t.Error("email_verified \"true\" was not accepted")
+	}
+	if !slices.Equal(identity.Groups, []string{"ops"}) {
+		t.Errorf("groups = %v, want ops", identity.Groups)
+	}
+}
+
+func TestDiscoveryFailure(t *testing.T) {
+	provider := newProvider(t)
+	client := NewClient(Config{DiscoveryURL: provider.URL + "/missing", ClientID: clientID})
+	if _, err := client.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Fatal("login started without a discovery document")
+	}
+}
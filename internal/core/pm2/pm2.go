@@ -5,17 +5,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"os/user"
+	"strconv"
 	"strings"
 
 	"github.com/satnamSandhu2001/stackjet/internal/dto"
 	"github.com/satnamSandhu2001/stackjet/internal/models"
 	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
 	"github.com/satnamSandhu2001/stackjet/pkg/commands"
 	"github.com/satnamSandhu2001/stackjet/pkg/logger"
 )
 
-func StartProcess(w io.Writer, ctx context.Context, service services.StackService, stack *models.Stack) error {
+// StartProcess starts or restarts the pm2 process of a stack. env is passed to the process, e.g. the PATH of a node toolchain.
+// The process runs as the user of the execution policy, post commands run with the whole policy.
+func StartProcess(w io.Writer, ctx context.Context, service services.StackService, stack *models.Stack, env map[string]string, policy *commands.Policy) error {
+	logger.StartStep(w, models.DEPLOYMENT_STEP_START)
+
 	// verify installation
 	if err := verifyInstallation(w); err != nil {
 		return err
@@ -29,10 +37,9 @@ func StartProcess(w io.Writer, ctx context.Context, service services.StackServic
 	if pm2Data == nil { // create new record
 		logger.EmitLog(w, "")
 		logger.EmitLog(w, "🚀 Creating pm2 process...")
-		commandParts := strings.Fields(stack.Commands.Start)
 		if _, err := service.CreatePM2(ctx, &dto.PM2_Create_Request{
 			StackID: stack.ID,
-			Script:  commandParts[0] + " -- " + strings.Join(commandParts[1:], " "),
+			Script:  startScript(stack),
 			Name:    stack.Name,
 		}); err != nil {
 			return err
@@ -44,39 +51,150 @@ func StartProcess(w io.Writer, ctx context.Context, service services.StackServic
 	}
 
 	// start pm2
-	if !stack.InitialDeploymentSuccess {
+	recreate := stack.InitialDeploymentSuccess && runsAsOtherUser(pm2Data.Name, policy)
+	if recreate {
+		// restarts keep the user a process was started as, so a changed policy user only applies to a new process
+		logger.EmitLog(w, "")
+		logger.EmitLog(w, "🧹 Deleting pm2 process to start it as another user...")
+		commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "pm2", Args: []string{"delete", pm2Data.Name}, Ctx: ctx})
+	}
+	if !stack.InitialDeploymentSuccess || recreate {
 		logger.EmitLog(w, "")
 		logger.EmitLog(w, "🚀 Starting pm2 process...")
-		if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "pm2", Args: []string{"start", "--name", pm2Data.Name, pm2Data.Script}}); err != nil {
+		if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "pm2", Args: startArgs(pm2Data.Name, pm2Data.Script, policy), Env: env, Ctx: ctx, Timeout: pkg.Config().StepTimeout("start")}); err != nil {
 			return err
 		}
 	} else {
 		logger.EmitLog(w, "")
 		logger.EmitLog(w, "🚀 Restarting pm2 process...")
-		if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "pm2", Args: []string{"restart", pm2Data.Name}}); err != nil {
+		if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "pm2", Args: restartArgs(pm2Data.Name, env), Env: env, Ctx: ctx, Timeout: pkg.Config().StepTimeout("start")}); err != nil {
 			return err
 		}
 	}
-	// post script
+	// verify status
+	logger.StartStep(w, models.DEPLOYMENT_STEP_HEALTH)
+	if err := validatePM2Process(pm2Data.Name); err != nil {
+		return fmt.Errorf("pm2 process did not start properly: %w", err)
+	}
+	// post script, once the app is running
 	if stack.Commands.Post != "" {
+		logger.StartStep(w, models.DEPLOYMENT_STEP_POST)
 		logger.EmitLog(w, "")
 		logger.EmitLog(w, "🛠️ Running post commands...")
-		if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "bash", Args: []string{"-c", stack.Commands.Post}}); err != nil {
+		if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "bash", Args: []string{"-c", stack.Commands.Post}, Env: env, Ctx: ctx, Timeout: pkg.Config().StepTimeout("post"), Policy: policy}); err != nil {
 			return err
 		}
 	}
-	// verify status
-	if err := validatePM2Process(pm2Data.Name); err != nil {
-		return fmt.Errorf("pm2 process did not start properly: %w", err)
-	}
-	// save pm2 app list if first deployment
-	if !stack.InitialDeploymentSuccess {
+	// save pm2 app list if the process is new
+	if !stack.InitialDeploymentSuccess || recreate {
 		commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "pm2", Args: []string{"save"}})
 	}
 
 	logger.EmitLog(w, "🚀 pm2 process started successfully")
 	return nil
 }
+
+// PlanProcess returns the pm2 and post commands StartProcess would run, without running them
+func PlanProcess(ctx context.Context, service services.StackService, stack *models.Stack, env map[string]string, policy *commands.Policy) ([]string, error) {
+	pm2Data, err := service.GetPM2byStackID(ctx, stack.ID)
+	if err != nil {
+		return nil, err
+	}
+	name, script := stack.Name, startScript(stack)
+	if pm2Data != nil {
+		name, script = pm2Data.Name, pm2Data.Script
+	}
+
+	var steps []string
+	recreate := stack.InitialDeploymentSuccess && runsAsOtherUser(name, policy)
+	if recreate {
+		steps = append(steps, "pm2 delete "+name)
+	}
+	if !stack.InitialDeploymentSuccess || recreate {
+		steps = append(steps, "pm2 "+strings.Join(startArgs(name, script, policy), " "))
+	} else {
+		steps = append(steps, "pm2 "+strings.Join(restartArgs(name, env), " "))
+	}
+	if stack.Commands.Post != "" {
+		steps = append(steps, fmt.Sprintf("bash -c %q", stack.Commands.Post))
+	}
+	if !stack.InitialDeploymentSuccess || recreate {
+		steps = append(steps, "pm2 save")
+	}
+	return steps, nil
+}
+
+// startArgs returns the pm2 start command of a process, which runs as the policy user if the policy has one
+func startArgs(name string, script string, policy *commands.Policy) []string {
+	args := append([]string{"start", "--name", name}, runAs(policy)...)
+	return append(args, script)
+}
+
+// runAs returns the pm2 options that run a process as the policy user and its primary group
+func runAs(policy *commands.Policy) []string {
+	if policy == nil || policy.User == "" {
+		return nil
+	}
+	// the dedicated user of a stack has a group of the same name, it is created on the first deploy
+	group := policy.User
+	if u, err := user.Lookup(policy.User); err == nil {
+		if g, err := user.LookupGroupId(u.Gid); err == nil {
+			group = g.Name
+		}
+	}
+	return []string{"--uid", policy.User, "--gid", group}
+}
+
+// runsAsOtherUser reports whether the running pm2 process of name runs as another user than the policy user,
+// or than StackJet if the policy has no user
+func runsAsOtherUser(name string, policy *commands.Policy) bool {
+	want := strconv.Itoa(os.Geteuid())
+	if policy != nil && policy.User != "" {
+		want = "" // no process runs as a user that is not created yet
+		if u, err := user.Lookup(policy.User); err == nil {
+			want = u.Uid
+		}
+	}
+	running, ok := processUID(name)
+	return ok && running != want
+}
+
+// processUID returns the user ID of the running pm2 process of name
+func processUID(name string) (string, bool) {
+	app, err := findProcess(name)
+	if err != nil {
+		return "", false
+	}
+	pid, _ := app["pid"].(float64)
+	if pid <= 0 {
+		return "", false
+	}
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", int(pid)))
+	if err != nil {
+		return "", false
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "Uid:" {
+			return fields[1], true
+		}
+	}
+	return "", false
+}
+
+// restarts pick up a changed env, e.g. a new node version, only with --update-env
+func restartArgs(name string, env map[string]string) []string {
+	if len(env) > 0 {
+		return []string{"restart", name, "--update-env"}
+	}
+	return []string{"restart", name}
+}
+
+// pm2 script of the start command, e.g. "npm -- run prod"
+func startScript(stack *models.Stack) string {
+	commandParts := strings.Fields(stack.Commands.Start)
+	return commandParts[0] + " -- " + strings.Join(commandParts[1:], " ")
+}
+
 func verifyInstallation(w io.Writer) error {
 	version, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "pm2", Args: []string{"--version"}})
 	if err != nil || version == "" {
@@ -89,29 +207,60 @@ func verifyInstallation(w io.Writer) error {
 
 // JSON-based validation function using <pm2 jlist>
 func validatePM2Process(name string) error {
+	app, err := findProcess(name)
+	if err != nil {
+		return err
+	}
+	// Check status
+	monit, ok := app["pm2_env"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("pm2_env not found in pm2 jlist")
+	}
+	if status, ok := monit["status"].(string); ok && status == "online" {
+		return nil
+	}
+	return fmt.Errorf("pm2 process status: %v", monit["status"])
+}
+
+// findProcess returns the entry of the pm2 process of name in <pm2 jlist>
+func findProcess(name string) (map[string]interface{}, error) {
 	out, err := exec.Command("pm2", "jlist").Output()
 	if err != nil {
-		return fmt.Errorf("failed to get pm2 jlist: %w", err)
+		return nil, fmt.Errorf("failed to get pm2 jlist: %w", err)
 	}
 
 	var apps []map[string]interface{}
 	if err := json.Unmarshal(out, &apps); err != nil {
-		return fmt.Errorf("failed to parse pm2 jlist: %w", err)
+		return nil, fmt.Errorf("failed to parse pm2 jlist: %w", err)
 	}
 
 	for _, app := range apps {
 		if appName, ok := app["name"].(string); ok && appName == name {
-			// Check status
-			monit, ok := app["pm2_env"].(map[string]interface{})
-			if !ok {
-				return fmt.Errorf("pm2_env not found in pm2 jlist")
-			}
-			if status, ok := monit["status"].(string); ok && status == "online" {
-				return nil
-			}
-			return fmt.Errorf("pm2 process status: %v", monit["status"])
+			return app, nil
 		}
 	}
 
-	return fmt.Errorf("pm2 process %s not found in jlist", name)
+	return nil, fmt.Errorf("pm2 process %s not found in jlist", name)
+}
+
+// DeleteProcess removes the pm2 process of a stack and saves the pm2 app list
+func DeleteProcess(w io.Writer, ctx context.Context, service services.StackService, stack *models.Stack) error {
+	pm2Data, err := service.GetPM2byStackID(ctx, stack.ID)
+	if err != nil {
+		return err
+	}
+	if pm2Data == nil {
+		return nil
+	}
+	if err := verifyInstallation(w); err != nil {
+		return err
+	}
+
+	logger.EmitLog(w, "")
+	logger.EmitLog(w, "🧹 Deleting pm2 process...")
+	if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "pm2", Args: []string{"delete", pm2Data.Name}}); err != nil {
+		logger.EmitLog(w, fmt.Sprintf("⚠️ pm2 process %s could not be deleted, it may not be running", pm2Data.Name))
+	}
+	commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "pm2", Args: []string{"save"}})
+	return nil
 }
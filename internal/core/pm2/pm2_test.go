@@ -0,0 +1,65 @@
+package pm2
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/satnamSandhu2001/stackjet/pkg/commands"
+)
+
+func TestStartArgsRunAsPolicyUser(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := user.LookupGroupId(current.Gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := startArgs("app", "npm -- start", &commands.Policy{User: current.Username})
+	want := []string{"start", "--name", "app", "--uid", current.Username, "--gid", group.Name, "npm -- start"}
+	if !slices.Equal(got, want) {
+		t.Errorf("start args = %v, want %v", got, want)
+	}
+
+	// without a policy user the process runs as StackJet
+	for _, policy := range []*commands.Policy{nil, {Sandbox: "auto"}} {
+		got := startArgs("app", "npm -- start", policy)
+		if want := []string{"start", "--name", "app", "npm -- start"}; !slices.Equal(got, want) {
+			t.Errorf("start args = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRunsAsOtherUser(t *testing.T) {
+	// a stand-in pm2 that lists this test process as the app
+	bin := t.TempDir()
+	jlist := fmt.Sprintf(`[{"name": "app", "pid": %d, "pm2_env": {"status": "online"}}]`, os.Getpid())
+	script := "#!/bin/sh\necho '" + jlist + "'\n"
+	if err := os.WriteFile(filepath.Join(bin, "pm2"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	current, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runsAsOtherUser("app", nil) {
+		t.Error("process of StackJet runs as another user without a policy")
+	}
+	if runsAsOtherUser("app", &commands.Policy{User: current.Username}) {
+		t.Error("process runs as another user than the policy user it runs as")
+	}
+	if !runsAsOtherUser("app", &commands.Policy{User: "stackjet-notcreated"}) {
+		t.Error("process does not run as a policy user that is not created yet")
+	}
+	if runsAsOtherUser("missing", &commands.Policy{User: "stackjet-notcreated"}) {
+		t.Error("a process that is not running needs no restart as another user")
+	}
+}
@@ -0,0 +1,131 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/satnamSandhu2001/stackjet/pkg/commands"
+	"github.com/satnamSandhu2001/stackjet/pkg/logger"
+)
+
+// StackUser is the policy user that is resolved to a dedicated user per stack
+const StackUser = "stack"
+
+// Resolve returns the execution policy of a stack, the global policy tightened by the policy of the stack.
+// It returns nil if user supplied commands run unrestricted.
+func Resolve(stack *models.Stack) (*commands.Policy, error) {
+	policy, err := pkg.Config().EXEC_POLICY.Merge(stack.ExecPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if policy.IsZero() {
+		return nil, nil
+	}
+	policy.Name = stack.Uuid
+	policy.WorkDir = stack.Directory
+	if policy.User == StackUser {
+		policy.User = UserName(stack)
+	}
+	if policy.User != "" {
+		policy.Home = filepath.Join(pkg.Config().SANDBOX_HOME_DIR, stack.Uuid)
+	}
+	return &policy, nil
+}
+
+// UserName returns the name of the dedicated user of a stack
+func UserName(stack *models.Stack) string {
+	return "stackjet-" + stack.Uuid[:8]
+}
+
+// Prepare creates the dedicated user of a stack if needed and gives the policy user write access to
+// the stack directory through its group. The directory stays owned by StackJet, so git keeps working.
+func Prepare(w io.Writer, policy *commands.Policy) error {
+	if policy == nil || policy.User == "" {
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("running commands as %s requires StackJet to run as root", policy.User)
+	}
+
+	u, err := user.Lookup(policy.User)
+	var unknown user.UnknownUserError
+	if errors.As(err, &unknown) {
+		logger.EmitLog(w, fmt.Sprintf("👤 Creating user %s...", policy.User))
+		if _, err := commands.RunCommand(commands.RunCommandArgs{Logger: w, Name: "useradd", Args: []string{
+			"--system", "--user-group", "--no-create-home", "--home-dir", policy.Home, "--shell", "/usr/sbin/nologin", policy.User,
+		}}); err != nil {
+			return fmt.Errorf("failed to create user %s: %w", policy.User, err)
+		}
+		u, err = user.Lookup(policy.User)
+	}
+	if err != nil {
+		return err
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+
+	if err := commands.CreateDir(policy.Home); err != nil {
+		return err
+	}
+	if err := os.Chown(policy.Home, uid, gid); err != nil {
+		return err
+	}
+	if err := os.Chmod(policy.Home, 0700); err != nil {
+		return err
+	}
+
+	// files written by git or restored from the build cache since the last deploy need the group too
+	logger.EmitLog(w, fmt.Sprintf("🔒 Granting %s access to %s...", policy.User, policy.WorkDir))
+	if err := grantGroup(policy.WorkDir, gid); err != nil {
+		return fmt.Errorf("failed to grant access to %s: %w", policy.WorkDir, err)
+	}
+	return nil
+}
+
+// grantGroup gives group gid read and write access to dir, like chgrp -R and chmod -R g+rwX.
+// .git is left out, hooks and config written there would run as StackJet on the next git command,
+// and write access granted to it by earlier versions is revoked.
+func grantGroup(dir string, gid int) error {
+	gitDir := filepath.Join(dir, ".git")
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// chmod follows symlinks, their targets may be outside of dir
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mode := info.Mode() & (fs.ModePerm | fs.ModeSetgid | fs.ModeSticky)
+
+		if path == gitDir || strings.HasPrefix(path, gitDir+string(filepath.Separator)) {
+			if mode&0020 != 0 {
+				return os.Chmod(path, mode&^0020)
+			}
+			return nil
+		}
+		if err := os.Lchown(path, -1, gid); err != nil {
+			return err
+		}
+		grant := fs.FileMode(0060)
+		if d.IsDir() || mode&0111 != 0 {
+			grant |= 0010
+		}
+		if mode&grant != grant {
+			return os.Chmod(path, mode|grant)
+		}
+		return nil
+	})
+}
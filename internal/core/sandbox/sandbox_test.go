@@ -0,0 +1,51 @@
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGrantGroupLeavesGitOut(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".git", "hooks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]os.FileMode{
+		"index.js":              0644,
+		"run.sh":                0744,
+		".git/config":           0664, // group write granted by an earlier deploy
+		".git/hooks/post-merge": 0755,
+	}
+	for name, mode := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := grantGroup(dir, os.Getgid()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]os.FileMode{
+		".":                     0775,
+		"index.js":              0664,
+		"run.sh":                0774,
+		".git":                  0755,
+		".git/config":           0644,
+		".git/hooks/post-merge": 0755,
+	}
+	for name, mode := range want {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Errorf("%s has mode %o, want %o", name, info.Mode().Perm(), mode)
+		}
+	}
+}
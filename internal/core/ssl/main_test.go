@@ -0,0 +1,80 @@
+package ssl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/satnamSandhu2001/stackjet/database"
+)
+
+// testDB is the database of a StackJet initialized in a temporary home for the tests
+var testDB *sqlx.DB
+
+// testCA is the ACME directory the config of the tests points at
+var testCA *acmeStandIn
+
+// nginxCalls is where the fake nginx on PATH appends its arguments
+var nginxCalls string
+
+// fakeNginx accepts every command and records it
+const fakeNginx = "#!/bin/sh\necho \"$@\" >> \"$(dirname \"$0\")/calls\"\n"
+
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "stackjet-ssl")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	code := func() int {
+		defer os.RemoveAll(home)
+		testCA = newACMEStandIn()
+		defer testCA.server.Close()
+
+		bin := filepath.Join(home, "bin")
+		nginxCalls = filepath.Join(bin, "calls")
+		webroot := filepath.Join(home, "acme-webroot")
+		for _, dir := range []string{bin, filepath.Join(webroot, ".well-known", "acme-challenge"), filepath.Join(home, "sites-available"), filepath.Join(home, "sites-enabled")} {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+		}
+		if err := os.WriteFile(filepath.Join(bin, "nginx"), []byte(fakeNginx), 0700); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+		os.Setenv("HOME", home)
+
+		config := fmt.Sprintf(`{
+	"acme_directory_url": %q,
+	"acme_webroot": %q,
+	"acme_renew_before_days": 30,
+	"nginx_sites_available": %q,
+	"nginx_sites_enabled": %q
+}`, testCA.server.URL+"/directory", webroot, filepath.Join(home, "sites-available"), filepath.Join(home, "sites-enabled"))
+		dir := filepath.Join(home, ".stackjet")
+		files := map[string]string{"init.lock": "", "jwt.token": "test-signing-key", "config.json": config}
+		if err := os.Mkdir(dir, 0700); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+		}
+		if err := database.RunInitSQL(); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		testDB = database.Connect()
+		defer testDB.Close()
+		return m.Run()
+	}()
+	os.Exit(code)
+}
@@ -0,0 +1,375 @@
+package ssl
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/satnamSandhu2001/stackjet/internal/core/nginx"
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/satnamSandhu2001/stackjet/pkg/helpers"
+	"github.com/satnamSandhu2001/stackjet/pkg/logger"
+	"golang.org/x/crypto/acme"
+)
+
+// IssueCertificate obtains a certificate for a domain attached to a stack using the ACME http-01
+// challenge served from the managed nginx webroot, then enables HTTPS for the domain.
+func IssueCertificate(w io.Writer, ctx context.Context, service services.StackService, domain string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	config, stack, err := getDomain(ctx, service, domain)
+	if err != nil {
+		return err
+	}
+
+	// make sure the challenge location is live before asking the CA to validate it
+	if err := os.MkdirAll(filepath.Join(pkg.Config().ACME_WEBROOT, ".well-known", "acme-challenge"), 0755); err != nil {
+		return fmt.Errorf("failed to create acme webroot: %w", err)
+	}
+	if err := nginx.ApplyConfig(w, ctx, service, stack); err != nil {
+		return err
+	}
+
+	if err := obtainCertificate(w, ctx, service, domain); err != nil {
+		return err
+	}
+
+	if !config.SSLEnabled {
+		logger.EmitLog(w, "")
+		logger.EmitLog(w, "🔒 Enabling HTTPS in nginx config...")
+		if err := service.UpdateNginxConfig(ctx, &dto.Nginx_Update_Request{ID: config.ID, SSLEnabled: helpers.Bool(true)}); err != nil {
+			return err
+		}
+		if err := nginx.ApplyConfig(w, ctx, service, stack); err != nil {
+			if revertErr := service.UpdateNginxConfig(ctx, &dto.Nginx_Update_Request{ID: config.ID, SSLEnabled: helpers.Bool(false)}); revertErr != nil {
+				return errors.Join(err, revertErr)
+			}
+			return err
+		}
+	} else if err := nginx.Reload(w); err != nil {
+		return err
+	}
+
+	logger.EmitLog(w, fmt.Sprintf("✅ HTTPS enabled for %s", domain))
+	return nil
+}
+
+// RenewCertificate renews the certificate of a domain if it expires within the renewal window
+// (or always when force is set) and reloads nginx afterwards.
+func RenewCertificate(w io.Writer, ctx context.Context, service services.StackService, domain string, force bool) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	cert, err := service.GetCertificateByDomain(ctx, domain)
+	if err != nil {
+		return err
+	}
+	if cert == nil {
+		return fmt.Errorf("no certificate found for %s. Run 'stackjet ssl issue %s' first", domain, domain)
+	}
+	if !force && !IsDueForRenewal(cert) {
+		logger.EmitLog(w, fmt.Sprintf("⏭️ Certificate for %s is not due for renewal (expires %s)", domain, cert.ExpiresAt))
+		return nil
+	}
+	if _, _, err := getDomain(ctx, service, domain); err != nil {
+		return err
+	}
+
+	if err := obtainCertificate(w, ctx, service, domain); err != nil {
+		if setErr := service.SetCertificateError(ctx, domain, err.Error()); setErr != nil {
+			return errors.Join(err, setErr)
+		}
+		return err
+	}
+	if err := nginx.Reload(w); err != nil {
+		return err
+	}
+
+	logger.EmitLog(w, fmt.Sprintf("✅ Certificate for %s renewed", domain))
+	return nil
+}
+
+// RenewDueCertificates renews every certificate that expires within the renewal window
+func RenewDueCertificates(w io.Writer, ctx context.Context, service services.StackService) error {
+	certs, err := service.GetCertificateList(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, cert := range certs {
+		if !IsDueForRenewal(&cert) {
+			continue
+		}
+		if err := RenewCertificate(w, ctx, service, cert.Domain, true); err != nil {
+			logger.EmitLog(w, fmt.Sprintf("⚠️ Failed to renew certificate for %s: %s", cert.Domain, err))
+			errs = append(errs, fmt.Errorf("%s: %w", cert.Domain, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// StartAutoRenew checks for due certificates on startup and then on every interval until ctx is cancelled
+func StartAutoRenew(ctx context.Context, service services.StackService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := RenewDueCertificates(log.Writer(), ctx, service); err != nil {
+			log.Println("Certificate renewal failed:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// IsDueForRenewal reports whether the certificate expires within the configured renewal window
+func IsDueForRenewal(cert *models.Certificate) bool {
+	expiresAt, err := ParseTime(cert.ExpiresAt)
+	if err != nil {
+		return true
+	}
+	renewBefore := time.Duration(pkg.Config().ACME_RENEW_BEFORE_DAYS) * 24 * time.Hour
+	return time.Until(expiresAt) <= renewBefore
+}
+
+// ParseTime parses timestamps as stored by sqlite
+func ParseTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02 15:04:05Z07:00"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", value)
+}
+
+// runs the ACME order for a domain and stores the certificate on disk and in db
+func obtainCertificate(w io.Writer, ctx context.Context, service services.StackService, domain string) error {
+	client, err := newClient(w, ctx)
+	if err != nil {
+		return err
+	}
+
+	logger.EmitLog(w, "")
+	logger.EmitLog(w, fmt.Sprintf("📜 Ordering certificate for %s ...", domain))
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domain))
+	if err != nil {
+		return fmt.Errorf("failed to create acme order: %w", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := authorize(w, ctx, client, authzURL); err != nil {
+			return err
+		}
+	}
+
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return fmt.Errorf("acme order failed: %w", err)
+	}
+
+	// new key for every certificate
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+	}, certKey)
+	if err != nil {
+		return fmt.Errorf("failed to create csr: %w", err)
+	}
+
+	logger.EmitLog(w, "📜 Finalizing order...")
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("failed to finalize acme order: %w", err)
+	}
+	if len(chain) == 0 {
+		return errors.New("acme server returned an empty certificate chain")
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse issued certificate: %w", err)
+	}
+
+	certPath, keyPath := helpers.CertificatePaths(domain)
+	if err := writeCertificate(certPath, keyPath, chain, certKey); err != nil {
+		return err
+	}
+
+	if err := service.UpsertCertificate(ctx, &dto.Certificate_Upsert_Request{
+		Domain:    domain,
+		Issuer:    leaf.Issuer.CommonName,
+		CertPath:  certPath,
+		KeyPath:   keyPath,
+		NotBefore: leaf.NotBefore.UTC().Format(time.RFC3339),
+		ExpiresAt: leaf.NotAfter.UTC().Format(time.RFC3339),
+	}); err != nil {
+		return err
+	}
+
+	logger.EmitLog(w, fmt.Sprintf("📜 Certificate issued by %s, valid until %s", leaf.Issuer.CommonName, leaf.NotAfter.UTC().Format(time.RFC1123)))
+	return nil
+}
+
+// solves the http-01 challenge of a single authorization
+func authorize(w io.Writer, ctx context.Context, client *acme.Client, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("failed to get acme authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("acme server offered no http-01 challenge for %s", authz.Identifier.Value)
+	}
+
+	response, err := client.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return err
+	}
+	tokenPath := filepath.Join(pkg.Config().ACME_WEBROOT, filepath.FromSlash(client.HTTP01ChallengePath(challenge.Token)))
+	if err := os.WriteFile(tokenPath, []byte(response), 0644); err != nil {
+		return fmt.Errorf("failed to write acme challenge: %w", err)
+	}
+	defer os.Remove(tokenPath)
+
+	logger.EmitLog(w, fmt.Sprintf("🔍 Validating domain %s over http-01...", authz.Identifier.Value))
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("failed to accept acme challenge: %w", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("domain validation failed: %w", err)
+	}
+	return nil
+}
+
+// creates an acme client with the stored account key and registers the account if needed
+func newClient(w io.Writer, ctx context.Context) (*acme.Client, error) {
+	key, err := loadAccountKey()
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{Key: key, DirectoryURL: pkg.Config().ACME_DIRECTORY_URL}
+
+	account := &acme.Account{}
+	if email := pkg.Config().ACME_EMAIL; email != "" {
+		account.Contact = []string{"mailto:" + email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("failed to register acme account: %w", err)
+	}
+	logger.EmitLog(w, fmt.Sprintf("🔑 Using ACME directory %s", client.DirectoryURL))
+	return client, nil
+}
+
+// loads the acme account key or generates a new one on first use
+func loadAccountKey() (crypto.Signer, error) {
+	keyPath := filepath.Join(pkg.Config().STACKJET_DIR, "acme", "account.key")
+	data, err := os.ReadFile(keyPath)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid acme account key: %s", keyPath)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save acme account key: %w", err)
+	}
+	return key, nil
+}
+
+// writes the certificate chain and key, replacing existing files atomically
+func writeCertificate(certPath string, keyPath string, chain [][]byte, key *ecdsa.PrivateKey) error {
+	if err := os.MkdirAll(filepath.Dir(certPath), 0700); err != nil {
+		return err
+	}
+
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	if err := writeFileAtomic(keyPath, keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to save certificate key: %w", err)
+	}
+	if err := writeFileAtomic(certPath, certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to save certificate: %w", err)
+	}
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// returns the nginx config and stack of an attached domain
+func getDomain(ctx context.Context, service services.StackService, domain string) (*models.NginxConfig, *models.Stack, error) {
+	config, err := service.GetNginxConfigByDomain(ctx, domain)
+	if err != nil {
+		return nil, nil, err
+	}
+	if config == nil {
+		return nil, nil, fmt.Errorf("domain %s is not attached to any stack. Run 'stackjet domain add %s' first", domain, domain)
+	}
+	stack, err := service.GetStackByID(ctx, config.StackID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stack == nil {
+		return nil, nil, errors.New("stack not found")
+	}
+	return config, stack, nil
+}
@@ -0,0 +1,625 @@
+package ssl
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/satnamSandhu2001/stackjet/pkg/helpers"
+	"golang.org/x/crypto/acme"
+)
+
+// acmeStandIn is a CA serving the parts of RFC 8555 the client uses. It validates http-01
+// challenges by reading the key authorization from the acme webroot nginx serves them from.
+// Signatures of the requests are not checked.
+type acmeStandIn struct {
+	server *httptest.Server
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+
+	mu         sync.Mutex
+	nonce      int
+	thumbprint string // of the registered account key
+	orders     []*standInOrder
+	// certValidity is the lifetime of the certificates it issues
+	certValidity time.Duration
+	// failValidation makes it find a wrong key authorization, as if the domain pointed elsewhere
+	failValidation bool
+}
+
+type standInOrder struct {
+	domain      string
+	token       string
+	authzStatus string
+	status      string
+	chain       [][]byte
+}
+
+func newACMEStandIn() *acmeStandIn {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Stand-in ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		panic(err)
+	}
+	caCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &acmeStandIn{caKey: caKey, caCert: caCert, certValidity: 90 * 24 * time.Hour}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /directory", s.directory)
+	mux.HandleFunc("HEAD /nonce", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("POST /account", s.newAccount)
+	mux.HandleFunc("POST /order", s.newOrder)
+	mux.HandleFunc("POST /order/{id}", s.getOrder)
+	mux.HandleFunc("POST /authz/{id}", s.getAuthorization)
+	mux.HandleFunc("POST /challenge/{id}", s.acceptChallenge)
+	mux.HandleFunc("POST /finalize/{id}", s.finalize)
+	mux.HandleFunc("POST /cert/{id}", s.certificate)
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.nonce++
+		w.Header().Set("Replay-Nonce", strconv.Itoa(s.nonce))
+		s.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	return s
+}
+
+// reset makes the CA issue valid certificates again, orders of earlier tests are kept
+func (s *acmeStandIn) reset(certValidity time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.certValidity = certValidity
+	s.failValidation = false
+}
+
+func (s *acmeStandIn) setFailValidation(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failValidation = fail
+}
+
+// ordersFor returns the orders created for a domain
+func (s *acmeStandIn) ordersFor(domain string) []standInOrder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var orders []standInOrder
+	for _, o := range s.orders {
+		if o.domain == domain {
+			orders = append(orders, *o)
+		}
+	}
+	return orders
+}
+
+func (s *acmeStandIn) directory(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"newNonce":   s.server.URL + "/nonce",
+		"newAccount": s.server.URL + "/account",
+		"newOrder":   s.server.URL + "/order",
+		"revokeCert": s.server.URL + "/revoke",
+		"keyChange":  s.server.URL + "/key-change",
+	})
+}
+
+func (s *acmeStandIn) newAccount(w http.ResponseWriter, r *http.Request) {
+	header, _, err := readJWS(r)
+	if err != nil || header.JWK == nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "account request without jwk")
+		return
+	}
+	thumbprint, err := jwkThumbprint(header.JWK)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := http.StatusOK
+	if s.thumbprint == "" {
+		s.thumbprint = thumbprint
+		status = http.StatusCreated
+	} else if s.thumbprint != thumbprint {
+		writeProblem(w, http.StatusConflict, "malformed", "the stand-in serves a single account")
+		return
+	}
+	w.Header().Set("Location", s.server.URL+"/account/1")
+	writeJSON(w, status, map[string]string{"status": "valid"})
+}
+
+func (s *acmeStandIn) newOrder(w http.ResponseWriter, r *http.Request) {
+	_, payload, err := readJWS(r)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	var req struct {
+		Identifiers []struct{ Type, Value string }
+	}
+	if err := json.Unmarshal(payload, &req); err != nil || len(req.Identifiers) != 1 || req.Identifiers[0].Type != "dns" {
+		writeProblem(w, http.StatusBadRequest, "malformed", "expected a single dns identifier")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token := make([]byte, 16)
+	rand.Read(token)
+	s.orders = append(s.orders, &standInOrder{
+		domain:      req.Identifiers[0].Value,
+		token:       base64.RawURLEncoding.EncodeToString(token),
+		authzStatus: acme.StatusPending,
+		status:      acme.StatusPending,
+	})
+	id := len(s.orders) - 1
+	w.Header().Set("Location", fmt.Sprintf("%s/order/%d", s.server.URL, id))
+	writeJSON(w, http.StatusCreated, s.orderBody(id))
+}
+
+func (s *acmeStandIn) getOrder(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.orderID(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/order/%d", s.server.URL, id))
+	writeJSON(w, http.StatusOK, s.orderBody(id))
+}
+
+func (s *acmeStandIn) getAuthorization(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.orderID(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.authorizationBody(id))
+}
+
+// acceptChallenge validates the challenge right away, so polling finds the final status
+func (s *acmeStandIn) acceptChallenge(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.orderID(w, r)
+	if !ok {
+		return
+	}
+	o := s.orders[id]
+	served, err := os.ReadFile(filepath.Join(pkg.Config().ACME_WEBROOT, ".well-known", "acme-challenge", o.token))
+	if err == nil && string(served) == o.token+"."+s.thumbprint && !s.failValidation {
+		o.authzStatus, o.status = acme.StatusValid, acme.StatusReady
+	} else {
+		o.authzStatus, o.status = acme.StatusInvalid, acme.StatusInvalid
+	}
+	writeJSON(w, http.StatusOK, s.authorizationBody(id)["challenges"].([]map[string]any)[0])
+}
+
+func (s *acmeStandIn) finalize(w http.ResponseWriter, r *http.Request) {
+	_, payload, err := readJWS(r)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.orderID(w, r)
+	if !ok {
+		return
+	}
+	o := s.orders[id]
+	if o.status != acme.StatusReady {
+		writeProblem(w, http.StatusForbidden, "orderNotReady", "order is "+o.status)
+		return
+	}
+
+	var req struct{ CSR string }
+	json.Unmarshal(payload, &req)
+	der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "badCSR", err.Error())
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil || csr.CheckSignature() != nil || len(csr.DNSNames) != 1 || csr.DNSNames[0] != o.domain {
+		writeProblem(w, http.StatusBadRequest, "badCSR", "csr does not match the order")
+		return
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(int64(id) + 2),
+		Subject:      pkix.Name{CommonName: o.domain},
+		DNSNames:     []string{o.domain},
+		NotBefore:    time.Now().Add(-time.Minute).Truncate(time.Second),
+		NotAfter:     time.Now().Add(s.certValidity).Truncate(time.Second),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, s.caCert, csr.PublicKey, s.caKey)
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, "serverInternal", err.Error())
+		return
+	}
+	o.chain = [][]byte{leaf, s.caCert.Raw}
+	o.status = acme.StatusValid
+	w.Header().Set("Location", fmt.Sprintf("%s/order/%d", s.server.URL, id))
+	writeJSON(w, http.StatusOK, s.orderBody(id))
+}
+
+func (s *acmeStandIn) certificate(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.orderID(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	for _, der := range s.orders[id].chain {
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+}
+
+func (s *acmeStandIn) orderID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 0 || id >= len(s.orders) {
+		writeProblem(w, http.StatusNotFound, "malformed", "no such order")
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *acmeStandIn) orderBody(id int) map[string]any {
+	o := s.orders[id]
+	body := map[string]any{
+		"status":         o.status,
+		"identifiers":    []map[string]string{{"type": "dns", "value": o.domain}},
+		"authorizations": []string{fmt.Sprintf("%s/authz/%d", s.server.URL, id)},
+		"finalize":       fmt.Sprintf("%s/finalize/%d", s.server.URL, id),
+	}
+	if o.status == acme.StatusValid {
+		body["certificate"] = fmt.Sprintf("%s/cert/%d", s.server.URL, id)
+	}
+	return body
+}
+
+func (s *acmeStandIn) authorizationBody(id int) map[string]any {
+	o := s.orders[id]
+	challenge := map[string]any{
+		"type":   "http-01",
+		"url":    fmt.Sprintf("%s/challenge/%d", s.server.URL, id),
+		"token":  o.token,
+		"status": o.authzStatus,
+	}
+	if o.authzStatus == acme.StatusInvalid {
+		challenge["error"] = map[string]any{"type": "urn:ietf:params:acme:error:unauthorized", "detail": "key authorization mismatch"}
+	}
+	return map[string]any{
+		"status":     o.authzStatus,
+		"identifier": map[string]string{"type": "dns", "value": o.domain},
+		"challenges": []map[string]any{challenge},
+	}
+}
+
+type jwsHeader struct {
+	JWK json.RawMessage `json:"jwk"`
+	KID string          `json:"kid"`
+}
+
+// readJWS decodes the protected header and payload of a flattened JWS request
+func readJWS(r *http.Request) (jwsHeader, []byte, error) {
+	var header jwsHeader
+	var body struct{ Protected, Payload string }
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return header, nil, err
+	}
+	protected, err := base64.RawURLEncoding.DecodeString(body.Protected)
+	if err != nil {
+		return header, nil, err
+	}
+	if err := json.Unmarshal(protected, &header); err != nil {
+		return header, nil, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body.Payload)
+	return header, payload, err
+}
+
+func jwkThumbprint(raw json.RawMessage) (string, error) {
+	var jwk struct{ Crv, Kty, X, Y string }
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", err
+	}
+	if jwk.Kty != "EC" || jwk.Crv != "P-256" {
+		return "", fmt.Errorf("unexpected account key %s %s", jwk.Kty, jwk.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return "", err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if err != nil {
+		return "", err
+	}
+	return acme.JWKThumbprint(&ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeProblem(w http.ResponseWriter, status int, kind string, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"type": "urn:ietf:params:acme:error:" + kind, "detail": detail, "status": status})
+}
+
+// attachDomain creates a stack with the domain attached, as 'stackjet domain add' does
+func attachDomain(t *testing.T, service *services.StackService, domain string) {
+	t.Helper()
+	result, err := testDB.Exec(`INSERT INTO stacks (uuid, name, directory, type, repo_url, port, commands) VALUES (?, ?, ?, 'nodejs', 'https://example.com/app.git', 3000, ?)`,
+		domain, domain, filepath.Join(t.TempDir(), domain), []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stackID, err := result.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.CreateNginxConfig(context.Background(), &dto.Nginx_Create_Request{StackID: stackID, Domain: domain, Port: 3000}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readChain(t *testing.T, domain string) []*x509.Certificate {
+	t.Helper()
+	certPath, _ := helpers.CertificatePaths(domain)
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chain []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, cert)
+	}
+	return chain
+}
+
+func readNginxCalls(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile(nginxCalls)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestIssueCertificate(t *testing.T) {
+	testCA.reset(90 * 24 * time.Hour)
+	service := services.NewStackService(testDB)
+	ctx := context.Background()
+	attachDomain(t, service, "issue.example.test")
+
+	var out bytes.Buffer
+	if err := IssueCertificate(&out, ctx, *service, " Issue.Example.Test "); err != nil {
+		t.Fatalf("issue: %v\n%s", err, out.String())
+	}
+
+	orders := testCA.ordersFor("issue.example.test")
+	if len(orders) != 1 || orders[0].authzStatus != acme.StatusValid || orders[0].status != acme.StatusValid {
+		t.Fatalf("orders = %+v, want one validated and issued order", orders)
+	}
+	challengePath := filepath.Join(pkg.Config().ACME_WEBROOT, ".well-known", "acme-challenge", orders[0].token)
+	if _, err := os.Stat(challengePath); !os.IsNotExist(err) {
+		t.Errorf("challenge file was left in the webroot: %v", err)
+	}
+
+	chain := readChain(t, "issue.example.test")
+	if len(chain) != 2 || chain[0].Subject.CommonName != "issue.example.test" || chain[1].Subject.CommonName != "Stand-in ACME CA" {
+		t.Fatalf("stored chain has %d certificates, want the leaf and the CA", len(chain))
+	}
+	_, keyPath := helpers.CertificatePaths("issue.example.test")
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(keyPath); info.Mode().Perm() != 0600 {
+		t.Errorf("key mode = %v, want 0600", info.Mode().Perm())
+	}
+	block, _ := pem.Decode(keyPEM)
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.PublicKey.Equal(chain[0].PublicKey) {
+		t.Error("stored key does not belong to the certificate")
+	}
+
+	cert, err := service.GetCertificateByDomain(ctx, "issue.example.test")
+	if err != nil || cert == nil {
+		t.Fatalf("certificate row: %v %v", cert, err)
+	}
+	if cert.Issuer != "Stand-in ACME CA" || cert.ExpiresAt != chain[0].NotAfter.UTC().Format(time.RFC3339) {
+		t.Errorf("certificate row = %+v", cert)
+	}
+
+	config, err := service.GetNginxConfigByDomain(ctx, "issue.example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.SSLEnabled {
+		t.Error("HTTPS was not enabled for the domain")
+	}
+	stack, err := service.GetStackByID(ctx, config.StackID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := os.ReadFile(filepath.Join(pkg.Config().NGINX_SITES_AVAILABLE, fmt.Sprintf("stackjet-%s.conf", stack.Uuid)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(rendered), "listen 443 ssl") {
+		t.Errorf("nginx config does not serve HTTPS:\n%s", rendered)
+	}
+	if !strings.Contains(readNginxCalls(t), "-s reload") {
+		t.Error("nginx was not reloaded")
+	}
+}
+
+func TestIssueCertificateFailedValidation(t *testing.T) {
+	testCA.reset(90 * 24 * time.Hour)
+	testCA.setFailValidation(true)
+	defer testCA.setFailValidation(false)
+	service := services.NewStackService(testDB)
+	ctx := context.Background()
+	attachDomain(t, service, "invalid.example.test")
+
+	var out bytes.Buffer
+	err := IssueCertificate(&out, ctx, *service, "invalid.example.test")
+	if err == nil || !strings.Contains(err.Error(), "domain validation failed") {
+		t.Fatalf("issue error = %v, want a failed validation", err)
+	}
+
+	orders := testCA.ordersFor("invalid.example.test")
+	if len(orders) != 1 || orders[0].chain != nil {
+		t.Fatalf("orders = %+v, want one order without certificate", orders)
+	}
+	challengePath := filepath.Join(pkg.Config().ACME_WEBROOT, ".well-known", "acme-challenge", orders[0].token)
+	if _, err := os.Stat(challengePath); !os.IsNotExist(err) {
+		t.Errorf("challenge file was left in the webroot: %v", err)
+	}
+	if cert, err := service.GetCertificateByDomain(ctx, "invalid.example.test"); err != nil || cert != nil {
+		t.Errorf("certificate row = %+v %v, want none", cert, err)
+	}
+	if config, err := service.GetNginxConfigByDomain(ctx, "invalid.example.test"); err != nil || config.SSLEnabled {
+		t.Errorf("HTTPS was enabled without a certificate: %v", err)
+	}
+}
+
+func TestRenewDueCertificates(t *testing.T) {
+	service := services.NewStackService(testDB)
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	// one certificate far from expiry and one inside the 30 day renewal window
+	attachDomain(t, service, "fresh.example.test")
+	testCA.reset(90 * 24 * time.Hour)
+	if err := IssueCertificate(&out, ctx, *service, "fresh.example.test"); err != nil {
+		t.Fatalf("issue: %v\n%s", err, out.String())
+	}
+	attachDomain(t, service, "due.example.test")
+	testCA.reset(10 * 24 * time.Hour)
+	if err := IssueCertificate(&out, ctx, *service, "due.example.test"); err != nil {
+		t.Fatalf("issue: %v\n%s", err, out.String())
+	}
+	dueBefore := readChain(t, "due.example.test")[0]
+
+	testCA.reset(90 * 24 * time.Hour)
+	out.Reset()
+	if err := RenewDueCertificates(&out, ctx, *service); err != nil {
+		t.Fatalf("renew: %v\n%s", err, out.String())
+	}
+
+	if orders := testCA.ordersFor("fresh.example.test"); len(orders) != 1 {
+		t.Errorf("fresh certificate was ordered %d times, want once", len(orders))
+	}
+	if orders := testCA.ordersFor("due.example.test"); len(orders) != 2 {
+		t.Fatalf("due certificate was ordered %d times, want twice", len(orders))
+	}
+	dueAfter := readChain(t, "due.example.test")[0]
+	if dueAfter.SerialNumber.Cmp(dueBefore.SerialNumber) == 0 || !dueAfter.NotAfter.After(dueBefore.NotAfter) {
+		t.Errorf("due certificate was not replaced, serial %v expires %v", dueAfter.SerialNumber, dueAfter.NotAfter)
+	}
+	cert, err := service.GetCertificateByDomain(ctx, "due.example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.ExpiresAt != dueAfter.NotAfter.UTC().Format(time.RFC3339) || IsDueForRenewal(cert) {
+		t.Errorf("certificate row was not updated: %+v", cert)
+	}
+
+	// the fresh one is only renewed when forced
+	out.Reset()
+	if err := RenewCertificate(&out, ctx, *service, "fresh.example.test", false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "not due for renewal") || len(testCA.ordersFor("fresh.example.test")) != 1 {
+		t.Errorf("certificate that is not due was renewed:\n%s", out.String())
+	}
+	if err := RenewCertificate(&out, ctx, *service, "fresh.example.test", true); err != nil {
+		t.Fatal(err)
+	}
+	if orders := testCA.ordersFor("fresh.example.test"); len(orders) != 2 {
+		t.Errorf("forced renewal ordered %d times in total, want twice", len(orders))
+	}
+}
+
+func TestRenewCertificateRecordsFailure(t *testing.T) {
+	testCA.reset(10 * 24 * time.Hour)
+	service := services.NewStackService(testDB)
+	ctx := context.Background()
+	attachDomain(t, service, "failing.example.test")
+
+	var out bytes.Buffer
+	if err := IssueCertificate(&out, ctx, *service, "failing.example.test"); err != nil {
+		t.Fatalf("issue: %v\n%s", err, out.String())
+	}
+	before := readChain(t, "failing.example.test")[0]
+
+	testCA.setFailValidation(true)
+	defer testCA.setFailValidation(false)
+	err := RenewCertificate(&out, ctx, *service, "failing.example.test", false)
+	if err == nil || !strings.Contains(err.Error(), "domain validation failed") {
+		t.Fatalf("renew error = %v, want a failed validation", err)
+	}
+
+	cert, err := service.GetCertificateByDomain(ctx, "failing.example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(cert.LastError, "domain validation failed") {
+		t.Errorf("last error = %q, want the validation failure", cert.LastError)
+	}
+	// the old certificate keeps being served until a renewal succeeds
+	if after := readChain(t, "failing.example.test")[0]; after.SerialNumber.Cmp(before.SerialNumber) != 0 {
+		t.Error("certificate was replaced by a failed renewal")
+	}
+}
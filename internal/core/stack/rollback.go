@@ -0,0 +1,77 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg/logger"
+)
+
+// rollbackHistory is how many deployments are searched for the deployment a rollback returns to
+const rollbackHistory = 100
+
+// RollbackStack deploys the commit of an earlier successful deployment again and returns the new deployment ID
+func RollbackStack(w io.Writer, ctx context.Context, service services.StackService, secrets services.SecretService, opts *dto.Stack_Rollback_Request) (int64, error) {
+	deployments, err := service.GetDeploymentList(ctx, opts.ID, rollbackHistory)
+	if err != nil {
+		return 0, err
+	}
+
+	// the current deployment is the last successful one, the target the one before it of another commit
+	var current, target *models.Deployment
+	for i := range deployments {
+		d := &deployments[i]
+		if d.Status != models.DEPLOYMENT_STATUS_SUCCESS || d.CommitHash == "" {
+			continue
+		}
+		if current == nil {
+			current = d
+		} else if opts.DeploymentID == 0 && d.CommitHash != current.CommitHash {
+			target = d
+			break
+		}
+	}
+	if current == nil {
+		return 0, errors.New("app has no successful deployment to roll back")
+	}
+
+	if opts.DeploymentID != 0 {
+		target, err = service.GetDeploymentByID(ctx, opts.DeploymentID)
+		if err != nil {
+			return 0, err
+		}
+		if target == nil || target.StackID != opts.ID {
+			return 0, fmt.Errorf("deployment #%d of this app not found", opts.DeploymentID)
+		}
+		if target.Status != models.DEPLOYMENT_STATUS_SUCCESS || target.CommitHash == "" {
+			return 0, fmt.Errorf("deployment #%d did not succeed, only successful deployments can be rolled back to", target.ID)
+		}
+	}
+	if target == nil {
+		return 0, errors.New("app has no earlier successful deployment of another commit to roll back to")
+	}
+	if target.CommitHash == current.CommitHash {
+		return 0, fmt.Errorf("commit %s of deployment #%d is deployed already", shortHash(target.CommitHash), target.ID)
+	}
+
+	logger.EmitLog(w, fmt.Sprintf("⏪ Rolling back deployment #%d (%s) to deployment #%d (%s)",
+		current.ID, shortHash(current.CommitHash), target.ID, shortHash(target.CommitHash)))
+	return DeployStack(w, ctx, service, secrets, &dto.Stack_Deploy_Request{
+		ID:               opts.ID,
+		GitHash:          target.CommitHash,
+		GitReset:         opts.GitReset,
+		RolledBackFromID: current.ID,
+	})
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
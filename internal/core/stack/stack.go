@@ -8,9 +8,14 @@ import (
 	"os"
 	"slices"
 	"strings"
+	"sync"
 
+	"github.com/satnamSandhu2001/stackjet/internal/core/cache"
+	"github.com/satnamSandhu2001/stackjet/internal/core/dns"
 	"github.com/satnamSandhu2001/stackjet/internal/core/git"
+	"github.com/satnamSandhu2001/stackjet/internal/core/nginx"
 	"github.com/satnamSandhu2001/stackjet/internal/core/nodejs"
+	"github.com/satnamSandhu2001/stackjet/internal/core/pm2"
 	"github.com/satnamSandhu2001/stackjet/internal/core/workspace"
 	"github.com/satnamSandhu2001/stackjet/internal/dto"
 	"github.com/satnamSandhu2001/stackjet/internal/models"
@@ -21,10 +26,53 @@ import (
 	"github.com/satnamSandhu2001/stackjet/pkg/logger"
 )
 
+// deploying and creating stacks change the working directory of the process, so only one may run at a time
+var workspaceMu sync.Mutex
+
+// running deployments of this process by ID
+var running = &deployments{cancels: map[int64]context.CancelFunc{}}
+
+type deployments struct {
+	mu      sync.Mutex
+	cancels map[int64]context.CancelFunc
+}
+
+func (d *deployments) add(id int64, cancel context.CancelFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cancels[id] = cancel
+}
+
+func (d *deployments) remove(id int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.cancels, id)
+}
+
+// CancelDeployment cancels a deployment running in this process and kills its commands.
+// It returns false if the deployment is not running here, e.g. because it was started from the CLI.
+func CancelDeployment(id int64) bool {
+	running.mu.Lock()
+	defer running.mu.Unlock()
+	cancel, ok := running.cancels[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
 // DeployStack deploys a stack and returns the deployment ID
-func DeployStack(w io.Writer, ctx context.Context, service services.StackService, opts *dto.Stack_Deploy_Request) (int64, error) {
+func DeployStack(w io.Writer, ctx context.Context, service services.StackService, secrets services.SecretService, opts *dto.Stack_Deploy_Request) (int64, error) {
+	workspaceMu.Lock()
+	defer workspaceMu.Unlock()
+
 	logger.EmitLog(w, "🛠️ Validating and preparing stack...")
 
+	// refs and hashes are passed to git, deploys of the cli and of webhooks are not bound by gin
+	if err := dto.Validate(opts); err != nil {
+		return 0, err
+	}
+
 	// get stack
 	var stack *models.Stack
 	var err error
@@ -42,6 +90,23 @@ func DeployStack(w io.Writer, ctx context.Context, service services.StackService
 	if !stack.CreatedSuccessfully {
 		return 0, errors.New("app was not created successfully. Please create app first")
 	}
+	// tags and refs are deployed instead of the head of the stack branch
+	gitRef := strings.TrimSpace(opts.Ref)
+	if tag := strings.TrimSpace(opts.Tag); tag != "" {
+		if gitRef != "" || opts.GitHash != "" {
+			return 0, errors.New("only one of tag, ref or git hash can be deployed")
+		}
+		gitRef = "refs/tags/" + strings.TrimPrefix(tag, "refs/tags/")
+	} else if gitRef != "" && opts.GitHash != "" {
+		return 0, errors.New("only one of tag, ref or git hash can be deployed")
+	}
+	verify := opts.VerifySignature || pkg.Config().GIT_VERIFY_SIGNATURES
+
+	// only report what would be done, without changing anything
+	if opts.DryRun {
+		return 0, planDeploy(w, ctx, service, secrets, stack, opts, gitRef, verify)
+	}
+
 	// update git data if new data is provided
 	if opts.Branch != "" || opts.Remote != "" {
 		updateStackData := &dto.Stack_Update_Request{
@@ -57,6 +122,12 @@ func DeployStack(w io.Writer, ctx context.Context, service services.StackService
 			if err := service.UpdateStack(ctx, updateStackData); err != nil {
 				return 0, err
 			}
+			if updateStackData.Branch != "" {
+				stack.Branch = updateStackData.Branch
+			}
+			if updateStackData.Remote != "" {
+				stack.Remote = updateStackData.Remote
+			}
 		}
 	}
 
@@ -64,8 +135,20 @@ func DeployStack(w io.Writer, ctx context.Context, service services.StackService
 	logger.EmitLog(w, fmt.Sprintf("------ Deploying: %s ------\n", stack.Name))
 	// add new deployment to deployments table
 	updateDeploymentData := &dto.Deployment_Create_Request{
-		StackID: stack.ID,
-		Status:  models.DEPLOYMENT_STATUS_IN_PROGRESS,
+		StackID:       stack.ID,
+		Status:        models.DEPLOYMENT_STATUS_IN_PROGRESS,
+		CommitMessage: opts.CommitMessage,
+		Pusher:        opts.Pusher,
+	}
+	// pushed commits are commits of the stack branch
+	if gitRef == "" && (opts.GitHash == "" || opts.PushedCommit != "") {
+		updateDeploymentData.Ref = "refs/heads/" + stack.Branch
+	}
+	if opts.PushedCommit != "" {
+		updateDeploymentData.CommitHash = &opts.PushedCommit
+	}
+	if opts.RolledBackFromID != 0 {
+		updateDeploymentData.RolledBackFromID = &opts.RolledBackFromID
 	}
 	deploymentID, err := service.CreateDeployment(ctx, updateDeploymentData)
 	if err != nil {
@@ -74,42 +157,58 @@ func DeployStack(w io.Writer, ctx context.Context, service services.StackService
 	if deploymentID == 0 {
 		return deploymentID, errors.New("failed to create deployment")
 	}
+	// the deployment can be cancelled until it finishes
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	running.add(deploymentID, cancel)
+	defer running.remove(deploymentID)
+
+	// record the steps of the deployment from here on
+	w = newStepRecorder(w, ctx, service, deploymentID)
+	logger.StartStep(w, models.DEPLOYMENT_STEP_FETCH)
 
 	//  workspace logic
 	if err := workspace.EnterWorkspace(w, stack); err != nil {
-		return deploymentID, err
+		return deploymentID, failDeployment(w, ctx, service, deploymentID, err)
 	}
 
 	// git logic
-	if err := git.UpdateRepo(w, ctx, service, deploymentID, stack.Branch, stack.Remote, opts.GitReset, opts.GitHash); err != nil {
-		// update deployment status
+	creds, err := git.LoadCredentials(ctx, secrets, stack)
+	if err != nil {
+		return deploymentID, failDeployment(w, ctx, service, deploymentID, err)
+	}
+	if err := git.UpdateRepo(w, ctx, service, deploymentID, stack.Branch, stack.Remote, opts.GitReset, opts.GitHash, gitRef, verify, stack.GitOptions, creds); err != nil {
+		return deploymentID, failDeployment(w, ctx, service, deploymentID, err)
+	}
+
+	// monorepo apps skip deploys that did not touch any of their paths
+	if skip := unchangedSinceLastDeploy(w, ctx, service, stack, opts, "HEAD"); skip {
+		logger.FinishStep(w, nil)
+		logger.EmitLog(w, "⏭️ No changes in the paths of this app, skipping deployment. Use --force to deploy anyway.")
 		updateDeploymentData := &dto.Deployment_Update_Request{
 			ID:     deploymentID,
-			Status: models.DEPLOYMENT_STATUS_FAILED,
+			Status: models.DEPLOYMENT_STATUS_SKIPPED,
 		}
 		if _, err := service.UpdateDeployment(ctx, updateDeploymentData); err != nil {
 			return deploymentID, err
 		}
+		return deploymentID, nil
+	}
 
-		return deploymentID, err
+	// run the app from its subfolder
+	if err := workspace.EnterAppDir(w, stack); err != nil {
+		return deploymentID, failDeployment(w, ctx, service, deploymentID, err)
 	}
 
 	// nodejs + pm2 logic logic
 	if stack.Type == "nodejs" {
-		if err := nodejs.DeployStack(w, ctx, service, stack); err != nil {
-			// update deployment status
-			updateDeploymentData := &dto.Deployment_Update_Request{
-				ID:     deploymentID,
-				Status: models.DEPLOYMENT_STATUS_FAILED,
-			}
-			if _, err := service.UpdateDeployment(ctx, updateDeploymentData); err != nil {
-				return deploymentID, err
-			}
-
-			return deploymentID, err
+		if err := nodejs.DeployStack(w, ctx, service, stack, deploymentID, opts.NoCache); err != nil {
+			return deploymentID, failDeployment(w, ctx, service, deploymentID, err)
 		}
 	}
 
+	logger.FinishStep(w, nil)
+
 	// update stack success if deployed for the first time
 	if !stack.InitialDeploymentSuccess {
 		updateStackStatusData := &dto.Stack_Update_Request{
@@ -135,8 +234,25 @@ func DeployStack(w io.Writer, ctx context.Context, service services.StackService
 	return deploymentID, nil
 }
 
+// failDeployment records a deployment and its running step as failed, timed out or cancelled and returns the error.
+// The status is saved even when ctx was cancelled.
+func failDeployment(w io.Writer, ctx context.Context, service services.StackService, deploymentID int64, err error) error {
+	logger.FinishStep(w, err)
+	updateDeploymentData := &dto.Deployment_Update_Request{
+		ID:     deploymentID,
+		Status: deploymentStatus(err),
+	}
+	if _, updateErr := service.UpdateDeployment(context.WithoutCancel(ctx), updateDeploymentData); updateErr != nil {
+		return updateErr
+	}
+	return err
+}
+
 // createNewStack creates new stack
-func CreateNewStack(w io.Writer, ctx context.Context, service services.StackService, opts *dto.Stack_Create_Request) error {
+func CreateNewStack(w io.Writer, ctx context.Context, service services.StackService, secrets services.SecretService, opts *dto.Stack_Create_Request) error {
+	workspaceMu.Lock()
+	defer workspaceMu.Unlock()
+
 	logger.EmitLog(w, "🛠️ Validating and preparing stack...")
 
 	// validate stack type
@@ -144,6 +260,14 @@ func CreateNewStack(w io.Writer, ctx context.Context, service services.StackServ
 		return errors.New("invalid stack type. Valid types: " + strings.Join(pkg.Config().VALID_STACKS, ", "))
 	}
 
+	// branch and remote are passed to git, stacks added by the cli are not bound by gin
+	if opts.Branch != "" && !dto.ValidGitRef(opts.Branch) {
+		return fmt.Errorf("invalid branch name %q", opts.Branch)
+	}
+	if opts.Remote != "" && !dto.ValidGitRef(opts.Remote) {
+		return fmt.Errorf("invalid remote name %q", opts.Remote)
+	}
+
 	// set default start command
 	if opts.Commands.Start == "" {
 		switch opts.Type {
@@ -152,8 +276,21 @@ func CreateNewStack(w io.Writer, ctx context.Context, service services.StackServ
 		}
 	}
 
+	// validate app path of monorepo apps
+	appPath, err := helpers.CleanAppPath(opts.AppPath)
+	if err != nil {
+		return err
+	}
+	opts.AppPath = appPath
+	if err := opts.ExecPolicy.Validate(); err != nil {
+		return err
+	}
+	if _, err := pkg.Config().EXEC_POLICY.Merge(opts.ExecPolicy); err != nil {
+		return err
+	}
+
 	// validate git repo access
-	if err := git.VerifyAccess(w, opts.RepoUrl); err != nil {
+	if err := git.VerifyAccess(w, ctx, opts.RepoUrl, opts.GitCredentials); err != nil {
 		return err
 	}
 	// validate port
@@ -171,6 +308,12 @@ func CreateNewStack(w io.Writer, ctx context.Context, service services.StackServ
 	if err != nil {
 		return err
 	}
+	// save private repo credentials for future deployments
+	if opts.GitCredentials != nil {
+		if err := git.SaveCredentials(ctx, secrets, newStack, opts.GitCredentials); err != nil {
+			return err
+		}
+	}
 	logger.EmitLog(w, "📁 Creating stack directory...")
 	// create stack folder in system
 	if err := commands.CreateDir(newStack.Directory); err != nil {
@@ -181,9 +324,14 @@ func CreateNewStack(w io.Writer, ctx context.Context, service services.StackServ
 		return err
 	}
 	// clone repo to directory
-	if err := git.CloneRepo(w, newStack.RepoUrl, newStack.Branch, newStack.Remote); err != nil {
+	if err := git.CloneRepo(w, ctx, newStack.RepoUrl, newStack.Branch, newStack.Remote, newStack.GitOptions, opts.GitCredentials); err != nil {
 		return err
 	}
+	if newStack.AppPath != "" {
+		if err := commands.StackDirExists(newStack.AppDir()); err != nil {
+			return fmt.Errorf("app path %s not found in repo", newStack.AppPath)
+		}
+	}
 	// update stack created_successfully status in db
 	if err := service.UpdateStack(ctx, &dto.Stack_Update_Request{ID: newStack.ID, CreatedSuccessfully: helpers.Bool(true)}); err != nil {
 		return err
@@ -196,6 +344,169 @@ func CreateNewStack(w io.Writer, ctx context.Context, service services.StackServ
 	return nil
 }
 
+// RemoveStack removes the dns records, nginx config and pm2 process of a stack and deletes it from StackJet.
+// The stack directory is deleted only when purge is set.
+func RemoveStack(w io.Writer, ctx context.Context, service services.StackService, secrets services.SecretService, stack *models.Stack, purge bool) error {
+	logger.EmitLog(w, fmt.Sprintf("------ Removing: %s ------\n", stack.Name))
+
+	configs, err := service.GetNginxConfigsByStackID(ctx, stack.ID)
+	if err != nil {
+		return err
+	}
+	for _, config := range configs {
+		if err := dns.RemoveDomainRecord(w, ctx, service, secrets, config.Domain); err != nil {
+			return err
+		}
+		if err := service.DeleteNginxConfig(ctx, config.ID); err != nil {
+			return err
+		}
+	}
+	if len(configs) > 0 {
+		if err := nginx.ApplyConfig(w, ctx, service, stack); err != nil {
+			return err
+		}
+	}
+
+	if err := pm2.DeleteProcess(w, ctx, service, stack); err != nil {
+		return err
+	}
+
+	logger.EmitLog(w, "🗑️ Deleting stack data...")
+	if err := service.DeleteStack(ctx, stack.ID); err != nil {
+		return err
+	}
+
+	if err := cache.Clear(stack); err != nil {
+		return err
+	}
+
+	if purge {
+		logger.EmitLog(w, fmt.Sprintf("🗑️ Deleting stack directory %s...", stack.Directory))
+		if err := os.RemoveAll(stack.Directory); err != nil {
+			return err
+		}
+	}
+
+	logger.EmitLog(w, "🎉 Stack removed successfully!")
+	return nil
+}
+
+// planDeploy fetches the remote and prints the changes and ordered commands a deploy would run.
+// Nothing is changed on disk, in db or in pm2.
+func planDeploy(w io.Writer, ctx context.Context, service services.StackService, secrets services.SecretService, stack *models.Stack, opts *dto.Stack_Deploy_Request, gitRef string, verify bool) error {
+	planned := *stack
+	if opts.Branch != "" {
+		planned.Branch = opts.Branch
+	}
+	if opts.Remote != "" {
+		planned.Remote = opts.Remote
+	}
+
+	logger.EmitLog(w, "")
+	logger.EmitLog(w, fmt.Sprintf("------ Dry run: %s ------\n", planned.Name))
+	if err := workspace.EnterWorkspace(w, &planned); err != nil {
+		return err
+	}
+	creds, err := git.LoadCredentials(ctx, secrets, &planned)
+	if err != nil {
+		return err
+	}
+	plan, err := git.PlanUpdate(w, ctx, planned.Branch, planned.Remote, opts.GitReset, opts.GitHash, gitRef, verify, planned.GitOptions, creds)
+	if err != nil {
+		return err
+	}
+
+	logger.EmitLog(w, "")
+	target := plan.Target
+	if plan.TargetRef != "" {
+		target = fmt.Sprintf("%s (%s)", plan.TargetRef, plan.Target)
+	}
+	logger.EmitLog(w, fmt.Sprintf("📍 Current commit: %s", plan.Current))
+	logger.EmitLog(w, fmt.Sprintf("🎯 Target: %s", target))
+	logger.EmitLog(w, fmt.Sprintf("Commits behind remote: %d", plan.Behind))
+	if len(plan.Commits) > 0 {
+		logger.EmitLog(w, "")
+		logger.EmitLog(w, "📝 Incoming commits:")
+		for _, commit := range plan.Commits {
+			logger.EmitLog(w, "    "+commit)
+		}
+	}
+	lockfiles := []string{}
+	if len(plan.ChangedFiles) > 0 {
+		logger.EmitLog(w, "")
+		logger.EmitLog(w, fmt.Sprintf("📄 Changed files (%d):", len(plan.ChangedFiles)))
+		for _, file := range plan.ChangedFiles {
+			logger.EmitLog(w, "    "+file)
+			if nodejs.IsLockfile(file) {
+				lockfiles = append(lockfiles, file)
+			}
+		}
+	}
+	logger.EmitLog(w, "")
+	if len(lockfiles) > 0 {
+		logger.EmitLog(w, fmt.Sprintf("🔒 Lockfiles changed: %s", strings.Join(lockfiles, ", ")))
+	} else {
+		logger.EmitLog(w, "🔒 Lockfiles changed: none")
+	}
+	if verify {
+		if plan.SignatureError != nil {
+			logger.EmitLog(w, fmt.Sprintf("⚠️ Signature: %s, the deployment would fail", plan.SignatureError))
+		} else {
+			logger.EmitLog(w, "🔏 Signature: verified")
+		}
+	}
+
+	if unchangedSinceLastDeploy(io.Discard, ctx, service, &planned, opts, plan.Target) {
+		logger.EmitLog(w, "")
+		logger.EmitLog(w, "⏭️ No changes in the paths of this app, the deployment would be skipped.")
+		return nil
+	}
+
+	steps := []string{"cd " + planned.Directory}
+	steps = append(steps, plan.Steps...)
+	if planned.AppPath != "" {
+		steps = append(steps, "cd "+planned.AppDir())
+	}
+	if planned.Type == "nodejs" {
+		nodeSteps, err := nodejs.PlanDeploy(ctx, service, &planned, plan.Target, plan.ChangedFiles, opts.NoCache)
+		if err != nil {
+			return err
+		}
+		steps = append(steps, nodeSteps...)
+	}
+
+	logger.EmitLog(w, "")
+	logger.EmitLog(w, "📋 Steps:")
+	for i, step := range steps {
+		logger.EmitLog(w, fmt.Sprintf("  %d. %s", i+1, step))
+	}
+	logger.EmitLog(w, "")
+	logger.EmitLog(w, "✅ Dry run finished, nothing was changed.")
+	return nil
+}
+
+// reports whether a deploy can be skipped because none of the path filters of the stack changed since the last successful deployment
+func unchangedSinceLastDeploy(w io.Writer, ctx context.Context, service services.StackService, stack *models.Stack, opts *dto.Stack_Deploy_Request, target string) bool {
+	// commits picked by hand are always deployed, pushed commits only when they touch the paths
+	if len(stack.PathFilters) == 0 || opts.Force || (opts.GitHash != "" && opts.PushedCommit == "") || !stack.InitialDeploymentSuccess {
+		return false
+	}
+	lastCommit, err := service.GetLastDeployedCommit(ctx, stack.ID)
+	if err != nil || lastCommit == "" {
+		return false
+	}
+
+	logger.EmitLog(w, "")
+	logger.EmitLog(w, fmt.Sprintf("🔍 Checking changes in %s since %s...", strings.Join(stack.PathFilters, ", "), lastCommit))
+	changed, err := git.ChangedFiles(w, lastCommit, target, stack.PathFilters)
+	if err != nil {
+		// e.g. the last commit is not part of a shallow clone
+		logger.EmitLog(w, fmt.Sprintf("⚠️ Could not compare with the last deployment, deploying anyway: %s", err))
+		return false
+	}
+	return len(changed) == 0
+}
+
 // IsValidStackType checks if stack type is valid from config file
 func IsValidStackType(stack string) bool {
 	return slices.Contains(pkg.Config().VALID_STACKS, stack)
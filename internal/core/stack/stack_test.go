@@ -0,0 +1,54 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/pkg/commands"
+)
+
+func TestDeploymentStatus(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w after 1m0s: npm", commands.ErrTimeout), models.DEPLOYMENT_STATUS_TIMED_OUT},
+		{fmt.Errorf("command cancelled: %w", context.Canceled), models.DEPLOYMENT_STATUS_CANCELLED},
+		{fmt.Errorf("command failed: %w", exitErr), models.DEPLOYMENT_STATUS_FAILED},
+		{errors.New("no supported package manager"), models.DEPLOYMENT_STATUS_FAILED},
+	}
+	for _, tt := range tests {
+		if got := deploymentStatus(tt.err); got != tt.want {
+			t.Errorf("deploymentStatus(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCancelDeployment(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	running.add(41, cancel)
+	defer running.remove(41)
+
+	if CancelDeployment(42) {
+		t.Fatal("a deployment that is not running was cancelled")
+	}
+	if ctx.Err() != nil {
+		t.Fatal("cancelling another deployment cancelled this one")
+	}
+	if !CancelDeployment(41) {
+		t.Fatal("the running deployment was not found")
+	}
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Fatal("the running deployment was not cancelled")
+	}
+
+	running.remove(41)
+	if CancelDeployment(41) {
+		t.Fatal("a finished deployment was cancelled")
+	}
+}
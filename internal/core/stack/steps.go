@@ -0,0 +1,128 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg/commands"
+	"github.com/satnamSandhu2001/stackjet/pkg/logger"
+)
+
+// stepRecorder passes logs on to w and saves the steps of a deployment with their timing, exit code and log.
+// Steps are sent to w as step events.
+type stepRecorder struct {
+	w            io.Writer
+	ctx          context.Context
+	service      services.StackService
+	deploymentID int64
+
+	current *models.DeploymentStep
+	started time.Time
+	log     strings.Builder
+}
+
+// the steps are saved even when the deployment is cancelled
+func newStepRecorder(w io.Writer, ctx context.Context, service services.StackService, deploymentID int64) *stepRecorder {
+	return &stepRecorder{w: w, ctx: context.WithoutCancel(ctx), service: service, deploymentID: deploymentID}
+}
+
+func (r *stepRecorder) Write(p []byte) (int, error) {
+	if r.current != nil {
+		r.log.Write(p)
+	}
+	return r.w.Write(p)
+}
+
+func (r *stepRecorder) WriteEvent(event string, data any) error {
+	return logger.EmitEvent(r.w, event, data)
+}
+
+func (r *stepRecorder) StartStep(name string) {
+	r.FinishStep(nil)
+
+	r.started = time.Now()
+	r.log.Reset()
+	r.current = &models.DeploymentStep{
+		DeploymentID: r.deploymentID,
+		Name:         name,
+		Status:       models.DEPLOYMENT_STATUS_IN_PROGRESS,
+		StartedAt:    r.started.UTC().Format(time.RFC3339),
+	}
+	id, err := r.service.CreateDeploymentStep(r.ctx, &dto.DeploymentStep_Create_Request{
+		DeploymentID: r.deploymentID,
+		Name:         name,
+		Status:       r.current.Status,
+		StartedAt:    r.current.StartedAt,
+	})
+	if err != nil {
+		// a failed step record must not fail the deployment
+		logger.EmitLog(r.w, fmt.Sprintf("⚠️ Failed to save %s step: %s", name, err))
+	}
+	r.current.ID = id
+	logger.EmitEvent(r.w, "step", *r.current)
+}
+
+func (r *stepRecorder) SkipStep() {
+	r.finish(models.DEPLOYMENT_STATUS_SKIPPED, nil)
+}
+
+func (r *stepRecorder) FinishStep(err error) {
+	if err != nil {
+		r.finish(deploymentStatus(err), err)
+	} else {
+		r.finish(models.DEPLOYMENT_STATUS_SUCCESS, nil)
+	}
+}
+
+func (r *stepRecorder) finish(status string, err error) {
+	step := r.current
+	if step == nil {
+		return
+	}
+	r.current = nil
+
+	finishedAt := time.Now()
+	step.Status = status
+	step.FinishedAt = new(string)
+	*step.FinishedAt = finishedAt.UTC().Format(time.RFC3339)
+	step.DurationMs = finishedAt.Sub(r.started).Milliseconds()
+	// exit code of the command that failed the step
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code := exitErr.ExitCode()
+		step.ExitCode = &code
+	}
+
+	if step.ID != 0 {
+		if err := r.service.UpdateDeploymentStep(r.ctx, &dto.DeploymentStep_Update_Request{
+			ID:         step.ID,
+			Status:     step.Status,
+			FinishedAt: *step.FinishedAt,
+			DurationMs: step.DurationMs,
+			ExitCode:   step.ExitCode,
+			Log:        r.log.String(),
+		}); err != nil {
+			logger.EmitLog(r.w, fmt.Sprintf("⚠️ Failed to save %s step: %s", step.Name, err))
+		}
+	}
+	logger.EmitEvent(r.w, "step", *step)
+}
+
+// deploymentStatus returns the status of a deployment or step that failed with err
+func deploymentStatus(err error) string {
+	switch {
+	case errors.Is(err, commands.ErrTimeout):
+		return models.DEPLOYMENT_STATUS_TIMED_OUT
+	case errors.Is(err, context.Canceled):
+		return models.DEPLOYMENT_STATUS_CANCELLED
+	}
+	return models.DEPLOYMENT_STATUS_FAILED
+}
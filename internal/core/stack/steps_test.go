@@ -0,0 +1,107 @@
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg/logger"
+)
+
+// eventStream collects the log lines and events a deployment sends to its client
+type eventStream struct {
+	logs   strings.Builder
+	events []string
+	steps  []models.DeploymentStep
+}
+
+func (s *eventStream) Write(p []byte) (int, error) {
+	return s.logs.Write(p)
+}
+
+func (s *eventStream) WriteEvent(event string, data any) error {
+	s.events = append(s.events, event)
+	if step, ok := data.(models.DeploymentStep); ok {
+		s.steps = append(s.steps, step)
+	}
+	return nil
+}
+
+func newDeployment(t *testing.T) int64 {
+	t.Helper()
+	uuid := strings.ReplaceAll(t.Name(), "/", "-")
+	result, err := testDB.Exec(`INSERT INTO stacks (uuid, name, directory, type, repo_url, port, commands) VALUES (?, ?, ?, 'nodejs', 'repo', 3000, ?)`,
+		uuid, uuid, "/tmp/"+uuid, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stackID, _ := result.LastInsertId()
+	result, err = testDB.Exec(`INSERT INTO deployments (stack_id, status) VALUES (?, ?)`, stackID, models.DEPLOYMENT_STATUS_IN_PROGRESS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+func TestStepRecorderEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	service := services.NewStackService(testDB)
+	deploymentID := newDeployment(t)
+	stream := &eventStream{}
+	// the recorder wraps the SSE writer and the log collector of a deployment
+	var collected strings.Builder
+	w := newStepRecorder(logger.MultiWriter(stream, &collected), ctx, *service, deploymentID)
+
+	logger.EmitLog(w, "preparing")
+	logger.StartStep(w, "install")
+	logger.EmitLog(w, "added 12 packages")
+	logger.StartStep(w, "build")
+	logger.SkipStep(w)
+	logger.StartStep(w, "start")
+	logger.EmitLog(w, "pm2 failed")
+	// steps are saved after the deployment was cancelled
+	cancel()
+	logger.FinishStep(w, fmt.Errorf("command failed: %w", exec.Command("sh", "-c", "exit 3").Run()))
+	logger.FinishStep(w, errors.New("a finished step is not finished again"))
+
+	want := []string{
+		"install in_progress", "install success",
+		"build in_progress", "build skipped",
+		"start in_progress", "start failed",
+	}
+	var got []string
+	for _, step := range stream.steps {
+		got = append(got, step.Name+" "+step.Status)
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") || len(stream.events) != len(want) {
+		t.Fatalf("events %v of steps %v, want %v", stream.events, got, want)
+	}
+	for i, step := range stream.steps {
+		if step.ID == 0 || step.DeploymentID != deploymentID || (i%2 == 1) != (step.FinishedAt != nil) {
+			t.Errorf("step event %d = %+v", i, step)
+		}
+	}
+	if last := stream.steps[len(stream.steps)-1]; last.ExitCode == nil || *last.ExitCode != 3 {
+		t.Errorf("exit code of the failed step = %v, want 3", last.ExitCode)
+	}
+	if logs := stream.logs.String(); logs != "preparing\nadded 12 packages\npm2 failed\n" || collected.String() != logs {
+		t.Errorf("logs = %q, collected %q", logs, collected.String())
+	}
+
+	steps, err := service.GetDeploymentSteps(context.Background(), deploymentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := json.Marshal(steps)
+	if len(steps) != 3 || steps[0].Log != "added 12 packages\n" || steps[1].Status != models.DEPLOYMENT_STATUS_SKIPPED ||
+		steps[2].Status != models.DEPLOYMENT_STATUS_FAILED || steps[2].Log != "pm2 failed\n" || steps[2].ExitCode == nil {
+		t.Fatalf("saved steps = %s", saved)
+	}
+}
@@ -0,0 +1,248 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	ProviderGitHub    = "github"
+	ProviderGitLab    = "gitlab"
+	ProviderGitea     = "gitea"
+	ProviderBitbucket = "bitbucket"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrUnknownProvider  = errors.New("unknown webhook provider")
+)
+
+// Push is the provider independent part of a push event
+type Push struct {
+	Provider string
+	// Event is false for pings and events other than pushes
+	Event   bool
+	Ref     string
+	Commit  string
+	Message string
+	Pusher  string
+}
+
+// Branch returns the pushed branch name or an empty string for tags
+func (p *Push) Branch() string {
+	if !strings.HasPrefix(p.Ref, "refs/heads/") {
+		return ""
+	}
+	return strings.TrimPrefix(p.Ref, "refs/heads/")
+}
+
+// SecretName returns the name of the secret holding the webhook secret of a stack
+func SecretName(stackUuid string) string {
+	return "webhook:" + stackUuid
+}
+
+// GenerateSecret returns a new random webhook secret
+func GenerateSecret() (string, error) {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// DetectProvider detects the git hosting provider from the request headers
+func DetectProvider(header http.Header) string {
+	switch {
+	// gitea also sends github headers, check it first
+	case header.Get("X-Gitea-Event") != "":
+		return ProviderGitea
+	case header.Get("X-GitHub-Event") != "":
+		return ProviderGitHub
+	case header.Get("X-Gitlab-Event") != "":
+		return ProviderGitLab
+	case header.Get("X-Event-Key") != "":
+		return ProviderBitbucket
+	}
+	return ""
+}
+
+// Verify checks the signature or token of a webhook request against the stack secret
+func Verify(provider string, header http.Header, body []byte, secret string) error {
+	switch provider {
+	case ProviderGitHub, ProviderBitbucket:
+		signature, ok := strings.CutPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+		if !ok {
+			// bitbucket cloud only sends the sha256 signature in X-Hub-Signature
+			signature, ok = strings.CutPrefix(header.Get("X-Hub-Signature"), "sha256=")
+		}
+		if !ok || !validHMAC(signature, body, secret) {
+			return ErrInvalidSignature
+		}
+	case ProviderGitea:
+		if !validHMAC(header.Get("X-Gitea-Signature"), body, secret) {
+			return ErrInvalidSignature
+		}
+	case ProviderGitLab:
+		if subtle.ConstantTimeCompare([]byte(header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnknownProvider
+	}
+	return nil
+}
+
+// ParsePush parses the push payload of a provider
+func ParsePush(provider string, header http.Header, body []byte) (*Push, error) {
+	push := &Push{Provider: provider}
+	var err error
+	switch provider {
+	case ProviderGitHub:
+		push.Event = header.Get("X-GitHub-Event") == "push"
+		err = parseGitHubLike(push, body)
+	case ProviderGitea:
+		push.Event = header.Get("X-Gitea-Event") == "push"
+		err = parseGitHubLike(push, body)
+	case ProviderGitLab:
+		push.Event = header.Get("X-Gitlab-Event") == "Push Hook"
+		err = parseGitLab(push, body)
+	case ProviderBitbucket:
+		push.Event = header.Get("X-Event-Key") == "repo:push"
+		err = parseBitbucket(push, body)
+	default:
+		return nil, ErrUnknownProvider
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s payload: %w", provider, err)
+	}
+	return push, nil
+}
+
+// github and gitea share the same push payload layout
+func parseGitHubLike(push *Push, body []byte) error {
+	var payload struct {
+		Ref    string `json:"ref"`
+		After  string `json:"after"`
+		Pusher struct {
+			Name     string `json:"name"`
+			Login    string `json:"login"`
+			Username string `json:"username"`
+		} `json:"pusher"`
+		HeadCommit *struct {
+			ID      string `json:"id"`
+			Message string `json:"message"`
+		} `json:"head_commit"`
+	}
+	if !push.Event {
+		return nil
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return err
+	}
+	push.Ref = payload.Ref
+	push.Commit = payload.After
+	push.Pusher = firstNonEmpty(payload.Pusher.Login, payload.Pusher.Username, payload.Pusher.Name)
+	if payload.HeadCommit != nil {
+		push.Commit = firstNonEmpty(payload.HeadCommit.ID, push.Commit)
+		push.Message = payload.HeadCommit.Message
+	}
+	return nil
+}
+
+func parseGitLab(push *Push, body []byte) error {
+	var payload struct {
+		Ref          string `json:"ref"`
+		After        string `json:"after"`
+		CheckoutSha  string `json:"checkout_sha"`
+		UserUsername string `json:"user_username"`
+		UserName     string `json:"user_name"`
+		Commits      []struct {
+			ID      string `json:"id"`
+			Message string `json:"message"`
+		} `json:"commits"`
+	}
+	if !push.Event {
+		return nil
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return err
+	}
+	push.Ref = payload.Ref
+	push.Commit = firstNonEmpty(payload.CheckoutSha, payload.After)
+	push.Pusher = firstNonEmpty(payload.UserUsername, payload.UserName)
+	for _, c := range payload.Commits {
+		if c.ID == push.Commit {
+			push.Message = c.Message
+		}
+	}
+	return nil
+}
+
+func parseBitbucket(push *Push, body []byte) error {
+	var payload struct {
+		Actor struct {
+			Nickname    string `json:"nickname"`
+			DisplayName string `json:"display_name"`
+		} `json:"actor"`
+		Push struct {
+			Changes []struct {
+				New *struct {
+					Type   string `json:"type"`
+					Name   string `json:"name"`
+					Target struct {
+						Hash    string `json:"hash"`
+						Message string `json:"message"`
+					} `json:"target"`
+				} `json:"new"`
+			} `json:"changes"`
+		} `json:"push"`
+	}
+	if !push.Event {
+		return nil
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return err
+	}
+	push.Pusher = firstNonEmpty(payload.Actor.Nickname, payload.Actor.DisplayName)
+	// the last change with a new head wins, deleted branches have no new head
+	for _, change := range payload.Push.Changes {
+		if change.New == nil {
+			continue
+		}
+		if change.New.Type == "tag" {
+			push.Ref = "refs/tags/" + change.New.Name
+		} else {
+			push.Ref = "refs/heads/" + change.New.Name
+		}
+		push.Commit = change.New.Target.Hash
+		push.Message = change.New.Target.Message
+	}
+	return nil
+}
+
+func validHMAC(signature string, body []byte, secret string) bool {
+	expected, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
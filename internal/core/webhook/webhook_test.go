@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+const testSecret = "webhook-secret"
+
+const zeroHash = "0000000000000000000000000000000000000000"
+
+func sign(body string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func headers(pairs ...string) http.Header {
+	header := http.Header{}
+	for i := 0; i < len(pairs); i += 2 {
+		header.Set(pairs[i], pairs[i+1])
+	}
+	return header
+}
+
+func TestVerify(t *testing.T) {
+	body := `{"ref": "refs/heads/main"}`
+	tests := []struct {
+		name     string
+		provider string
+		header   http.Header
+		err      error
+	}{
+		{"github valid", ProviderGitHub, headers("X-Hub-Signature-256", "sha256="+sign(body, testSecret)), nil},
+		{"github wrong signature", ProviderGitHub, headers("X-Hub-Signature-256", "sha256="+sign(body, "other")), ErrInvalidSignature},
+		{"github sha1 signature", ProviderGitHub, headers("X-Hub-Signature", "sha1=0123456789abcdef"), ErrInvalidSignature},
+		{"github missing header", ProviderGitHub, headers(), ErrInvalidSignature},
+		{"gitea valid", ProviderGitea, headers("X-Gitea-Signature", sign(body, testSecret)), nil},
+		{"gitea wrong signature", ProviderGitea, headers("X-Gitea-Signature", sign(body, "other")), ErrInvalidSignature},
+		{"gitea missing header", ProviderGitea, headers(), ErrInvalidSignature},
+		{"gitlab valid", ProviderGitLab, headers("X-Gitlab-Token", testSecret), nil},
+		{"gitlab wrong token", ProviderGitLab, headers("X-Gitlab-Token", "other"), ErrInvalidSignature},
+		{"gitlab missing header", ProviderGitLab, headers(), ErrInvalidSignature},
+		{"bitbucket valid", ProviderBitbucket, headers("X-Hub-Signature", "sha256="+sign(body, testSecret)), nil},
+		{"bitbucket server valid", ProviderBitbucket, headers("X-Hub-Signature-256", "sha256="+sign(body, testSecret)), nil},
+		{"bitbucket wrong signature", ProviderBitbucket, headers("X-Hub-Signature", "sha256="+sign(body, "other")), ErrInvalidSignature},
+		{"bitbucket missing header", ProviderBitbucket, headers(), ErrInvalidSignature},
+		{"unknown provider", "", headers("X-Hub-Signature-256", "sha256="+sign(body, testSecret)), ErrUnknownProvider},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.provider, tt.header, []byte(body), testSecret); !errors.Is(err, tt.err) {
+				t.Fatalf("Verify = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	// the signature covers the body
+	header := headers("X-Hub-Signature-256", "sha256="+sign(body, testSecret))
+	if err := Verify(ProviderGitHub, header, []byte(`{"ref": "refs/heads/evil"}`), testSecret); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Verify of a changed body = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestDetectProvider(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		want   string
+	}{
+		{headers("X-GitHub-Event", "push"), ProviderGitHub},
+		{headers("X-Gitea-Event", "push", "X-GitHub-Event", "push"), ProviderGitea},
+		{headers("X-Gitlab-Event", "Push Hook"), ProviderGitLab},
+		{headers("X-Event-Key", "repo:push"), ProviderBitbucket},
+		{headers(), ""},
+	}
+	for _, tt := range tests {
+		if got := DetectProvider(tt.header); got != tt.want {
+			t.Errorf("DetectProvider(%v) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestParsePush(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		name     string
+		provider string
+		header   http.Header
+		body     string
+		want     Push
+		branch   string
+	}{
+		{
+			name: "github branch push", provider: ProviderGitHub, header: headers("X-GitHub-Event", "push"),
+			body: `{"ref": "refs/heads/main", "after": "` + commit + `", "pusher": {"name": "dev"}, "head_commit": {"id": "` + commit + `", "message": "fix login"}}`,
+			want: Push{Event: true, Ref: "refs/heads/main", Commit: commit, Message: "fix login", Pusher: "dev"}, branch: "main",
+		},
+		{
+			name: "github tag push", provider: ProviderGitHub, header: headers("X-GitHub-Event", "push"),
+			body: `{"ref": "refs/tags/v1.0.0", "after": "` + commit + `", "pusher": {"name": "dev"}, "head_commit": {"id": "` + commit + `", "message": "release"}}`,
+			want: Push{Event: true, Ref: "refs/tags/v1.0.0", Commit: commit, Message: "release", Pusher: "dev"},
+		},
+		{
+			name: "github branch delete", provider: ProviderGitHub, header: headers("X-GitHub-Event", "push"),
+			body: `{"ref": "refs/heads/main", "after": "` + zeroHash + `", "deleted": true, "pusher": {"name": "dev"}, "head_commit": null}`,
+			want: Push{Event: true, Ref: "refs/heads/main", Commit: zeroHash, Pusher: "dev"}, branch: "main",
+		},
+		{
+			name: "github ping", provider: ProviderGitHub, header: headers("X-GitHub-Event", "ping"),
+			body: `{"zen": "Keep it logically awesome."}`,
+		},
+		{
+			name: "gitea branch push", provider: ProviderGitea, header: headers("X-Gitea-Event", "push"),
+			body: `{"ref": "refs/heads/dev", "after": "` + commit + `", "pusher": {"login": "gitea-dev", "username": "gitea-dev"}, "head_commit": {"id": "` + commit + `", "message": "wip"}}`,
+			want: Push{Event: true, Ref: "refs/heads/dev", Commit: commit, Message: "wip", Pusher: "gitea-dev"}, branch: "dev",
+		},
+		{
+			name: "gitea tag push", provider: ProviderGitea, header: headers("X-Gitea-Event", "push"),
+			body: `{"ref": "refs/tags/v2", "after": "` + commit + `", "pusher": {"login": "gitea-dev"}}`,
+			want: Push{Event: true, Ref: "refs/tags/v2", Commit: commit, Pusher: "gitea-dev"},
+		},
+		{
+			name: "gitea branch delete", provider: ProviderGitea, header: headers("X-Gitea-Event", "push"),
+			body: `{"ref": "refs/heads/dev", "after": "` + zeroHash + `", "pusher": {"login": "gitea-dev"}}`,
+			want: Push{Event: true, Ref: "refs/heads/dev", Commit: zeroHash, Pusher: "gitea-dev"}, branch: "dev",
+		},
+		{
+			name: "gitlab branch push", provider: ProviderGitLab, header: headers("X-Gitlab-Event", "Push Hook"),
+			body: `{"ref": "refs/heads/main", "after": "` + commit + `", "checkout_sha": "` + commit + `", "user_username": "lab-dev", "commits": [{"id": "` + commit + `", "message": "ci"}]}`,
+			want: Push{Event: true, Ref: "refs/heads/main", Commit: commit, Message: "ci", Pusher: "lab-dev"}, branch: "main",
+		},
+		{
+			// gitlab sends tag pushes as their own event
+			name: "gitlab tag push", provider: ProviderGitLab, header: headers("X-Gitlab-Event", "Tag Push Hook"),
+			body: `{"ref": "refs/tags/v1", "after": "` + commit + `", "checkout_sha": "` + commit + `", "user_username": "lab-dev"}`,
+		},
+		{
+			name: "gitlab branch delete", provider: ProviderGitLab, header: headers("X-Gitlab-Event", "Push Hook"),
+			body: `{"ref": "refs/heads/main", "after": "` + zeroHash + `", "checkout_sha": null, "user_username": "lab-dev", "commits": []}`,
+			want: Push{Event: true, Ref: "refs/heads/main", Commit: zeroHash, Pusher: "lab-dev"}, branch: "main",
+		},
+		{
+			name: "bitbucket branch push", provider: ProviderBitbucket, header: headers("X-Event-Key", "repo:push"),
+			body: `{"actor": {"nickname": "bb-dev"}, "push": {"changes": [{"new": {"type": "branch", "name": "main", "target": {"hash": "` + commit + `", "message": "deploy"}}}]}}`,
+			want: Push{Event: true, Ref: "refs/heads/main", Commit: commit, Message: "deploy", Pusher: "bb-dev"}, branch: "main",
+		},
+		{
+			name: "bitbucket tag push", provider: ProviderBitbucket, header: headers("X-Event-Key", "repo:push"),
+			body: `{"actor": {"display_name": "BB Dev"}, "push": {"changes": [{"new": {"type": "tag", "name": "v1", "target": {"hash": "` + commit + `"}}}]}}`,
+			want: Push{Event: true, Ref: "refs/tags/v1", Commit: commit, Pusher: "BB Dev"},
+		},
+		{
+			name: "bitbucket branch delete", provider: ProviderBitbucket, header: headers("X-Event-Key", "repo:push"),
+			body: `{"actor": {"nickname": "bb-dev"}, "push": {"changes": [{"old": {"type": "branch", "name": "main"}, "new": null}]}}`,
+			want: Push{Event: true, Pusher: "bb-dev"},
+		},
+		{
+			name: "bitbucket pull request", provider: ProviderBitbucket, header: headers("X-Event-Key", "pullrequest:created"),
+			body: `{"pullrequest": {}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			push, err := ParsePush(tt.provider, tt.header, []byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.Provider = tt.provider
+			if *push != tt.want {
+				t.Fatalf("push = %+v, want %+v", *push, tt.want)
+			}
+			if branch := push.Branch(); branch != tt.branch {
+				t.Fatalf("branch = %q, want %q", branch, tt.branch)
+			}
+		})
+	}
+}
+
+func TestParsePushRejectsInvalidPayloads(t *testing.T) {
+	if _, err := ParsePush(ProviderGitHub, headers("X-GitHub-Event", "push"), []byte(`{"ref": `)); err == nil {
+		t.Error("truncated payload was parsed")
+	}
+	if _, err := ParsePush("", headers(), []byte(`{}`)); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("unknown provider = %v, want %v", err, ErrUnknownProvider)
+	}
+}
@@ -26,3 +26,15 @@ func EnterWorkspace(w io.Writer, stack *models.Stack) error {
 	logger.EmitLog(w, fmt.Sprintf("📁 Working dir: %v \n", checkDir))
 	return nil
 }
+
+// Enter the app directory of a monorepo project, does nothing for apps at the repo root
+func EnterAppDir(w io.Writer, stack *models.Stack) error {
+	if stack.AppPath == "" {
+		return nil
+	}
+	logger.EmitLog(w, fmt.Sprintf("📁 Entering app path %s...", stack.AppPath))
+	if err := commands.StackDirExists(stack.AppDir()); err != nil {
+		return fmt.Errorf("app path %s not found in repo", stack.AppPath)
+	}
+	return os.Chdir(stack.AppDir())
+}
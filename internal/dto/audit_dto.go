@@ -0,0 +1,26 @@
+package dto
+
+type AuditEvent_Create_Request struct {
+	Action string
+	// StackID is 0 for actions on no stack
+	StackID int64
+	Summary string
+	Result  string
+	// Actor and ActorID override the actor of the context, for logins which act before they are authenticated
+	Actor   string
+	ActorID int64
+}
+
+type AuditEvent_List_Request struct {
+	Actor  string `form:"actor"`
+	Source string `form:"source" binding:"omitempty,oneof=cli api webhook scheduler"`
+	// Action matches actions starting with it, "stack." matches every stack action
+	Action  string `form:"action"`
+	StackID int64  `form:"stack_id"`
+	Result  string `form:"result" binding:"omitempty,oneof=success failure blocked"`
+	// Since and Until are RFC3339 times or dates
+	Since  string `form:"since"`
+	Until  string `form:"until"`
+	Limit  uint64 `form:"limit" binding:"omitempty,max=1000"`
+	Offset uint64 `form:"offset"`
+}
@@ -1,47 +1,96 @@
 package dto
 
-import "github.com/satnamSandhu2001/stackjet/internal/models"
+import (
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/pkg/commands"
+)
 
 type Stack_Create_Request struct {
-	ID       int64                `json:"id" db:"id"`
-	Name     string               `json:"name" db:"name" binding:"required"`
-	Type     string               `json:"type" db:"type" binding:"required"`
-	Port     int                  `json:"port" db:"port" binding:"required"`
-	RepoUrl  string               `json:"repo_url" db:"repo_url" binding:"required"`
-	Branch   string               `json:"branch" db:"branch"`
-	Remote   string               `json:"remote" db:"remote"`
-	Commands models.StackCommands `db:"commands" json:"commands" binding:"required"`
+	ID         int64                `json:"id" db:"id"`
+	Name       string               `json:"name" db:"name" binding:"required"`
+	Type       string               `json:"type" db:"type" binding:"required"`
+	Port       int                  `json:"port" db:"port" binding:"required"`
+	RepoUrl    string               `json:"repo_url" db:"repo_url" binding:"required"`
+	Branch     string               `json:"branch" db:"branch" binding:"omitempty,gitref"`
+	Remote     string               `json:"remote" db:"remote" binding:"omitempty,gitref"`
+	Commands   models.StackCommands `db:"commands" json:"commands" binding:"required"`
+	GitOptions models.GitOptions    `db:"git_options" json:"git_options"`
+	// monorepos: subfolder of the app and the paths that trigger a deploy
+	AppPath     string             `db:"app_path" json:"app_path"`
+	PathFilters models.PathFilters `db:"path_filters" json:"path_filters"`
+	// restricts install, build and post commands, can only tighten the global policy
+	ExecPolicy commands.Policy `db:"exec_policy" json:"exec_policy"`
+
+	// credentials for private repositories, saved encrypted
+	GitCredentials *models.GitCredentials `json:"git_credentials"`
 }
 
 type Stack_Deploy_Request struct {
-	ID        int64  `json:"id" db:"id" binding:"required"`
-	Branch    string `json:"branch" db:"branch"`
-	Remote    string `json:"remote" db:"remote"`
-	GitHash   string `json:"git_hash"`
-	GitReset  bool
-	Directory string `db:"directory"` // only used for cli created stacks
+	// ID is the stack of the route, never read from the body that permissions were not checked for
+	ID        int64  `json:"-" db:"id"`
+	Branch    string `json:"branch" db:"branch" binding:"omitempty,gitref"`
+	Remote    string `json:"remote" db:"remote" binding:"omitempty,gitref"`
+	GitHash   string `json:"git_hash" binding:"omitempty,githash"`
+	GitReset  bool   `json:"-"`
+	Directory string `json:"-" db:"directory"` // only used for cli created stacks
+
+	// branch, tag or commit deployed instead of the head of the stack branch
+	Ref string `json:"ref" binding:"omitempty,gitref"`
+	Tag string `json:"tag" binding:"omitempty,gitref"`
+	// require a valid signature of an allowed signer on the deployed tag or commit
+	VerifySignature bool `json:"verify_signature"`
+	// deploy even if none of the path filters of the stack changed
+	Force bool `json:"force"`
+	// only report what a deploy would do
+	DryRun bool `json:"dry_run"`
+	// rebuild even if a build of the commit is cached
+	NoCache bool `json:"no_cache"`
+
+	// set by webhook deployments
+	Pusher        string `json:"-"`
+	PushedCommit  string `json:"-" binding:"omitempty,githash"`
+	CommitMessage string `json:"-"`
+	// set by rollbacks to the deployment they undo
+	RolledBackFromID int64 `json:"-"`
+}
+
+type Stack_Rollback_Request struct {
+	// ID is the stack of the route, never read from the body
+	ID int64 `json:"-"`
+	// DeploymentID is the deployment whose commit is deployed again, by default the last successful one of another commit
+	DeploymentID int64 `json:"deployment_id"`
+	GitReset     bool  `json:"-"`
 }
 
 type Stack_Update_Request struct {
-	ID                       int64  `json:"id" db:"id" binding:"required"`
-	Name                     string `json:"name" db:"name"`
-	RepoUrl                  string `json:"repo_url" db:"repo_url"`
-	Branch                   string `json:"branch" db:"branch"`
-	Remote                   string `json:"remote" db:"remote"`
-	CreatedSuccessfully      *bool  `db:"created_successfully"`
-	InitialDeploymentSuccess *bool  `db:"initial_deployment_success"`
+	ID                       int64               `json:"id" db:"id" binding:"required"`
+	Name                     string              `json:"name" db:"name"`
+	RepoUrl                  string              `json:"repo_url" db:"repo_url"`
+	Branch                   string              `json:"branch" db:"branch" binding:"omitempty,gitref"`
+	Remote                   string              `json:"remote" db:"remote" binding:"omitempty,gitref"`
+	CreatedSuccessfully      *bool               `db:"created_successfully"`
+	InitialDeploymentSuccess *bool               `db:"initial_deployment_success"`
+	GitOptions               *models.GitOptions  `db:"git_options"`
+	AppPath                  *string             `db:"app_path"`
+	PathFilters              *models.PathFilters `db:"path_filters"`
+	ExecPolicy               *commands.Policy    `db:"exec_policy"`
 }
 
 type Deployment_Create_Request struct {
 	StackID          int64   `db:"stack_id" json:"stack_id"`
 	Status           string  `db:"status" json:"status"`
 	CommitHash       *string `db:"commit_hash" json:"commit_hash"`
+	Ref              string  `db:"ref" json:"ref"`
+	CommitMessage    string  `db:"commit_message" json:"commit_message"`
+	Pusher           string  `db:"pusher" json:"pusher"`
 	RolledBackFromID *int64  `db:"rolled_back_from_id" json:"rolled_back_from_id"`
 }
 type Deployment_Update_Request struct {
 	ID               int64  `db:"id" json:"id"`
 	Status           string `db:"status" json:"status"`
 	CommitHash       string `db:"commit_hash" json:"commit_hash"`
+	Ref              string `db:"ref" json:"ref"`
+	RuntimeVersion   string `db:"runtime_version" json:"runtime_version"`
 	RolledBackFromID *int64 `db:"rolled_back_from_id" json:"rolled_back_from_id"`
 }
 
@@ -58,3 +107,63 @@ type DeploymentLog_Create_Request struct {
 	DeploymentID int64  `db:"deployment_id" json:"deployment_id"`
 	Log          string `db:"log" json:"log"`
 }
+
+type DeploymentStep_Create_Request struct {
+	DeploymentID int64  `db:"deployment_id" json:"deployment_id"`
+	Name         string `db:"name" json:"name"`
+	Status       string `db:"status" json:"status"`
+	StartedAt    string `db:"started_at" json:"started_at"`
+}
+
+type DeploymentStep_Update_Request struct {
+	ID         int64  `db:"id" json:"id"`
+	Status     string `db:"status" json:"status"`
+	FinishedAt string `db:"finished_at" json:"finished_at"`
+	DurationMs int64  `db:"duration_ms" json:"duration_ms"`
+	ExitCode   *int   `db:"exit_code" json:"exit_code"`
+	Log        string `db:"log" json:"log"`
+}
+
+type Nginx_Create_Request struct {
+	StackID    int64               `json:"stack_id" db:"stack_id"`
+	Domain     string              `json:"domain" db:"domain" binding:"required"`
+	Port       int                 `json:"port" db:"port"`
+	SSLEnabled bool                `json:"ssl_enabled" db:"ssl_enabled"`
+	Headers    models.NginxHeaders `json:"headers" db:"headers"`
+	CustomConf string              `json:"custom_conf" db:"custom_conf"`
+}
+
+type Nginx_Update_Request struct {
+	ID         int64 `json:"id" db:"id" binding:"required"`
+	SSLEnabled *bool `json:"ssl_enabled" db:"ssl_enabled"`
+}
+
+type Certificate_Upsert_Request struct {
+	Domain    string `db:"domain" json:"domain"`
+	Issuer    string `db:"issuer" json:"issuer"`
+	CertPath  string `db:"cert_path" json:"cert_path"`
+	KeyPath   string `db:"key_path" json:"key_path"`
+	NotBefore string `db:"not_before" json:"not_before"`
+	ExpiresAt string `db:"expires_at" json:"expires_at"`
+	LastError string `db:"last_error" json:"last_error"`
+}
+
+type DNSRecord_Upsert_Request struct {
+	Domain   string `db:"domain" json:"domain"`
+	Provider string `db:"provider" json:"provider"`
+	ZoneID   string `db:"zone_id" json:"zone_id"`
+	RecordID string `db:"record_id" json:"record_id"`
+	Type     string `db:"type" json:"type"`
+	Content  string `db:"content" json:"content"`
+	TTL      int    `db:"ttl" json:"ttl"`
+	Proxied  bool   `db:"proxied" json:"proxied"`
+}
+
+type DNSRecord_Sync_Request struct {
+	Domain   string `json:"domain" binding:"required"`
+	Provider string `json:"provider"`
+	Type     string `json:"type"`
+	Content  string `json:"content"`
+	TTL      int    `json:"ttl"`
+	Proxied  *bool  `json:"proxied"`
+}
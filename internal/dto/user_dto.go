@@ -3,8 +3,68 @@ package dto
 type User_RegisterRequest struct {
 	ID       int64  `json:"id"`
 	Email    string `json:"email,omitempty" binding:"required,email"`
-	Password string `json:"password,omitempty" binding:"required,min=4,max=16"`
-	Role     string `json:"role,omitempty"`
+	Password string `json:"password,omitempty" binding:"required,min=12"`
+	Role     string `json:"role,omitempty" binding:"omitempty,oneof=admin maintainer deployer viewer member"`
+	// InviteToken creates the account from an invitation, it is required while signup is disabled
+	InviteToken string `json:"invite_token,omitempty"`
+}
+
+type User_Update_Request struct {
+	ID    int64   `json:"-"`
+	Email *string `json:"email,omitempty" binding:"omitempty,email"`
+	Role  *string `json:"role,omitempty" binding:"omitempty,oneof=admin maintainer deployer viewer member"`
+}
+
+type User_ChangePassword_Request struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=12"`
+}
+
+type User_ResetPassword_Request struct {
+	// Password is generated when empty
+	Password string `json:"password,omitempty" binding:"omitempty,min=12"`
+}
+
+type UserInvitation_Create_Request struct {
+	// Email restricts the invitation to one address when set
+	Email          string `json:"email,omitempty" binding:"omitempty,email"`
+	Role           string `json:"role" binding:"required,oneof=admin maintainer deployer viewer member"`
+	ExpiresInHours int    `json:"expires_in_hours,omitempty" binding:"omitempty,min=1,max=720"`
+	CreatedBy      int64  `json:"-"`
+}
+
+type StackMember_Upsert_Request struct {
+	StackID int64  `json:"-"`
+	UserID  int64  `json:"user_id" binding:"required"`
+	Role    string `json:"role" binding:"required,oneof=maintainer deployer viewer"`
+}
+
+type APIToken_Create_Request struct {
+	UserID        int64    `json:"-"`
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty" binding:"omitempty,min=1,max=3650"`
+}
+
+type Session_Refresh_Request struct {
+	// RefreshToken is read from the Refresh cookie when empty
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+type TwoFactor_Code_Request struct {
+	// Code is a code of the TOTP app, RecoveryCode a recovery code used instead of it
+	Code         string `json:"code,omitempty" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+type TwoFactor_Login_Request struct {
+	Token string `json:"two_factor_token" binding:"required"`
+	TwoFactor_Code_Request
+}
+
+type TwoFactor_Disable_Request struct {
+	Password string `json:"password" binding:"required"`
+	TwoFactor_Code_Request
 }
 
 type User_LoginRequest struct {
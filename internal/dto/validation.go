@@ -0,0 +1,54 @@
+package dto
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+)
+
+// git refs and hashes of requests end up in the arguments of git commands
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterValidation("gitref", func(fl validator.FieldLevel) bool { return ValidGitRef(fl.Field().String()) })
+		v.RegisterValidation("githash", func(fl validator.FieldLevel) bool { return ValidGitHash(fl.Field().String()) })
+	}
+}
+
+var gitHashPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// ValidGitRef reports whether a branch, tag, remote or ref name is accepted by git and can't be taken for an option
+func ValidGitRef(ref string) bool {
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return false
+	}
+	return exec.Command("git", "check-ref-format", "--allow-onelevel", ref).Run() == nil
+}
+
+// ValidGitHash reports whether a commit hash is 7 to 40 lower case hex characters
+func ValidGitHash(hash string) bool {
+	return gitHashPattern.MatchString(hash)
+}
+
+// Validate checks the binding tags of a request that was not bound by gin, like deploys of the cli and of webhooks
+func Validate(obj any) error {
+	err := binding.Validator.ValidateStruct(obj)
+	if err == nil {
+		return nil
+	}
+	fields := pkg.TagValidationErrors(err, obj)
+	if len(fields) == 0 {
+		return err
+	}
+	messages := make([]string, 0, len(fields))
+	for _, message := range fields {
+		messages = append(messages, message)
+	}
+	sort.Strings(messages)
+	return errors.New(strings.Join(messages, ", "))
+}
@@ -0,0 +1,65 @@
+package dto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidGitRef(t *testing.T) {
+	tests := []struct {
+		ref   string
+		valid bool
+	}{
+		{"main", true},
+		{"feature/login", true},
+		{"refs/tags/v1.2.0", true},
+		{"v1.2.0", true},
+		{"0a1b2c3", true},
+		{"", false},
+		{"-b", false},
+		{"--upload-pack=touch /tmp/pwned", false},
+		{"main..dev", false},
+		{"feature branch", false},
+		{"HEAD~1", false},
+		{"main.lock", false},
+		{"refs/heads/", false},
+		{"bad\nref", false},
+	}
+	for _, tt := range tests {
+		if got := ValidGitRef(tt.ref); got != tt.valid {
+			t.Errorf("ValidGitRef(%q) = %v, want %v", tt.ref, got, tt.valid)
+		}
+	}
+}
+
+func TestValidGitHash(t *testing.T) {
+	tests := []struct {
+		hash  string
+		valid bool
+	}{
+		{"0a1b2c3", true},
+		{"0123456789abcdef0123456789abcdef01234567", true},
+		{"0a1b2c", false},
+		{"0123456789abcdef0123456789abcdef012345678", false},
+		{"0A1B2C3", false},
+		{"-0a1b2c3", false},
+		{"main", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidGitHash(tt.hash); got != tt.valid {
+			t.Errorf("ValidGitHash(%q) = %v, want %v", tt.hash, got, tt.valid)
+		}
+	}
+}
+
+func TestValidateDeployRequest(t *testing.T) {
+	if err := Validate(&Stack_Deploy_Request{Branch: "main", GitHash: "0a1b2c3", PushedCommit: "0a1b2c3"}); err != nil {
+		t.Fatalf("valid request: %v", err)
+	}
+	// webhook deploys are not bound by gin, the pushed commit comes from the payload
+	err := Validate(&Stack_Deploy_Request{GitHash: "--upload-pack=sh", PushedCommit: "--upload-pack=sh"})
+	if err == nil || !strings.Contains(err.Error(), "git_hash") || !strings.Contains(err.Error(), "PushedCommit") {
+		t.Fatalf("error = %v, want git_hash and PushedCommit rejected", err)
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/satnamSandhu2001/stackjet/pkg/API"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	service *services.AuditService
+}
+
+func NewAuditHandler(service *services.AuditService) *AuditHandler {
+	return &AuditHandler{
+		service: service,
+	}
+}
+
+// GET /audit
+func (h *AuditHandler) ListEvents(c *gin.Context) {
+	var query dto.AuditEvent_List_Request
+	if err := c.ShouldBindQuery(&query); err != nil {
+		errors := pkg.TagValidationErrors(err, &query)
+		API.ValidationsErrors(c, errors)
+		return
+	}
+	events, err := h.service.ListEvents(c.Request.Context(), &query)
+	if errors.Is(err, services.ErrInvalidAuditTime) {
+		API.Error(c, err.Error())
+		return
+	}
+	if err != nil {
+		API.InternalServerError(c, "failed to list audit events", err)
+		return
+	}
+	API.Success(c, "success", events)
+}
@@ -1,7 +1,17 @@
 package handlers
 
 import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/satnamSandhu2001/stackjet/internal/core/oidc"
 	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
 	"github.com/satnamSandhu2001/stackjet/internal/services"
 	"github.com/satnamSandhu2001/stackjet/pkg"
 	"github.com/satnamSandhu2001/stackjet/pkg/API"
@@ -9,14 +19,30 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// oidcLoginCookie keeps an OIDC login between the redirects to and from the provider
+const oidcLoginCookie = "OIDC"
+
 type AuthHandler struct {
 	service services.UserService
+	// oidc is nil unless OIDC login is configured
+	oidc *oidc.Client
 }
 
 func NewAuthHandler(service *services.UserService) *AuthHandler {
-	return &AuthHandler{
+	h := &AuthHandler{
 		service: *service,
 	}
+	if config := pkg.Config(); config.OIDCEnabled() {
+		h.oidc = oidc.NewClient(oidc.Config{
+			DiscoveryURL: config.OIDC_DISCOVERY_URL,
+			ClientID:     config.OIDC_CLIENT_ID,
+			ClientSecret: config.OIDC_CLIENT_SECRET,
+			RedirectURL:  config.OIDC_REDIRECT_URL,
+			Scopes:       config.OIDC_SCOPES,
+			GroupsClaim:  config.OIDC_GROUPS_CLAIM,
+		})
+	}
+	return h
 }
 
 // POST /auth/signup
@@ -27,6 +53,10 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 		API.ValidationsErrors(c, errors)
 		return
 	}
+	if u.InviteToken == "" && !pkg.Config().ALLOW_SIGNUP {
+		API.Forbidden(c, "signup is disabled, ask an admin for an invitation")
+		return
+	}
 	userExists, err := h.service.GetUserByEmail(c.Request.Context(), u.Email)
 	if err != nil {
 		API.InternalServerError(c, "Failed to signup", err)
@@ -36,7 +66,19 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 		API.Error(c, "User with this email already exists")
 		return
 	}
-	if err := h.service.CreateUser(c.Request.Context(), &u); err != nil {
+	if u.InviteToken != "" {
+		// the invitation decides the role
+		err = h.service.CreateUserWithInvitation(c.Request.Context(), &u, u.InviteToken)
+	} else {
+		// roles are granted by admins, accounts created through open signup are members of no stack
+		u.Role = string(models.RoleMember)
+		err = h.service.CreateUser(c.Request.Context(), &u)
+	}
+	if errors.Is(err, services.ErrInvalidInvitation) {
+		API.Error(c, err.Error())
+		return
+	}
+	if err != nil {
 		API.InternalServerError(c, "Failed to signup", err)
 		return
 	}
@@ -47,12 +89,7 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 		return
 	}
 
-	token, err := pkg.GenerateToken(u.Email)
-	if err != nil {
-		API.InternalServerError(c, "Failed to generate token", err)
-
-	}
-	API.SendJWTtoken(c, token, "Account Created Successfully", map[string]any{"token": token, "user": newUser})
+	h.startSession(c, newUser, models.AUTH_METHOD_PASSWORD, "Account Created Successfully")
 }
 
 // POST /auth/login
@@ -66,6 +103,14 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	user, err := h.service.Authenticate(c.Request.Context(), u.Email, u.Password)
+	if errors.Is(err, services.ErrUserDisabled) || errors.Is(err, services.ErrUserLocked) {
+		API.Forbidden(c, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrInvalidPassword) {
+		API.Error(c, "invalid credentials")
+		return
+	}
 	if err != nil {
 		API.InternalServerError(c, "invalid credentials", err)
 		return
@@ -75,10 +120,295 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := pkg.GenerateToken(u.Email)
+	// the session starts once the second factor is verified
+	if user.TOTPEnabled {
+		token, err := pkg.GenerateTwoFactorToken(user.Email, models.AUTH_METHOD_PASSWORD)
+		if err != nil {
+			API.InternalServerError(c, "failed to generate token", err)
+			return
+		}
+		API.Success(c, "two-factor code required", gin.H{
+			"two_factor_required": true,
+			"two_factor_token":    token,
+			"expires_in":          int(pkg.TwoFactorTokenTTL.Seconds()),
+		})
+		return
+	}
+
+	h.startSession(c, user, models.AUTH_METHOD_PASSWORD, "logged in successfully")
+}
+
+// POST /auth/2fa/verify
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var body dto.TwoFactor_Login_Request
+	if err := c.ShouldBindJSON(&body); err != nil {
+		errors := pkg.TagValidationErrors(err, &body)
+		API.ValidationsErrors(c, errors)
+		return
+	}
+
+	email, authMethod, err := pkg.ValidateTwoFactorToken(body.Token)
+	if err != nil {
+		API.Unauthorized(c, "two-factor token is invalid or expired, log in again")
+		return
+	}
+	user, err := h.service.GetUserByEmail(c.Request.Context(), email)
+	if err != nil {
+		API.InternalServerError(c, "failed to verify code", err)
+		return
+	}
+	if user == nil || user.Disabled || !user.TOTPEnabled {
+		API.Unauthorized(c, "unauthorized")
+		return
+	}
+	if user.IsLocked(time.Now()) {
+		API.Forbidden(c, services.ErrUserLocked.Error())
+		return
+	}
+
+	err = h.service.VerifySecondFactor(c.Request.Context(), user, body.Code, body.RecoveryCode)
+	if errors.Is(err, services.ErrInvalidTOTPCode) {
+		// codes count as failed logins, a stolen password must not allow guessing them
+		if err := h.service.RecordFailedLogin(c.Request.Context(), user); err != nil {
+			API.InternalServerError(c, "failed to verify code", err)
+			return
+		}
+		API.Unauthorized(c, err.Error())
+		return
+	}
+	if err != nil {
+		API.InternalServerError(c, "failed to verify code", err)
+		return
+	}
+	// tokens of older versions have no method, they were all issued for password logins
+	if authMethod == "" {
+		authMethod = models.AUTH_METHOD_PASSWORD
+	}
+	h.startSession(c, user, authMethod, "logged in successfully")
+}
+
+// GET /auth/oidc/login?redirect=/path
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	if h.oidc == nil {
+		API.NotFound(c, "OIDC login is not configured")
+		return
+	}
+	var login pkg.OIDCLoginClaims
+	var err error
+	for _, value := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		if *value, err = oidc.GenerateVerifier(); err != nil {
+			API.InternalServerError(c, "failed to start OIDC login", err)
+			return
+		}
+	}
+	// only paths of this server, a full URL would make the login an open redirect
+	login.Redirect = c.Query("redirect")
+	if !strings.HasPrefix(login.Redirect, "/") || strings.HasPrefix(login.Redirect, "//") || strings.HasPrefix(login.Redirect, "/\\") {
+		login.Redirect = "/"
+	}
+
+	authURL, err := h.oidc.AuthCodeURL(c.Request.Context(), login.State, login.Nonce, login.Verifier)
+	if err != nil {
+		API.InternalServerError(c, "OIDC provider is unavailable", err)
+		return
+	}
+	token, err := pkg.GenerateOIDCLoginToken(login)
+	if err != nil {
+		API.InternalServerError(c, "failed to generate token", err)
+		return
+	}
+	h.setOIDCLoginCookie(c, token, int(pkg.OIDCLoginTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// GET /auth/oidc/callback?code=...&state=...
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	if h.oidc == nil {
+		API.NotFound(c, "OIDC login is not configured")
+		return
+	}
+	cookie, _ := c.Cookie(oidcLoginCookie)
+	// each login is used once
+	h.setOIDCLoginCookie(c, "", -1)
+	login, err := pkg.ValidateOIDCLoginToken(cookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(login.State)) != 1 {
+		API.Unauthorized(c, "OIDC login is invalid or expired, log in again")
+		return
+	}
+	if providerErr := c.Query("error"); providerErr != "" {
+		API.Unauthorized(c, strings.TrimSpace("OIDC login failed: "+providerErr+" "+c.Query("error_description")))
+		return
+	}
+	if c.Query("code") == "" {
+		API.Error(c, "code is required")
+		return
+	}
+
+	identity, err := h.oidc.Exchange(c.Request.Context(), c.Query("code"), login.Verifier, login.Nonce)
+	if err != nil {
+		log.Println("OIDC login failed :", err)
+		API.Unauthorized(c, "OIDC login failed")
+		return
+	}
+	config := pkg.Config()
+	role := oidcRole(config.OIDC_ROLE_MAPPING, identity.Groups)
+	var provisionRole models.Role
+	if config.OIDC_AUTO_PROVISION {
+		provisionRole = role
+		if provisionRole == "" {
+			provisionRole = models.Role(config.OIDC_DEFAULT_ROLE)
+		}
+		if !provisionRole.IsValid() {
+			provisionRole = ""
+		}
+	}
+	user, err := h.service.AuthenticateOIDC(c.Request.Context(), identity, role, provisionRole)
+	if errors.Is(err, services.ErrOIDCUserUnknown) || errors.Is(err, services.ErrOIDCAdminLink) || errors.Is(err, services.ErrUserDisabled) {
+		API.Forbidden(c, err.Error())
+		return
+	}
+	if err != nil {
+		API.InternalServerError(c, "OIDC login failed", err)
+		return
+	}
+
+	// the provider may not ask for a second factor, accounts with one enter it like on password logins
+	if user.TOTPEnabled {
+		token, err := pkg.GenerateTwoFactorToken(user.Email, models.AUTH_METHOD_OIDC)
+		if err != nil {
+			API.InternalServerError(c, "failed to generate token", err)
+			return
+		}
+		// fragments are not sent to servers, the panel posts the token with the code to /auth/2fa/verify
+		location, _, _ := strings.Cut(login.Redirect, "#")
+		c.Redirect(http.StatusFound, location+"#"+url.Values{"two_factor_required": {"true"}, "two_factor_token": {token}}.Encode())
+		return
+	}
+
+	token, refreshToken, ok := h.createSession(c, user, models.AUTH_METHOD_OIDC)
+	if !ok {
+		return
+	}
+	API.RedirectSession(c, token, refreshToken, login.Redirect)
+}
+
+// oidcRole returns the role with the most permissions mapped from groups, empty when no group is mapped
+func oidcRole(mapping map[string]string, groups []string) models.Role {
+	var role models.Role
+	for _, group := range groups {
+		if mapped := models.Role(mapping[group]); mapped.IsValid() {
+			role = role.Max(mapped)
+		}
+	}
+	return role
+}
+
+// setOIDCLoginCookie sets the cookie of an OIDC login, it is sent back when the provider redirects to the callback
+func (h *AuthHandler) setOIDCLoginCookie(c *gin.Context, token string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcLoginCookie, token, maxAge, "/api/v1/auth/oidc", "", pkg.Config().GO_ENV == "production", true)
+}
+
+// POST /auth/refresh
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	refreshToken := h.refreshToken(c)
+	if refreshToken == "" {
+		API.Unauthorized(c, "refresh token is required")
+		return
+	}
+
+	session, newRefreshToken, err := h.service.RefreshSession(c.Request.Context(), refreshToken)
+	if errors.Is(err, services.ErrInvalidSession) {
+		API.ClearSession(c)
+		API.Unauthorized(c, err.Error())
+		return
+	}
+	if err != nil {
+		API.InternalServerError(c, "failed to refresh session", err)
+		return
+	}
+	user, err := h.service.GetUserByID(c.Request.Context(), session.UserID)
+	if err != nil {
+		API.InternalServerError(c, "failed to refresh session", err)
+		return
+	}
+	if user == nil || user.Disabled {
+		h.service.RevokeSession(c.Request.Context(), session.ID)
+		API.ClearSession(c)
+		API.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	token, err := pkg.GenerateToken(user.Email, session.ID)
+	if err != nil {
+		API.InternalServerError(c, "failed to generate token", err)
+		return
+	}
+	API.SendSession(c, token, newRefreshToken, "session refreshed", map[string]any{"user": user})
+}
+
+// POST /auth/logout
+func (h *AuthHandler) Logout(c *gin.Context) {
+	// the access token may have expired already, the refresh token identifies the session too
+	var err error
+	if refreshToken := h.refreshToken(c); refreshToken != "" {
+		err = h.service.RevokeSessionByRefreshToken(c.Request.Context(), refreshToken)
+	} else if _, sessionID, verr := pkg.ValidateToken(h.accessToken(c)); verr == nil {
+		err = h.service.RevokeSession(c.Request.Context(), sessionID)
+	}
+	if err != nil {
+		API.InternalServerError(c, "failed to logout", err)
+		return
+	}
+	API.ClearSession(c)
+	API.Success(c, "logged out successfully", nil)
+}
+
+// startSession creates a session of the user and sends its tokens
+func (h *AuthHandler) startSession(c *gin.Context, user *models.User, authMethod string, message string) {
+	token, refreshToken, ok := h.createSession(c, user, authMethod)
+	if !ok {
+		return
+	}
+	API.SendSession(c, token, refreshToken, message, map[string]any{"user": user})
+}
+
+// createSession creates a session of the user and returns its access and refresh tokens, it responds on failure
+func (h *AuthHandler) createSession(c *gin.Context, user *models.User, authMethod string) (string, string, bool) {
+	if user.FailedLogins > 0 {
+		if err := h.service.ResetFailedLogins(c.Request.Context(), user.ID); err != nil {
+			API.InternalServerError(c, "failed to create session", err)
+			return "", "", false
+		}
+	}
+	session, refreshToken, err := h.service.CreateSession(c.Request.Context(), user.ID, authMethod, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		API.InternalServerError(c, "failed to create session", err)
+		return "", "", false
+	}
+	token, err := pkg.GenerateToken(user.Email, session.ID)
 	if err != nil {
 		API.InternalServerError(c, "failed to generate token", err)
+		return "", "", false
+	}
+	return token, refreshToken, true
+}
+
+// accessToken returns the access token of the Authorization header or cookie
+func (h *AuthHandler) accessToken(c *gin.Context) string {
+	token := c.GetHeader("Authorization")
+	if token == "" {
+		token, _ = c.Cookie("Authorization")
 	}
+	return strings.TrimPrefix(token, "Bearer ")
+}
 
-	API.SendJWTtoken(c, token, "logged in successfully", map[string]any{"token": token, "user": user})
+// refreshToken returns the refresh token of the request body or the Refresh cookie
+func (h *AuthHandler) refreshToken(c *gin.Context) string {
+	var body dto.Session_Refresh_Request
+	if err := c.ShouldBindJSON(&body); err == nil && body.RefreshToken != "" {
+		return body.RefreshToken
+	}
+	token, _ := c.Cookie("Refresh")
+	return token
 }
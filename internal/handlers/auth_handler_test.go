@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/satnamSandhu2001/stackjet/internal/core/oidc"
+	"github.com/satnamSandhu2001/stackjet/internal/core/oidc/oidctest"
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+)
+
+const callbackURL = "http://stackjet.test/api/v1/auth/oidc/callback"
+
+// newOIDCRouter serves the OIDC routes of an auth handler logging in at provider
+func newOIDCRouter(t *testing.T, provider *oidctest.Provider) (*gin.Engine, *services.UserService) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	service := services.NewUserService(testDB)
+	h := &AuthHandler{
+		service: *service,
+		oidc:    oidc.NewClient(oidc.Config{DiscoveryURL: provider.Issuer(), ClientID: provider.ClientID, RedirectURL: callbackURL}),
+	}
+	router := gin.New()
+	router.GET("/api/v1/auth/oidc/login", h.OIDCLogin)
+	router.GET("/api/v1/auth/oidc/callback", h.OIDCCallback)
+	return router, service
+}
+
+func serve(router *gin.Engine, target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// startOIDCLogin starts a login and follows it to the provider, returning the login cookie and the callback
+func startOIDCLogin(t *testing.T, router *gin.Engine, provider *oidctest.Provider, redirect string) (*http.Cookie, *url.URL) {
+	t.Helper()
+	w := serve(router, "/api/v1/auth/oidc/login?redirect="+url.QueryEscape(redirect))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login responded %d: %s", w.Code, w.Body)
+	}
+	cookie := responseCookie(w, oidcLoginCookie)
+	if cookie == nil || cookie.Value == "" {
+		t.Fatal("login set no OIDC cookie")
+	}
+	back, err := provider.Authorize(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cookie, back
+}
+
+func TestOIDCCallbackProvisionsUser(t *testing.T) {
+	provider := oidctest.NewProvider("stackjet")
+	defer provider.Close()
+	provider.Claims = jwt.MapClaims{"sub": "subject-new", "email": "new@example.com", "email_verified": true, "groups": []string{"ops"}}
+	router, service := newOIDCRouter(t, provider)
+
+	cookie, back := startOIDCLogin(t, router, provider, "/apps")
+	w := serve(router, back.RequestURI(), cookie)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/apps" {
+		t.Fatalf("callback responded %d to %q: %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	if session := responseCookie(w, "Authorization"); session == nil || session.Value == "" {
+		t.Error("callback set no session")
+	}
+
+	user, err := service.GetUserByEmail(context.Background(), "new@example.com")
+	if err != nil || user == nil {
+		t.Fatalf("user was not provisioned: %v", err)
+	}
+	if user.Role != models.RoleMaintainer {
+		t.Errorf("role = %s, want the maintainer role mapped from ops", user.Role)
+	}
+	if user.OIDCSubject == nil || *user.OIDCSubject != "subject-new" {
+		t.Errorf("subject = %v, want subject-new", user.OIDCSubject)
+	}
+
+	// the login cookie is used once
+	if w := serve(router, back.RequestURI(), cookie); w.Code != http.StatusUnauthorized {
+		t.Errorf("second callback of the login responded %d, want 401", w.Code)
+	}
+}
+
+func TestOIDCCallbackRejectsInvalidLogins(t *testing.T) {
+	provider := oidctest.NewProvider("stackjet")
+	defer provider.Close()
+	provider.Claims = jwt.MapClaims{"sub": "subject-rejected", "email": "rejected@example.com", "email_verified": true}
+	router, _ := newOIDCRouter(t, provider)
+
+	t.Run("no cookie", func(t *testing.T) {
+		_, back := startOIDCLogin(t, router, provider, "/")
+		if w := serve(router, back.RequestURI()); w.Code != http.StatusUnauthorized {
+			t.Errorf("callback without login cookie responded %d, want 401", w.Code)
+		}
+	})
+	t.Run("state of another login", func(t *testing.T) {
+		cookie, _ := startOIDCLogin(t, router, provider, "/")
+		_, other := startOIDCLogin(t, router, provider, "/")
+		if w := serve(router, other.RequestURI(), cookie); w.Code != http.StatusUnauthorized {
+			t.Errorf("callback with the state of another login responded %d, want 401", w.Code)
+		}
+	})
+	t.Run("provider error", func(t *testing.T) {
+		cookie, back := startOIDCLogin(t, router, provider, "/")
+		query := url.Values{"state": {back.Query().Get("state")}, "error": {"access_denied"}}
+		if w := serve(router, back.Path+"?"+query.Encode(), cookie); w.Code != http.StatusUnauthorized {
+			t.Errorf("callback with a provider error responded %d, want 401", w.Code)
+		}
+	})
+	t.Run("unverified email", func(t *testing.T) {
+		provider.Claims["email_verified"] = false
+		defer func() { provider.Claims["email_verified"] = true }()
+		cookie, back := startOIDCLogin(t, router, provider, "/")
+		if w := serve(router, back.RequestURI(), cookie); w.Code != http.StatusForbidden {
+			t.Errorf("callback of an unverified email responded %d, want 403", w.Code)
+		}
+	})
+	t.Run("open redirect", func(t *testing.T) {
+		cookie, back := startOIDCLogin(t, router, provider, "//evil.example.com")
+		w := serve(router, back.RequestURI(), cookie)
+		if w.Code != http.StatusFound || w.Header().Get("Location") != "/" {
+			t.Errorf("callback redirected to %q, want /", w.Header().Get("Location"))
+		}
+	})
+}
+
+func TestOIDCCallbackDoesNotLinkAdmin(t *testing.T) {
+	provider := oidctest.NewProvider("stackjet")
+	defer provider.Close()
+	provider.Claims = jwt.MapClaims{"sub": "subject-admin", "email": "admin@example.com", "email_verified": true}
+	router, service := newOIDCRouter(t, provider)
+	ctx := context.Background()
+	if err := service.CreateUser(ctx, &dto.User_RegisterRequest{Email: "admin@example.com", Password: "correct horse battery", Role: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cookie, back := startOIDCLogin(t, router, provider, "/")
+	if w := serve(router, back.RequestURI(), cookie); w.Code != http.StatusForbidden {
+		t.Fatalf("callback of an unlinked admin responded %d, want 403", w.Code)
+	}
+	admin, err := service.GetUserByEmail(ctx, "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.OIDCSubject != nil {
+		t.Fatalf("admin was linked to subject %s on login", *admin.OIDCSubject)
+	}
+
+	// the explicit link lets the admin log in
+	if err := service.LinkOIDCSubject(ctx, admin.ID, "subject-admin"); err != nil {
+		t.Fatal(err)
+	}
+	cookie, back = startOIDCLogin(t, router, provider, "/")
+	if w := serve(router, back.RequestURI(), cookie); w.Code != http.StatusFound || responseCookie(w, "Authorization") == nil {
+		t.Fatalf("callback of a linked admin responded %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestOIDCCallbackRequiresTwoFactor(t *testing.T) {
+	provider := oidctest.NewProvider("stackjet")
+	defer provider.Close()
+	provider.Claims = jwt.MapClaims{"sub": "subject-2fa", "email": "totp@example.com", "email_verified": true}
+	router, service := newOIDCRouter(t, provider)
+	h := &AuthHandler{service: *service}
+	router.POST("/api/v1/auth/2fa/verify", h.VerifyTwoFactor)
+	ctx := context.Background()
+
+	if err := service.CreateUser(ctx, &dto.User_RegisterRequest{Email: "totp@example.com", Password: "correct horse battery", Role: "deployer"}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := service.GetUserByEmail(ctx, "totp@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.Exec("UPDATE users SET totp_enabled = 1 WHERE id = ?", user.ID); err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes, err := service.RegenerateRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookie, back := startOIDCLogin(t, router, provider, "/apps")
+	w := serve(router, back.RequestURI(), cookie)
+	if w.Code != http.StatusFound {
+		t.Fatalf("callback responded %d: %s", w.Code, w.Body)
+	}
+	if responseCookie(w, "Authorization") != nil {
+		t.Fatal("callback started a session before the second factor")
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fragment, _ := url.ParseQuery(location.Fragment)
+	if location.Path != "/apps" || fragment.Get("two_factor_required") != "true" || fragment.Get("two_factor_token") == "" {
+		t.Fatalf("callback redirected to %s, want /apps with a two-factor token in the fragment", location)
+	}
+
+	body, _ := json.Marshal(dto.TwoFactor_Login_Request{Token: fragment.Get("two_factor_token"), TwoFactor_Code_Request: dto.TwoFactor_Code_Request{RecoveryCode: recoveryCodes[0]}})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/2fa/verify", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("two-factor verify responded %d: %s", w.Code, w.Body)
+	}
+	sessions, err := service.ListSessions(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].AuthMethod != models.AUTH_METHOD_OIDC {
+		t.Errorf("sessions = %+v, want one OIDC session", sessions)
+	}
+}
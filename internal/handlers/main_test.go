@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/satnamSandhu2001/stackjet/database"
+)
+
+// testDB is the database of a StackJet initialized in a temporary home for the tests
+var testDB *sqlx.DB
+
+// testConfig is the config.json of the tests
+const testConfig = `{
+	"oidc_role_mapping": {"ops": "maintainer"},
+	"oidc_auto_provision": true,
+	"oidc_default_role": "viewer",
+	"login_lockout_attempts": -1,
+	"rate_limits": {"webhook": 5, "webhook_failed": 3}
+}`
+
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "stackjet-handlers")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	code := func() int {
+		defer os.RemoveAll(home)
+		os.Setenv("HOME", home)
+		dir := filepath.Join(home, ".stackjet")
+		files := map[string]string{"init.lock": "", "jwt.token": "test-signing-key", "config.json": testConfig}
+		if err := os.Mkdir(dir, 0700); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+		}
+		if err := database.RunInitSQL(); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		testDB = database.Connect()
+		defer testDB.Close()
+		return m.Run()
+	}()
+	os.Exit(code)
+}
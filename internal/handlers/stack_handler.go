@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"strconv"
 	"strings"
@@ -8,19 +10,28 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/satnamSandhu2001/stackjet/internal/core/stack"
 	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/middlewares"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
 	"github.com/satnamSandhu2001/stackjet/internal/services"
 	"github.com/satnamSandhu2001/stackjet/pkg"
 	"github.com/satnamSandhu2001/stackjet/pkg/API"
 	"github.com/satnamSandhu2001/stackjet/pkg/helpers"
+	"github.com/satnamSandhu2001/stackjet/pkg/logger"
 )
 
 type StackHandler struct {
 	service services.StackService
+	secrets services.SecretService
+	users   services.UserService
+	audit   *services.AuditService
 }
 
-func NewStackHandler(service *services.StackService) *StackHandler {
+func NewStackHandler(service *services.StackService, secrets *services.SecretService, users *services.UserService, audit *services.AuditService) *StackHandler {
 	return &StackHandler{
 		service: *service,
+		secrets: *secrets,
+		users:   *users,
+		audit:   audit,
 	}
 }
 
@@ -46,50 +57,282 @@ func (h *StackHandler) CreateNewStack(c *gin.Context) {
 	// handle streaming
 	logWriter := API.NewSSEWriter(c.Writer)
 
-	err := stack.CreateNewStack(logWriter, c.Request.Context(), h.service, &body)
+	err := stack.CreateNewStack(logWriter, c.Request.Context(), h.service, h.secrets, &body)
 
+	done := gin.H{"status": models.DEPLOYMENT_STATUS_SUCCESS}
 	if err != nil {
-		logWriter.Write([]byte("__ERROR__: " + err.Error()))
+		done = gin.H{"status": models.DEPLOYMENT_STATUS_FAILED, "error": err.Error()}
 	}
+	logWriter.WriteEvent("done", done)
 	logWriter.Close()
 }
 
 func (h *StackHandler) DeployStack(c *gin.Context) {
+	body, ok := bindDeployRequest(c)
+	if !ok {
+		return
+	}
+	body.GitReset = pkg.Config().GIT_RESET
+
+	h.streamDeployment(c, func(w io.Writer) (int64, error) {
+		return stack.DeployStack(w, c.Request.Context(), h.service, h.secrets, body)
+	})
+}
+
+// POST /stack/rollback/:id
+func (h *StackHandler) RollbackStack(c *gin.Context) {
+	body, ok := bindRollbackRequest(c)
+	if !ok {
+		return
+	}
+	body.GitReset = pkg.Config().GIT_RESET
+
+	// the deployment rolled back to must be one of the stack permissions were checked for
+	if body.DeploymentID != 0 {
+		deployment, err := h.service.GetDeploymentByID(c.Request.Context(), body.DeploymentID)
+		if err != nil {
+			API.InternalServerError(c, "failed to get deployment", err)
+			return
+		}
+		if deployment == nil || deployment.StackID != body.ID {
+			API.NotFound(c, "deployment not found")
+			return
+		}
+	}
+
+	h.streamDeployment(c, func(w io.Writer) (int64, error) {
+		return stack.RollbackStack(w, c.Request.Context(), h.service, h.secrets, body)
+	})
+}
+
+// bindDeployRequest binds the body of a deploy. The stack is set from the route after binding,
+// so that the body can not deploy another stack than the one permissions were checked for.
+func bindDeployRequest(c *gin.Context) (*dto.Stack_Deploy_Request, bool) {
 	var body dto.Stack_Deploy_Request
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		API.Error(c, "Invalid ID format")
-		return
+		return nil, false
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		errors := pkg.TagValidationErrors(err, &body)
+		API.ValidationsErrors(c, errors)
+		return nil, false
 	}
 	body.ID = id
+	return &body, true
+}
+
+// bindRollbackRequest binds the body of a rollback, the stack is set from the route after binding
+func bindRollbackRequest(c *gin.Context) (*dto.Stack_Rollback_Request, bool) {
+	var body dto.Stack_Rollback_Request
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		API.Error(c, "Invalid ID format")
+		return nil, false
+	}
 	if err := c.ShouldBindJSON(&body); err != nil {
 		errors := pkg.TagValidationErrors(err, &body)
 		API.ValidationsErrors(c, errors)
-		return
+		return nil, false
 	}
+	body.ID = id
+	return &body, true
+}
 
+// streamDeployment runs a deployment and streams its log, step and done events
+func (h *StackHandler) streamDeployment(c *gin.Context, deploy func(w io.Writer) (int64, error)) {
 	// Create log collector
 	var logBuf strings.Builder
 	sseWriter := API.NewSSEWriter(c.Writer)
-	logWriter := io.MultiWriter(sseWriter, &logBuf)
+	logWriter := logger.MultiWriter(sseWriter, &logBuf)
 
-	deploymentID, err := stack.DeployStack(logWriter, c.Request.Context(), h.service, &body)
+	deploymentID, err := deploy(logWriter)
 	if err != nil {
-		logWriter.Write([]byte("__ERROR__: " + err.Error()))
+		logBuf.WriteString("__ERROR__: " + err.Error())
 	}
 
-	// Save logs to DB
+	// Save logs to DB, also when the client disconnected and cancelled the deployment
+	ctx := context.WithoutCancel(c.Request.Context())
+	done := gin.H{"deployment_id": deploymentID, "status": models.DEPLOYMENT_STATUS_SUCCESS}
+	if err != nil {
+		done["status"] = models.DEPLOYMENT_STATUS_FAILED
+		done["error"] = err.Error()
+	}
 	if deploymentID != 0 {
-		h.service.CreateDeploymentLog(c.Request.Context(), &dto.DeploymentLog_Create_Request{DeploymentID: deploymentID, Log: logBuf.String()})
+		h.service.CreateDeploymentLog(ctx, &dto.DeploymentLog_Create_Request{DeploymentID: deploymentID, Log: logBuf.String()})
+		if deployment, err := h.service.GetDeploymentByID(ctx, deploymentID); err == nil && deployment != nil {
+			done["status"] = deployment.Status
+		}
 	}
+	sseWriter.WriteEvent("done", done)
 	sseWriter.Close()
 }
 
+// CancelDeployment cancels a running deployment and kills its commands
+func (h *StackHandler) CancelDeployment(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		API.Error(c, "Invalid ID format")
+		return
+	}
+	deployment, err := h.service.GetDeploymentByID(c.Request.Context(), id)
+	if err != nil {
+		API.InternalServerError(c, "failed to get deployment", err)
+		return
+	}
+	if deployment == nil {
+		API.NotFound(c, "deployment not found")
+		return
+	}
+	if deployment.Status != models.DEPLOYMENT_STATUS_IN_PROGRESS {
+		API.Error(c, "deployment is not in progress")
+		return
+	}
+	if !stack.CancelDeployment(id) {
+		API.Error(c, "deployment is not running on this server, it may have been started from the CLI")
+		return
+	}
+	h.audit.Track(c.Request.Context(), "deployment.cancel", deployment.StackID, fmt.Sprintf("deployment #%d", id), nil)
+	API.Success(c, "deployment cancelled", gin.H{"id": id})
+}
+
+// GET /stack/:id/deployments
+func (h *StackHandler) ListDeployments(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		API.Error(c, "Invalid ID format")
+		return
+	}
+	limit, err := strconv.ParseUint(c.DefaultQuery("limit", "20"), 10, 64)
+	if err != nil || limit == 0 || limit > 1000 {
+		API.Error(c, "limit must be a number from 1 to 1000")
+		return
+	}
+	deployments, err := h.service.GetDeploymentList(c.Request.Context(), id, limit)
+	if err != nil {
+		API.InternalServerError(c, "failed to list deployments", err)
+		return
+	}
+	API.Success(c, "success", deployments)
+}
+
+// GET /deployments/:id/logs, the log is saved when the deployment finished, the steps are recorded while it runs
+func (h *StackHandler) GetDeploymentLogs(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		API.Error(c, "Invalid ID format")
+		return
+	}
+	deployment, err := h.service.GetDeploymentByID(c.Request.Context(), id)
+	if err != nil {
+		API.InternalServerError(c, "failed to get deployment", err)
+		return
+	}
+	if deployment == nil {
+		API.NotFound(c, "deployment not found")
+		return
+	}
+	steps, err := h.service.GetDeploymentSteps(c.Request.Context(), id)
+	if err != nil {
+		API.InternalServerError(c, "failed to get deployment steps", err)
+		return
+	}
+	log, err := h.service.GetDeploymentLog(c.Request.Context(), id)
+	if err != nil {
+		API.InternalServerError(c, "failed to get deployment log", err)
+		return
+	}
+	API.Success(c, "success", gin.H{"deployment": deployment, "steps": steps, "log": log})
+}
+
 func (h *StackHandler) ListStacks(c *gin.Context) {
-	stacks, err := h.service.GetStackList(c.Request.Context())
+	user := middlewares.CurrentUser(c)
+	var stacks []models.Stack
+	var err error
+	// a role on all stacks reads every stack, other users only the stacks they are members of
+	if user.Role.Includes(models.RoleViewer) {
+		stacks, err = h.service.GetStackList(c.Request.Context())
+	} else {
+		stacks, err = h.service.GetMemberStackList(c.Request.Context(), user.ID)
+	}
 	if err != nil {
 		API.Error(c, "failed to list stacks")
 		return
 	}
+	if token := middlewares.CurrentAPIToken(c); token != nil {
+		allowed := []models.Stack{}
+		for _, s := range stacks {
+			if token.Scopes.Allows(models.RoleViewer, s.ID) {
+				allowed = append(allowed, s)
+			}
+		}
+		stacks = allowed
+	}
 	API.Success(c, "success", stacks)
 }
+
+// GET /stack/:id/members
+func (h *StackHandler) ListMembers(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		API.Error(c, "Invalid ID format")
+		return
+	}
+	members, err := h.service.ListStackMembers(c.Request.Context(), id)
+	if err != nil {
+		API.InternalServerError(c, "failed to list members", err)
+		return
+	}
+	API.Success(c, "success", members)
+}
+
+// PUT /stack/:id/members
+func (h *StackHandler) UpsertMember(c *gin.Context) {
+	var body dto.StackMember_Upsert_Request
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		API.Error(c, "Invalid ID format")
+		return
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		errors := pkg.TagValidationErrors(err, &body)
+		API.ValidationsErrors(c, errors)
+		return
+	}
+	body.StackID = id
+
+	user, err := h.users.GetUserByID(c.Request.Context(), body.UserID)
+	if err != nil {
+		API.InternalServerError(c, "failed to get user", err)
+		return
+	}
+	if user == nil {
+		API.NotFound(c, "user not found")
+		return
+	}
+	if err := h.service.UpsertStackMember(c.Request.Context(), &body); err != nil {
+		API.InternalServerError(c, "failed to save member", err)
+		return
+	}
+	API.Success(c, "member saved", gin.H{"stack_id": id, "user_id": body.UserID, "role": body.Role})
+}
+
+// DELETE /stack/:id/members/:user_id
+func (h *StackHandler) DeleteMember(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		API.Error(c, "Invalid ID format")
+		return
+	}
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		API.Error(c, "Invalid user ID format")
+		return
+	}
+	if err := h.service.DeleteStackMember(c.Request.Context(), id, userID); err != nil {
+		API.InternalServerError(c, "failed to remove member", err)
+		return
+	}
+	API.Success(c, "member removed", gin.H{"stack_id": id, "user_id": userID})
+}
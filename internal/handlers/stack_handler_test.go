@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+)
+
+func newRouteContext(id string, body string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/stack/deploy/"+id, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: id}}
+	return c, w
+}
+
+func TestBindDeployRequestKeepsRouteStack(t *testing.T) {
+	c, _ := newRouteContext("3", `{"id": 7, "directory": "/var/www/sites/other", "GitReset": true, "Directory": "/tmp", "branch": "main"}`)
+
+	body, ok := bindDeployRequest(c)
+	if !ok {
+		t.Fatal("valid deploy body was rejected")
+	}
+	if body.ID != 3 {
+		t.Errorf("deploy targets stack %d, want stack 3 of the route", body.ID)
+	}
+	if body.Directory != "" {
+		t.Errorf("body set the directory to %q, which selects the stack by directory", body.Directory)
+	}
+	if body.GitReset {
+		t.Error("body set GitReset")
+	}
+	if body.Branch != "main" {
+		t.Errorf("branch = %q, want main", body.Branch)
+	}
+}
+
+func TestBindDeployRequestRejectsInvalidRouteID(t *testing.T) {
+	c, w := newRouteContext("abc", `{"id": 7}`)
+
+	if _, ok := bindDeployRequest(c); ok {
+		t.Fatal("deploy with an invalid route ID was accepted")
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestBindDeployRequestRejectsInvalidRefs(t *testing.T) {
+	tests := []struct {
+		body  string
+		field string
+	}{
+		{`{"git_hash": "--upload-pack=touch /tmp/pwned"}`, "git_hash"},
+		{`{"git_hash": "HEAD"}`, "git_hash"},
+		{`{"git_hash": "ABCDEF0"}`, "git_hash"},
+		{`{"ref": "--output=/tmp/pwned"}`, "ref"},
+		{`{"ref": "main..dev"}`, "ref"},
+		{`{"tag": "-v1"}`, "tag"},
+		{`{"branch": "-b"}`, "branch"},
+		{`{"branch": "feature branch"}`, "branch"},
+		{`{"remote": "--upload-pack=sh"}`, "remote"},
+	}
+	for _, tt := range tests {
+		c, w := newRouteContext("3", tt.body)
+		if _, ok := bindDeployRequest(c); ok {
+			t.Errorf("%s was accepted", tt.body)
+			continue
+		}
+		if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"`+tt.field+`"`) {
+			t.Errorf("%s: %d %s, want a validation error of %s", tt.body, w.Code, w.Body.String(), tt.field)
+		}
+	}
+
+	c, _ := newRouteContext("3", `{"git_hash": "0a1b2c3", "branch": "feature/login", "remote": "origin", "ref": "refs/heads/main", "tag": "v1.2.0"}`)
+	if _, ok := bindDeployRequest(c); !ok {
+		t.Fatal("valid refs were rejected")
+	}
+}
+
+func TestBindRollbackRequestKeepsRouteStack(t *testing.T) {
+	c, _ := newRouteContext("3", `{"id": 7, "deployment_id": 12, "GitReset": true}`)
+
+	body, ok := bindRollbackRequest(c)
+	if !ok {
+		t.Fatal("valid rollback body was rejected")
+	}
+	if body.ID != 3 {
+		t.Errorf("rollback targets stack %d, want stack 3 of the route", body.ID)
+	}
+	if body.DeploymentID != 12 {
+		t.Errorf("deployment = %d, want 12", body.DeploymentID)
+	}
+	if body.GitReset {
+		t.Error("body set GitReset")
+	}
+}
+
+// newListStack inserts a stack named after the test and returns its ID
+func newListStack(t *testing.T, name string) int64 {
+	t.Helper()
+	uuid := strings.ReplaceAll(t.Name(), "/", "-") + "-" + name
+	result, err := testDB.Exec(`INSERT INTO stacks (uuid, name, directory, type, repo_url, port, commands) VALUES (?, ?, ?, 'nodejs', 'repo', 3000, ?)`,
+		uuid, uuid, "/tmp/"+uuid, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+// listStacks returns the IDs of the stacks ListStacks shows to user, through token when it is not nil
+func listStacks(t *testing.T, h *StackHandler, user *models.User, token *models.APIToken) map[int64]bool {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/stack/list", nil)
+	c.Set("user", user)
+	if token != nil {
+		c.Set("api_token", token)
+	}
+	h.ListStacks(c)
+
+	var response struct {
+		Data []models.Stack `json:"data"`
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("list = %d %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	ids := map[int64]bool{}
+	for _, stack := range response.Data {
+		ids[stack.ID] = true
+	}
+	return ids
+}
+
+func TestListStacksShowsMembersTheirStacks(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+	users := services.NewUserService(testDB)
+	stacks := services.NewStackService(testDB)
+	h := NewStackHandler(stacks, services.NewSecretService(testDB), users, services.NewAuditService(testDB))
+	stackA, stackB := newListStack(t, "a"), newListStack(t, "b")
+
+	// new accounts have no role on all stacks
+	if err := users.CreateUser(ctx, &dto.User_RegisterRequest{Email: "list-member@example.com", Password: "correct horse battery"}); err != nil {
+		t.Fatal(err)
+	}
+	member, err := users.GetUserByEmail(ctx, "list-member@example.com")
+	if err != nil || member == nil || member.Role != models.RoleMember {
+		t.Fatalf("new user = %+v %v, want a member", member, err)
+	}
+	if got := listStacks(t, h, member, nil); len(got) != 0 {
+		t.Fatalf("stacks of a user without memberships = %v, want none", got)
+	}
+	if err := stacks.UpsertStackMember(ctx, &dto.StackMember_Upsert_Request{StackID: stackA, UserID: member.ID, Role: string(models.RoleViewer)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := listStacks(t, h, member, nil); len(got) != 1 || !got[stackA] {
+		t.Fatalf("stacks of a member = %v, want only %d", got, stackA)
+	}
+
+	viewer := &models.User{ID: member.ID + 1000, Role: models.RoleViewer}
+	if got := listStacks(t, h, viewer, nil); !got[stackA] || !got[stackB] {
+		t.Fatalf("stacks of a viewer = %v, want %d and %d", got, stackA, stackB)
+	}
+	// API tokens only show the stacks their scopes read
+	token := &models.APIToken{Scopes: models.TokenScopes{fmt.Sprintf("read:stack:%d", stackB)}}
+	if got := listStacks(t, h, viewer, token); len(got) != 1 || !got[stackB] {
+		t.Fatalf("stacks of a viewer token scoped to %d = %v", stackB, got)
+	}
+	if got := listStacks(t, h, member, token); len(got) != 0 {
+		t.Fatalf("stacks of a member token scoped to another stack = %v, want none", got)
+	}
+}
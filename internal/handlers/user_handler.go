@@ -1,8 +1,15 @@
 package handlers
 
 import (
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/middlewares"
 	"github.com/satnamSandhu2001/stackjet/internal/models"
 	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
 	"github.com/satnamSandhu2001/stackjet/pkg/API"
 
 	"github.com/gin-gonic/gin"
@@ -44,3 +51,534 @@ func (h *UserHandler) GetMyDetails(c *gin.Context) {
 	}
 	API.Success(c, "success", u)
 }
+
+// PUT /users/me/password
+func (h *UserHandler) ChangeMyPassword(c *gin.Context) {
+	var body dto.User_ChangePassword_Request
+	if err := c.ShouldBindJSON(&body); err != nil {
+		errors := pkg.TagValidationErrors(err, &body)
+		API.ValidationsErrors(c, errors)
+		return
+	}
+	currentUser := middlewares.CurrentUser(c)
+
+	err := h.service.ChangePassword(c.Request.Context(), currentUser.ID, body.CurrentPassword, body.NewPassword)
+	if errors.Is(err, services.ErrInvalidPassword) {
+		API.Error(c, "current password is incorrect")
+		return
+	}
+	if errors.Is(err, services.ErrSamePassword) {
+		API.Error(c, err.Error())
+		return
+	}
+	if err != nil {
+		API.InternalServerError(c, "failed to change password", err)
+		return
+	}
+	// log out everywhere else, the password may have been changed because it leaked
+	if _, err := h.service.RevokeUserSessions(c.Request.Context(), currentUser.ID, middlewares.CurrentSession(c).ID); err != nil {
+		API.InternalServerError(c, "failed to revoke sessions", err)
+		return
+	}
+	API.Success(c, "password changed", nil)
+}
+
+// GET /users/me/sessions
+func (h *UserHandler) ListMySessions(c *gin.Context) {
+	sessions, err := h.service.ListSessions(c.Request.Context(), middlewares.CurrentUser(c).ID)
+	if err != nil {
+		API.InternalServerError(c, "failed to list sessions", err)
+		return
+	}
+	API.Success(c, "success", gin.H{"current": middlewares.CurrentSession(c).ID, "sessions": sessions})
+}
+
+// DELETE /users/me/sessions/:id
+func (h *UserHandler) RevokeMySession(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		API.Error(c, "Invalid ID format")
+		return
+	}
+	session, err := h.service.GetActiveSession(c.Request.Context(), id)
+	if err != nil {
+		API.InternalServerError(c, "failed to get session", err)
+		return
+	}
+	if session == nil || session.UserID != middlewares.CurrentUser(c).ID {
+		API.NotFound(c, "session not found")
+		return
+	}
+	if err := h.service.RevokeSession(c.Request.Context(), id); err != nil {
+		API.InternalServerError(c, "failed to revoke session", err)
+		return
+	}
+	API.Success(c, "session revoked", gin.H{"id": id})
+}
+
+// POST /users/me/sessions/revoke-all
+func (h *UserHandler) RevokeMySessions(c *gin.Context) {
+	revoked, err := h.service.RevokeUserSessions(c.Request.Context(), middlewares.CurrentUser(c).ID, 0)
+	if err != nil {
+		API.InternalServerError(c, "failed to revoke sessions", err)
+		return
+	}
+	API.ClearSession(c)
+	API.Success(c, "sessions revoked", gin.H{"revoked": revoked})
+}
+
+// POST /users/:id/sessions/revoke-all
+func (h *UserHandler) RevokeUserSessions(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+	revoked, err := h.service.RevokeUserSessions(c.Request.Context(), user.ID, 0)
+	if err != nil {
+		API.InternalServerError(c, "failed to revoke sessions", err)
+		return
+	}
+	API.Success(c, "sessions revoked", gin.H{"id": user.ID, "revoked": revoked})
+}
+
+// GET /users/me/tokens
+func (h *UserHandler) ListMyTokens(c *gin.Context) {
+	tokens, err := h.service.ListAPITokens(c.Request.Context(), middlewares.CurrentUser(c).ID)
+	if err != nil {
+		API.InternalServerError(c, "failed to list tokens", err)
+		return
+	}
+	API.Success(c, "success", tokens)
+}
+
+// POST /users/me/tokens
+func (h *UserHandler) CreateMyToken(c *gin.Context) {
+	var body dto.APIToken_Create_Request
+	if err := c.ShouldBindJSON(&body); err != nil {
+		errors := pkg.TagValidationErrors(err, &body)
+		API.ValidationsErrors(c, errors)
+		return
+	}
+	if err := models.TokenScopes(body.Scopes).Validate(); err != nil {
+		API.Error(c, err.Error())
+		return
+	}
+	body.UserID = middlewares.CurrentUser(c).ID
+
+	id, token, err := h.service.CreateAPIToken(c.Request.Context(), &body)
+	if err != nil {
+		API.InternalServerError(c, "failed to create token", err)
+		return
+	}
+	// the token is only shown once, send it as "Authorization: Bearer <token>"
+	API.Success(c, "token created", gin.H{"id": id, "token": token})
+}
+
+// DELETE /users/me/tokens/:id
+func (h *UserHandler) DeleteMyToken(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		API.Error(c, "Invalid ID format")
+		return
+	}
+	token, err := h.service.GetAPITokenByID(c.Request.Context(), id)
+	if err != nil {
+		API.InternalServerError(c, "failed to get token", err)
+		return
+	}
+	if token == nil || token.UserID != middlewares.CurrentUser(c).ID {
+		API.NotFound(c, "token not found")
+		return
+	}
+	if err := h.service.DeleteAPIToken(c.Request.Context(), id); err != nil {
+		API.InternalServerError(c, "failed to revoke token", err)
+		return
+	}
+	API.Success(c, "token revoked", gin.H{"id": id})
+}
+
+// GET /users/me/2fa
+func (h *UserHandler) GetMyTwoFactor(c *gin.Context) {
+	user := middlewares.CurrentUser(c)
+	recoveryCodes, err := h.service.CountRecoveryCodes(c.Request.Context(), user.ID)
+	if err != nil {
+		API.InternalServerError(c, "failed to get two-factor status", err)
+		return
+	}
+	API.Success(c, "success", gin.H{
+		"enabled":             user.TOTPEnabled,
+		"required":            pkg.Config().REQUIRE_TWO_FACTOR,
+		"recovery_codes_left": recoveryCodes,
+	})
+}
+
+// POST /users/me/2fa/setup
+func (h *UserHandler) SetupMyTwoFactor(c *gin.Context) {
+	user := middlewares.CurrentUser(c)
+	secret, err := h.service.SetupTOTP(c.Request.Context(), user)
+	if errors.Is(err, services.ErrTOTPEnabled) {
+		API.Error(c, err.Error())
+		return
+	}
+	if err != nil {
+		API.InternalServerError(c, "failed to set up two-factor authentication", err)
+		return
+	}
+	// the uri is shown as a QR code to scan with an authenticator app, then a code confirms it
+	API.Success(c, "scan the uri and confirm a code with POST /api/v1/users/me/2fa/enable", gin.H{
+		"secret": secret,
+		"uri":    pkg.TOTPURI("StackJet", user.Email, secret),
+	})
+}
+
+// POST /users/me/2fa/enable
+func (h *UserHandler) EnableMyTwoFactor(c *gin.Context) {
+	var body dto.TwoFactor_Code_Request
+	if err := c.ShouldBindJSON(&body); err != nil {
+		errors := pkg.TagValidationErrors(err, &body)
+		API.ValidationsErrors(c, errors)
+		return
+	}
+	user := middlewares.CurrentUser(c)
+
+	codes, err := h.service.EnableTOTP(c.Request.Context(), user, body.Code)
+	if errors.Is(err, services.ErrTOTPEnabled) || errors.Is(err, services.ErrTOTPNotSetUp) || errors.Is(err, services.ErrInvalidTOTPCode) {
+		API.Error(c, err.Error())
+		return
+	}
+	if err != nil {
+		API.InternalServerError(c, "failed to enable two-factor authentication", err)
+		return
+	}
+	// recovery codes are only shown once
+	API.Success(c, "two-factor authentication enabled", gin.H{"recovery_codes": codes})
+}
+
+// POST /users/me/2fa/disable
+func (h *UserHandler) DisableMyTwoFactor(c *gin.Context) {
+	var body dto.TwoFactor_Disable_Request
+	if err := c.ShouldBindJSON(&body); err != nil {
+		errors := pkg.TagValidationErrors(err, &body)
+		API.ValidationsErrors(c, errors)
+		return
+	}
+	if pkg.Config().REQUIRE_TWO_FACTOR {
+		API.Error(c, "two-factor authentication is required on this server")
+		return
+	}
+	user := middlewares.CurrentUser(c)
+	if !user.TOTPEnabled {
+		API.Error(c, services.ErrTOTPNotSetUp.Error())
+		return
+	}
+
+	if !h.verifyPasswordAndSecondFactor(c, user, body.Password, body.TwoFactor_Code_Request) {
+		return
+	}
+	if err := h.service.DisableTOTP(c.Request.Context(), user.ID); err != nil {
+		API.InternalServerError(c, "failed to disable two-factor authentication", err)
+		return
+	}
+	API.Success(c, "two-factor authentication disabled", nil)
+}
+
+// POST /users/me/2fa/recovery-codes
+func (h *UserHandler) RegenerateMyRecoveryCodes(c *gin.Context) {
+	var body dto.TwoFactor_Code_Request
+	if err := c.ShouldBindJSON(&body); err != nil {
+		errors := pkg.TagValidationErrors(err, &body)
+		API.ValidationsErrors(c, errors)
+		return
+	}
+	user := middlewares.CurrentUser(c)
+	if !user.TOTPEnabled {
+		API.Error(c, services.ErrTOTPNotSetUp.Error())
+		return
+	}
+
+	err := h.service.VerifySecondFactor(c.Request.Context(), user, body.Code, body.RecoveryCode)
+	if errors.Is(err, services.ErrInvalidTOTPCode) {
+		API.Error(c, err.Error())
+		return
+	}
+	if err != nil {
+		API.InternalServerError(c, "failed to verify code", err)
+		return
+	}
+	codes, err := h.service.RegenerateRecoveryCodes(c.Request.Context(), user.ID)
+	if err != nil {
+		API.InternalServerError(c, "failed to generate recovery codes", err)
+		return
+	}
+	API.Success(c, "recovery codes replaced", gin.H{"recovery_codes": codes})
+}
+
+// POST /users/:id/2fa/reset
+func (h *UserHandler) ResetTwoFactor(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+	if err := h.service.DisableTOTP(c.Request.Context(), user.ID); err != nil {
+		API.InternalServerError(c, "failed to reset two-factor authentication", err)
+		return
+	}
+	if _, err := h.service.RevokeUserSessions(c.Request.Context(), user.ID, 0); err != nil {
+		API.InternalServerError(c, "failed to revoke sessions", err)
+		return
+	}
+	API.Success(c, "two-factor authentication reset", gin.H{"id": user.ID})
+}
+
+// verifyPasswordAndSecondFactor checks both the password and the second factor, sending an error response when one is wrong
+func (h *UserHandler) verifyPasswordAndSecondFactor(c *gin.Context, user *models.User, password string, factor dto.TwoFactor_Code_Request) bool {
+	if err := pkg.CompareHashAndPassword(user.Password, password); err != nil {
+		API.Error(c, "current password is incorrect")
+		return false
+	}
+	err := h.service.VerifySecondFactor(c.Request.Context(), user, factor.Code, factor.RecoveryCode)
+	if errors.Is(err, services.ErrInvalidTOTPCode) {
+		API.Error(c, err.Error())
+		return false
+	}
+	if err != nil {
+		API.InternalServerError(c, "failed to verify code", err)
+		return false
+	}
+	return true
+}
+
+// POST /users
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	var body dto.User_RegisterRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		errors := pkg.TagValidationErrors(err, &body)
+		API.ValidationsErrors(c, errors)
+		return
+	}
+	userExists, err := h.service.GetUserByEmail(c.Request.Context(), body.Email)
+	if err != nil {
+		API.InternalServerError(c, "failed to create user", err)
+		return
+	}
+	if userExists != nil {
+		API.Error(c, "User with this email already exists")
+		return
+	}
+	if err := h.service.CreateUser(c.Request.Context(), &body); err != nil {
+		API.InternalServerError(c, "failed to create user", err)
+		return
+	}
+	user, err := h.service.GetUserByID(c.Request.Context(), body.ID)
+	if err != nil {
+		API.InternalServerError(c, "failed to create user", err)
+		return
+	}
+	API.Success(c, "user created", user)
+}
+
+// PATCH /users/:id
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	var body dto.User_Update_Request
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		errors := pkg.TagValidationErrors(err, &body)
+		API.ValidationsErrors(c, errors)
+		return
+	}
+	body.ID = user.ID
+
+	if body.Email != nil && *body.Email != user.Email {
+		userExists, err := h.service.GetUserByEmail(c.Request.Context(), *body.Email)
+		if err != nil {
+			API.InternalServerError(c, "failed to update user", err)
+			return
+		}
+		if userExists != nil {
+			API.Error(c, "User with this email already exists")
+			return
+		}
+	}
+	if !h.check(c, h.service.UpdateUser(c.Request.Context(), &body), "failed to update user") {
+		return
+	}
+	user, err := h.service.GetUserByID(c.Request.Context(), user.ID)
+	if err != nil {
+		API.InternalServerError(c, "failed to update user", err)
+		return
+	}
+	API.Success(c, "user updated", user)
+}
+
+// DELETE /users/:id
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+	if user.ID == middlewares.CurrentUser(c).ID {
+		API.Error(c, "you cannot delete your own account")
+		return
+	}
+	if !h.check(c, h.service.DeleteUser(c.Request.Context(), user.ID), "failed to delete user") {
+		return
+	}
+	API.Success(c, "user deleted", gin.H{"id": user.ID})
+}
+
+// POST /users/:id/disable
+func (h *UserHandler) DisableUser(c *gin.Context) {
+	h.setDisabled(c, true)
+}
+
+// POST /users/:id/enable
+func (h *UserHandler) EnableUser(c *gin.Context) {
+	h.setDisabled(c, false)
+}
+
+func (h *UserHandler) setDisabled(c *gin.Context, disabled bool) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+	if disabled && user.ID == middlewares.CurrentUser(c).ID {
+		API.Error(c, "you cannot disable your own account")
+		return
+	}
+	if !h.check(c, h.service.SetDisabled(c.Request.Context(), user.ID, disabled), "failed to update user") {
+		return
+	}
+	if disabled {
+		if _, err := h.service.RevokeUserSessions(c.Request.Context(), user.ID, 0); err != nil {
+			API.InternalServerError(c, "failed to revoke sessions", err)
+			return
+		}
+	}
+	API.Success(c, "user updated", gin.H{"id": user.ID, "disabled": disabled})
+}
+
+// POST /users/:id/unlock
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+	if !h.check(c, h.service.UnlockUser(c.Request.Context(), user.ID), "failed to unlock user") {
+		return
+	}
+	API.Success(c, "user unlocked", gin.H{"id": user.ID})
+}
+
+// POST /users/:id/password
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var body dto.User_ResetPassword_Request
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+	// the body is optional
+	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		errors := pkg.TagValidationErrors(err, &body)
+		API.ValidationsErrors(c, errors)
+		return
+	}
+
+	data := gin.H{"id": user.ID}
+	if body.Password == "" {
+		password, err := pkg.GenerateRandomToken(8)
+		if err != nil {
+			API.InternalServerError(c, "failed to reset password", err)
+			return
+		}
+		body.Password = password
+		data["password"] = password
+	}
+	// the admin knows the password, the user has to replace it
+	if err := h.service.SetPassword(c.Request.Context(), user.ID, body.Password, true); err != nil {
+		API.InternalServerError(c, "failed to reset password", err)
+		return
+	}
+	if _, err := h.service.RevokeUserSessions(c.Request.Context(), user.ID, 0); err != nil {
+		API.InternalServerError(c, "failed to revoke sessions", err)
+		return
+	}
+	API.Success(c, "password reset", data)
+}
+
+// GET /users/invitations
+func (h *UserHandler) ListInvitations(c *gin.Context) {
+	invitations, err := h.service.ListInvitations(c.Request.Context())
+	if err != nil {
+		API.InternalServerError(c, "failed to list invitations", err)
+		return
+	}
+	API.Success(c, "success", invitations)
+}
+
+// POST /users/invitations
+func (h *UserHandler) CreateInvitation(c *gin.Context) {
+	var body dto.UserInvitation_Create_Request
+	if err := c.ShouldBindJSON(&body); err != nil {
+		errors := pkg.TagValidationErrors(err, &body)
+		API.ValidationsErrors(c, errors)
+		return
+	}
+	body.CreatedBy = middlewares.CurrentUser(c).ID
+
+	id, token, err := h.service.CreateInvitation(c.Request.Context(), &body)
+	if err != nil {
+		API.InternalServerError(c, "failed to create invitation", err)
+		return
+	}
+	// the token is only shown once, signup with it as invite_token
+	API.Success(c, "invitation created", gin.H{"id": id, "token": token})
+}
+
+// DELETE /users/invitations/:id
+func (h *UserHandler) DeleteInvitation(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		API.Error(c, "Invalid ID format")
+		return
+	}
+	if err := h.service.DeleteInvitation(c.Request.Context(), id); err != nil {
+		API.InternalServerError(c, "failed to delete invitation", err)
+		return
+	}
+	API.Success(c, "invitation deleted", gin.H{"id": id})
+}
+
+// findUser returns the user of the id route param, sending an error response when it is not found
+func (h *UserHandler) findUser(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		API.Error(c, "Invalid ID format")
+		return nil, false
+	}
+	user, err := h.service.GetUserByID(c.Request.Context(), id)
+	if err != nil {
+		API.InternalServerError(c, "failed to get user", err)
+		return nil, false
+	}
+	if user == nil {
+		API.NotFound(c, "user not found")
+		return nil, false
+	}
+	return user, true
+}
+
+// check sends an error response for err, reporting whether the request can continue
+func (h *UserHandler) check(c *gin.Context, err error, message string) bool {
+	if errors.Is(err, services.ErrLastAdmin) {
+		API.Error(c, err.Error())
+		return false
+	}
+	if err != nil {
+		API.InternalServerError(c, message, err)
+		return false
+	}
+	return true
+}
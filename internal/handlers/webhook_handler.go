@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/satnamSandhu2001/stackjet/internal/core/stack"
+	"github.com/satnamSandhu2001/stackjet/internal/core/webhook"
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/satnamSandhu2001/stackjet/pkg/API"
+)
+
+// max accepted payload size
+const webhookMaxBodySize = 5 << 20
+
+type WebhookHandler struct {
+	service services.StackService
+	secrets services.SecretService
+}
+
+func NewWebhookHandler(service *services.StackService, secrets *services.SecretService) *WebhookHandler {
+	return &WebhookHandler{
+		service: *service,
+		secrets: *secrets,
+	}
+}
+
+// the verified delivery, passed from Verify to Receive
+type webhookDelivery struct {
+	stack    *models.Stack
+	provider string
+	body     []byte
+}
+
+const webhookDeliveryKey = "webhook_delivery"
+
+// Verify checks the signature of a delivery with the webhook secret of its stack. It runs before the
+// rate limit of the stack, so that unsigned deliveries can't use up the limit of a stack.
+func (h *WebhookHandler) Verify(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// Verify is a middleware, its errors abort the handlers after it
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, webhookMaxBodySize))
+	if err != nil {
+		API.AbortWithStatusError(c, http.StatusBadRequest, "failed to read payload")
+		return
+	}
+
+	stackData, err := h.service.GetStackByUuid(ctx, c.Param("stack_uuid"))
+	if err != nil {
+		API.InternalServerError(c, "failed to process webhook", err)
+		return
+	}
+	if stackData == nil {
+		API.NotFound(c, "stack not found")
+		return
+	}
+	secret, err := h.secrets.GetSecret(ctx, webhook.SecretName(stackData.Uuid))
+	if err != nil {
+		API.InternalServerError(c, "failed to process webhook", err)
+		return
+	}
+	if secret == "" {
+		API.Forbidden(c, "webhook is not enabled for this stack")
+		return
+	}
+
+	provider := webhook.DetectProvider(c.Request.Header)
+	if err := webhook.Verify(provider, c.Request.Header, body, secret); err != nil {
+		if errors.Is(err, webhook.ErrUnknownProvider) {
+			API.AbortWithStatusError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		API.Unauthorized(c, err.Error())
+		return
+	}
+	c.Set(webhookDeliveryKey, &webhookDelivery{stack: stackData, provider: provider, body: body})
+	c.Next()
+}
+
+// POST /hooks/:stack_uuid, after Verify
+func (h *WebhookHandler) Receive(c *gin.Context) {
+	ctx := c.Request.Context()
+	value, _ := c.Get(webhookDeliveryKey)
+	delivery, ok := value.(*webhookDelivery)
+	if !ok {
+		API.InternalServerError(c, "failed to process webhook", errors.New("webhook delivery was not verified"))
+		return
+	}
+	stackData := delivery.stack
+
+	push, err := webhook.ParsePush(delivery.provider, c.Request.Header, delivery.body)
+	if err != nil {
+		API.Error(c, err.Error())
+		return
+	}
+	if !push.Event {
+		API.Success(c, "event ignored", nil)
+		return
+	}
+	if push.Branch() != stackData.Branch {
+		API.Success(c, "push to "+push.Ref+" ignored, stack deploys branch "+stackData.Branch, nil)
+		return
+	}
+	if push.Commit == "" || strings.Trim(push.Commit, "0") == "" {
+		API.Success(c, "branch deletion ignored", nil)
+		return
+	}
+	if !dto.ValidGitHash(push.Commit) {
+		API.Error(c, "invalid commit hash in payload")
+		return
+	}
+
+	// git providers time out quickly, deploy in background and save logs when done.
+	// The deployment is audited for the pusher, it outlives the request.
+	actor := services.ActorFromContext(ctx)
+	if push.Pusher != "" {
+		actor.Name = push.Pusher
+	}
+	deployCtx := services.WithActor(context.WithoutCancel(ctx), actor)
+	go func() {
+		var logBuf strings.Builder
+		// the pushed commit is deployed, a later push moving the branch on deploys its own commit
+		opts := &dto.Stack_Deploy_Request{
+			ID:            stackData.ID,
+			GitReset:      pkg.Config().GIT_RESET,
+			GitHash:       push.Commit,
+			Pusher:        push.Pusher,
+			PushedCommit:  push.Commit,
+			CommitMessage: push.Message,
+		}
+		deploymentID, err := stack.DeployStack(&logBuf, deployCtx, h.service, h.secrets, opts)
+		if err != nil {
+			logBuf.WriteString("__ERROR__: " + err.Error())
+			log.Printf("Webhook deployment of stack %d failed: %v", stackData.ID, err)
+		}
+		if deploymentID != 0 {
+			if _, err := h.service.CreateDeploymentLog(deployCtx, &dto.DeploymentLog_Create_Request{DeploymentID: deploymentID, Log: logBuf.String()}); err != nil {
+				log.Println("Failed to save webhook deployment logs:", err)
+			}
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, API.Response{
+		Success: true,
+		Message: "deployment triggered",
+		Data:    map[string]any{"provider": push.Provider, "ref": push.Ref, "commit": push.Commit, "pusher": push.Pusher},
+	})
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/satnamSandhu2001/stackjet/internal/core/webhook"
+	"github.com/satnamSandhu2001/stackjet/internal/middlewares"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+)
+
+// a push to another branch than the one of the stack, answered without deploying
+const otherBranchPush = `{"ref": "refs/heads/other", "after": "0123456789abcdef0123456789abcdef01234567", "pusher": {"name": "dev"}}`
+
+// newWebhookRouter routes webhooks like InitRouter and returns it with a stack whose webhook is enabled
+func newWebhookRouter(t *testing.T) (*gin.Engine, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	uuid := strings.ReplaceAll(t.Name(), "/", "-")
+	if _, err := testDB.Exec(`INSERT INTO stacks (uuid, name, directory, type, repo_url, port, commands, branch, remote) VALUES (?, ?, ?, 'nodejs', 'repo', 3000, ?, 'main', 'origin')`,
+		uuid, uuid, "/tmp/"+uuid, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	secrets := services.NewSecretService(testDB)
+	if err := secrets.SetSecret(context.Background(), webhook.SecretName(uuid), "webhook-secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	audit := services.NewAuditService(testDB)
+	handler := NewWebhookHandler(services.NewStackService(testDB), secrets)
+	router := gin.New()
+	router.POST("/hooks/:stack_uuid",
+		middlewares.RateLimitFailures("webhook_failed", middlewares.RateLimitByIP, audit),
+		handler.Verify, middlewares.RateLimit("webhook", middlewares.RateLimitByParam("stack_uuid"), audit), handler.Receive)
+	return router, uuid
+}
+
+func deliver(router *gin.Engine, uuid string, ip string, secret string) int {
+	return deliverPush(router, uuid, ip, secret, otherBranchPush).Code
+}
+
+// deliverPush sends a github push signed with secret
+func deliverPush(router *gin.Engine, uuid string, ip string, secret string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/hooks/"+uuid, strings.NewReader(body))
+	req.RemoteAddr = ip + ":40000"
+	req.Header.Set("X-GitHub-Event", "push")
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestWebhookIgnoresPushesNotDeployed(t *testing.T) {
+	router, uuid := newWebhookRouter(t)
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		name    string
+		body    string
+		message string
+	}{
+		{"other branch", otherBranchPush, "push to refs/heads/other ignored, stack deploys branch main"},
+		{"tag", `{"ref": "refs/tags/v1.0.0", "after": "` + commit + `"}`, "push to refs/tags/v1.0.0 ignored, stack deploys branch main"},
+		{"branch delete", `{"ref": "refs/heads/main", "after": "0000000000000000000000000000000000000000", "deleted": true}`, "branch deletion ignored"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := deliverPush(router, uuid, "203.0.113.1", "webhook-secret", tt.body)
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tt.message) {
+				t.Fatalf("response = %d %s, want %q", w.Code, w.Body.String(), tt.message)
+			}
+		})
+	}
+	var deployments int
+	if err := testDB.Get(&deployments, `SELECT COUNT(*) FROM deployments d JOIN stacks s ON s.id = d.stack_id WHERE s.uuid = ?`, uuid); err != nil || deployments != 0 {
+		t.Fatalf("deployments = %d %v, want none", deployments, err)
+	}
+
+	w := deliverPush(router, uuid, "203.0.113.1", "webhook-secret", `{"ref": "refs/heads/main", "after": "--upload-pack=sh"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("push of an invalid commit = %d %s, want 400", w.Code, w.Body.String())
+	}
+}
+
+func TestWebhookFailuresDoNotUseStackLimit(t *testing.T) {
+	router, uuid := newWebhookRouter(t)
+
+	// wrong signatures are limited per IP, 3 per minute in the tests
+	for i := 0; i < 3; i++ {
+		if code := deliver(router, uuid, "192.0.2.1", "wrong-secret"); code != http.StatusUnauthorized {
+			t.Fatalf("unsigned delivery %d = %d, want 401", i+1, code)
+		}
+	}
+	if code := deliver(router, uuid, "192.0.2.1", "webhook-secret"); code != http.StatusTooManyRequests {
+		t.Fatalf("delivery after 3 failures = %d, want 429", code)
+	}
+
+	// the stack limit of 5 is left to the git provider
+	for i := 0; i < 5; i++ {
+		if code := deliver(router, uuid, "198.51.100.1", "webhook-secret"); code != http.StatusOK {
+			t.Fatalf("signed delivery %d = %d, want 200", i+1, code)
+		}
+	}
+	if code := deliver(router, uuid, "198.51.100.1", "webhook-secret"); code != http.StatusTooManyRequests {
+		t.Fatalf("sixth signed delivery = %d, want 429", code)
+	}
+}
+
+func TestWebhookUnknownStackCountsAsFailure(t *testing.T) {
+	router, uuid := newWebhookRouter(t)
+
+	for i := 0; i < 3; i++ {
+		if code := deliver(router, "no-such-stack", "192.0.2.2", "webhook-secret"); code != http.StatusNotFound {
+			t.Fatalf("delivery %d to an unknown stack = %d, want 404", i+1, code)
+		}
+	}
+	if code := deliver(router, uuid, "192.0.2.2", "webhook-secret"); code != http.StatusTooManyRequests {
+		t.Fatalf("delivery after guessing stacks = %d, want 429", code)
+	}
+	// successful deliveries are not counted as failures
+	for i := 0; i < 2; i++ {
+		if code := deliver(router, uuid, "192.0.2.3", "webhook-secret"); code != http.StatusOK {
+			t.Fatalf("signed delivery %d = %d, want 200", i+1, code)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package middlewares
+
+import (
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestActor records the audit events of a request for its client IP and source. AuthMiddleware adds the user.
+func RequestActor(source string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actor := services.ActorFromContext(ctx.Request.Context())
+		actor.Source, actor.IP = source, ctx.ClientIP()
+		ctx.Request = ctx.Request.WithContext(services.WithActor(ctx.Request.Context(), actor))
+		ctx.Next()
+	}
+}
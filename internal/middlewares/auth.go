@@ -3,6 +3,7 @@ package middlewares
 import (
 	"strings"
 
+	"github.com/satnamSandhu2001/stackjet/internal/models"
 	"github.com/satnamSandhu2001/stackjet/internal/services"
 	"github.com/satnamSandhu2001/stackjet/pkg"
 	"github.com/satnamSandhu2001/stackjet/pkg/API"
@@ -10,12 +11,28 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// passwordChangeRoutes are the routes open to users who must change their password
+var passwordChangeRoutes = map[string]bool{
+	"/api/v1/users/me":          true,
+	"/api/v1/users/me/password": true,
+}
+
+// twoFactorSetupRoutes are the routes open to users who must set up two-factor authentication
+var twoFactorSetupRoutes = map[string]bool{
+	"/api/v1/users/me":            true,
+	"/api/v1/users/me/password":   true,
+	"/api/v1/users/me/2fa":        true,
+	"/api/v1/users/me/2fa/setup":  true,
+	"/api/v1/users/me/2fa/enable": true,
+}
+
+// AuthMiddleware authenticates a session JWT from the Authorization cookie or header, or an API token from the header.
+// It sets "user", and "session" for sessions or "api_token" for API tokens.
 func AuthMiddleware(userService *services.UserService) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		token, err := ctx.Cookie("Authorization")
-		if err != nil {
-			API.Unauthorized(ctx, "unauthorized")
-			return
+		token := ctx.GetHeader("Authorization")
+		if token == "" {
+			token, _ = ctx.Cookie("Authorization")
 		}
 
 		if token == "" || !strings.HasPrefix(token, "Bearer ") {
@@ -24,19 +41,55 @@ func AuthMiddleware(userService *services.UserService) gin.HandlerFunc {
 		}
 		token = strings.TrimPrefix(token, "Bearer ")
 
-		email, err := pkg.ValidateToken(token)
-		if err != nil {
+		var user *models.User
+		var err error
+		if strings.HasPrefix(token, models.APITokenPrefix) {
+			var apiToken *models.APIToken
+			user, apiToken, err = userService.AuthenticateAPIToken(ctx.Request.Context(), token)
+			if apiToken != nil {
+				ctx.Set("api_token", apiToken)
+			}
+		} else {
+			email, sessionID, verr := pkg.ValidateToken(token)
+			if verr != nil {
+				API.Unauthorized(ctx, "unauthorized")
+				return
+			}
+			// revoked sessions end their access tokens before they expire
+			session, serr := userService.GetActiveSession(ctx.Request.Context(), sessionID)
+			if session == nil || serr != nil {
+				API.Unauthorized(ctx, "unauthorized")
+				return
+			}
+			user, err = userService.GetUserByID(ctx.Request.Context(), session.UserID)
+			if user != nil && user.Email != email {
+				user = nil
+			}
+			ctx.Set("session", session)
+		}
+		if (user == nil) || (err != nil) || user.Disabled {
 			API.Unauthorized(ctx, "unauthorized")
 			return
 		}
 
-		user, err := userService.GetUserByEmail(ctx.Request.Context(), email)
-		if (user == nil) || (err != nil) {
-			API.Unauthorized(ctx, "unauthorized")
+		if user.MustChangePassword && !passwordChangeRoutes[ctx.FullPath()] {
+			API.Forbidden(ctx, "password change required, use PUT /api/v1/users/me/password")
+			return
+		}
+
+		// API tokens are created from sessions, which already went through the two-factor setup,
+		// and OIDC sessions leave the second factor to the identity provider
+		session := CurrentSession(ctx)
+		if pkg.Config().REQUIRE_TWO_FACTOR && !user.TOTPEnabled && session != nil && session.AuthMethod != models.AUTH_METHOD_OIDC &&
+			!twoFactorSetupRoutes[ctx.FullPath()] {
+			API.Forbidden(ctx, "two-factor authentication required, set it up with POST /api/v1/users/me/2fa/setup")
 			return
 		}
 
 		ctx.Set("user", user)
+		actor := services.ActorFromContext(ctx.Request.Context())
+		actor.UserID, actor.Name = user.ID, user.Email
+		ctx.Request = ctx.Request.WithContext(services.WithActor(ctx.Request.Context(), actor))
 		ctx.Next()
 	}
 }
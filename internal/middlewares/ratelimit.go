@@ -0,0 +1,215 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+	"github.com/satnamSandhu2001/stackjet/pkg/API"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitKey returns the key a request is counted under, requests with an empty key are not limited
+type RateLimitKey func(c *gin.Context) string
+
+// RateLimit allows each key the requests per minute of the rate limit name in RATE_LIMITS, bursts included.
+// Blocked requests are answered with 429 and the first one of a key is audited.
+func RateLimit(name string, key RateLimitKey, audit *services.AuditService) gin.HandlerFunc {
+	limit := pkg.Config().RATE_LIMITS[name]
+	if limit <= 0 {
+		return func(ctx *gin.Context) {
+			ctx.Next()
+		}
+	}
+	limiter := newRateLimiter(limit, time.Minute)
+
+	return func(ctx *gin.Context) {
+		k := key(ctx)
+		if ctx.IsAborted() {
+			return
+		}
+		if k == "" {
+			ctx.Next()
+			return
+		}
+		allowed, retryAfter, first := limiter.allow(k, time.Now())
+		if allowed {
+			ctx.Next()
+			return
+		}
+		if first {
+			audit.Record(ctx.Request.Context(), &dto.AuditEvent_Create_Request{
+				Action:  "ratelimit." + name,
+				Summary: fmt.Sprintf("%s %s: more than %d requests per minute for %s", ctx.Request.Method, ctx.FullPath(), limit, k),
+				Result:  models.AUDIT_RESULT_BLOCKED,
+			})
+		}
+		API.TooManyRequests(ctx, retryAfter, fmt.Sprintf("too many requests, retry in %d seconds", int(math.Ceil(retryAfter.Seconds()))))
+	}
+}
+
+// RateLimitFailures allows each key the failed requests per minute of the rate limit name in RATE_LIMITS.
+// A request fails when it is answered with 401, 403 or 404, others are not counted. Once the failures
+// of a key used up the limit all its requests are answered with 429 and the first one is audited.
+func RateLimitFailures(name string, key RateLimitKey, audit *services.AuditService) gin.HandlerFunc {
+	limit := pkg.Config().RATE_LIMITS[name]
+	if limit <= 0 {
+		return func(ctx *gin.Context) {
+			ctx.Next()
+		}
+	}
+	limiter := newRateLimiter(limit, time.Minute)
+
+	return func(ctx *gin.Context) {
+		k := key(ctx)
+		if ctx.IsAborted() {
+			return
+		}
+		if k == "" {
+			ctx.Next()
+			return
+		}
+		if allowed, retryAfter, first := limiter.check(k, time.Now(), false); !allowed {
+			if first {
+				audit.Record(ctx.Request.Context(), &dto.AuditEvent_Create_Request{
+					Action:  "ratelimit." + name,
+					Summary: fmt.Sprintf("%s %s: more than %d failed requests per minute for %s", ctx.Request.Method, ctx.FullPath(), limit, k),
+					Result:  models.AUDIT_RESULT_BLOCKED,
+				})
+			}
+			API.TooManyRequests(ctx, retryAfter, fmt.Sprintf("too many failed requests, retry in %d seconds", int(math.Ceil(retryAfter.Seconds()))))
+			return
+		}
+		ctx.Next()
+		switch ctx.Writer.Status() {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+			limiter.allow(k, time.Now())
+		}
+	}
+}
+
+// RateLimitByIP counts requests per client IP
+func RateLimitByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitByUser counts requests per user, or per client IP before AuthMiddleware
+func RateLimitByUser(c *gin.Context) string {
+	if user := CurrentUser(c); user != nil {
+		return fmt.Sprintf("user:%d", user.ID)
+	}
+	return RateLimitByIP(c)
+}
+
+// maxAccountBodyBytes limits the bodies of logins and signups, they are read before any other check
+const maxAccountBodyBytes = 8 << 10
+
+// RateLimitByEmail counts requests per email of the JSON body, for logins and signups. The body is left readable.
+// Bodies larger than maxAccountBodyBytes are answered with 413.
+func RateLimitByEmail(c *gin.Context) string {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxAccountBodyBytes))
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		API.PayloadTooLarge(c, fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit))
+		return ""
+	}
+	if err != nil {
+		return ""
+	}
+	var account struct {
+		Email string `json:"email"`
+	}
+	if json.Unmarshal(body, &account) != nil || account.Email == "" {
+		return ""
+	}
+	return "email:" + strings.ToLower(strings.TrimSpace(account.Email))
+}
+
+// RateLimitByParam counts requests per value of a path parameter
+func RateLimitByParam(param string) RateLimitKey {
+	return func(c *gin.Context) string {
+		return param + ":" + c.Param(param)
+	}
+}
+
+// rateLimiter is an in-memory token bucket per key, refilled with limit tokens every period
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   float64
+	period  time.Duration
+	buckets map[string]*rateBucket
+	swept   time.Time
+}
+
+type rateBucket struct {
+	tokens  float64
+	updated time.Time
+	blocked bool
+}
+
+func newRateLimiter(limit int, period time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:   float64(limit),
+		period:  period,
+		buckets: map[string]*rateBucket{},
+	}
+}
+
+// allow takes a token of key. When none is left it returns how long until one is,
+// and whether this is the first blocked request since the key was last allowed.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration, bool) {
+	return l.check(key, now, true)
+}
+
+// check is allow that only takes the token if take is set
+func (l *rateLimiter) check(key string, now time.Time, take bool) (bool, time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &rateBucket{tokens: l.limit, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.limit, b.tokens+now.Sub(b.updated).Seconds()*l.limit/l.period.Seconds())
+	b.updated = now
+
+	if b.tokens >= 1 {
+		if take {
+			b.tokens--
+		}
+		b.blocked = false
+		return true, 0, false
+	}
+	first := !b.blocked
+	b.blocked = true
+	retryAfter := time.Duration((1 - b.tokens) * float64(l.period) / l.limit)
+	return false, retryAfter, first
+}
+
+// sweep drops the buckets that are full again once per period, so that keys seen once are not kept forever
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.period {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.period {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package middlewares
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newBodyContext(body string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	return c, w
+}
+
+func TestRateLimitByEmail(t *testing.T) {
+	body := `{"email": " Dev@Example.com ", "password": "secret"}`
+	c, _ := newBodyContext(body)
+
+	if key := RateLimitByEmail(c); key != "email:dev@example.com" {
+		t.Errorf("key = %q, want email:dev@example.com", key)
+	}
+	if c.IsAborted() {
+		t.Fatal("small body was rejected")
+	}
+	// the handler binds the body again
+	if read, _ := io.ReadAll(c.Request.Body); string(read) != body {
+		t.Errorf("body left = %q, want %q", read, body)
+	}
+}
+
+func TestRateLimitByEmailRejectsLargeBody(t *testing.T) {
+	c, w := newBodyContext(`{"email": "dev@example.com", "password": "` + strings.Repeat("a", maxAccountBodyBytes) + `"}`)
+
+	if key := RateLimitByEmail(c); key != "" {
+		t.Errorf("key = %q for a body over the limit", key)
+	}
+	if !c.IsAborted() || w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("response = %d, want 413", w.Code)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, time.Minute)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if allowed, _, _ := limiter.allow("ip:1", now); !allowed {
+			t.Fatalf("request %d within the limit was blocked", i+1)
+		}
+	}
+	allowed, retryAfter, first := limiter.allow("ip:1", now)
+	if allowed || !first || retryAfter != 30*time.Second {
+		t.Errorf("third request: allowed %t, first %t, retry after %s, want blocked first for 30s", allowed, first, retryAfter)
+	}
+	if _, _, first := limiter.allow("ip:1", now); first {
+		t.Error("second blocked request was reported as first")
+	}
+	if allowed, _, _ := limiter.allow("ip:2", now); !allowed {
+		t.Error("other key was blocked")
+	}
+	if allowed, _, _ := limiter.allow("ip:1", now.Add(30*time.Second)); !allowed {
+		t.Error("request after the refill was blocked")
+	}
+}
+
+func TestRateLimiterCheckWithoutTaking(t *testing.T) {
+	limiter := newRateLimiter(1, time.Minute)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if allowed, _, _ := limiter.check("ip:1", now, false); !allowed {
+			t.Fatalf("check %d took the token", i+1)
+		}
+	}
+	limiter.allow("ip:1", now)
+	if allowed, retryAfter, first := limiter.check("ip:1", now, false); allowed || !first || retryAfter != time.Minute {
+		t.Errorf("check after the token was taken: allowed %t, first %t, retry after %s, want blocked first for 1m", allowed, first, retryAfter)
+	}
+}
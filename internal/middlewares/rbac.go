@@ -0,0 +1,139 @@
+package middlewares
+
+import (
+	"strconv"
+
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+	"github.com/satnamSandhu2001/stackjet/pkg/API"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StackResolver returns the ID of the stack a request acts on, 0 if it does not exist
+type StackResolver func(c *gin.Context, stackService *services.StackService) (int64, error)
+
+// CurrentUser returns the user set by AuthMiddleware
+func CurrentUser(c *gin.Context) *models.User {
+	user, _ := c.Get("user")
+	u, _ := user.(*models.User)
+	return u
+}
+
+// CurrentAPIToken returns the API token the request was authenticated with, nil for sessions
+func CurrentAPIToken(c *gin.Context) *models.APIToken {
+	token, _ := c.Get("api_token")
+	t, _ := token.(*models.APIToken)
+	return t
+}
+
+// CurrentSession returns the session the request was authenticated with, nil for API tokens
+func CurrentSession(c *gin.Context) *models.Session {
+	session, _ := c.Get("session")
+	s, _ := session.(*models.Session)
+	return s
+}
+
+// RequireRole allows users whose role on all stacks includes role. It must run after AuthMiddleware.
+// API tokens also need a scope granting role on all stacks.
+func RequireRole(role models.Role) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user := CurrentUser(ctx)
+		if user == nil {
+			API.Unauthorized(ctx, "unauthorized")
+			return
+		}
+		if !user.Role.Includes(role) {
+			API.Forbidden(ctx, "forbidden")
+			return
+		}
+		if token := CurrentAPIToken(ctx); token != nil && !token.Scopes.Allows(role, 0) {
+			API.Forbidden(ctx, "token scopes do not allow this")
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// RequireSession rejects API tokens, for routes that manage the account itself. It must run after AuthMiddleware.
+func RequireSession() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if CurrentAPIToken(ctx) != nil {
+			API.Forbidden(ctx, "API tokens can not be used here, log in instead")
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// RequireStackPermission allows users whose role on all stacks or whose membership of the stack includes role.
+// API tokens also need a scope granting role on the stack or on all stacks.
+// The role on the stack is stored as "stack_role". It must run after AuthMiddleware.
+func RequireStackPermission(stackService *services.StackService, role models.Role, resolve StackResolver) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user := CurrentUser(ctx)
+		if user == nil {
+			API.Unauthorized(ctx, "unauthorized")
+			return
+		}
+		stackID, err := resolve(ctx, stackService)
+		if err != nil {
+			API.InternalServerError(ctx, "failed to check permissions", err)
+			return
+		}
+		if stackID == 0 {
+			API.NotFound(ctx, "stack not found")
+			return
+		}
+
+		stackRole := user.Role
+		if !stackRole.Includes(role) {
+			memberRole, err := stackService.GetStackMemberRole(ctx.Request.Context(), stackID, user.ID)
+			if err != nil {
+				API.InternalServerError(ctx, "failed to check permissions", err)
+				return
+			}
+			stackRole = stackRole.Max(memberRole)
+		}
+		if !stackRole.Includes(role) {
+			API.Forbidden(ctx, "forbidden")
+			return
+		}
+		if token := CurrentAPIToken(ctx); token != nil && !token.Scopes.Allows(role, stackID) {
+			API.Forbidden(ctx, "token scopes do not allow this")
+			return
+		}
+		ctx.Set("stack_role", stackRole)
+		ctx.Next()
+	}
+}
+
+// StackFromParam resolves the stack from a stack ID route param
+func StackFromParam(name string) StackResolver {
+	return func(c *gin.Context, stackService *services.StackService) (int64, error) {
+		id, err := strconv.ParseInt(c.Param(name), 10, 64)
+		if err != nil {
+			return 0, nil
+		}
+		stack, err := stackService.GetStackByID(c.Request.Context(), id)
+		if err != nil || stack == nil {
+			return 0, err
+		}
+		return stack.ID, nil
+	}
+}
+
+// StackFromDeployment resolves the stack of a deployment ID route param
+func StackFromDeployment(name string) StackResolver {
+	return func(c *gin.Context, stackService *services.StackService) (int64, error) {
+		id, err := strconv.ParseInt(c.Param(name), 10, 64)
+		if err != nil {
+			return 0, nil
+		}
+		deployment, err := stackService.GetDeploymentByID(c.Request.Context(), id)
+		if err != nil || deployment == nil {
+			return 0, err
+		}
+		return deployment.StackID, nil
+	}
+}
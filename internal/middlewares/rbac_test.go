@@ -0,0 +1,119 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/internal/services"
+)
+
+// newRBACRouter routes a global and a stack route like InitRouter, both answering 200 when allowed
+func newRBACRouter(users *services.UserService, stacks *services.StackService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router := gin.New()
+	auth := router.Group("", AuthMiddleware(users))
+	auth.POST("/deploy-all", RequireRole(models.RoleDeployer), ok)
+	auth.GET("/stack/:id", RequireStackPermission(stacks, models.RoleViewer, StackFromParam("id")), ok)
+	auth.POST("/stack/deploy/:id", RequireStackPermission(stacks, models.RoleDeployer, StackFromParam("id")), ok)
+	return router
+}
+
+// usersCreated numbers the emails of newTokenUser, tests create several users of a role
+var usersCreated int
+
+// newTokenUser creates a user of role with an API token of scopes and returns the user and token
+func newTokenUser(t *testing.T, users *services.UserService, role models.Role, scopes ...string) (*models.User, string) {
+	t.Helper()
+	ctx := context.Background()
+	usersCreated++
+	email := fmt.Sprintf("%s-%d@example.com", strings.ToLower(strings.ReplaceAll(t.Name(), "/", "-")), usersCreated)
+	if err := users.CreateUser(ctx, &dto.User_RegisterRequest{Email: email, Password: "correct horse battery", Role: string(role)}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := users.GetUserByEmail(ctx, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, token, err := users.CreateAPIToken(ctx, &dto.APIToken_Create_Request{UserID: user.ID, Name: "ci", Scopes: scopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, token
+}
+
+func newTestStack(t *testing.T, name string) int64 {
+	t.Helper()
+	uuid := strings.ReplaceAll(t.Name(), "/", "-") + "-" + name
+	result, err := testDB.Exec(`INSERT INTO stacks (uuid, name, directory, type, repo_url, port, commands) VALUES (?, ?, ?, 'nodejs', 'repo', 3000, ?)`,
+		uuid, uuid, "/tmp/"+uuid, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	ctx := context.Background()
+	users := services.NewUserService(testDB)
+	stacks := services.NewStackService(testDB)
+	router := newRBACRouter(users, stacks)
+	stackA, stackB := newTestStack(t, "a"), newTestStack(t, "b")
+
+	// the scopes of a token never lift the role of its owner
+	_, viewerAdminToken := newTokenUser(t, users, models.RoleViewer, "admin")
+	_, deployerStackToken := newTokenUser(t, users, models.RoleDeployer, fmt.Sprintf("deploy:stack:%d", stackA))
+	_, maintainerReadToken := newTokenUser(t, users, models.RoleMaintainer, "read")
+	member, memberToken := newTokenUser(t, users, models.RoleViewer, fmt.Sprintf("deploy:stack:%d", stackA), fmt.Sprintf("deploy:stack:%d", stackB))
+	if err := stacks.UpsertStackMember(ctx, &dto.StackMember_Upsert_Request{StackID: stackA, UserID: member.ID, Role: string(models.RoleDeployer)}); err != nil {
+		t.Fatal(err)
+	}
+	// members have no role on the stacks they are not members of
+	reader, readerToken := newTokenUser(t, users, models.RoleMember, "read")
+	if err := stacks.UpsertStackMember(ctx, &dto.StackMember_Upsert_Request{StackID: stackA, UserID: reader.ID, Role: string(models.RoleViewer)}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		status int
+	}{
+		{"viewer with admin scope reads", viewerAdminToken, http.MethodGet, fmt.Sprintf("/stack/%d", stackA), http.StatusOK},
+		{"viewer with admin scope deploys a stack", viewerAdminToken, http.MethodPost, fmt.Sprintf("/stack/deploy/%d", stackA), http.StatusForbidden},
+		{"viewer with admin scope deploys all", viewerAdminToken, http.MethodPost, "/deploy-all", http.StatusForbidden},
+		{"stack scope on its stack", deployerStackToken, http.MethodPost, fmt.Sprintf("/stack/deploy/%d", stackA), http.StatusOK},
+		{"stack scope reads its stack", deployerStackToken, http.MethodGet, fmt.Sprintf("/stack/%d", stackA), http.StatusOK},
+		{"stack scope on another stack", deployerStackToken, http.MethodPost, fmt.Sprintf("/stack/deploy/%d", stackB), http.StatusForbidden},
+		{"stack scope reads another stack", deployerStackToken, http.MethodGet, fmt.Sprintf("/stack/%d", stackB), http.StatusForbidden},
+		{"stack scope on all stacks", deployerStackToken, http.MethodPost, "/deploy-all", http.StatusForbidden},
+		{"read scope of a maintainer reads", maintainerReadToken, http.MethodGet, fmt.Sprintf("/stack/%d", stackB), http.StatusOK},
+		{"read scope of a maintainer deploys", maintainerReadToken, http.MethodPost, fmt.Sprintf("/stack/deploy/%d", stackB), http.StatusForbidden},
+		{"member deploys the stack of its membership", memberToken, http.MethodPost, fmt.Sprintf("/stack/deploy/%d", stackA), http.StatusOK},
+		{"member deploys another stack", memberToken, http.MethodPost, fmt.Sprintf("/stack/deploy/%d", stackB), http.StatusForbidden},
+		{"member reads the stack of its membership", readerToken, http.MethodGet, fmt.Sprintf("/stack/%d", stackA), http.StatusOK},
+		{"member reads another stack", readerToken, http.MethodGet, fmt.Sprintf("/stack/%d", stackB), http.StatusForbidden},
+		{"unknown token", "sjt_unknown", http.MethodGet, fmt.Sprintf("/stack/%d", stackA), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body.String(), tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package models
+
+// sources of audit events
+const (
+	AUDIT_SOURCE_CLI       = "cli"
+	AUDIT_SOURCE_API       = "api"
+	AUDIT_SOURCE_WEBHOOK   = "webhook"
+	AUDIT_SOURCE_SCHEDULER = "scheduler"
+)
+
+// results of audit events
+const (
+	AUDIT_RESULT_SUCCESS = "success"
+	AUDIT_RESULT_FAILURE = "failure"
+	// AUDIT_RESULT_BLOCKED is an attempt stopped by rate limits or a locked account
+	AUDIT_RESULT_BLOCKED = "blocked"
+)
+
+// AuditEvent records who did what and how it went. Its stack and actor are kept after they are deleted.
+type AuditEvent struct {
+	ID        int64  `db:"id" json:"id"`
+	ActorID   *int64 `db:"actor_id" json:"actor_id"`
+	Actor     string `db:"actor" json:"actor"`
+	Source    string `db:"source" json:"source"`
+	Action    string `db:"action" json:"action"`
+	StackID   *int64 `db:"stack_id" json:"stack_id"`
+	IP        string `db:"ip" json:"ip"`
+	Summary   string `db:"summary" json:"summary"`
+	Result    string `db:"result" json:"result"`
+	CreatedAt string `db:"created_at" json:"created_at"`
+}
+
+// AuditActor is who performs the actions of a request or command, carried in its context
+type AuditActor struct {
+	UserID int64
+	// Name is the email of users, the system user running the CLI or the pusher of webhooks
+	Name   string
+	Source string
+	IP     string
+}
+
+// String names the actor for people, users by their email and others with their source
+func (a AuditActor) String() string {
+	switch {
+	case a.Source == AUDIT_SOURCE_API && a.Name != "":
+		return a.Name
+	case a.Name != "":
+		return a.Source + ":" + a.Name
+	}
+	return a.Source
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+type NginxConfig struct {
+	ID         int64        `db:"id" json:"id"`
+	StackID    int64        `db:"stack_id" json:"stack_id"`
+	Domain     string       `db:"domain" json:"domain"`
+	Port       int          `db:"port" json:"port"`
+	SSLEnabled bool         `db:"ssl_enabled" json:"ssl_enabled"`
+	Headers    NginxHeaders `db:"headers" json:"headers"`
+	CustomConf string       `db:"custom_conf" json:"custom_conf"`
+}
+
+// NginxHeaders are extra headers passed to the upstream app with proxy_set_header
+type NginxHeaders map[string]string
+
+// For saving to DB
+func (h NginxHeaders) Value() (driver.Value, error) {
+	if h == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(h)
+}
+
+// For reading from DB
+func (h *NginxHeaders) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, h)
+	case string:
+		return json.Unmarshal([]byte(v), h)
+	case nil:
+		*h = NginxHeaders{}
+		return nil
+	}
+	return fmt.Errorf("Scan source is not []byte")
+}
+
+type Certificate struct {
+	ID        int64  `db:"id" json:"id"`
+	Domain    string `db:"domain" json:"domain"`
+	Issuer    string `db:"issuer" json:"issuer"`
+	CertPath  string `db:"cert_path" json:"cert_path"`
+	KeyPath   string `db:"key_path" json:"key_path"`
+	NotBefore string `db:"not_before" json:"not_before"`
+	ExpiresAt string `db:"expires_at" json:"expires_at"`
+	LastError string `db:"last_error" json:"last_error"`
+	IssuedAt  string `db:"issued_at" json:"issued_at"`
+}
+
+type DNSRecord struct {
+	ID       int64  `db:"id" json:"id"`
+	Domain   string `db:"domain" json:"domain"`
+	Provider string `db:"provider" json:"provider"`
+	ZoneID   string `db:"zone_id" json:"zone_id"`
+	RecordID string `db:"record_id" json:"record_id"`
+	Type     string `db:"type" json:"type"`
+	Content  string `db:"content" json:"content"`
+	TTL      int    `db:"ttl" json:"ttl"`
+	Proxied  bool   `db:"proxied" json:"proxied"`
+	SyncedAt string `db:"synced_at" json:"synced_at"`
+}
@@ -4,28 +4,42 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+
+	"github.com/satnamSandhu2001/stackjet/pkg/commands"
 )
 
 type Stack struct {
-	ID                       int64         `db:"id" json:"id"`
-	Name                     string        `db:"name" json:"name"`
-	Uuid                     string        `db:"uuid" json:"uuid"`
-	Directory                string        `db:"directory" json:"directory"`
-	Type                     string        `db:"type" json:"type"`
-	RepoUrl                  string        `db:"repo_url" json:"repo_url"`
-	Branch                   string        `db:"branch" json:"branch"`
-	Remote                   string        `db:"remote" json:"remote"`
-	Port                     int           `db:"port" json:"port"`
-	Commands                 StackCommands `db:"commands" json:"commands"`
-	CreatedSuccessfully      bool          `db:"created_successfully" json:"created_successfully"`
-	InitialDeploymentSuccess bool          `db:"initial_deployment_success" json:"initial_deployment_success"`
-	CreatedAt                string        `db:"created_at" json:"created_at"`
+	ID                       int64           `db:"id" json:"id"`
+	Name                     string          `db:"name" json:"name"`
+	Uuid                     string          `db:"uuid" json:"uuid"`
+	Directory                string          `db:"directory" json:"directory"`
+	Type                     string          `db:"type" json:"type"`
+	RepoUrl                  string          `db:"repo_url" json:"repo_url"`
+	Branch                   string          `db:"branch" json:"branch"`
+	Remote                   string          `db:"remote" json:"remote"`
+	Port                     int             `db:"port" json:"port"`
+	Commands                 StackCommands   `db:"commands" json:"commands"`
+	GitOptions               GitOptions      `db:"git_options" json:"git_options"`
+	AppPath                  string          `db:"app_path" json:"app_path"`
+	PathFilters              PathFilters     `db:"path_filters" json:"path_filters"`
+	ExecPolicy               commands.Policy `db:"exec_policy" json:"exec_policy"`
+	CreatedSuccessfully      bool            `db:"created_successfully" json:"created_successfully"`
+	InitialDeploymentSuccess bool            `db:"initial_deployment_success" json:"initial_deployment_success"`
+	CreatedAt                string          `db:"created_at" json:"created_at"`
+}
+
+// AppDir returns the directory the app runs in, the repo root unless an app path is set
+func (s *Stack) AppDir() string {
+	return filepath.Join(s.Directory, s.AppPath)
 }
 
 type StackCommands struct {
 	Build string `json:"build"`
 	Start string `json:"start"`
 	Post  string `json:"post"`
+	// BuildOutputs are the folders of the app cached per commit after a build
+	BuildOutputs []string `json:"build_outputs,omitempty"`
 }
 
 // For saving to DB
@@ -42,10 +56,74 @@ func (s *StackCommands) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, s)
 }
 
+// GitOptions control how the repository of a stack is cloned and updated
+type GitOptions struct {
+	// Depth limits clones and fetches to the last n commits, 0 fetches the full history
+	Depth int `json:"depth"`
+	// PartialClone clones without file contents (--filter=blob:none), blobs are fetched on checkout
+	PartialClone bool `json:"partial_clone"`
+	// Submodules initializes and updates submodules recursively on clone and every update
+	Submodules bool `json:"submodules"`
+}
+
+// For saving to DB
+func (o GitOptions) Value() (driver.Value, error) {
+	return json.Marshal(o)
+}
+
+// For reading from DB
+func (o *GitOptions) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, o)
+	case string:
+		return json.Unmarshal([]byte(v), o)
+	case nil:
+		return nil
+	}
+	return fmt.Errorf("Scan source is not []byte")
+}
+
+// PathFilters are the repo paths (git pathspecs) a stack is built from.
+// Deploys are skipped when none of them changed since the last deployment.
+type PathFilters []string
+
+// For saving to DB
+func (p PathFilters) Value() (driver.Value, error) {
+	if p == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(p)
+}
+
+// For reading from DB
+func (p *PathFilters) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	case nil:
+		*p = nil
+		return nil
+	}
+	return fmt.Errorf("Scan source is not []byte")
+}
+
+// GitCredentials are the private repository credentials of a stack, stored encrypted in the secrets store
+type GitCredentials struct {
+	SSHPrivateKey string `json:"ssh_private_key,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+}
+
 const (
 	DEPLOYMENT_STATUS_IN_PROGRESS = "in_progress"
 	DEPLOYMENT_STATUS_SUCCESS     = "success"
 	DEPLOYMENT_STATUS_FAILED      = "failed"
+	DEPLOYMENT_STATUS_SKIPPED     = "skipped"
+	DEPLOYMENT_STATUS_CANCELLED   = "cancelled"
+	DEPLOYMENT_STATUS_TIMED_OUT   = "timed_out"
 )
 
 type Deployment struct {
@@ -53,10 +131,38 @@ type Deployment struct {
 	StackID          int64  `db:"stack_id" json:"stack_id"`
 	Status           string `db:"status" json:"status"`
 	CommitHash       string `db:"commit_hash" json:"commit_hash"`
+	Ref              string `db:"ref" json:"ref"`
+	RuntimeVersion   string `db:"runtime_version" json:"runtime_version"`
+	CommitMessage    string `db:"commit_message" json:"commit_message"`
+	Pusher           string `db:"pusher" json:"pusher"`
+	TriggeredBy      string `db:"triggered_by" json:"triggered_by"`
 	RolledBackFromID int64  `db:"rolled_back_from_id" json:"rolled_back_from_id"`
 	DeployedAt       string `db:"deployed_at" json:"deployed_at"`
 }
 
+// deployment steps in the order they run
+const (
+	DEPLOYMENT_STEP_FETCH   = "fetch"
+	DEPLOYMENT_STEP_INSTALL = "install"
+	DEPLOYMENT_STEP_BUILD   = "build"
+	DEPLOYMENT_STEP_START   = "start"
+	DEPLOYMENT_STEP_HEALTH  = "health"
+	DEPLOYMENT_STEP_POST    = "post"
+)
+
+// DeploymentStep is a timed step of a deployment. Its status is one of the deployment statuses.
+type DeploymentStep struct {
+	ID           int64   `db:"id" json:"id"`
+	DeploymentID int64   `db:"deployment_id" json:"deployment_id"`
+	Name         string  `db:"name" json:"name"`
+	Status       string  `db:"status" json:"status"`
+	StartedAt    string  `db:"started_at" json:"started_at"`
+	FinishedAt   *string `db:"finished_at" json:"finished_at"`
+	DurationMs   int64   `db:"duration_ms" json:"duration_ms"`
+	ExitCode     *int    `db:"exit_code" json:"exit_code"`
+	Log          string  `db:"log" json:"log,omitempty"`
+}
+
 type DeploymentLog struct {
 	ID           int64  `db:"id" json:"id"`
 	DeploymentID int64  `db:"deployment_id" json:"deployment_id"`
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// APITokenPrefix starts every API token, it tells them apart from session JWTs
+const APITokenPrefix = "sjt_"
+
+// APIToken is a named token of a user for scripts and CI. Only the hash of the token is stored.
+type APIToken struct {
+	ID         int64       `db:"id" json:"id"`
+	UserID     int64       `db:"user_id" json:"user_id"`
+	Name       string      `db:"name" json:"name"`
+	TokenHash  string      `db:"token_hash" json:"-"`
+	Prefix     string      `db:"prefix" json:"prefix"`
+	Scopes     TokenScopes `db:"scopes" json:"scopes"`
+	ExpiresAt  *string     `db:"expires_at" json:"expires_at"`
+	LastUsedAt *string     `db:"last_used_at" json:"last_used_at"`
+	CreatedAt  string      `db:"created_at" json:"created_at"`
+}
+
+// scopeRoles are the scope actions and the role each of them grants
+var scopeRoles = map[string]Role{
+	"read":   RoleViewer,
+	"deploy": RoleDeployer,
+	"manage": RoleMaintainer,
+	"admin":  RoleAdmin,
+}
+
+// ParseScope parses a scope like "deploy" or "deploy:stack:3" into the role it grants and its stack,
+// stack 0 means all stacks
+func ParseScope(scope string) (Role, int64, error) {
+	action, stack, limited := strings.Cut(scope, ":stack:")
+	role, ok := scopeRoles[action]
+	if !ok {
+		return "", 0, fmt.Errorf("invalid scope %q, use read, deploy, manage or admin, optionally followed by :stack:<id>", scope)
+	}
+	if !limited {
+		return role, 0, nil
+	}
+	if role == RoleAdmin {
+		return "", 0, fmt.Errorf("invalid scope %q, admin can not be limited to a stack", scope)
+	}
+	stackID, err := strconv.ParseInt(stack, 10, 64)
+	if err != nil || stackID <= 0 {
+		return "", 0, fmt.Errorf("invalid stack id in scope %q", scope)
+	}
+	return role, stackID, nil
+}
+
+// TokenScopes limit what an API token can do on top of the role of its user
+type TokenScopes []string
+
+// Validate checks every scope can be parsed
+func (s TokenScopes) Validate() error {
+	if len(s) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range s {
+		if _, _, err := ParseScope(scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Allows reports whether a scope grants role on a stack. With stack 0 only scopes on all stacks count.
+func (s TokenScopes) Allows(role Role, stackID int64) bool {
+	for _, scope := range s {
+		scopeRole, scopeStack, err := ParseScope(scope)
+		if err != nil || !scopeRole.Includes(role) {
+			continue
+		}
+		if scopeStack == 0 || (stackID != 0 && scopeStack == stackID) {
+			return true
+		}
+	}
+	return false
+}
+
+// For saving to DB
+func (s TokenScopes) Value() (driver.Value, error) {
+	if s == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(s)
+}
+
+// For reading from DB
+func (s *TokenScopes) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	case nil:
+		*s = nil
+		return nil
+	}
+	return fmt.Errorf("Scan source is not []byte")
+}
@@ -0,0 +1,89 @@
+package models
+
+import "testing"
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		scope string
+		role  Role
+		stack int64
+		valid bool
+	}{
+		{"read", RoleViewer, 0, true},
+		{"deploy", RoleDeployer, 0, true},
+		{"manage", RoleMaintainer, 0, true},
+		{"admin", RoleAdmin, 0, true},
+		{"deploy:stack:3", RoleDeployer, 3, true},
+		{"read:stack:12", RoleViewer, 12, true},
+		{"", "", 0, false},
+		{"write", "", 0, false},
+		{"Deploy", "", 0, false},
+		{" deploy", "", 0, false},
+		{"admin:stack:3", "", 0, false},
+		{"deploy:stack:", "", 0, false},
+		{"deploy:stack:0", "", 0, false},
+		{"deploy:stack:-3", "", 0, false},
+		{"deploy:stack:abc", "", 0, false},
+		{"deploy:stack:3:stack:4", "", 0, false},
+		{"deploy:stacks:3", "", 0, false},
+		{"deploy:3", "", 0, false},
+	}
+	for _, tt := range tests {
+		role, stack, err := ParseScope(tt.scope)
+		if (err == nil) != tt.valid || role != tt.role || stack != tt.stack {
+			t.Errorf("ParseScope(%q) = %q, %d, %v, want %q, %d, valid %t", tt.scope, role, stack, err, tt.role, tt.stack, tt.valid)
+		}
+	}
+}
+
+func TestTokenScopesAllows(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  TokenScopes
+		role    Role
+		stackID int64
+		allowed bool
+	}{
+		// the scope hierarchy follows the roles
+		{"admin allows manage", TokenScopes{"admin"}, RoleMaintainer, 3, true},
+		{"manage allows deploy", TokenScopes{"manage"}, RoleDeployer, 3, true},
+		{"deploy allows read", TokenScopes{"deploy"}, RoleViewer, 3, true},
+		{"read denies deploy", TokenScopes{"read"}, RoleDeployer, 3, false},
+		{"deploy denies manage", TokenScopes{"deploy"}, RoleMaintainer, 3, false},
+		{"manage denies admin", TokenScopes{"manage"}, RoleAdmin, 0, false},
+		{"global scope on every stack", TokenScopes{"deploy"}, RoleDeployer, 0, true},
+
+		// stack bound scopes
+		{"own stack", TokenScopes{"deploy:stack:3"}, RoleDeployer, 3, true},
+		{"own stack lower role", TokenScopes{"deploy:stack:3"}, RoleViewer, 3, true},
+		{"own stack higher role", TokenScopes{"deploy:stack:3"}, RoleMaintainer, 3, false},
+		{"other stack", TokenScopes{"deploy:stack:3"}, RoleDeployer, 4, false},
+		{"all stacks", TokenScopes{"manage:stack:3"}, RoleViewer, 0, false},
+		{"one of several scopes", TokenScopes{"read", "deploy:stack:4"}, RoleDeployer, 4, true},
+		{"read everywhere deploy on one", TokenScopes{"read", "deploy:stack:4"}, RoleDeployer, 3, false},
+
+		// malformed scopes grant nothing
+		{"unknown action", TokenScopes{"write"}, RoleViewer, 3, false},
+		{"admin on a stack", TokenScopes{"admin:stack:3"}, RoleViewer, 3, false},
+		{"invalid stack", TokenScopes{"deploy:stack:x"}, RoleViewer, 0, false},
+		{"no scopes", nil, RoleViewer, 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scopes.Allows(tt.role, tt.stackID); got != tt.allowed {
+				t.Fatalf("%v.Allows(%s, %d) = %t, want %t", tt.scopes, tt.role, tt.stackID, got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestTokenScopesValidate(t *testing.T) {
+	if err := (TokenScopes{"read", "deploy:stack:3"}).Validate(); err != nil {
+		t.Errorf("valid scopes: %v", err)
+	}
+	for _, scopes := range []TokenScopes{nil, {}, {"read", "write"}, {"admin:stack:1"}} {
+		if err := scopes.Validate(); err == nil {
+			t.Errorf("%v was accepted", scopes)
+		}
+	}
+}
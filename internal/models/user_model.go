@@ -1,14 +1,116 @@
 package models
 
+import "time"
+
 type Role string
 
 const (
+	// RoleAdmin manages users and has every permission on every stack
+	RoleAdmin Role = "admin"
+	// RoleMaintainer creates stacks and changes their configuration and members
+	RoleMaintainer Role = "maintainer"
+	// RoleDeployer deploys stacks and cancels their deployments
+	RoleDeployer Role = "deployer"
+	// RoleViewer reads stacks and their deployments
+	RoleViewer Role = "viewer"
+	// RoleMember has no role on all stacks, only on the stacks it is a member of
+	RoleMember Role = "member"
+	// RoleSuperAdmin is the role of accounts created by older versions, it has the permissions of an admin
 	RoleSuperAdmin Role = "superadmin"
 )
 
+// roles ordered by their permissions, each role includes the permissions of the roles before it
+var roleRanks = map[Role]int{
+	RoleViewer:     1,
+	RoleDeployer:   2,
+	RoleMaintainer: 3,
+	RoleAdmin:      4,
+	RoleSuperAdmin: 4,
+}
+
+// Includes reports whether r has at least the permissions of role
+func (r Role) Includes(role Role) bool {
+	return roleRanks[r] > 0 && roleRanks[r] >= roleRanks[role]
+}
+
+// IsValid reports whether r can be given to a user
+func (r Role) IsValid() bool {
+	return r == RoleAdmin || r == RoleMember || r.IsStackRole()
+}
+
+// IsStackRole reports whether r can be granted on a single stack
+func (r Role) IsStackRole() bool {
+	return r == RoleMaintainer || r == RoleDeployer || r == RoleViewer
+}
+
+// Max returns the role with more permissions
+func (r Role) Max(other Role) Role {
+	if roleRanks[other] > roleRanks[r] {
+		return other
+	}
+	return r
+}
+
 type User struct {
-	ID       int64  `db:"id" json:"id"`
-	Email    string `db:"email" json:"email"`
-	Password string `db:"password" json:"-"`
-	Role     Role   `db:"role" json:"role"`
+	ID                 int64   `db:"id" json:"id"`
+	Email              string  `db:"email" json:"email"`
+	Password           string  `db:"password" json:"-"`
+	Role               Role    `db:"role" json:"role"`
+	Disabled           bool    `db:"disabled" json:"disabled"`
+	MustChangePassword bool    `db:"must_change_password" json:"must_change_password"`
+	TOTPSecret         string  `db:"totp_secret" json:"-"`
+	TOTPEnabled        bool    `db:"totp_enabled" json:"totp_enabled"`
+	TOTPLastStep       int64   `db:"totp_last_step" json:"-"`
+	FailedLogins       int     `db:"failed_logins" json:"-"`
+	LockedUntil        *string `db:"locked_until" json:"locked_until"`
+	OIDCSubject        *string `db:"oidc_subject" json:"-"`
+	CreatedAt          string  `db:"created_at" json:"created_at"`
+}
+
+// IsLocked reports whether the account is locked after too many failed logins
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && *u.LockedUntil > now.UTC().Format(time.RFC3339)
+}
+
+// UserInvitation lets someone create an account with a role while signup is disabled.
+// Only the hash of the token is stored.
+type UserInvitation struct {
+	ID        int64   `db:"id" json:"id"`
+	TokenHash string  `db:"token_hash" json:"-"`
+	Email     string  `db:"email" json:"email"`
+	Role      Role    `db:"role" json:"role"`
+	CreatedBy *int64  `db:"created_by" json:"created_by"`
+	ExpiresAt string  `db:"expires_at" json:"expires_at"`
+	UsedAt    *string `db:"used_at" json:"used_at"`
+	CreatedAt string  `db:"created_at" json:"created_at"`
+}
+
+// StackMember grants a user a role on a single stack, in addition to the role of the user on all stacks
+type StackMember struct {
+	ID      int64  `db:"id" json:"id"`
+	StackID int64  `db:"stack_id" json:"stack_id"`
+	UserID  int64  `db:"user_id" json:"user_id"`
+	Email   string `db:"email" json:"email"`
+	Role    Role   `db:"role" json:"role"`
+}
+
+// how sessions were started
+const (
+	AUTH_METHOD_PASSWORD = "password"
+	// AUTH_METHOD_OIDC sessions leave the second factor to the identity provider
+	AUTH_METHOD_OIDC = "oidc"
+)
+
+// Session is a login of a user. Its refresh token, of which only the hash is stored, issues new access tokens.
+type Session struct {
+	ID          int64   `db:"id" json:"id"`
+	UserID      int64   `db:"user_id" json:"user_id"`
+	RefreshHash string  `db:"refresh_hash" json:"-"`
+	AuthMethod  string  `db:"auth_method" json:"auth_method"`
+	UserAgent   string  `db:"user_agent" json:"user_agent"`
+	IP          string  `db:"ip" json:"ip"`
+	ExpiresAt   string  `db:"expires_at" json:"expires_at"`
+	RevokedAt   *string `db:"revoked_at" json:"revoked_at"`
+	LastUsedAt  string  `db:"last_used_at" json:"last_used_at"`
+	CreatedAt   string  `db:"created_at" json:"created_at"`
 }
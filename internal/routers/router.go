@@ -5,21 +5,33 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/satnamSandhu2001/stackjet/internal/handlers"
 	"github.com/satnamSandhu2001/stackjet/internal/middlewares"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
 	"github.com/satnamSandhu2001/stackjet/internal/services"
 )
 
 func InitRouter(router *gin.Engine, db *sqlx.DB) {
 
-	v1 := router.Group("/api/v1")
+	// rate limits are counted per server, see RATE_LIMITS
+	auditService := services.NewAuditService(db)
+	v1 := router.Group("/api/v1",
+		middlewares.RequestActor(models.AUDIT_SOURCE_API),
+		middlewares.RateLimit("api", middlewares.RateLimitByIP, auditService),
+	)
 
 	userService := services.NewUserService(db)
 
-	// auth routes
+	// auth routes, limited per IP and per account on top of the lockout of accounts
 	authHandler := handlers.NewAuthHandler(userService)
-	authGroup := v1.Group("/auth")
+	authGroup := v1.Group("/auth", middlewares.RateLimit("auth_ip", middlewares.RateLimitByIP, auditService))
+	accountLimit := middlewares.RateLimit("auth_account", middlewares.RateLimitByEmail, auditService)
 	{
-		authGroup.POST("/signup", authHandler.Signup)
-		authGroup.POST("/login", authHandler.Login)
+		authGroup.POST("/signup", accountLimit, authHandler.Signup)
+		authGroup.POST("/login", accountLimit, authHandler.Login)
+		authGroup.POST("/2fa/verify", authHandler.VerifyTwoFactor)
+		authGroup.POST("/refresh", authHandler.Refresh)
+		authGroup.POST("/logout", authHandler.Logout)
+		authGroup.GET("/oidc/login", authHandler.OIDCLogin)
+		authGroup.GET("/oidc/callback", authHandler.OIDCCallback)
 	}
 
 	// user routes
@@ -27,17 +39,74 @@ func InitRouter(router *gin.Engine, db *sqlx.DB) {
 	userGroup := v1.Group("/users", middlewares.AuthMiddleware(userService))
 	{
 		userGroup.GET("me", userHandler.GetMyDetails)
-		userGroup.GET("", userHandler.ListUsers)
+		userGroup.PUT("me/password", middlewares.RequireSession(), userHandler.ChangeMyPassword)
+		userGroup.GET("me/tokens", middlewares.RequireSession(), userHandler.ListMyTokens)
+		userGroup.POST("me/tokens", middlewares.RequireSession(), userHandler.CreateMyToken)
+		userGroup.DELETE("me/tokens/:id", middlewares.RequireSession(), userHandler.DeleteMyToken)
+		userGroup.GET("me/2fa", middlewares.RequireSession(), userHandler.GetMyTwoFactor)
+		userGroup.POST("me/2fa/setup", middlewares.RequireSession(), userHandler.SetupMyTwoFactor)
+		userGroup.POST("me/2fa/enable", middlewares.RequireSession(), userHandler.EnableMyTwoFactor)
+		userGroup.POST("me/2fa/disable", middlewares.RequireSession(), userHandler.DisableMyTwoFactor)
+		userGroup.POST("me/2fa/recovery-codes", middlewares.RequireSession(), userHandler.RegenerateMyRecoveryCodes)
+		userGroup.GET("me/sessions", middlewares.RequireSession(), userHandler.ListMySessions)
+		userGroup.DELETE("me/sessions/:id", middlewares.RequireSession(), userHandler.RevokeMySession)
+		userGroup.POST("me/sessions/revoke-all", middlewares.RequireSession(), userHandler.RevokeMySessions)
+
+		adminGroup := userGroup.Group("", middlewares.RequireRole(models.RoleAdmin))
+		adminGroup.GET("", userHandler.ListUsers)
+		adminGroup.POST("", userHandler.CreateUser)
+		adminGroup.GET("/invitations", userHandler.ListInvitations)
+		adminGroup.POST("/invitations", userHandler.CreateInvitation)
+		adminGroup.DELETE("/invitations/:id", userHandler.DeleteInvitation)
+		adminGroup.PATCH("/:id", userHandler.UpdateUser)
+		adminGroup.DELETE("/:id", userHandler.DeleteUser)
+		adminGroup.POST("/:id/disable", userHandler.DisableUser)
+		adminGroup.POST("/:id/enable", userHandler.EnableUser)
+		adminGroup.POST("/:id/unlock", userHandler.UnlockUser)
+		adminGroup.POST("/:id/password", userHandler.ResetPassword)
+		adminGroup.POST("/:id/sessions/revoke-all", userHandler.RevokeUserSessions)
+		adminGroup.POST("/:id/2fa/reset", userHandler.ResetTwoFactor)
 	}
 
-	// stack routes
+	// stack routes, a user's role on all stacks is raised by its membership of a stack
 	stackService := services.NewStackService(db)
-	stackHandler := handlers.NewStackHandler(stackService)
+	secretService := services.NewSecretService(db)
+	stackHandler := handlers.NewStackHandler(stackService, secretService, userService, auditService)
+	stackParam := middlewares.StackFromParam("id")
+	deployLimit := middlewares.RateLimit("deploy", middlewares.RateLimitByUser, auditService)
 	stackGroup := v1.Group("/stack", middlewares.AuthMiddleware(userService))
 	{
 		stackGroup.GET("/list", stackHandler.ListStacks)
-		stackGroup.POST("/new", stackHandler.CreateNewStack)
-		stackGroup.POST("/deploy/:id", stackHandler.DeployStack)
+		stackGroup.POST("/new", middlewares.RequireRole(models.RoleMaintainer), stackHandler.CreateNewStack)
+		stackGroup.POST("/deploy/:id", deployLimit, middlewares.RequireStackPermission(stackService, models.RoleDeployer, stackParam), stackHandler.DeployStack)
+		stackGroup.POST("/rollback/:id", deployLimit, middlewares.RequireStackPermission(stackService, models.RoleDeployer, stackParam), stackHandler.RollbackStack)
+		stackGroup.GET("/:id/deployments", middlewares.RequireStackPermission(stackService, models.RoleViewer, stackParam), stackHandler.ListDeployments)
+		stackGroup.GET("/:id/members", middlewares.RequireStackPermission(stackService, models.RoleViewer, stackParam), stackHandler.ListMembers)
+		stackGroup.PUT("/:id/members", middlewares.RequireStackPermission(stackService, models.RoleMaintainer, stackParam), stackHandler.UpsertMember)
+		stackGroup.DELETE("/:id/members/:user_id", middlewares.RequireStackPermission(stackService, models.RoleMaintainer, stackParam), stackHandler.DeleteMember)
+	}
+	deploymentGroup := v1.Group("/deployments", middlewares.AuthMiddleware(userService))
+	{
+		deploymentGroup.GET("/:id/logs", middlewares.RequireStackPermission(stackService, models.RoleViewer, middlewares.StackFromDeployment("id")), stackHandler.GetDeploymentLogs)
+		deploymentGroup.POST("/:id/cancel", deployLimit, middlewares.RequireStackPermission(stackService, models.RoleDeployer, middlewares.StackFromDeployment("id")), stackHandler.CancelDeployment)
+	}
+
+	// audit log, readable by admins only
+	auditHandler := handlers.NewAuditHandler(auditService)
+	auditGroup := v1.Group("/audit", middlewares.AuthMiddleware(userService), middlewares.RequireRole(models.RoleAdmin))
+	{
+		auditGroup.GET("", auditHandler.ListEvents)
+	}
+
+	// git webhook routes, authenticated by the per-stack webhook secret
+	webhookHandler := handlers.NewWebhookHandler(stackService, secretService)
+	// failed deliveries are limited per IP, verified ones per stack
+	hookGroup := v1.Group("/hooks",
+		middlewares.RequestActor(models.AUDIT_SOURCE_WEBHOOK),
+		middlewares.RateLimitFailures("webhook_failed", middlewares.RateLimitByIP, auditService),
+	)
+	{
+		hookGroup.POST("/:stack_uuid", webhookHandler.Verify, middlewares.RateLimit("webhook", middlewares.RateLimitByParam("stack_uuid"), auditService), webhookHandler.Receive)
 	}
 
 }
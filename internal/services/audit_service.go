@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+type AuditService struct {
+	db *sqlx.DB
+}
+
+func NewAuditService(db *sqlx.DB) *AuditService {
+	return &AuditService{
+		db: db,
+	}
+}
+
+type auditActorKey struct{}
+
+// WithActor returns a context whose audit events are recorded for actor
+func WithActor(ctx context.Context, actor models.AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// ActorFromContext returns the actor of a context, commands without one are run from the CLI by the system user
+func ActorFromContext(ctx context.Context) models.AuditActor {
+	actor, ok := ctx.Value(auditActorKey{}).(models.AuditActor)
+	if !ok || actor.Source == "" {
+		actor.Source = models.AUDIT_SOURCE_CLI
+		actor.Name = systemUser()
+	}
+	return actor
+}
+
+func systemUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// Record stores an audit event for the actor of ctx. Failures are logged, they never fail the audited action.
+func (s *AuditService) Record(ctx context.Context, event *dto.AuditEvent_Create_Request) {
+	actor := ActorFromContext(ctx)
+	if event.Actor == "" {
+		event.Actor = actor.Name
+	}
+	if event.ActorID == 0 {
+		event.ActorID = actor.UserID
+	}
+
+	var actorID, stackID any
+	if event.ActorID != 0 {
+		actorID = event.ActorID
+	}
+	if event.StackID != 0 {
+		stackID = event.StackID
+	}
+	query, args, err := sq.Insert("audit_events").
+		Columns("actor_id", "actor", "source", "action", "stack_id", "ip", "summary", "result", "created_at").
+		Values(actorID, event.Actor, actor.Source, event.Action, stackID, actor.IP, event.Summary, event.Result, time.Now().UTC().Format(time.RFC3339)).
+		PlaceholderFormat(sq.Question).ToSql()
+	if err == nil {
+		_, err = s.db.ExecContext(context.WithoutCancel(ctx), query, args...)
+	}
+	if err != nil {
+		log.Printf("Failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+// Track records the outcome of an action, it failed when err is not nil
+func (s *AuditService) Track(ctx context.Context, action string, stackID int64, summary string, err error) {
+	event := &dto.AuditEvent_Create_Request{Action: action, StackID: stackID, Summary: summary, Result: models.AUDIT_RESULT_SUCCESS}
+	if err != nil {
+		event.Result = models.AUDIT_RESULT_FAILURE
+		if event.Summary != "" {
+			event.Summary += ": "
+		}
+		event.Summary += err.Error()
+	}
+	s.Record(ctx, event)
+}
+
+// ListEvents returns the newest audit events matching filter first
+func (s *AuditService) ListEvents(ctx context.Context, filter *dto.AuditEvent_List_Request) ([]models.AuditEvent, error) {
+	events := []models.AuditEvent{}
+
+	builder := sq.Select("*").From("audit_events").OrderBy("id DESC")
+	if filter.Actor != "" {
+		builder = builder.Where(sq.Eq{"actor": filter.Actor})
+	}
+	if filter.Source != "" {
+		builder = builder.Where(sq.Eq{"source": filter.Source})
+	}
+	if filter.Action != "" {
+		// a plain prefix, LIKE would treat _ and % as wildcards and ignore case
+		builder = builder.Where("substr(action, 1, ?) = ?", len(filter.Action), filter.Action)
+	}
+	if filter.StackID != 0 {
+		builder = builder.Where(sq.Eq{"stack_id": filter.StackID})
+	}
+	if filter.Result != "" {
+		builder = builder.Where(sq.Eq{"result": filter.Result})
+	}
+	if filter.Since != "" {
+		since, err := parseAuditTime(filter.Since, false)
+		if err != nil {
+			return nil, err
+		}
+		builder = builder.Where(sq.GtOrEq{"created_at": since})
+	}
+	if filter.Until != "" {
+		until, err := parseAuditTime(filter.Until, true)
+		if err != nil {
+			return nil, err
+		}
+		builder = builder.Where(sq.Lt{"created_at": until})
+	}
+	limit := filter.Limit
+	if limit == 0 {
+		limit = 100
+	}
+	builder = builder.Limit(limit).Offset(filter.Offset)
+
+	query, args, err := builder.PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &events, query, args...); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// parseAuditTime parses an RFC3339 time or a date into the format events are stored in.
+// With endOfDay a date ends after its last second, so that events of that day are included.
+func parseAuditTime(value string, endOfDay bool) (string, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		if t, err = time.Parse(time.DateOnly, value); err != nil {
+			return "", ErrInvalidAuditTime
+		}
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
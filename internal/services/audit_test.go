@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+)
+
+func TestListEventsFilters(t *testing.T) {
+	ctx := context.Background()
+	service := NewAuditService(newEmptyDB(t))
+	api := WithActor(ctx, models.AuditActor{Source: models.AUDIT_SOURCE_API, Name: "dev@example.com", UserID: 7, IP: "10.0.0.1"})
+
+	events := []struct {
+		ctx       context.Context
+		event     dto.AuditEvent_Create_Request
+		createdAt string
+	}{
+		{api, dto.AuditEvent_Create_Request{Action: "auth.login", Result: models.AUDIT_RESULT_FAILURE}, "2026-10-17T23:59:59Z"},
+		{api, dto.AuditEvent_Create_Request{Action: "stack.deploy", StackID: 3, Result: models.AUDIT_RESULT_SUCCESS}, "2026-10-18T08:00:00Z"},
+		{ctx, dto.AuditEvent_Create_Request{Action: "stack.deploy", StackID: 4, Result: models.AUDIT_RESULT_FAILURE}, "2026-10-18T23:59:59Z"},
+		{api, dto.AuditEvent_Create_Request{Action: "stackXdeploy", Result: models.AUDIT_RESULT_SUCCESS}, "2026-10-19T00:00:00Z"},
+		{api, dto.AuditEvent_Create_Request{Action: "Stack.rename", Result: models.AUDIT_RESULT_BLOCKED}, "2026-10-19T10:00:00Z"},
+	}
+	for i, e := range events {
+		service.Record(e.ctx, &e.event)
+		if _, err := service.db.Exec("UPDATE audit_events SET created_at = ? WHERE id = ?", e.createdAt, i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter dto.AuditEvent_List_Request
+		want   string
+	}{
+		{"all newest first", dto.AuditEvent_List_Request{}, "5 4 3 2 1"},
+		{"action prefix", dto.AuditEvent_List_Request{Action: "stack."}, "3 2"},
+		{"action prefix is not a pattern", dto.AuditEvent_List_Request{Action: "stack_"}, ""},
+		{"action prefix keeps case", dto.AuditEvent_List_Request{Action: "Stack"}, "5"},
+		{"whole action", dto.AuditEvent_List_Request{Action: "auth.login"}, "1"},
+		{"actor", dto.AuditEvent_List_Request{Actor: "dev@example.com"}, "5 4 2 1"},
+		{"source", dto.AuditEvent_List_Request{Source: models.AUDIT_SOURCE_CLI}, "3"},
+		{"stack", dto.AuditEvent_List_Request{StackID: 3}, "2"},
+		{"result", dto.AuditEvent_List_Request{Result: models.AUDIT_RESULT_FAILURE}, "3 1"},
+		{"since a date", dto.AuditEvent_List_Request{Since: "2026-10-18"}, "5 4 3 2"},
+		{"until a date includes the day", dto.AuditEvent_List_Request{Until: "2026-10-18"}, "3 2 1"},
+		{"one day", dto.AuditEvent_List_Request{Since: "2026-10-18", Until: "2026-10-18"}, "3 2"},
+		{"until a time excludes it", dto.AuditEvent_List_Request{Until: "2026-10-19T00:00:00Z"}, "3 2 1"},
+		{"times in another zone", dto.AuditEvent_List_Request{Since: "2026-10-18T10:00:00+02:00", Until: "2026-10-19T02:00:00+02:00"}, "3 2"},
+		{"combined", dto.AuditEvent_List_Request{Action: "stack.", Result: models.AUDIT_RESULT_FAILURE, Source: models.AUDIT_SOURCE_CLI}, "3"},
+		{"page", dto.AuditEvent_List_Request{Limit: 2, Offset: 1}, "4 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := service.ListEvents(ctx, &tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			for i, event := range list {
+				if i > 0 {
+					got += " "
+				}
+				got += fmt.Sprint(event.ID)
+			}
+			if got != tt.want {
+				t.Fatalf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := service.ListEvents(ctx, &dto.AuditEvent_List_Request{Since: "yesterday"}); !errors.Is(err, ErrInvalidAuditTime) {
+		t.Fatalf("invalid time = %v, want %v", err, ErrInvalidAuditTime)
+	}
+}
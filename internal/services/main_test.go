@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+)
+
+// testDB is the database of a StackJet initialized in a temporary home for the tests
+var testDB *sqlx.DB
+
+// testHome is the temporary home of the tests
+var testHome string
+
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "stackjet-services")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	code := func() int {
+		defer os.RemoveAll(home)
+		testHome = home
+		os.Setenv("HOME", home)
+		dir := filepath.Join(home, ".stackjet")
+		files := map[string]string{"init.lock": "", "jwt.token": "test-signing-key", "config.json": "{}"}
+		if err := os.Mkdir(dir, 0700); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+		}
+		if err := database.RunInitSQL(); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		testDB = database.Connect()
+		defer testDB.Close()
+		return m.Run()
+	}()
+	os.Exit(code)
+}
+
+// usersCreated numbers the users of newUser
+var usersCreated int
+
+// newUser creates a user named after the test and returns it as stored
+func newUser(t *testing.T, service *UserService, role models.Role) *models.User {
+	t.Helper()
+	ctx := context.Background()
+	usersCreated++
+	email := fmt.Sprintf("%s-%d@example.com", strings.ToLower(strings.NewReplacer("/", "-", "_", "-").Replace(t.Name())), usersCreated)
+	if err := service.CreateUser(ctx, &dto.User_RegisterRequest{Email: email, Password: "correct horse battery", Role: string(role)}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := service.GetUserByEmail(ctx, email)
+	if err != nil || user == nil {
+		t.Fatalf("user %s = %v %v", email, user, err)
+	}
+	return user
+}
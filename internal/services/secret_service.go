@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+)
+
+// SecretService stores values encrypted with the StackJet secret key
+type SecretService struct {
+	db    *sqlx.DB
+	audit *AuditService
+}
+
+func NewSecretService(db *sqlx.DB) *SecretService {
+	return &SecretService{
+		db:    db,
+		audit: NewAuditService(db),
+	}
+}
+
+// SetSecret creates or replaces a secret
+func (s *SecretService) SetSecret(ctx context.Context, name string, value string) (err error) {
+	defer func() { s.audit.Track(ctx, "secret.set", 0, name, err) }()
+
+	encrypted, err := pkg.Encrypt(value)
+	if err != nil {
+		return err
+	}
+	query, args, err := sq.Insert("secrets").Columns("name", "value").Values(name, encrypted).
+		Suffix("ON CONFLICT(name) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP").
+		PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetSecret returns the decrypted secret or an empty string if it does not exist
+func (s *SecretService) GetSecret(ctx context.Context, name string) (string, error) {
+	var encrypted string
+
+	query, args, err := sq.Select("value").From("secrets").Where(sq.Eq{"name": name}).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.GetContext(ctx, &encrypted, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return pkg.Decrypt(encrypted)
+}
+
+// ListSecretNames returns the names of all stored secrets, never their values
+func (s *SecretService) ListSecretNames(ctx context.Context) ([]string, error) {
+	var names []string
+
+	query, args, err := sq.Select("name").From("secrets").OrderBy("name").PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &names, query, args...); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (s *SecretService) DeleteSecret(ctx context.Context, name string) (err error) {
+	defer func() { s.audit.Track(ctx, "secret.delete", 0, name, err) }()
+
+	query, args, err := sq.Delete("secrets").Where(sq.Eq{"name": name}).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	return nil
+}
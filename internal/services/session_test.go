@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+)
+
+func TestRefreshSessionRotatesToken(t *testing.T) {
+	ctx := context.Background()
+	service := NewUserService(testDB)
+	user := newUser(t, service, models.RoleViewer)
+	session, first, err := service.CreateSession(ctx, user.ID, "password", "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refreshed, second, err := service.RefreshSession(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.ID != session.ID || second == first {
+		t.Fatalf("refresh = session #%d with a new token %v, want session #%d rotated", refreshed.ID, second != first, session.ID)
+	}
+	if _, third, err := service.RefreshSession(ctx, second); err != nil || third == second {
+		t.Fatalf("refresh with the rotated token = %v", err)
+	}
+
+	if _, _, err := service.RefreshSession(ctx, "unknown-token"); !errors.Is(err, ErrInvalidSession) {
+		t.Fatalf("refresh with an unknown token = %v, want %v", err, ErrInvalidSession)
+	}
+	if active, err := service.GetActiveSession(ctx, session.ID); err != nil || active == nil {
+		t.Fatalf("an unknown token revoked the session: %v", err)
+	}
+}
+
+func TestRefreshSessionReuseRevokesSession(t *testing.T) {
+	ctx := context.Background()
+	service := NewUserService(testDB)
+	user := newUser(t, service, models.RoleViewer)
+	session, stolen, err := service.CreateSession(ctx, user.ID, "password", "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, otherToken, err := service.CreateSession(ctx, user.ID, "password", "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, current, err := service.RefreshSession(ctx, stolen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := service.RefreshSession(ctx, stolen); !errors.Is(err, ErrInvalidSession) {
+		t.Fatalf("refresh with a rotated token = %v, want %v", err, ErrInvalidSession)
+	}
+	if active, err := service.GetActiveSession(ctx, session.ID); err != nil || active != nil {
+		t.Fatalf("session after the reuse = %v %v, want it revoked", active, err)
+	}
+	// the holder of the current token is logged out as well, the thief may be holding it
+	if _, _, err := service.RefreshSession(ctx, current); !errors.Is(err, ErrInvalidSession) {
+		t.Fatalf("refresh with the current token of a revoked session = %v, want %v", err, ErrInvalidSession)
+	}
+	if active, err := service.GetActiveSession(ctx, other.ID); err != nil || active == nil {
+		t.Fatalf("another session of the user was revoked: %v", err)
+	}
+	if _, _, err := service.RefreshSession(ctx, otherToken); err != nil {
+		t.Fatalf("refresh of another session: %v", err)
+	}
+
+	var events int
+	if err := testDB.Get(&events, `SELECT COUNT(*) FROM audit_events WHERE action = 'auth.refresh_reuse' AND actor_id = ?`, user.ID); err != nil || events != 1 {
+		t.Fatalf("reuse audit events = %d %v, want 1", events, err)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"net/url"
+	"sort"
 	"strings"
 
 	sq "github.com/Masterminds/squirrel"
@@ -15,23 +18,29 @@ import (
 )
 
 type StackService struct {
-	db *sqlx.DB
+	db    *sqlx.DB
+	audit *AuditService
 }
 
 func NewStackService(db *sqlx.DB) *StackService {
 	return &StackService{
-		db: db,
+		db:    db,
+		audit: NewAuditService(db),
 	}
 }
 
-func (s *StackService) CreateStack(ctx context.Context, data *dto.Stack_Create_Request) (int64, error) {
+func (s *StackService) CreateStack(ctx context.Context, data *dto.Stack_Create_Request) (id int64, err error) {
+	defer func() {
+		s.audit.Track(ctx, "stack.create", id, fmt.Sprintf("%s stack %s from %s", data.Type, data.Name, redactURL(data.RepoUrl)), err)
+	}()
+
 	directory := helpers.GenerateStackDirPath(data.RepoUrl)
 	uuid := uuid.New().String()
 	if data.Name == "" {
 		data.Name = strings.Split(directory, "/")[len(strings.Split(directory, "/"))-1]
 	}
-	columns := []string{"name", "uuid", "type", "directory", "port", "commands"}
-	values := []any{data.Name, uuid, data.Type, directory, data.Port, data.Commands}
+	columns := []string{"name", "uuid", "type", "directory", "port", "commands", "git_options", "app_path", "path_filters", "exec_policy"}
+	values := []any{data.Name, uuid, data.Type, directory, data.Port, data.Commands, data.GitOptions, data.AppPath, data.PathFilters, data.ExecPolicy}
 
 	if data.RepoUrl != "" {
 		columns = append(columns, "repo_url")
@@ -55,12 +64,7 @@ func (s *StackService) CreateStack(ctx context.Context, data *dto.Stack_Create_R
 	if err != nil {
 		return 0, err
 	}
-	newStackID, err := result_stack.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-
-	return newStackID, nil
+	return result_stack.LastInsertId()
 }
 
 func (s *StackService) GetStackList(ctx context.Context) ([]models.Stack, error) {
@@ -78,6 +82,21 @@ func (s *StackService) GetStackList(ctx context.Context) ([]models.Stack, error)
 	return stacks, nil
 }
 
+// GetMemberStackList returns the stacks a user is a member of
+func (s *StackService) GetMemberStackList(ctx context.Context, userID int64) ([]models.Stack, error) {
+	stacks := []models.Stack{}
+
+	query, args, err := sq.Select("s.*").From("stacks s").Join("stack_members m ON m.stack_id = s.id").
+		Where(sq.Eq{"m.user_id": userID}).OrderBy("s.id").PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &stacks, query, args...); err != nil {
+		return nil, err
+	}
+	return stacks, nil
+}
+
 func (s *StackService) GetStackByID(ctx context.Context, id int64) (*models.Stack, error) {
 	var stack models.Stack
 
@@ -94,6 +113,22 @@ func (s *StackService) GetStackByID(ctx context.Context, id int64) (*models.Stac
 	return &stack, nil
 }
 
+func (s *StackService) GetStackByUuid(ctx context.Context, uuid string) (*models.Stack, error) {
+	var stack models.Stack
+
+	query, args, err := sq.Select("*").From("stacks").Where(sq.Eq{"uuid": uuid}).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.GetContext(ctx, &stack, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &stack, nil
+}
+
 func (s *StackService) GetStackByDirectory(ctx context.Context, directory string) (*models.Stack, error) {
 	var stack models.Stack
 
@@ -111,7 +146,11 @@ func (s *StackService) GetStackByDirectory(ctx context.Context, directory string
 	return &stack, nil
 }
 
-func (s *StackService) UpdateStack(ctx context.Context, data *dto.Stack_Update_Request) error {
+func (s *StackService) UpdateStack(ctx context.Context, data *dto.Stack_Update_Request) (err error) {
+	defer func() {
+		s.audit.Track(ctx, "stack.update", data.ID, "changed "+strings.Join(changedStackFields(data), ", "), err)
+	}()
+
 	// check if stack exists
 	existingStack, err := s.GetStackByID(ctx, data.ID)
 	if err != nil {
@@ -140,6 +179,18 @@ func (s *StackService) UpdateStack(ctx context.Context, data *dto.Stack_Update_R
 	if data.InitialDeploymentSuccess != nil {
 		builder = builder.Set("initial_deployment_success", data.InitialDeploymentSuccess)
 	}
+	if data.GitOptions != nil {
+		builder = builder.Set("git_options", *data.GitOptions)
+	}
+	if data.AppPath != nil {
+		builder = builder.Set("app_path", *data.AppPath)
+	}
+	if data.PathFilters != nil {
+		builder = builder.Set("path_filters", *data.PathFilters)
+	}
+	if data.ExecPolicy != nil {
+		builder = builder.Set("exec_policy", *data.ExecPolicy)
+	}
 
 	query, args, err := builder.PlaceholderFormat(sq.Question).ToSql()
 	if err != nil {
@@ -151,9 +202,102 @@ func (s *StackService) UpdateStack(ctx context.Context, data *dto.Stack_Update_R
 	return nil
 }
 
-func (s *StackService) CreateDeployment(ctx context.Context, data *dto.Deployment_Create_Request) (int64, error) {
-	cols := []string{"stack_id", "status"}
-	values := []any{data.StackID, data.Status}
+// redactURL hides the password of URLs with credentials
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
+
+// changedStackFields names the fields an update sets, values are left out as they may hold credentials
+func changedStackFields(data *dto.Stack_Update_Request) []string {
+	var fields []string
+	for name, changed := range map[string]bool{
+		"name":                       data.Name != "",
+		"repo_url":                   data.RepoUrl != "",
+		"branch":                     data.Branch != "",
+		"remote":                     data.Remote != "",
+		"created_successfully":       data.CreatedSuccessfully != nil,
+		"initial_deployment_success": data.InitialDeploymentSuccess != nil,
+		"git_options":                data.GitOptions != nil,
+		"app_path":                   data.AppPath != nil,
+		"path_filters":               data.PathFilters != nil,
+		"exec_policy":                data.ExecPolicy != nil,
+	} {
+		if changed {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// GetStackMemberRole returns the role of a user on a stack, "" if the user is not a member
+func (s *StackService) GetStackMemberRole(ctx context.Context, stackID int64, userID int64) (models.Role, error) {
+	var role models.Role
+
+	query, args, err := sq.Select("role").From("stack_members").Where(sq.Eq{"stack_id": stackID, "user_id": userID}).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.GetContext(ctx, &role, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return role, nil
+}
+
+func (s *StackService) ListStackMembers(ctx context.Context, stackID int64) ([]models.StackMember, error) {
+	members := []models.StackMember{}
+
+	query, args, err := sq.Select("m.id", "m.stack_id", "m.user_id", "u.email", "m.role").From("stack_members m").
+		Join("users u ON u.id = m.user_id").Where(sq.Eq{"m.stack_id": stackID}).OrderBy("m.id").
+		PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &members, query, args...); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// UpsertStackMember grants a user a role on a stack, replacing the previous role
+func (s *StackService) UpsertStackMember(ctx context.Context, data *dto.StackMember_Upsert_Request) (err error) {
+	defer func() {
+		s.audit.Track(ctx, "stack.member.set", data.StackID, fmt.Sprintf("user #%d as %s", data.UserID, data.Role), err)
+	}()
+
+	query, args, err := sq.Insert("stack_members").Columns("stack_id", "user_id", "role").Values(data.StackID, data.UserID, data.Role).
+		Suffix("ON CONFLICT (stack_id, user_id) DO UPDATE SET role = excluded.role").PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s *StackService) DeleteStackMember(ctx context.Context, stackID int64, userID int64) (err error) {
+	defer func() { s.audit.Track(ctx, "stack.member.remove", stackID, fmt.Sprintf("user #%d", userID), err) }()
+
+	query, args, err := sq.Delete("stack_members").Where(sq.Eq{"stack_id": stackID, "user_id": userID}).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// CreateDeployment records a deployment triggered by the actor of ctx
+func (s *StackService) CreateDeployment(ctx context.Context, data *dto.Deployment_Create_Request) (id int64, err error) {
+	defer func() { s.audit.Track(ctx, "deployment.start", data.StackID, deploymentSummary(id, data), err) }()
+
+	cols := []string{"stack_id", "status", "triggered_by"}
+	values := []any{data.StackID, data.Status, ActorFromContext(ctx).String()}
 
 	if data.CommitHash != nil {
 		cols = append(cols, "commit_hash")
@@ -163,6 +307,18 @@ func (s *StackService) CreateDeployment(ctx context.Context, data *dto.Deploymen
 		cols = append(cols, "rolled_back_from_id")
 		values = append(values, *data.RolledBackFromID)
 	}
+	if data.CommitMessage != "" {
+		cols = append(cols, "commit_message")
+		values = append(values, data.CommitMessage)
+	}
+	if data.Pusher != "" {
+		cols = append(cols, "pusher")
+		values = append(values, data.Pusher)
+	}
+	if data.Ref != "" {
+		cols = append(cols, "ref")
+		values = append(values, data.Ref)
+	}
 
 	query, args, err := sq.Insert("deployments").Columns(cols...).Values(values...).PlaceholderFormat(sq.Question).ToSql()
 	if err != nil {
@@ -172,17 +328,71 @@ func (s *StackService) CreateDeployment(ctx context.Context, data *dto.Deploymen
 	if err != nil {
 		return 0, err
 	}
-	newDeploymentID, err := result.LastInsertId()
+	return result.LastInsertId()
+}
+
+// deploymentSummary describes what a deployment deploys
+func deploymentSummary(id int64, data *dto.Deployment_Create_Request) string {
+	summary := fmt.Sprintf("deployment #%d", id)
+	if data.Ref != "" {
+		summary += " of " + data.Ref
+	}
+	if data.CommitHash != nil {
+		summary += " at " + *data.CommitHash
+	}
+	if data.RolledBackFromID != nil {
+		summary += fmt.Sprintf(", rolling back #%d", *data.RolledBackFromID)
+	}
+	if data.Pusher != "" {
+		summary += " pushed by " + data.Pusher
+	}
+	return summary
+}
+
+// nullable deployment columns are read as zero values
+var deploymentColumns = []string{
+	"id", "stack_id", "status", "COALESCE(commit_hash, '') AS commit_hash", "ref", "runtime_version",
+	"commit_message", "pusher", "triggered_by", "COALESCE(rolled_back_from_id, 0) AS rolled_back_from_id", "deployed_at",
+}
+
+func (s *StackService) GetDeploymentByID(ctx context.Context, id int64) (*models.Deployment, error) {
+	var deployment models.Deployment
+
+	query, args, err := sq.Select(deploymentColumns...).From("deployments").Where(sq.Eq{"id": id}).PlaceholderFormat(sq.Question).ToSql()
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if err := s.db.GetContext(ctx, &deployment, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
 	}
-	return newDeploymentID, nil
+	return &deployment, nil
+}
+
+// GetDeploymentList returns the latest deployments of a stack, newest first
+func (s *StackService) GetDeploymentList(ctx context.Context, stackID int64, limit uint64) ([]models.Deployment, error) {
+	deployments := []models.Deployment{}
+
+	query, args, err := sq.Select(deploymentColumns...).From("deployments").Where(sq.Eq{"stack_id": stackID}).
+		OrderBy("id DESC").Limit(limit).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &deployments, query, args...); err != nil {
+		return nil, err
+	}
+	return deployments, nil
 }
 
 func (s *StackService) UpdateDeployment(ctx context.Context, data *dto.Deployment_Update_Request) (*models.Deployment, error) {
 	if data == nil || data.ID == 0 {
 		return nil, errors.New("deployment id is required")
 	}
+	if data.Status != "" && data.Status != models.DEPLOYMENT_STATUS_IN_PROGRESS {
+		defer s.trackDeploymentFinish(ctx, data)
+	}
 
 	builder := sq.Update("deployments").Where(sq.Eq{"id": data.ID})
 	if data.Status != "" {
@@ -191,6 +401,12 @@ func (s *StackService) UpdateDeployment(ctx context.Context, data *dto.Deploymen
 	if data.CommitHash != "" {
 		builder = builder.Set("commit_hash", data.CommitHash)
 	}
+	if data.Ref != "" {
+		builder = builder.Set("ref", data.Ref)
+	}
+	if data.RuntimeVersion != "" {
+		builder = builder.Set("runtime_version", data.RuntimeVersion)
+	}
 	if data.RolledBackFromID != nil {
 		builder = builder.Set("rolled_back_from_id", *data.RolledBackFromID)
 	}
@@ -210,6 +426,22 @@ func (s *StackService) UpdateDeployment(ctx context.Context, data *dto.Deploymen
 	return deployment, nil
 }
 
+// trackDeploymentFinish records the final status of a deployment
+func (s *StackService) trackDeploymentFinish(ctx context.Context, data *dto.Deployment_Update_Request) {
+	result := models.AUDIT_RESULT_SUCCESS
+	if data.Status != models.DEPLOYMENT_STATUS_SUCCESS && data.Status != models.DEPLOYMENT_STATUS_SKIPPED {
+		result = models.AUDIT_RESULT_FAILURE
+	}
+	var stackID int64
+	s.db.GetContext(ctx, &stackID, "SELECT stack_id FROM deployments WHERE id = ?", data.ID)
+	s.audit.Record(ctx, &dto.AuditEvent_Create_Request{
+		Action:  "deployment.finish",
+		StackID: stackID,
+		Summary: fmt.Sprintf("deployment #%d %s", data.ID, data.Status),
+		Result:  result,
+	})
+}
+
 func (s *StackService) CreatePM2(ctx context.Context, data *dto.PM2_Create_Request) (int64, error) {
 	cols := []string{"stack_id", "name", "script"}
 	values := []any{data.StackID, data.Name, data.Script}
@@ -231,11 +463,7 @@ func (s *StackService) CreatePM2(ctx context.Context, data *dto.PM2_Create_Reque
 	if err != nil {
 		return 0, err
 	}
-	newID, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-	return newID, nil
+	return result.LastInsertId()
 }
 
 func (s *StackService) GetPM2byStackID(ctx context.Context, id int64) (*models.PM2, error) {
@@ -255,6 +483,27 @@ func (s *StackService) GetPM2byStackID(ctx context.Context, id int64) (*models.P
 
 }
 
+// GetLastDeployedCommit returns the commit hash of the last successful deployment of a stack, or "" if there is none
+func (s *StackService) GetLastDeployedCommit(ctx context.Context, stackID int64) (string, error) {
+	var commitHash string
+
+	query, args, err := sq.Select("commit_hash").From("deployments").
+		Where(sq.Eq{"stack_id": stackID, "status": models.DEPLOYMENT_STATUS_SUCCESS}).
+		Where(sq.NotEq{"commit_hash": nil}).
+		OrderBy("id DESC").Limit(1).
+		PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.GetContext(ctx, &commitHash, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return commitHash, nil
+}
+
 func (s *StackService) CreateDeploymentLog(ctx context.Context, data *dto.DeploymentLog_Create_Request) (int64, error) {
 	query, args, err := sq.Insert("deployment_logs").Columns("deployment_id", "log").Values(data.DeploymentID, data.Log).PlaceholderFormat(sq.Question).ToSql()
 	if err != nil {
@@ -271,3 +520,319 @@ func (s *StackService) CreateDeploymentLog(ctx context.Context, data *dto.Deploy
 
 	return newID, nil
 }
+
+// GetDeploymentLog returns the log of a deployment, which is saved once it finished
+func (s *StackService) GetDeploymentLog(ctx context.Context, deploymentID int64) (string, error) {
+	logs := []string{}
+	query, args, err := sq.Select("log").From("deployment_logs").Where(sq.Eq{"deployment_id": deploymentID}).OrderBy("id").PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.SelectContext(ctx, &logs, query, args...); err != nil {
+		return "", err
+	}
+	return strings.Join(logs, "\n"), nil
+}
+
+func (s *StackService) CreateDeploymentStep(ctx context.Context, data *dto.DeploymentStep_Create_Request) (int64, error) {
+	query, args, err := sq.Insert("deployment_steps").Columns("deployment_id", "name", "status", "started_at").
+		Values(data.DeploymentID, data.Name, data.Status, data.StartedAt).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (s *StackService) UpdateDeploymentStep(ctx context.Context, data *dto.DeploymentStep_Update_Request) error {
+	builder := sq.Update("deployment_steps").Where(sq.Eq{"id": data.ID}).
+		Set("status", data.Status).
+		Set("finished_at", data.FinishedAt).
+		Set("duration_ms", data.DurationMs).
+		Set("log", data.Log)
+	if data.ExitCode != nil {
+		builder = builder.Set("exit_code", *data.ExitCode)
+	}
+	query, args, err := builder.PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// GetDeploymentSteps returns the steps of a deployment in the order they ran
+func (s *StackService) GetDeploymentSteps(ctx context.Context, deploymentID int64) ([]models.DeploymentStep, error) {
+	steps := []models.DeploymentStep{}
+	query, args, err := sq.Select("*").From("deployment_steps").Where(sq.Eq{"deployment_id": deploymentID}).OrderBy("id").PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &steps, query, args...); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+func (s *StackService) CreateNginxConfig(ctx context.Context, data *dto.Nginx_Create_Request) (id int64, err error) {
+	defer func() {
+		s.audit.Track(ctx, "domain.add", data.StackID, fmt.Sprintf("%s to port %d", data.Domain, data.Port), err)
+	}()
+
+	cols := []string{"stack_id", "domain", "port", "ssl_enabled", "headers", "custom_conf"}
+	values := []any{data.StackID, data.Domain, data.Port, data.SSLEnabled, data.Headers, data.CustomConf}
+
+	query, args, err := sq.Insert("nginx_configs").Columns(cols...).Values(values...).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+func (s *StackService) GetNginxConfigsByStackID(ctx context.Context, stackID int64) ([]models.NginxConfig, error) {
+	var configs []models.NginxConfig
+
+	query, args, err := sq.Select("*").From("nginx_configs").Where(sq.Eq{"stack_id": stackID}).OrderBy("id").PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &configs, query, args...); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+func (s *StackService) GetNginxConfigList(ctx context.Context) ([]models.NginxConfig, error) {
+	var configs []models.NginxConfig
+
+	query, args, err := sq.Select("*").From("nginx_configs").OrderBy("stack_id", "id").PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &configs, query, args...); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+func (s *StackService) GetNginxConfigByDomain(ctx context.Context, domain string) (*models.NginxConfig, error) {
+	var config models.NginxConfig
+
+	query, args, err := sq.Select("*").From("nginx_configs").Where(sq.Eq{"domain": domain}).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.GetContext(ctx, &config, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (s *StackService) DeleteNginxConfig(ctx context.Context, id int64) (err error) {
+	defer func() { s.audit.Track(ctx, "domain.remove", 0, fmt.Sprintf("nginx config #%d", id), err) }()
+
+	query, args, err := sq.Delete("nginx_configs").Where(sq.Eq{"id": id}).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *StackService) UpdateNginxConfig(ctx context.Context, data *dto.Nginx_Update_Request) (err error) {
+	defer func() { s.audit.Track(ctx, "domain.update", 0, fmt.Sprintf("nginx config #%d", data.ID), err) }()
+
+	if data == nil || data.ID == 0 {
+		return errors.New("nginx config id is required")
+	}
+
+	builder := sq.Update("nginx_configs").Where(sq.Eq{"id": data.ID})
+	if data.SSLEnabled != nil {
+		builder = builder.Set("ssl_enabled", *data.SSLEnabled)
+	}
+
+	query, args, err := builder.PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpsertCertificate creates or replaces the certificate record of a domain
+func (s *StackService) UpsertCertificate(ctx context.Context, data *dto.Certificate_Upsert_Request) (err error) {
+	defer func() {
+		s.audit.Track(ctx, "ssl.issue", 0, fmt.Sprintf("%s by %s until %s", data.Domain, data.Issuer, data.ExpiresAt), err)
+	}()
+
+	query, args, err := sq.Insert("certificates").
+		Columns("domain", "issuer", "cert_path", "key_path", "not_before", "expires_at", "last_error").
+		Values(data.Domain, data.Issuer, data.CertPath, data.KeyPath, data.NotBefore, data.ExpiresAt, data.LastError).
+		Suffix(`ON CONFLICT(domain) DO UPDATE SET issuer = excluded.issuer, cert_path = excluded.cert_path, key_path = excluded.key_path,
+			not_before = excluded.not_before, expires_at = excluded.expires_at, last_error = excluded.last_error, issued_at = CURRENT_TIMESTAMP`).
+		PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetCertificateError records the last renewal error of a domain without touching the certificate data
+func (s *StackService) SetCertificateError(ctx context.Context, domain string, lastError string) error {
+	s.audit.Track(ctx, "ssl.issue", 0, domain, errors.New(lastError))
+
+	query, args, err := sq.Update("certificates").Set("last_error", lastError).Where(sq.Eq{"domain": domain}).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *StackService) GetCertificateByDomain(ctx context.Context, domain string) (*models.Certificate, error) {
+	var cert models.Certificate
+
+	query, args, err := sq.Select("*").From("certificates").Where(sq.Eq{"domain": domain}).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.GetContext(ctx, &cert, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &cert, nil
+}
+
+func (s *StackService) GetCertificateList(ctx context.Context) ([]models.Certificate, error) {
+	var certs []models.Certificate
+
+	query, args, err := sq.Select("*").From("certificates").OrderBy("expires_at").PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &certs, query, args...); err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// UpsertDNSRecord creates or replaces the dns record of a domain
+func (s *StackService) UpsertDNSRecord(ctx context.Context, data *dto.DNSRecord_Upsert_Request) (err error) {
+	defer func() {
+		s.audit.Track(ctx, "dns.set", 0, fmt.Sprintf("%s %s %s at %s", data.Type, data.Domain, data.Content, data.Provider), err)
+	}()
+
+	query, args, err := sq.Insert("dns_records").
+		Columns("domain", "provider", "zone_id", "record_id", "type", "content", "ttl", "proxied").
+		Values(data.Domain, data.Provider, data.ZoneID, data.RecordID, data.Type, data.Content, data.TTL, data.Proxied).
+		Suffix(`ON CONFLICT(domain) DO UPDATE SET provider = excluded.provider, zone_id = excluded.zone_id, record_id = excluded.record_id,
+			type = excluded.type, content = excluded.content, ttl = excluded.ttl, proxied = excluded.proxied, synced_at = CURRENT_TIMESTAMP`).
+		PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *StackService) GetDNSRecordByDomain(ctx context.Context, domain string) (*models.DNSRecord, error) {
+	var record models.DNSRecord
+
+	query, args, err := sq.Select("*").From("dns_records").Where(sq.Eq{"domain": domain}).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.GetContext(ctx, &record, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (s *StackService) GetDNSRecordList(ctx context.Context) ([]models.DNSRecord, error) {
+	var records []models.DNSRecord
+
+	query, args, err := sq.Select("*").From("dns_records").OrderBy("domain").PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &records, query, args...); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s *StackService) DeleteDNSRecord(ctx context.Context, domain string) (err error) {
+	defer func() { s.audit.Track(ctx, "dns.delete", 0, domain, err) }()
+
+	query, args, err := sq.Delete("dns_records").Where(sq.Eq{"domain": domain}).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteStack deletes a stack with all of its records
+func (s *StackService) DeleteStack(ctx context.Context, id int64) (err error) {
+	defer func() { s.audit.Track(ctx, "stack.delete", id, fmt.Sprintf("stack #%d", id), err) }()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// foreign keys are not enforced by every sqlite driver, delete children explicitly
+	deploymentIDs := sq.Select("id").From("deployments").Where(sq.Eq{"stack_id": id})
+	builders := []sq.DeleteBuilder{
+		sq.Delete("deployment_logs").Where(sq.Expr("deployment_id IN (?)", deploymentIDs)),
+		sq.Delete("deployment_steps").Where(sq.Expr("deployment_id IN (?)", deploymentIDs)),
+		sq.Delete("deployments").Where(sq.Eq{"stack_id": id}),
+		sq.Delete("pm2_configs").Where(sq.Eq{"stack_id": id}),
+		sq.Delete("nginx_configs").Where(sq.Eq{"stack_id": id}),
+		sq.Delete("stack_members").Where(sq.Eq{"stack_id": id}),
+		sq.Delete("stacks").Where(sq.Eq{"id": id}),
+	}
+	for _, builder := range builders {
+		query, args, err := builder.PlaceholderFormat(sq.Question).ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
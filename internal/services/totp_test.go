@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+)
+
+// totpAt returns the code of a base32 secret at a time, like an authenticator app
+func totpAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+// enableTOTP turns on two-factor authentication of a user with a code of the previous step,
+// so that the current and next step are still unused. It returns the secret and recovery codes.
+func enableTOTP(t *testing.T, service *UserService, user *models.User) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	secret, err := service.SetupTOTP(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err = service.GetUserByID(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	codes, err := service.EnableTOTP(ctx, user, totpAt(t, secret, time.Now().Add(-30*time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret, codes
+}
+
+func TestVerifyTOTPCodeRejectsReplays(t *testing.T) {
+	ctx := context.Background()
+	service := NewUserService(testDB)
+	user := newUser(t, service, models.RoleViewer)
+	secret, _ := enableTOTP(t, service, user)
+	now := time.Now()
+
+	// a fresh copy of the user for every attempt, as logins load it
+	verify := func(code string) error {
+		fresh, err := service.GetUserByID(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return service.VerifyTOTPCode(ctx, fresh, code)
+	}
+	if err := verify(totpAt(t, secret, now)); err != nil {
+		t.Fatalf("current code: %v", err)
+	}
+	if err := verify(totpAt(t, secret, now)); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Fatalf("replayed code = %v, want %v", err, ErrInvalidTOTPCode)
+	}
+	// the code of enableTOTP is still within the skew, but older than the last accepted one
+	if err := verify(totpAt(t, secret, now.Add(-30*time.Second))); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Fatalf("code of an earlier step = %v, want %v", err, ErrInvalidTOTPCode)
+	}
+	if err := verify(totpAt(t, secret, now.Add(30*time.Second))); err != nil {
+		t.Fatalf("code of the next step: %v", err)
+	}
+
+	stored, err := service.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := now.Add(30*time.Second).Unix() / 30; stored.TOTPLastStep != want {
+		t.Fatalf("totp_last_step = %d, want %d", stored.TOTPLastStep, want)
+	}
+}
+
+func TestUseRecoveryCodeOnce(t *testing.T) {
+	ctx := context.Background()
+	service := NewUserService(testDB)
+	user := newUser(t, service, models.RoleViewer)
+	_, codes := enableTOTP(t, service, user)
+	if len(codes) != 10 {
+		t.Fatalf("got %d recovery codes, want 10", len(codes))
+	}
+
+	if err := service.UseRecoveryCode(ctx, user.ID, codes[0]); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := service.UseRecoveryCode(ctx, user.ID, codes[0]); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Fatalf("second use = %v, want %v", err, ErrInvalidTOTPCode)
+	}
+	// typed without dashes and in upper case
+	if err := service.UseRecoveryCode(ctx, user.ID, strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))); err != nil {
+		t.Fatalf("reformatted code: %v", err)
+	}
+	if err := service.UseRecoveryCode(ctx, user.ID, "0000-0000-0000-0000"); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Fatalf("unknown code = %v, want %v", err, ErrInvalidTOTPCode)
+	}
+
+	// codes of a user don't work for another
+	other := newUser(t, service, models.RoleViewer)
+	if err := service.UseRecoveryCode(ctx, other.ID, codes[2]); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Fatalf("code of another user = %v, want %v", err, ErrInvalidTOTPCode)
+	}
+	if left, err := service.CountRecoveryCodes(ctx, user.ID); err != nil || left != 8 {
+		t.Fatalf("codes left = %d %v, want 8", left, err)
+	}
+
+	// regenerating replaces the unused codes
+	if _, err := service.RegenerateRecoveryCodes(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.UseRecoveryCode(ctx, user.ID, codes[3]); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Fatalf("code from before regenerating = %v, want %v", err, ErrInvalidTOTPCode)
+	}
+}
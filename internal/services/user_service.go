@@ -4,35 +4,111 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/satnamSandhu2001/stackjet/internal/core/oidc"
 	"github.com/satnamSandhu2001/stackjet/internal/dto"
 	"github.com/satnamSandhu2001/stackjet/internal/models"
 	"github.com/satnamSandhu2001/stackjet/pkg"
 
+	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
 )
 
+var (
+	ErrInvalidInvitation = errors.New("invitation is invalid or expired")
+	ErrUserDisabled      = errors.New("account is disabled")
+	ErrInvalidPassword   = errors.New("invalid password")
+	ErrLastAdmin         = errors.New("at least one enabled admin is required")
+	ErrSamePassword      = errors.New("new password must be different from the current one")
+	ErrInvalidSession    = errors.New("session is invalid or expired")
+	ErrInvalidTOTPCode   = errors.New("invalid two-factor code")
+	ErrTOTPEnabled       = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotSetUp      = errors.New("two-factor authentication is not set up")
+	ErrUserLocked        = errors.New("account is temporarily locked after too many failed logins")
+	ErrOIDCUserUnknown   = errors.New("no StackJet account is allowed for this identity, ask an admin for access")
+	ErrOIDCAdminLink     = errors.New("admin accounts are not linked to OIDC on login, link it with stackjet user link-oidc")
+	ErrInvalidAuditTime  = errors.New("time must be RFC3339 or a date like 2006-01-02")
+)
+
+// knownDefaultPasswords were created by older versions for the first admin
+var knownDefaultPasswords = []string{"admin123"}
+
 type UserService struct {
-	db *sqlx.DB
+	db    *sqlx.DB
+	audit *AuditService
 }
 
 func NewUserService(db *sqlx.DB) *UserService {
 	return &UserService{
-		db: db,
+		db:    db,
+		audit: NewAuditService(db),
 	}
 }
 
-func (s *UserService) CreateUser(ctx context.Context, u *dto.User_RegisterRequest) error {
+func (s *UserService) CreateUser(ctx context.Context, u *dto.User_RegisterRequest) (err error) {
+	defer func() { s.audit.Track(ctx, "user.create", 0, fmt.Sprintf("%s as %s", u.Email, u.Role), err) }()
+
+	return s.insertUser(ctx, s.db, u)
+}
+
+// CreateUserWithInvitation creates a user with the role of an invitation and marks the invitation used
+func (s *UserService) CreateUserWithInvitation(ctx context.Context, u *dto.User_RegisterRequest, token string) (err error) {
+	defer func() {
+		s.audit.Track(ctx, "user.create", 0, fmt.Sprintf("%s as %s from an invitation", u.Email, u.Role), err)
+	}()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var invitation models.UserInvitation
+	err = tx.GetContext(ctx, &invitation, "SELECT * FROM user_invitations WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?",
+		pkg.HashToken(token), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidInvitation
+		}
+		return err
+	}
+	if invitation.Email != "" && !strings.EqualFold(invitation.Email, u.Email) {
+		return ErrInvalidInvitation
+	}
+
+	u.Role = string(invitation.Role)
+	if err := s.insertUser(ctx, tx, u); err != nil {
+		return err
+	}
+	// a concurrent signup may have used the invitation since it was read
+	res, err := tx.ExecContext(ctx, "UPDATE user_invitations SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL", invitation.ID)
+	if err != nil {
+		return err
+	}
+	if used, err := res.RowsAffected(); err != nil || used == 0 {
+		if err == nil {
+			err = ErrInvalidInvitation
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *UserService) insertUser(ctx context.Context, db sqlx.ExtContext, u *dto.User_RegisterRequest) error {
 	hash, err := pkg.GenerateHash(u.Password)
 	if err != nil {
 		return err
 	}
 	u.Password = hash
+	// new accounts only see the stacks they are made members of until they are given a role
 	if u.Role == "" {
-		u.Role = "superadmin"
+		u.Role = string(models.RoleMember)
 	}
 	query := `INSERT INTO users (email, password, role) VALUES (?, ?, ?)`
-	res, err := s.db.ExecContext(ctx, query, u.Email, u.Password, u.Role)
+	res, err := db.ExecContext(ctx, query, u.Email, u.Password, u.Role)
 	if err != nil {
 		return err
 	}
@@ -83,16 +159,821 @@ func (s *UserService) Authenticate(ctx context.Context, email string, password s
 	err := s.db.GetContext(ctx, &u, "SELECT * FROM users WHERE email = ?", email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
+			s.trackLoginFailure(ctx, email, 0, "unknown user")
 			return nil, nil
 		}
 		return nil, errors.New("user not found")
 	}
 
+	// the password of a locked account is not checked, guessing it is pointless until the lock ends
+	if u.IsLocked(time.Now()) {
+		s.audit.Record(ctx, &dto.AuditEvent_Create_Request{
+			Action: "auth.login", Actor: u.Email, Summary: "account is locked", Result: models.AUDIT_RESULT_BLOCKED,
+		})
+		return nil, ErrUserLocked
+	}
 	err = pkg.CompareHashAndPassword(u.Password, password)
 	if err != nil {
-		return nil, errors.New("invalid password")
+		s.trackLoginFailure(ctx, u.Email, u.ID, "invalid password")
+		if err := s.RecordFailedLogin(ctx, &u); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidPassword
+	}
+	if u.Disabled {
+		s.trackLoginFailure(ctx, u.Email, u.ID, "account is disabled")
+		return nil, ErrUserDisabled
 	}
 
 	u.Password = ""
 	return &u, nil
 }
+
+// trackLoginFailure records a failed login, before the user is authenticated and known to the context
+func (s *UserService) trackLoginFailure(ctx context.Context, email string, userID int64, reason string) {
+	s.audit.Record(ctx, &dto.AuditEvent_Create_Request{
+		Action: "auth.login", Actor: email, ActorID: userID, Summary: reason, Result: models.AUDIT_RESULT_FAILURE,
+	})
+}
+
+// AuthenticateOIDC returns the user of an identity proven by the OIDC provider. Users are found by their subject,
+// or by their verified email on their first OIDC login. Unknown identities get an account with provisionRole,
+// or ErrOIDCUserUnknown when it is empty. role, mapped from the groups of the identity, replaces the role of the user unless empty.
+func (s *UserService) AuthenticateOIDC(ctx context.Context, identity *oidc.Identity, role models.Role, provisionRole models.Role) (*models.User, error) {
+	var user models.User
+	err := s.db.GetContext(ctx, &user, "SELECT * FROM users WHERE oidc_subject = ?", identity.Subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = s.linkOIDCUser(ctx, &user, identity, provisionRole)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	if role != "" && role != user.Role {
+		newRole := string(role)
+		err := s.UpdateUser(ctx, &dto.User_Update_Request{ID: user.ID, Role: &newRole})
+		// the groups of the last admin may be out of date, it keeps its role
+		if err != nil && !errors.Is(err, ErrLastAdmin) {
+			return nil, err
+		}
+		if err == nil {
+			user.Role = role
+		}
+	}
+	user.Password = ""
+	return &user, nil
+}
+
+// linkOIDCUser sets the subject of an identity on the user with its verified email, created with provisionRole if needed.
+// Admins are only linked by LinkOIDCSubject.
+func (s *UserService) linkOIDCUser(ctx context.Context, user *models.User, identity *oidc.Identity, provisionRole models.Role) error {
+	// unverified emails could claim the account of someone else
+	if identity.Email == "" || !identity.EmailVerified {
+		return ErrOIDCUserUnknown
+	}
+	existing, err := s.GetUserByEmail(ctx, identity.Email)
+	if err != nil {
+		return err
+	}
+	// a provider that lets users set their email would hand out the admin account with it
+	if existing != nil && existing.Role.Includes(models.RoleAdmin) {
+		s.audit.Record(ctx, &dto.AuditEvent_Create_Request{
+			Action: "user.oidc.link", Actor: existing.Email, ActorID: existing.ID, Result: models.AUDIT_RESULT_BLOCKED,
+			Summary: fmt.Sprintf("admin %s is not linked to subject %s on login", existing.Email, identity.Subject),
+		})
+		return ErrOIDCAdminLink
+	}
+	if existing == nil {
+		if provisionRole == "" {
+			return ErrOIDCUserUnknown
+		}
+		// nobody knows the random password, an admin can set one
+		password, err := pkg.GenerateRandomToken(32)
+		if err != nil {
+			return err
+		}
+		newUser := dto.User_RegisterRequest{Email: identity.Email, Password: password, Role: string(provisionRole)}
+		err = s.insertUser(ctx, s.db, &newUser)
+		s.audit.Track(ctx, "user.create", 0, fmt.Sprintf("%s as %s through OIDC", newUser.Email, newUser.Role), err)
+		if err != nil {
+			return err
+		}
+		if existing, err = s.GetUserByID(ctx, newUser.ID); err != nil || existing == nil {
+			return errors.Join(errors.New("failed to create user"), err)
+		}
+	}
+	if existing.OIDCSubject != nil {
+		// the account belongs to another identity of the provider
+		return ErrOIDCUserUnknown
+	}
+
+	_, err = s.db.ExecContext(ctx, "UPDATE users SET oidc_subject = ? WHERE id = ?", identity.Subject, existing.ID)
+	s.audit.Track(ctx, "user.oidc.link", 0, fmt.Sprintf("%s to subject %s", existing.Email, identity.Subject), err)
+	if err != nil {
+		return err
+	}
+	existing.OIDCSubject = &identity.Subject
+	*user = *existing
+	return nil
+}
+
+// LinkOIDCSubject links a user to the subject of its identity at the OIDC provider,
+// the explicit step for admins which are not linked on login
+func (s *UserService) LinkOIDCSubject(ctx context.Context, id int64, subject string) (err error) {
+	defer func() {
+		s.audit.Track(ctx, "user.oidc.link", 0, fmt.Sprintf("user #%d to subject %s", id, subject), err)
+	}()
+
+	_, err = s.db.ExecContext(ctx, "UPDATE users SET oidc_subject = ? WHERE id = ?", subject, id)
+	return err
+}
+
+// RecordFailedLogin counts a failed password or two-factor code of a user,
+// and locks the account for LOGIN_LOCKOUT_MINUTES once LOGIN_LOCKOUT_ATTEMPTS are reached
+func (s *UserService) RecordFailedLogin(ctx context.Context, user *models.User) error {
+	config := pkg.Config()
+	if config.LOGIN_LOCKOUT_ATTEMPTS < 0 {
+		return nil
+	}
+	if _, err := s.db.ExecContext(ctx, "UPDATE users SET failed_logins = failed_logins + 1 WHERE id = ?", user.ID); err != nil {
+		return err
+	}
+
+	lockedUntil := time.Now().UTC().Add(time.Duration(config.LOGIN_LOCKOUT_MINUTES) * time.Minute).Format(time.RFC3339)
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET failed_logins = 0, locked_until = ? WHERE id = ? AND failed_logins >= ?",
+		lockedUntil, user.ID, config.LOGIN_LOCKOUT_ATTEMPTS)
+	if err != nil {
+		return err
+	}
+	if rows, err := res.RowsAffected(); err != nil || rows == 0 {
+		return err
+	}
+	user.LockedUntil = &lockedUntil
+	s.audit.Record(ctx, &dto.AuditEvent_Create_Request{
+		Action:  "auth.lockout",
+		Actor:   user.Email,
+		Summary: fmt.Sprintf("locked until %s after %d failed logins", lockedUntil, config.LOGIN_LOCKOUT_ATTEMPTS),
+		Result:  models.AUDIT_RESULT_BLOCKED,
+	})
+	return nil
+}
+
+// ResetFailedLogins clears the failed logins of a user after a successful login
+func (s *UserService) ResetFailedLogins(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET failed_logins = 0 WHERE id = ?", id)
+	return err
+}
+
+// UnlockUser ends the lock of an account and clears its failed logins
+func (s *UserService) UnlockUser(ctx context.Context, id int64) (err error) {
+	defer func() { s.audit.Track(ctx, "user.unlock", 0, fmt.Sprintf("user #%d", id), err) }()
+
+	_, err = s.db.ExecContext(ctx, "UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = ?", id)
+	return err
+}
+
+// UpdateUser changes the email and role of a user, the fields left nil are kept
+func (s *UserService) UpdateUser(ctx context.Context, data *dto.User_Update_Request) (err error) {
+	defer func() { s.audit.Track(ctx, "user.update", 0, userUpdateSummary(data), err) }()
+
+	builder := sq.Update("users").Where(sq.Eq{"id": data.ID})
+	if data.Email != nil {
+		builder = builder.Set("email", *data.Email)
+	}
+	if data.Role != nil {
+		if !models.Role(*data.Role).Includes(models.RoleAdmin) {
+			if err := s.ensureOtherAdmin(ctx, data.ID); err != nil {
+				return err
+			}
+		}
+		builder = builder.Set("role", *data.Role)
+	}
+	if data.Email == nil && data.Role == nil {
+		return nil
+	}
+
+	query, args, err := builder.PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// userUpdateSummary describes the changes of an update
+func userUpdateSummary(data *dto.User_Update_Request) string {
+	summary := fmt.Sprintf("user #%d", data.ID)
+	if data.Email != nil {
+		summary += ", email to " + *data.Email
+	}
+	if data.Role != nil {
+		summary += ", role to " + *data.Role
+	}
+	return summary
+}
+
+// DeleteUser deletes a user with its stack memberships
+func (s *UserService) DeleteUser(ctx context.Context, id int64) (err error) {
+	defer func() { s.audit.Track(ctx, "user.delete", 0, fmt.Sprintf("user #%d", id), err) }()
+
+	if err := s.ensureOtherAdmin(ctx, id); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// foreign keys are not enforced by every sqlite driver, update children explicitly
+	builders := []sq.Sqlizer{
+		sq.Delete("stack_members").Where(sq.Eq{"user_id": id}),
+		sq.Delete("api_tokens").Where(sq.Eq{"user_id": id}),
+		sq.Delete("rotated_refresh_tokens").Where(sq.Expr("session_id IN (SELECT id FROM sessions WHERE user_id = ?)", id)),
+		sq.Delete("sessions").Where(sq.Eq{"user_id": id}),
+		sq.Delete("user_recovery_codes").Where(sq.Eq{"user_id": id}),
+		sq.Update("user_invitations").Set("created_by", nil).Where(sq.Eq{"created_by": id}),
+		sq.Delete("users").Where(sq.Eq{"id": id}),
+	}
+	for _, builder := range builders {
+		query, args, err := builder.ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetPassword replaces the password of a user. With mustChange it has to be changed on the next login.
+func (s *UserService) SetPassword(ctx context.Context, id int64, password string, mustChange bool) (err error) {
+	defer func() {
+		s.audit.Track(ctx, "user.password", 0, fmt.Sprintf("user #%d, must change: %t", id, mustChange), err)
+	}()
+
+	hash, err := pkg.GenerateHash(password)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, "UPDATE users SET password = ?, must_change_password = ? WHERE id = ?", hash, mustChange, id)
+	return err
+}
+
+// ChangePassword replaces the password of a user after checking the current one
+func (s *UserService) ChangePassword(ctx context.Context, id int64, currentPassword string, newPassword string) error {
+	var hash string
+	if err := s.db.GetContext(ctx, &hash, "SELECT password FROM users WHERE id = ?", id); err != nil {
+		return err
+	}
+	if err := pkg.CompareHashAndPassword(hash, currentPassword); err != nil {
+		return ErrInvalidPassword
+	}
+	if newPassword == currentPassword {
+		return ErrSamePassword
+	}
+	return s.SetPassword(ctx, id, newPassword, false)
+}
+
+// SetDisabled disables or enables the account of a user, disabled users can not log in
+func (s *UserService) SetDisabled(ctx context.Context, id int64, disabled bool) (err error) {
+	action := "user.enable"
+	if disabled {
+		action = "user.disable"
+	}
+	defer func() { s.audit.Track(ctx, action, 0, fmt.Sprintf("user #%d", id), err) }()
+
+	if disabled {
+		if err := s.ensureOtherAdmin(ctx, id); err != nil {
+			return err
+		}
+	}
+	_, err = s.db.ExecContext(ctx, "UPDATE users SET disabled = ? WHERE id = ?", disabled, id)
+	return err
+}
+
+// ensureOtherAdmin returns ErrLastAdmin if the user is the only enabled admin
+func (s *UserService) ensureOtherAdmin(ctx context.Context, id int64) error {
+	query, args, err := sq.Select("COUNT(*)").From("users").
+		Where(sq.Eq{"role": []models.Role{models.RoleAdmin, models.RoleSuperAdmin}, "disabled": false}).Where(sq.NotEq{"id": id}).
+		PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return err
+	}
+	var admins int
+	if err := s.db.GetContext(ctx, &admins, query, args...); err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if user != nil && !user.Disabled && user.Role.Includes(models.RoleAdmin) {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// CreateInvitation stores a new invitation and returns its token, which is only available here
+func (s *UserService) CreateInvitation(ctx context.Context, data *dto.UserInvitation_Create_Request) (int64, string, error) {
+	token, err := pkg.GenerateRandomToken(24)
+	if err != nil {
+		return 0, "", err
+	}
+	hours := data.ExpiresInHours
+	if hours == 0 {
+		hours = 72
+	}
+	expiresAt := time.Now().UTC().Add(time.Duration(hours) * time.Hour).Format(time.RFC3339)
+
+	var createdBy any
+	if data.CreatedBy != 0 {
+		createdBy = data.CreatedBy
+	}
+	query, args, err := sq.Insert("user_invitations").Columns("token_hash", "email", "role", "created_by", "expires_at").
+		Values(pkg.HashToken(token), data.Email, data.Role, createdBy, expiresAt).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return 0, "", err
+	}
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, "", err
+	}
+	invitee := data.Email
+	if invitee == "" {
+		invitee = "anyone"
+	}
+	s.audit.Track(ctx, "invitation.create", 0, fmt.Sprintf("invitation #%d as %s for %s", id, data.Role, invitee), nil)
+	return id, token, nil
+}
+
+// ListInvitations returns the invitations that were not used and have not expired
+func (s *UserService) ListInvitations(ctx context.Context) ([]models.UserInvitation, error) {
+	invitations := []models.UserInvitation{}
+	err := s.db.SelectContext(ctx, &invitations, "SELECT * FROM user_invitations WHERE used_at IS NULL AND expires_at > ? ORDER BY id",
+		time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (s *UserService) DeleteInvitation(ctx context.Context, id int64) (err error) {
+	defer func() { s.audit.Track(ctx, "invitation.delete", 0, fmt.Sprintf("invitation #%d", id), err) }()
+
+	_, err = s.db.ExecContext(ctx, "DELETE FROM user_invitations WHERE id = ?", id)
+	return err
+}
+
+// FindDefaultCredentials returns the users whose password is a known default password
+func (s *UserService) FindDefaultCredentials(ctx context.Context) ([]models.User, error) {
+	users, err := s.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var found []models.User
+	for _, user := range users {
+		for _, password := range knownDefaultPasswords {
+			if pkg.CompareHashAndPassword(user.Password, password) == nil {
+				found = append(found, user)
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+// CreateAPIToken stores a new API token of a user and returns it, the token is only available here
+func (s *UserService) CreateAPIToken(ctx context.Context, data *dto.APIToken_Create_Request) (int64, string, error) {
+	if err := models.TokenScopes(data.Scopes).Validate(); err != nil {
+		return 0, "", err
+	}
+	random, err := pkg.GenerateRandomToken(24)
+	if err != nil {
+		return 0, "", err
+	}
+	token := models.APITokenPrefix + random
+
+	var expiresAt any
+	if data.ExpiresInDays > 0 {
+		expiresAt = time.Now().UTC().AddDate(0, 0, data.ExpiresInDays).Format(time.RFC3339)
+	}
+	query, args, err := sq.Insert("api_tokens").Columns("user_id", "name", "token_hash", "prefix", "scopes", "expires_at").
+		Values(data.UserID, data.Name, pkg.HashToken(token), token[:len(models.APITokenPrefix)+8], models.TokenScopes(data.Scopes), expiresAt).
+		PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return 0, "", err
+	}
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, "", err
+	}
+	s.audit.Track(ctx, "token.create", 0, fmt.Sprintf("token #%d %s of user #%d with scopes %s", id, data.Name, data.UserID, strings.Join(data.Scopes, " ")), nil)
+	return id, token, nil
+}
+
+// ListAPITokens returns the API tokens of a user, of all users when userID is 0
+func (s *UserService) ListAPITokens(ctx context.Context, userID int64) ([]models.APIToken, error) {
+	tokens := []models.APIToken{}
+
+	builder := sq.Select("*").From("api_tokens").OrderBy("id")
+	if userID != 0 {
+		builder = builder.Where(sq.Eq{"user_id": userID})
+	}
+	query, args, err := builder.PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &tokens, query, args...); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (s *UserService) GetAPITokenByID(ctx context.Context, id int64) (*models.APIToken, error) {
+	var token models.APIToken
+	err := s.db.GetContext(ctx, &token, "SELECT * FROM api_tokens WHERE id = ?", id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// DeleteAPIToken revokes an API token
+func (s *UserService) DeleteAPIToken(ctx context.Context, id int64) (err error) {
+	defer func() { s.audit.Track(ctx, "token.revoke", 0, fmt.Sprintf("token #%d", id), err) }()
+
+	_, err = s.db.ExecContext(ctx, "DELETE FROM api_tokens WHERE id = ?", id)
+	return err
+}
+
+// AuthenticateAPIToken returns the enabled user and the token of a valid API token, nil if it is invalid or expired.
+// The last used time of the token is updated.
+func (s *UserService) AuthenticateAPIToken(ctx context.Context, token string) (*models.User, *models.APIToken, error) {
+	var apiToken models.APIToken
+	now := time.Now().UTC().Format(time.RFC3339)
+	err := s.db.GetContext(ctx, &apiToken, "SELECT * FROM api_tokens WHERE token_hash = ? AND (expires_at IS NULL OR expires_at > ?)",
+		pkg.HashToken(token), now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	user, err := s.GetUserByID(ctx, apiToken.UserID)
+	if err != nil || user == nil || user.Disabled {
+		return nil, nil, err
+	}
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE api_tokens SET last_used_at = ? WHERE id = ?", now, apiToken.ID); err != nil {
+		return nil, nil, err
+	}
+	apiToken.LastUsedAt = &now
+	return user, &apiToken, nil
+}
+
+// CreateSession starts a session of a user and returns it with its refresh token, which is only available here
+func (s *UserService) CreateSession(ctx context.Context, userID int64, authMethod string, userAgent string, ip string) (*models.Session, string, error) {
+	refreshToken, err := pkg.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	expiresAt := time.Now().UTC().Add(pkg.Config().RefreshTokenTTL()).Format(time.RFC3339)
+
+	query, args, err := sq.Insert("sessions").Columns("user_id", "refresh_hash", "auth_method", "user_agent", "ip", "expires_at").
+		Values(userID, pkg.HashToken(refreshToken), authMethod, userAgent, ip, expiresAt).PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, "", err
+	}
+	session, err := s.GetActiveSession(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	var email string
+	s.db.GetContext(ctx, &email, "SELECT email FROM users WHERE id = ?", userID)
+	s.audit.Record(ctx, &dto.AuditEvent_Create_Request{
+		Action: "auth.login", Actor: email, ActorID: userID, Summary: fmt.Sprintf("session #%d with %s", id, authMethod), Result: models.AUDIT_RESULT_SUCCESS,
+	})
+	return session, refreshToken, nil
+}
+
+// RefreshSession replaces the refresh token of an active session, the old token can not be used again.
+// An old token presented again was stolen or replayed, the session is revoked so that neither
+// its holder nor the thief can keep using it.
+func (s *UserService) RefreshSession(ctx context.Context, refreshToken string) (*models.Session, string, error) {
+	newToken, err := pkg.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE sessions SET refresh_hash = ?, last_used_at = CURRENT_TIMESTAMP
+		WHERE refresh_hash = ? AND revoked_at IS NULL AND expires_at > ?`,
+		pkg.HashToken(newToken), pkg.HashToken(refreshToken), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, "", err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return nil, "", err
+	}
+	if rows == 0 {
+		tx.Rollback()
+		if err := s.revokeReusedSession(ctx, refreshToken); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrInvalidSession
+	}
+
+	var session models.Session
+	if err := tx.GetContext(ctx, &session, "SELECT * FROM sessions WHERE refresh_hash = ?", pkg.HashToken(newToken)); err != nil {
+		return nil, "", err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO rotated_refresh_tokens (refresh_hash, session_id) VALUES (?, ?)",
+		pkg.HashToken(refreshToken), session.ID); err != nil {
+		return nil, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, "", err
+	}
+	return &session, newToken, nil
+}
+
+// revokeReusedSession revokes the session a refresh token was rotated away from, if it was
+func (s *UserService) revokeReusedSession(ctx context.Context, refreshToken string) error {
+	var owner struct {
+		SessionID int64  `db:"session_id"`
+		UserID    int64  `db:"user_id"`
+		Email     string `db:"email"`
+	}
+	err := s.db.GetContext(ctx, &owner, `SELECT r.session_id, s.user_id, u.email FROM rotated_refresh_tokens r
+		JOIN sessions s ON s.id = r.session_id JOIN users u ON u.id = s.user_id WHERE r.refresh_hash = ?`, pkg.HashToken(refreshToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, "UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL", owner.SessionID)
+	if err != nil {
+		return err
+	}
+	// a session revoked before needs no second event
+	if revoked, err := res.RowsAffected(); err != nil || revoked == 0 {
+		return err
+	}
+	s.audit.Record(ctx, &dto.AuditEvent_Create_Request{
+		Action: "auth.refresh_reuse", Actor: owner.Email, ActorID: owner.UserID,
+		Summary: fmt.Sprintf("session #%d revoked, a rotated refresh token was used again", owner.SessionID), Result: models.AUDIT_RESULT_BLOCKED,
+	})
+	return nil
+}
+
+// GetActiveSession returns a session that was not revoked and has not expired, nil otherwise
+func (s *UserService) GetActiveSession(ctx context.Context, id int64) (*models.Session, error) {
+	var session models.Session
+	err := s.db.GetContext(ctx, &session, "SELECT * FROM sessions WHERE id = ? AND revoked_at IS NULL AND expires_at > ?",
+		id, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListSessions returns the active sessions of a user, of all users when userID is 0
+func (s *UserService) ListSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	sessions := []models.Session{}
+
+	builder := sq.Select("*").From("sessions").Where("revoked_at IS NULL").
+		Where(sq.Gt{"expires_at": time.Now().UTC().Format(time.RFC3339)}).OrderBy("id")
+	if userID != 0 {
+		builder = builder.Where(sq.Eq{"user_id": userID})
+	}
+	query, args, err := builder.PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &sessions, query, args...); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (s *UserService) RevokeSession(ctx context.Context, id int64) (err error) {
+	defer func() { s.audit.Track(ctx, "session.revoke", 0, fmt.Sprintf("session #%d", id), err) }()
+
+	_, err = s.db.ExecContext(ctx, "UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL", id)
+	return err
+}
+
+func (s *UserService) RevokeSessionByRefreshToken(ctx context.Context, refreshToken string) (err error) {
+	defer func() { s.audit.Track(ctx, "auth.logout", 0, "", err) }()
+
+	_, err = s.db.ExecContext(ctx, "UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE refresh_hash = ? AND revoked_at IS NULL",
+		pkg.HashToken(refreshToken))
+	return err
+}
+
+// RevokeUserSessions revokes the sessions of a user except the session keepID, returning how many were revoked
+func (s *UserService) RevokeUserSessions(ctx context.Context, userID int64, keepID int64) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND id != ? AND revoked_at IS NULL",
+		userID, keepID)
+	if err != nil {
+		return 0, err
+	}
+	revoked, err := res.RowsAffected()
+	s.audit.Track(ctx, "session.revoke", 0, fmt.Sprintf("%d sessions of user #%d", revoked, userID), err)
+	return revoked, err
+}
+
+// SetupTOTP stores a new TOTP secret for a user and returns it. It is used once EnableTOTP verified a code of it.
+func (s *UserService) SetupTOTP(ctx context.Context, user *models.User) (string, error) {
+	if user.TOTPEnabled {
+		return "", ErrTOTPEnabled
+	}
+	secret, err := pkg.GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := pkg.Encrypt(secret)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.db.ExecContext(ctx, "UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ?", encrypted, user.ID); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// EnableTOTP turns on two-factor authentication after checking a code of the secret from SetupTOTP,
+// and returns new recovery codes
+func (s *UserService) EnableTOTP(ctx context.Context, user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTOTPEnabled
+	}
+	if err := s.VerifyTOTPCode(ctx, user, code); err != nil {
+		return nil, err
+	}
+	if _, err := s.db.ExecContext(ctx, "UPDATE users SET totp_enabled = 1 WHERE id = ?", user.ID); err != nil {
+		return nil, err
+	}
+	s.audit.Track(ctx, "user.2fa.enable", 0, fmt.Sprintf("user #%d", user.ID), nil)
+	return s.RegenerateRecoveryCodes(ctx, user.ID)
+}
+
+// DisableTOTP turns off two-factor authentication and deletes the secret and recovery codes
+func (s *UserService) DisableTOTP(ctx context.Context, userID int64) (err error) {
+	defer func() { s.audit.Track(ctx, "user.2fa.disable", 0, fmt.Sprintf("user #%d", userID), err) }()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET totp_secret = '', totp_enabled = 0, totp_last_step = 0 WHERE id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// VerifyTOTPCode checks a code of the TOTP secret of a user. Each code is accepted once.
+func (s *UserService) VerifyTOTPCode(ctx context.Context, user *models.User, code string) error {
+	if user.TOTPSecret == "" {
+		return ErrTOTPNotSetUp
+	}
+	secret, err := pkg.Decrypt(user.TOTPSecret)
+	if err != nil {
+		return err
+	}
+	step, ok := pkg.VerifyTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+
+	// only move forward, a code seen before or an older code is a replay
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?", step, user.ID, step)
+	if err != nil {
+		return err
+	}
+	if rows, err := res.RowsAffected(); err != nil || rows == 0 {
+		if err == nil {
+			err = ErrInvalidTOTPCode
+		}
+		return err
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+// VerifySecondFactor checks a TOTP code, or a recovery code when code is empty
+func (s *UserService) VerifySecondFactor(ctx context.Context, user *models.User, code string, recoveryCode string) error {
+	var err error
+	if code != "" {
+		err = s.VerifyTOTPCode(ctx, user, code)
+	} else {
+		err = s.UseRecoveryCode(ctx, user.ID, recoveryCode)
+	}
+	if errors.Is(err, ErrInvalidTOTPCode) {
+		s.audit.Record(ctx, &dto.AuditEvent_Create_Request{
+			Action: "auth.2fa", Actor: user.Email, ActorID: user.ID, Summary: err.Error(), Result: models.AUDIT_RESULT_FAILURE,
+		})
+	}
+	return err
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user and returns them, only their hashes are stored
+func (s *UserService) RegenerateRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 10)
+	for i := range codes {
+		random, err := pkg.GenerateRandomToken(8)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = random[:4] + "-" + random[4:8] + "-" + random[8:12] + "-" + random[12:]
+		if _, err := tx.ExecContext(ctx, "INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)",
+			userID, hashRecoveryCode(codes[i])); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.audit.Track(ctx, "user.2fa.recovery-codes", 0, fmt.Sprintf("user #%d", userID), nil)
+	return codes, nil
+}
+
+// UseRecoveryCode marks a recovery code of a user as used, ErrInvalidTOTPCode if it is unknown or used
+func (s *UserService) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE user_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if rows, err := res.RowsAffected(); err != nil || rows == 0 {
+		if err == nil {
+			err = ErrInvalidTOTPCode
+		}
+		return err
+	}
+	return nil
+}
+
+// CountRecoveryCodes returns how many recovery codes of a user are left
+func (s *UserService) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := s.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID)
+	return count, err
+}
+
+// hashRecoveryCode hashes a recovery code ignoring case, spaces and dashes
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return pkg.HashToken(code)
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/satnamSandhu2001/stackjet/database"
+	"github.com/satnamSandhu2001/stackjet/internal/dto"
+	"github.com/satnamSandhu2001/stackjet/internal/models"
+	"github.com/satnamSandhu2001/stackjet/pkg"
+)
+
+// newEmptyDB returns a database of its own, for tests counting the users of the whole database
+func newEmptyDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	config := pkg.Config()
+	shared := config.DB_URL
+	config.DB_URL = filepath.Join(t.TempDir(), "stackjet.db")
+	defer func() { config.DB_URL = shared }()
+
+	if err := database.RunInitSQL(); err != nil {
+		t.Fatal(err)
+	}
+	db := database.Connect()
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLastAdminIsKept(t *testing.T) {
+	ctx := context.Background()
+	service := NewUserService(newEmptyDB(t))
+	admin := newUser(t, service, models.RoleAdmin)
+	deployer := newUser(t, service, models.RoleDeployer)
+	viewer := string(models.RoleViewer)
+
+	for name, err := range map[string]error{
+		"demote":  service.UpdateUser(ctx, &dto.User_Update_Request{ID: admin.ID, Role: &viewer}),
+		"disable": service.SetDisabled(ctx, admin.ID, true),
+		"delete":  service.DeleteUser(ctx, admin.ID),
+	} {
+		if !errors.Is(err, ErrLastAdmin) {
+			t.Errorf("%s the last admin = %v, want %v", name, err, ErrLastAdmin)
+		}
+	}
+	// other users are not held back by the last admin
+	if err := service.SetDisabled(ctx, deployer.ID, true); err != nil {
+		t.Fatalf("disable a deployer: %v", err)
+	}
+
+	// a disabled admin can not take over
+	second := newUser(t, service, models.RoleAdmin)
+	if err := service.SetDisabled(ctx, second.ID, true); err != nil {
+		t.Fatalf("disable the second admin: %v", err)
+	}
+	if err := service.SetDisabled(ctx, admin.ID, true); !errors.Is(err, ErrLastAdmin) {
+		t.Fatalf("disable the last enabled admin = %v, want %v", err, ErrLastAdmin)
+	}
+
+	// accounts of older versions are admins too
+	if _, err := service.db.Exec("UPDATE users SET disabled = 0, role = ? WHERE id = ?", models.RoleSuperAdmin, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.UpdateUser(ctx, &dto.User_Update_Request{ID: admin.ID, Role: &viewer}); err != nil {
+		t.Fatalf("demote an admin next to a superadmin: %v", err)
+	}
+	if err := service.DeleteUser(ctx, second.ID); !errors.Is(err, ErrLastAdmin) {
+		t.Fatalf("delete the last superadmin = %v, want %v", err, ErrLastAdmin)
+	}
+}
+
+func TestDeleteUserRemovesItsAccess(t *testing.T) {
+	ctx := context.Background()
+	service := NewUserService(testDB)
+	user := newUser(t, service, models.RoleDeployer)
+	result, err := testDB.Exec(`INSERT INTO stacks (uuid, name, directory, type, repo_url, port, commands) VALUES (?, ?, ?, 'nodejs', 'repo', 3000, ?)`,
+		t.Name(), t.Name(), "/tmp/"+t.Name(), []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stackID, _ := result.LastInsertId()
+	if err := NewStackService(testDB).UpsertStackMember(ctx, &dto.StackMember_Upsert_Request{StackID: stackID, UserID: user.ID, Role: string(models.RoleMaintainer)}); err != nil {
+		t.Fatal(err)
+	}
+	_, token, err := service.CreateAPIToken(ctx, &dto.APIToken_Create_Request{UserID: user.ID, Name: "ci", Scopes: []string{"deploy"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, refreshToken, err := service.CreateSession(ctx, user.ID, "password", "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, err := service.GetUserByID(ctx, user.ID); err != nil || deleted != nil {
+		t.Fatalf("deleted user = %+v %v", deleted, err)
+	}
+	if authenticated, _, err := service.AuthenticateAPIToken(ctx, token); authenticated != nil {
+		t.Fatalf("API token of a deleted user authenticated %+v %v", authenticated, err)
+	}
+	if _, _, err := service.RefreshSession(ctx, refreshToken); !errors.Is(err, ErrInvalidSession) {
+		t.Fatalf("refresh a session of a deleted user = %v, want %v", err, ErrInvalidSession)
+	}
+	var members int
+	if err := testDB.Get(&members, "SELECT COUNT(*) FROM stack_members WHERE user_id = ?", user.ID); err != nil || members != 0 {
+		t.Fatalf("memberships of a deleted user = %d %v", members, err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	service := NewUserService(testDB)
+	user := newUser(t, service, models.RoleViewer)
+	if err := service.SetPassword(ctx, user.ID, "temporary password", true); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := service.GetUserByID(ctx, user.ID); !changed.MustChangePassword {
+		t.Fatal("a reset password does not have to be changed")
+	}
+
+	if err := service.ChangePassword(ctx, user.ID, "wrong password", "new correct horse"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("change with a wrong password = %v, want %v", err, ErrInvalidPassword)
+	}
+	if err := service.ChangePassword(ctx, user.ID, "temporary password", "temporary password"); !errors.Is(err, ErrSamePassword) {
+		t.Fatalf("change to the same password = %v, want %v", err, ErrSamePassword)
+	}
+	if err := service.ChangePassword(ctx, user.ID, "temporary password", "new correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Authenticate(ctx, user.Email, "new correct horse"); err != nil {
+		t.Fatalf("login with the new password: %v", err)
+	}
+	if changed, _ := service.GetUserByID(ctx, user.ID); changed.MustChangePassword {
+		t.Fatal("the password still has to be changed")
+	}
+}
+
+func TestDisabledUserCanNotLogIn(t *testing.T) {
+	ctx := context.Background()
+	service := NewUserService(testDB)
+	user := newUser(t, service, models.RoleViewer)
+	if err := service.SetDisabled(ctx, user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Authenticate(ctx, user.Email, "correct horse battery"); !errors.Is(err, ErrUserDisabled) {
+		t.Fatalf("login of a disabled user = %v, want %v", err, ErrUserDisabled)
+	}
+	if err := service.SetDisabled(ctx, user.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Authenticate(ctx, user.Email, "correct horse battery"); err != nil {
+		t.Fatalf("login of an enabled user: %v", err)
+	}
+}
+
+func TestCreateUserWithInvitation(t *testing.T) {
+	ctx := context.Background()
+	service := NewUserService(testDB)
+	_, token, err := service.CreateInvitation(ctx, &dto.UserInvitation_Create_Request{Email: "Invited@example.com", Role: string(models.RoleDeployer)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the invitation decides the role, and only its email may use it
+	other := &dto.User_RegisterRequest{Email: "other@example.com", Password: "correct horse battery", Role: string(models.RoleAdmin)}
+	if err := service.CreateUserWithInvitation(ctx, other, token); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("invitation used by another email = %v, want %v", err, ErrInvalidInvitation)
+	}
+	invited := &dto.User_RegisterRequest{Email: "invited@example.com", Password: "correct horse battery", Role: string(models.RoleAdmin)}
+	if err := service.CreateUserWithInvitation(ctx, invited, token); err != nil {
+		t.Fatal(err)
+	}
+	if user, err := service.GetUserByEmail(ctx, "invited@example.com"); err != nil || user.Role != models.RoleDeployer {
+		t.Fatalf("invited user = %+v %v, want a deployer", user, err)
+	}
+
+	again := &dto.User_RegisterRequest{Email: "invited@example.com", Password: "correct horse battery"}
+	if err := service.CreateUserWithInvitation(ctx, again, token); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("invitation used twice = %v, want %v", err, ErrInvalidInvitation)
+	}
+	if err := service.CreateUserWithInvitation(ctx, again, "unknown"); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("unknown invitation = %v, want %v", err, ErrInvalidInvitation)
+	}
+
+	_, expired, err := service.CreateInvitation(ctx, &dto.UserInvitation_Create_Request{Role: string(models.RoleViewer)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.Exec("UPDATE user_invitations SET expires_at = '2000-01-01T00:00:00Z' WHERE token_hash = ?", pkg.HashToken(expired)); err != nil {
+		t.Fatal(err)
+	}
+	late := &dto.User_RegisterRequest{Email: "late@example.com", Password: "correct horse battery"}
+	if err := service.CreateUserWithInvitation(ctx, late, expired); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("expired invitation = %v, want %v", err, ErrInvalidInvitation)
+	}
+}
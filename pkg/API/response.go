@@ -1,10 +1,14 @@
 package API
 
 import (
+	"encoding/json"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/satnamSandhu2001/stackjet/pkg"
@@ -71,22 +75,46 @@ func Forbidden(c *gin.Context, message string) {
 	AbortWithStatusError(c, http.StatusForbidden, message)
 }
 
-// SendJWTtoken sends a JWT token in a cookie with JSON Response
-func SendJWTtoken(c *gin.Context, token string, message string, data any) {
+// PayloadTooLarge sends a 413 Request Entity Too Large response and aborts
+func PayloadTooLarge(c *gin.Context, message string) {
+	AbortWithStatusError(c, http.StatusRequestEntityTooLarge, message)
+}
+
+// TooManyRequests sends a 429 Too Many Requests response telling when to retry and aborts
+func TooManyRequests(c *gin.Context, retryAfter time.Duration, message string) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	AbortWithStatusError(c, http.StatusTooManyRequests, message)
+}
+
+// SendSession sends the access token and the refresh token of a session in cookies with JSON Response
+func SendSession(c *gin.Context, accessToken string, refreshToken string, message string, data map[string]any) {
+	setSessionCookies(c, "Bearer "+accessToken, refreshToken, int(pkg.Config().AccessTokenTTL().Seconds()), int(pkg.Config().RefreshTokenTTL().Seconds()))
+	data["token"] = accessToken
+	data["refresh_token"] = refreshToken
+	data["expires_in"] = int(pkg.Config().AccessTokenTTL().Seconds())
+	Success(c, message, data)
+}
+
+// RedirectSession sends the access token and the refresh token of a session in cookies and redirects to location,
+// for logins that end in the browser
+func RedirectSession(c *gin.Context, accessToken string, refreshToken string, location string) {
+	setSessionCookies(c, "Bearer "+accessToken, refreshToken, int(pkg.Config().AccessTokenTTL().Seconds()), int(pkg.Config().RefreshTokenTTL().Seconds()))
+	c.Redirect(http.StatusFound, location)
+}
+
+// ClearSession deletes the session cookies
+func ClearSession(c *gin.Context) {
+	setSessionCookies(c, "", "", -1, -1)
+}
+
+// setSessionCookies sets the access token cookie for the API and the refresh token cookie for the auth routes only
+func setSessionCookies(c *gin.Context, access string, refresh string, accessMaxAge int, refreshMaxAge int) {
 	env := pkg.Config().GO_ENV
 	if env == "production" {
 		c.SetSameSite(http.SameSiteStrictMode)
 	}
-	c.SetCookie(
-		"Authorization",
-		"Bearer "+token,
-		60*60*24*3, // 3 days
-		"/",
-		"",
-		env == "production",
-		true,
-	)
-	Success(c, message, data)
+	c.SetCookie("Authorization", access, accessMaxAge, "/", "", env == "production", true)
+	c.SetCookie("Refresh", refresh, refreshMaxAge, "/api/v1/auth", "", env == "production", true)
 }
 
 // server-sent-events writer
@@ -107,34 +135,48 @@ func NewSSEWriter(w http.ResponseWriter) *SSEWriter {
 	return &SSEWriter{w: w}
 }
 
+// Write sends log lines as a log event
 func (w *SSEWriter) Write(p []byte) (int, error) {
+	if err := w.send("log", strings.TrimSuffix(strings.TrimSuffix(string(p), "\n"), "\r")); err != nil {
+		return 0, err
+	}
+	// report only number of input bytes accepted (not expanded)
+	return len(p), nil
+}
+
+// WriteEvent sends data as a JSON encoded event, e.g. step or done
+func (w *SSEWriter) WriteEvent(event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return w.send(event, string(payload))
+}
+
+func (w *SSEWriter) send(event string, data string) error {
 	if w.closed {
-		return 0, io.EOF
+		return io.EOF
 	}
 
-	// split into lines, prefix each with "data: "
-	lines := strings.Split(string(p), "\n")
+	// split into lines, prefix each with "data: ". Clients also end lines at \r, which must
+	// not let a log line start a field of its own.
+	data = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(data)
 	var ssePayload strings.Builder
-	for _, line := range lines {
+	ssePayload.WriteString("event: " + event + "\n")
+	for _, line := range strings.Split(data, "\n") {
 		ssePayload.WriteString("data: ")
 		ssePayload.WriteString(line)
 		ssePayload.WriteString("\n")
 	}
 	ssePayload.WriteString("\n") // end SSE event
 
-	msg := ssePayload.String()
-
-	_, err := w.w.Write([]byte(msg))
-	if err != nil {
-		return 0, err
+	if _, err := w.w.Write([]byte(ssePayload.String())); err != nil {
+		return err
 	}
-
 	if flusher, ok := w.w.(http.Flusher); ok {
 		flusher.Flush()
 	}
-
-	// report only number of input bytes accepted (not expanded)
-	return len(p), nil
+	return nil
 }
 
 func (s *SSEWriter) Close() {
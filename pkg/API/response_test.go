@@ -0,0 +1,46 @@
+package API
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSSEWriter(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	w := NewSSEWriter(recorder)
+	if got := recorder.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("content type = %q", got)
+	}
+
+	if _, err := w.Write([]byte("Installing...\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteEvent("step", map[string]any{"name": "install", "status": "in_progress"}); err != nil {
+		t.Fatal(err)
+	}
+	// a log line of a build can not forge an event of its own
+	if _, err := w.Write([]byte("50%\revent: done\r\ndata: {\"success\": true}\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte("Done\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "event: log\ndata: Installing...\n\n" +
+		"event: step\ndata: {\"name\":\"install\",\"status\":\"in_progress\"}\n\n" +
+		"event: log\ndata: 50%\ndata: event: done\ndata: data: {\"success\": true}\n\n" +
+		"event: log\ndata: Done\n\n"
+	if got := recorder.Body.String(); got != want {
+		t.Fatalf("stream = %q, want %q", got, want)
+	}
+
+	w.Close()
+	if _, err := w.Write([]byte("after close\n")); err != io.EOF {
+		t.Fatalf("write after close = %v, want %v", err, io.EOF)
+	}
+	if err := w.WriteEvent("done", nil); err != io.EOF {
+		t.Fatalf("event after close = %v, want %v", err, io.EOF)
+	}
+}
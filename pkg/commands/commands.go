@@ -2,6 +2,8 @@ package commands
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -9,6 +11,8 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/satnamSandhu2001/stackjet/pkg/logger"
 )
@@ -18,8 +22,21 @@ type RunCommandArgs struct {
 	Name   string
 	Args   []string
 	Env    map[string]string
+	// Dir is the working directory of the command, the current directory if empty
+	Dir string
+	// SecretEnv is passed to the command like Env but never logged
+	SecretEnv map[string]string
+	// Ctx cancels the command. The command runs in its own process group, so all of its child processes are killed too.
+	Ctx context.Context
+	// Timeout kills the command after the duration, no timeout if zero
+	Timeout time.Duration
+	// Policy restricts how user supplied commands run, nil runs them as the StackJet user
+	Policy *Policy
 }
 
+// ErrTimeout is returned when a command was killed after its timeout
+var ErrTimeout = errors.New("command timed out")
+
 // RunCommand runs a command with the given name and arguments
 func RunCommand(args RunCommandArgs) (string, error) {
 	// if cmd.Verbose {
@@ -27,15 +44,54 @@ func RunCommand(args RunCommandArgs) (string, error) {
 	for k, v := range args.Env {
 		envVarsList = append(envVarsList, fmt.Sprintf("%s=%v", k, v))
 	}
-	logger.EmitLog(args.Logger, fmt.Sprintf("> Executing: %s %s %s\n", strings.Join(envVarsList, " "), args.Name, strings.Join(args.Args, " ")))
+	restrictions := ""
+	if args.Policy != nil {
+		restrictions = fmt.Sprintf(" (%s)", args.Policy)
+	}
+	logger.EmitLog(args.Logger, fmt.Sprintf("> Executing%s: %s %s %s\n", restrictions, strings.Join(envVarsList, " "), args.Name, strings.Join(args.Args, " ")))
 	// }
 
+	name, cmdArgs, baseEnv := args.Name, args.Args, os.Environ()
+	if args.Policy != nil {
+		var err error
+		if name, cmdArgs, err = args.Policy.wrap(name, cmdArgs); err != nil {
+			return "", err
+		}
+		if baseEnv, err = args.Policy.environ(); err != nil {
+			return "", err
+		}
+	}
+
+	ctx := args.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if args.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, args.Timeout, ErrTimeout)
+		defer cancel()
+	}
+
 	// Create command
-	cmd := exec.Command(args.Name, args.Args...)
-	cmd.Env = os.Environ()
+	cmd := exec.CommandContext(ctx, name, cmdArgs...)
+	setProcessGroup(cmd)
+	if args.Policy != nil {
+		cleanup, err := args.Policy.apply(cmd)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+	}
+	// output pipes held open by orphaned children must not block forever
+	cmd.WaitDelay = 10 * time.Second
+	cmd.Dir = args.Dir
+	cmd.Env = baseEnv
 	for k, v := range args.Env {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
+	for k, v := range args.SecretEnv {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
 
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
@@ -51,13 +107,15 @@ func RunCommand(args RunCommandArgs) (string, error) {
 	}
 
 	var output strings.Builder
+	// stdout and stderr are streamed at the same time, their lines are written one at a time
+	var mu sync.Mutex
 
 	done := make(chan error, 2)
 	go func() {
-		done <- streamOutput(stdoutPipe, args.Logger, &output)
+		done <- streamOutput(stdoutPipe, args.Logger, &output, &mu)
 	}()
 	go func() {
-		done <- streamOutput(stderrPipe, args.Logger, &output)
+		done <- streamOutput(stderrPipe, args.Logger, &output, &mu)
 	}()
 
 	// wait for both stdout and stderr
@@ -66,22 +124,30 @@ func RunCommand(args RunCommandArgs) (string, error) {
 	}
 
 	if err := cmd.Wait(); err != nil {
+		if errors.Is(context.Cause(ctx), ErrTimeout) {
+			return output.String(), fmt.Errorf("%w after %s: %s", ErrTimeout, args.Timeout, args.Name)
+		}
+		if ctx.Err() != nil {
+			return output.String(), fmt.Errorf("command cancelled: %w", context.Cause(ctx))
+		}
 		return output.String(), fmt.Errorf("command failed: %w", err)
 	}
 	return output.String(), nil
 }
 
 // streams the output of a command to a writer
-func streamOutput(reader io.Reader, w io.Writer, output *strings.Builder) error {
+func streamOutput(reader io.Reader, w io.Writer, output *strings.Builder, mu *sync.Mutex) error {
 	scanner := bufio.NewScanner(reader)
 	for scanner.Scan() {
 		line := scanner.Text()
+		mu.Lock()
 		logger.EmitLog(w, line)
 		output.WriteString(line + "\n")
 
 		if f, ok := w.(http.Flusher); ok {
 			f.Flush()
 		}
+		mu.Unlock()
 	}
 	return scanner.Err()
 }
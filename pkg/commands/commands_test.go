@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunCommandOutput(t *testing.T) {
+	output, err := RunCommand(RunCommandArgs{
+		Logger: io.Discard, Name: "sh", Args: []string{"-c", `for i in 1 2 3; do echo "out $i"; echo "err $i" >&2; done; echo "$GREETING"`},
+		Env: map[string]string{"GREETING": "hello"}, Dir: t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"out 1", "out 3", "err 1", "err 3", "hello"} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("output %q is missing %q", output, line)
+		}
+	}
+
+	if _, err := RunCommand(RunCommandArgs{Logger: io.Discard, Name: "sh", Args: []string{"-c", "exit 3"}}); err == nil || errors.Is(err, ErrTimeout) {
+		t.Fatalf("failing command = %v, want a failure", err)
+	}
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	start := time.Now()
+	_, err := RunCommand(RunCommandArgs{Logger: io.Discard, Name: "sleep", Args: []string{"30"}, Timeout: 100 * time.Millisecond})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("error = %v, want %v", err, ErrTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("the command was killed after %s", elapsed)
+	}
+}
+
+func TestRunCommandCancelKillsChildren(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	cancelled := errors.New("deployment cancelled")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	go func() {
+		// cancel once the child runs
+		for range 100 {
+			if _, err := os.Stat(pidFile); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		cancel(cancelled)
+	}()
+
+	start := time.Now()
+	// the child holds the output pipes open, as the dev servers and watchers of builds do
+	_, err := RunCommand(RunCommandArgs{Logger: io.Discard, Name: "sh", Args: []string{"-c", `sleep 30 & echo $! > "$0"; wait`, pidFile}, Ctx: ctx})
+	if !errors.Is(err, cancelled) || errors.Is(err, ErrTimeout) {
+		t.Fatalf("error = %v, want the cause of the cancellation", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("the command was killed after %s", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the killed child may linger as a zombie of the reaped shell for a moment
+	for range 50 {
+		if err := syscall.Kill(pid, 0); err != nil {
+			return
+		}
+		if stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat")); err == nil && strings.Contains(string(stat), ") Z ") {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("child process %d survived the cancellation", pid)
+}
@@ -0,0 +1,217 @@
+package commands
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Policy restricts how user supplied commands like installs, builds and post commands run.
+// Zero values leave the command unrestricted.
+type Policy struct {
+	// User runs commands as this unix user, which requires StackJet to run as root.
+	// "stack" is resolved to a dedicated user per stack by the caller.
+	User string `json:"user,omitempty"`
+	// AllowEnv lists the variables passed on from the StackJet environment, all are passed if empty.
+	// PATH is always passed and a trailing * matches a prefix, e.g. NPM_CONFIG_*.
+	AllowEnv []string `json:"allow_env,omitempty"`
+	// CPUs limits CPU time to this many cores, MemoryMB and MaxProcesses limit memory and processes (cgroup v2)
+	CPUs         float64 `json:"cpus,omitempty"`
+	MemoryMB     int     `json:"memory_mb,omitempty"`
+	MaxProcesses int     `json:"max_processes,omitempty"`
+	// Sandbox is "bwrap" to run commands in a bubblewrap sandbox or "auto" to use it when installed
+	Sandbox string `json:"sandbox,omitempty"`
+	// AllowUsers lists the users apps may run commands as while the global policy sets no user, only read from the global policy
+	AllowUsers []string `json:"allow_users,omitempty"`
+
+	// set by the caller for each stack
+	Name    string `json:"-"` // cgroup name
+	WorkDir string `json:"-"` // the only directory besides Home and /tmp writable in the sandbox
+	Home    string `json:"-"`
+}
+
+// sandboxes from weakest to strictest
+var sandboxes = []string{"", "auto", "bwrap"}
+
+// Validate checks the values of a policy
+func (p Policy) Validate() error {
+	if !slices.Contains(sandboxes, p.Sandbox) {
+		return fmt.Errorf("invalid sandbox %q, valid sandboxes: auto, bwrap", p.Sandbox)
+	}
+	if p.CPUs < 0 || p.MemoryMB < 0 || p.MaxProcesses < 0 {
+		return errors.New("resource limits must not be negative")
+	}
+	return nil
+}
+
+// IsZero reports whether the policy restricts nothing
+func (p Policy) IsZero() bool {
+	return p.User == "" && len(p.AllowEnv) == 0 && p.CPUs == 0 && p.MemoryMB == 0 && p.MaxProcesses == 0 && p.Sandbox == ""
+}
+
+// Merge combines a global policy with the policy of a stack, the stack can only tighten the global policy.
+// The user of the global policy always applies, without one a stack can only pick a user of AllowUsers.
+func (p Policy) Merge(stack Policy) (Policy, error) {
+	merged := p
+	merged.AllowUsers = nil
+	if merged.User == "" && stack.User != "" {
+		if !slices.Contains(p.AllowUsers, stack.User) {
+			return Policy{}, fmt.Errorf("apps can't run commands as %s, add it to allow_users of exec_policy in the config", stack.User)
+		}
+		merged.User = stack.User
+	}
+	if slices.Index(sandboxes, stack.Sandbox) > slices.Index(sandboxes, merged.Sandbox) {
+		merged.Sandbox = stack.Sandbox
+	}
+	merged.CPUs = stricter(merged.CPUs, stack.CPUs)
+	merged.MemoryMB = stricter(merged.MemoryMB, stack.MemoryMB)
+	merged.MaxProcesses = stricter(merged.MaxProcesses, stack.MaxProcesses)
+	switch {
+	case len(merged.AllowEnv) == 0:
+		merged.AllowEnv = stack.AllowEnv
+	case len(stack.AllowEnv) > 0:
+		var both []string
+		for _, name := range stack.AllowEnv {
+			if slices.Contains(merged.AllowEnv, name) {
+				both = append(both, name)
+			}
+		}
+		// an empty intersection would allow everything
+		if len(both) == 0 {
+			both = []string{"PATH"}
+		}
+		merged.AllowEnv = both
+	}
+	return merged, nil
+}
+
+// the lower of two limits, zero means no limit
+func stricter[T int | float64](a T, b T) T {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// String describes the restrictions of the policy
+func (p Policy) String() string {
+	var parts []string
+	if p.User != "" {
+		parts = append(parts, "user "+p.User)
+	}
+	if p.Sandbox != "" {
+		parts = append(parts, "sandbox "+p.Sandbox)
+	}
+	if p.CPUs > 0 {
+		parts = append(parts, fmt.Sprintf("%g cpus", p.CPUs))
+	}
+	if p.MemoryMB > 0 {
+		parts = append(parts, fmt.Sprintf("%d MB memory", p.MemoryMB))
+	}
+	if p.MaxProcesses > 0 {
+		parts = append(parts, fmt.Sprintf("%d processes", p.MaxProcesses))
+	}
+	if len(p.AllowEnv) > 0 {
+		parts = append(parts, "env "+strings.Join(p.AllowEnv, ","))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// For saving to DB
+func (p Policy) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+// For reading from DB
+func (p *Policy) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	case nil:
+		return nil
+	}
+	return fmt.Errorf("Scan source is not []byte")
+}
+
+// environ returns the environment passed on from StackJet, with HOME and USER of the policy user
+func (p *Policy) environ() ([]string, error) {
+	env := os.Environ()
+	if len(p.AllowEnv) > 0 {
+		env = slices.DeleteFunc(env, func(entry string) bool {
+			name, _, _ := strings.Cut(entry, "=")
+			return name != "PATH" && !slices.ContainsFunc(p.AllowEnv, func(allowed string) bool {
+				if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+					return strings.HasPrefix(name, prefix)
+				}
+				return name == allowed
+			})
+		})
+	}
+
+	home := p.Home
+	if p.User != "" {
+		u, err := user.Lookup(p.User)
+		if err != nil {
+			return nil, err
+		}
+		if home == "" {
+			home = u.HomeDir
+		}
+		env = append(env, "USER="+u.Username, "LOGNAME="+u.Username)
+	}
+	if home != "" {
+		env = append(env, "HOME="+home)
+	}
+	return env, nil
+}
+
+// wrap returns the command that runs name in the sandbox of the policy
+func (p *Policy) wrap(name string, args []string) (string, []string, error) {
+	sandbox := p.Sandbox
+	if sandbox == "auto" {
+		sandbox = ""
+		if _, err := exec.LookPath("bwrap"); err == nil {
+			sandbox = "bwrap"
+		}
+	}
+	if sandbox == "" {
+		return name, args, nil
+	}
+	if _, err := exec.LookPath("bwrap"); err != nil {
+		return "", nil, errors.New("bubblewrap (bwrap) is not installed, install it or remove the sandbox from the execution policy")
+	}
+
+	workDir := p.WorkDir
+	if workDir == "" {
+		var err error
+		if workDir, err = os.Getwd(); err != nil {
+			return "", nil, err
+		}
+	}
+	// the host is read-only except the work dir, home and a private /tmp, the network stays available for installs.
+	// .git of the work dir stays read-only, git runs outside of the sandbox as StackJet.
+	gitDir := filepath.Join(workDir, ".git")
+	wrapped := []string{
+		"--die-with-parent", "--unshare-pid", "--unshare-ipc", "--unshare-uts", "--unshare-cgroup-try",
+		"--ro-bind", "/", "/", "--dev", "/dev", "--proc", "/proc", "--tmpfs", "/tmp",
+		"--bind", workDir, workDir,
+		"--ro-bind-try", gitDir, gitDir,
+	}
+	if p.Home != "" {
+		wrapped = append(wrapped, "--bind", p.Home, p.Home)
+	}
+	if dir, err := os.Getwd(); err == nil {
+		wrapped = append(wrapped, "--chdir", dir)
+	}
+	wrapped = append(wrapped, "--", name)
+	return "bwrap", append(wrapped, args...), nil
+}
@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// apply switches the user of cmd and starts it in a cgroup with the limits of the policy.
+// The returned cleanup removes the cgroup after the command exited.
+func (p *Policy) apply(cmd *exec.Cmd) (func(), error) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if p.User != "" {
+		u, err := user.Lookup(p.User)
+		if err != nil {
+			return nil, err
+		}
+		uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+		gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+		if os.Geteuid() != 0 && uint64(os.Geteuid()) != uid {
+			return nil, fmt.Errorf("running commands as %s requires StackJet to run as root", p.User)
+		}
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	}
+
+	if p.CPUs == 0 && p.MemoryMB == 0 && p.MaxProcesses == 0 {
+		return func() {}, nil
+	}
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return nil, errors.New("resource limits require cgroup v2 mounted at " + cgroupRoot)
+	}
+	parent := filepath.Join(cgroupRoot, "stackjet")
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+cpu +memory +pids"), 0644); err != nil {
+		return nil, fmt.Errorf("failed to enable cgroup controllers: %w", err)
+	}
+
+	// every command gets its own cgroup, so its limits are not shared with other commands
+	dir := filepath.Join(parent, fmt.Sprintf("%s-%d", p.Name, time.Now().UnixNano()))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	limits := map[string]string{}
+	if p.CPUs > 0 {
+		limits["cpu.max"] = fmt.Sprintf("%d 100000", int(p.CPUs*100000))
+	}
+	if p.MemoryMB > 0 {
+		limits["memory.max"] = strconv.Itoa(p.MemoryMB * 1024 * 1024)
+		limits["memory.swap.max"] = "0"
+	}
+	if p.MaxProcesses > 0 {
+		limits["pids.max"] = strconv.Itoa(p.MaxProcesses)
+	}
+	for file, value := range limits {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0644); err != nil && file != "memory.swap.max" {
+			os.Remove(dir)
+			return nil, fmt.Errorf("failed to set cgroup limit %s: %w", file, err)
+		}
+	}
+	fd, err := os.Open(dir)
+	if err != nil {
+		os.Remove(dir)
+		return nil, err
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(fd.Fd())
+	return func() {
+		fd.Close()
+		// fails while processes that escaped the process group are still running in it
+		os.Remove(dir)
+	}, nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package commands
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// users and resource limits of execution policies are only supported on linux
+func (p *Policy) apply(cmd *exec.Cmd) (func(), error) {
+	if p.User != "" || p.CPUs > 0 || p.MemoryMB > 0 || p.MaxProcesses > 0 {
+		return nil, errors.New("execution policies with a user or resource limits are only supported on linux")
+	}
+	return func() {}, nil
+}
@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWrapMountsGitReadOnly(t *testing.T) {
+	// a stand-in bwrap, wrap only looks it up
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "bwrap"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	p := &Policy{Sandbox: "bwrap", WorkDir: "/var/www/app"}
+	name, args, err := p.wrap("npm", []string{"install"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "bwrap" {
+		t.Fatalf("wrapped command is %s, want bwrap", name)
+	}
+
+	bind := slices.Index(args, "--bind")
+	roBind := slices.Index(args, "--ro-bind-try")
+	if bind < 0 || roBind < 0 {
+		t.Fatalf("missing work dir mounts in %v", args)
+	}
+	if got := args[roBind+1 : roBind+3]; !slices.Equal(got, []string{"/var/www/app/.git", "/var/www/app/.git"}) {
+		t.Errorf("read-only mount is %v, want .git of the work dir", got)
+	}
+	// later mounts win, .git must come after the writable work dir
+	if roBind < bind {
+		t.Error(".git is mounted before the work dir and would be writable")
+	}
+}
+
+func TestMergeStackUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		global  Policy
+		stack   Policy
+		want    string
+		wantErr bool
+	}{
+		{name: "no user", global: Policy{}, stack: Policy{}, want: ""},
+		{name: "global user wins", global: Policy{User: "www-data"}, stack: Policy{User: "root"}, want: "www-data"},
+		{name: "not allowed", global: Policy{}, stack: Policy{User: "root"}, wantErr: true},
+		{name: "other user allowed", global: Policy{AllowUsers: []string{"stack"}}, stack: Policy{User: "root"}, wantErr: true},
+		{name: "allowed", global: Policy{AllowUsers: []string{"stack"}}, stack: Policy{User: "stack"}, want: "stack"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := tt.global.Merge(tt.stack)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if merged.User != tt.want {
+				t.Errorf("user = %q, want %q", merged.User, tt.want)
+			}
+			if len(merged.AllowUsers) > 0 {
+				t.Error("merged policy keeps the allowed users")
+			}
+		})
+	}
+}
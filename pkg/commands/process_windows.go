@@ -0,0 +1,6 @@
+package commands
+
+import "os/exec"
+
+// process groups are not supported, only the command itself is killed when it is cancelled
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -2,22 +2,64 @@ package pkg
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/satnamSandhu2001/stackjet/pkg/commands"
 )
 
 type AppConfig struct {
-	GO_ENV                  string   `json:"-"`
-	PORT                    uint     `json:"port"`
-	JWT_TOKEN               string   `json:"-"`
-	GIT_BRANCH              string   `json:"git_branch"`
-	GIT_REMOTE              string   `json:"git_remote"`
-	GIT_RESET               bool     `json:"git_reset"`
-	DEFAULT_STACKS_BASE_DIR string   `json:"default_stacks_base_dir"`
-	DB_URL                  string   `json:"-"`
-	VALID_STACKS            []string `json:"-"`
+	GO_ENV                  string            `json:"-"`
+	PORT                    uint              `json:"port"`
+	ALLOW_SIGNUP            bool              `json:"allow_signup"`
+	REQUIRE_TWO_FACTOR      bool              `json:"require_two_factor"`
+	RATE_LIMITS             map[string]int    `json:"rate_limits"`
+	LOGIN_LOCKOUT_ATTEMPTS  int               `json:"login_lockout_attempts"`
+	LOGIN_LOCKOUT_MINUTES   int               `json:"login_lockout_minutes"`
+	OIDC_DISCOVERY_URL      string            `json:"oidc_discovery_url"`
+	OIDC_CLIENT_ID          string            `json:"oidc_client_id"`
+	OIDC_CLIENT_SECRET      string            `json:"oidc_client_secret"`
+	OIDC_REDIRECT_URL       string            `json:"oidc_redirect_url"`
+	OIDC_SCOPES             []string          `json:"oidc_scopes"`
+	OIDC_GROUPS_CLAIM       string            `json:"oidc_groups_claim"`
+	OIDC_ROLE_MAPPING       map[string]string `json:"oidc_role_mapping"`
+	OIDC_AUTO_PROVISION     bool              `json:"oidc_auto_provision"`
+	OIDC_DEFAULT_ROLE       string            `json:"oidc_default_role"`
+	ACCESS_TOKEN_MINUTES    int               `json:"access_token_minutes"`
+	REFRESH_TOKEN_DAYS      int               `json:"refresh_token_days"`
+	JWT_KEY_GRACE_MINUTES   int               `json:"jwt_key_grace_minutes"`
+	GIT_BRANCH              string            `json:"git_branch"`
+	GIT_REMOTE              string            `json:"git_remote"`
+	GIT_RESET               bool              `json:"git_reset"`
+	GIT_VERIFY_SIGNATURES   bool              `json:"git_verify_signatures"`
+	GIT_ALLOWED_SIGNERS     string            `json:"git_allowed_signers"`
+	GIT_ALLOWED_GPG_KEYS    []string          `json:"git_allowed_gpg_keys"`
+	DEFAULT_STACKS_BASE_DIR string            `json:"default_stacks_base_dir"`
+	BUILD_CACHE_KEEP        int               `json:"build_cache_keep"`
+	NODE_INSTALL_ROOTS      []string          `json:"node_install_roots"`
+	STEP_TIMEOUTS           map[string]int    `json:"step_timeouts"`
+	EXEC_POLICY             commands.Policy   `json:"exec_policy"`
+	SANDBOX_HOME_DIR        string            `json:"sandbox_home_dir"`
+	NGINX_SITES_AVAILABLE   string            `json:"nginx_sites_available"`
+	NGINX_SITES_ENABLED     string            `json:"nginx_sites_enabled"`
+	ACME_DIRECTORY_URL      string            `json:"acme_directory_url"`
+	ACME_EMAIL              string            `json:"acme_email"`
+	ACME_WEBROOT            string            `json:"acme_webroot"`
+	ACME_RENEW_BEFORE_DAYS  int               `json:"acme_renew_before_days"`
+	DNS_PROVIDER            string            `json:"dns_provider"`
+	DNS_IPV4                string            `json:"dns_ipv4"`
+	DNS_IPV6                string            `json:"dns_ipv6"`
+	DNS_TTL                 int               `json:"dns_ttl"`
+	DNS_PROXIED             bool              `json:"dns_proxied"`
+	DB_URL                  string            `json:"-"`
+	STACKJET_DIR            string            `json:"-"`
+	VALID_STACKS            []string          `json:"-"`
 }
 
 var (
@@ -75,9 +117,8 @@ func Config() *AppConfig {
 			os.Exit(1)
 		}
 
-		// Load token
-		tokenData, err := os.ReadFile(filepath.Join(stackjetDir, "jwt.token"))
-		if err != nil {
+		// Check the signing key, it is read when used so that it can be rotated
+		if _, err := os.Stat(filepath.Join(stackjetDir, "jwt.token")); err != nil {
 			fmt.Println("❌ StackJet Authentication Error")
 			fmt.Println("Authentication token not found or corrupted.")
 			fmt.Println("\n🔧 To fix this issue, run:")
@@ -90,12 +131,160 @@ func Config() *AppConfig {
 			go_env = "development"
 		}
 		loaded.GO_ENV = go_env
-		loaded.JWT_TOKEN = string(tokenData)
 		loaded.VALID_STACKS = []string{"nodejs"}
+		loaded.STACKJET_DIR = stackjetDir
 		loaded.DB_URL = fmt.Sprintf("file:%s?_fk=1", filepath.Join(stackjetDir, "stackjet.db"))
 
+		// defaults for keys missing from configs created by older versions
+		if loaded.GIT_ALLOWED_SIGNERS == "" {
+			loaded.GIT_ALLOWED_SIGNERS = filepath.Join(stackjetDir, "allowed_signers")
+		}
+		if loaded.ACCESS_TOKEN_MINUTES == 0 {
+			loaded.ACCESS_TOKEN_MINUTES = 15
+		}
+		if loaded.REFRESH_TOKEN_DAYS == 0 {
+			loaded.REFRESH_TOKEN_DAYS = 30
+		}
+		if loaded.JWT_KEY_GRACE_MINUTES == 0 {
+			loaded.JWT_KEY_GRACE_MINUTES = 60
+		}
+		if loaded.RATE_LIMITS == nil {
+			loaded.RATE_LIMITS = map[string]int{}
+		}
+		for name, limit := range DefaultRateLimits {
+			if _, ok := loaded.RATE_LIMITS[name]; !ok {
+				loaded.RATE_LIMITS[name] = limit
+			}
+		}
+		if loaded.LOGIN_LOCKOUT_ATTEMPTS == 0 {
+			loaded.LOGIN_LOCKOUT_ATTEMPTS = 5
+		}
+		if loaded.LOGIN_LOCKOUT_MINUTES == 0 {
+			loaded.LOGIN_LOCKOUT_MINUTES = 15
+		}
+		if len(loaded.OIDC_SCOPES) == 0 {
+			loaded.OIDC_SCOPES = []string{"openid", "email", "profile"}
+		}
+		if loaded.OIDC_GROUPS_CLAIM == "" {
+			loaded.OIDC_GROUPS_CLAIM = "groups"
+		}
+		if loaded.BUILD_CACHE_KEEP == 0 {
+			loaded.BUILD_CACHE_KEEP = 5
+		}
+		if len(loaded.NODE_INSTALL_ROOTS) == 0 {
+			loaded.NODE_INSTALL_ROOTS = defaultNodeInstallRoots(homeDir, stackjetDir)
+		}
+		if loaded.STEP_TIMEOUTS == nil {
+			loaded.STEP_TIMEOUTS = map[string]int{}
+		}
+		for step, seconds := range DefaultStepTimeouts {
+			if _, ok := loaded.STEP_TIMEOUTS[step]; !ok {
+				loaded.STEP_TIMEOUTS[step] = seconds
+			}
+		}
+		if loaded.SANDBOX_HOME_DIR == "" {
+			loaded.SANDBOX_HOME_DIR = "/var/lib/stackjet/home"
+		}
+		if loaded.NGINX_SITES_AVAILABLE == "" {
+			loaded.NGINX_SITES_AVAILABLE = "/etc/nginx/sites-available"
+		}
+		if loaded.NGINX_SITES_ENABLED == "" {
+			loaded.NGINX_SITES_ENABLED = "/etc/nginx/sites-enabled"
+		}
+		if loaded.ACME_DIRECTORY_URL == "" {
+			loaded.ACME_DIRECTORY_URL = "https://acme-v02.api.letsencrypt.org/directory"
+		}
+		if loaded.ACME_WEBROOT == "" {
+			loaded.ACME_WEBROOT = filepath.Join(loaded.DEFAULT_STACKS_BASE_DIR, ".acme-challenge")
+		}
+		if loaded.ACME_RENEW_BEFORE_DAYS == 0 {
+			loaded.ACME_RENEW_BEFORE_DAYS = 30
+		}
+		if loaded.DNS_TTL == 0 {
+			loaded.DNS_TTL = 1 // automatic
+		}
+		for i, key := range loaded.GIT_ALLOWED_GPG_KEYS {
+			fingerprint, err := gpgFingerprint(key)
+			if err != nil {
+				fmt.Println("❌ StackJet Configuration Error")
+				fmt.Printf("Invalid key %q in \"git_allowed_gpg_keys\": %v.\n", key, err)
+				fmt.Println("\n🔧 To fix this issue, use the fingerprints shown by:")
+				fmt.Println("   \033[1;34mgpg --fingerprint\033[0m")
+				os.Exit(1)
+			}
+			loaded.GIT_ALLOWED_GPG_KEYS[i] = fingerprint
+		}
+
 		config = &loaded
 	})
 
 	return config
 }
+
+// DefaultStepTimeouts are the timeouts of deploy steps in seconds
+var DefaultStepTimeouts = map[string]int{
+	"git":     600,
+	"install": 1200,
+	"build":   1800,
+	"start":   120,
+	"post":    600,
+}
+
+// DefaultRateLimits are the requests allowed per minute for each rate limit, 0 disables a limit
+var DefaultRateLimits = map[string]int{
+	// every API request of an IP
+	"api": 600,
+	// auth requests of an IP
+	"auth_ip": 20,
+	// login and signup attempts of an email
+	"auth_account": 10,
+	// deploys and cancellations of a user
+	"deploy": 10,
+	// verified webhook deliveries of a stack
+	"webhook": 30,
+	// webhook deliveries of an IP failing verification or naming an unknown stack
+	"webhook_failed": 10,
+}
+
+// OIDCEnabled reports whether users can log in through an OIDC provider
+func (c *AppConfig) OIDCEnabled() bool {
+	return c.OIDC_DISCOVERY_URL != "" && c.OIDC_CLIENT_ID != "" && c.OIDC_REDIRECT_URL != ""
+}
+
+// AccessTokenTTL returns how long access tokens are valid
+func (c *AppConfig) AccessTokenTTL() time.Duration {
+	return time.Duration(c.ACCESS_TOKEN_MINUTES) * time.Minute
+}
+
+// RefreshTokenTTL returns how long a session can be refreshed without logging in
+func (c *AppConfig) RefreshTokenTTL() time.Duration {
+	return time.Duration(c.REFRESH_TOKEN_DAYS) * 24 * time.Hour
+}
+
+// StepTimeout returns the timeout of a deploy step (git, install, build, start or post), zero if it has none
+func (c *AppConfig) StepTimeout(step string) time.Duration {
+	return time.Duration(c.STEP_TIMEOUTS[step]) * time.Second
+}
+
+// gpgFingerprint normalizes a gpg key fingerprint to 40 upper case hex characters. Short key ids
+// are rejected, anyone can generate a key with the same id.
+func gpgFingerprint(key string) (string, error) {
+	fingerprint := strings.ToUpper(strings.ReplaceAll(key, " ", ""))
+	if !fingerprintPattern.MatchString(fingerprint) {
+		return "", errors.New("a full fingerprint of 40 hex characters is required")
+	}
+	return fingerprint, nil
+}
+
+var fingerprintPattern = regexp.MustCompile(`^[0-9A-F]{40}$`)
+
+// defaultNodeInstallRoots returns the node version folders of StackJet, nvm, fnm and volta
+func defaultNodeInstallRoots(homeDir string, stackjetDir string) []string {
+	return []string{
+		filepath.Join(stackjetDir, "node"),
+		filepath.Join(homeDir, ".nvm", "versions", "node"),
+		filepath.Join(homeDir, ".local", "share", "fnm", "node-versions"),
+		filepath.Join(homeDir, ".fnm", "node-versions"),
+		filepath.Join(homeDir, ".volta", "tools", "image", "node"),
+	}
+}
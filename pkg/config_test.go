@@ -0,0 +1,26 @@
+package pkg
+
+import "testing"
+
+func TestGPGFingerprint(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"0123456789ABCDEF0123456789ABCDEF01234567", "0123456789ABCDEF0123456789ABCDEF01234567"},
+		{"0123 4567 89ab cdef 0123  4567 89ab cdef 0123 4567", "0123456789ABCDEF0123456789ABCDEF01234567"},
+		// long and short key ids
+		{"89ABCDEF01234567", ""},
+		{"01234567", ""},
+		{"0123456789ABCDEF0123456789ABCDEF0123456", ""},
+		{"0123456789ABCDEF0123456789ABCDEF012345678", ""},
+		{"G123456789ABCDEF0123456789ABCDEF01234567", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, err := gpgFingerprint(tt.key)
+		if got != tt.want || (err == nil) != (tt.want != "") {
+			t.Errorf("gpgFingerprint(%q) = %q, %v, want %q", tt.key, got, err, tt.want)
+		}
+	}
+}
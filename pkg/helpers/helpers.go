@@ -43,7 +43,7 @@ func GenerateStackDirPath(repoUrl string) string {
 	return finalPath
 }
 
-// accepts only: [npm | yarn | pnpm] start or [npm | yarn | pnpm] run <script>
+// accepts only: [npm | yarn | pnpm | bun] start, [npm | yarn | pnpm | bun] run <script> or [yarn | pnpm] <script>
 func ValidateNodeStartCommand(command string) error {
 	command = strings.TrimSpace(command)
 
@@ -52,12 +52,63 @@ func ValidateNodeStartCommand(command string) error {
 		return errors.New("chaining or piping is not allowed in start command")
 	}
 
-	// allow only npm|yarn|pnpm start / run script-name
-	validPattern := regexp.MustCompile(`^(npm|yarn|pnpm)\s+(start|run\s+[a-zA-Z0-9:_-]+)$`)
-	if !validPattern.MatchString(command) {
-		return errors.New("start command must be 'npm|yarn|pnpm start' or 'run <script>'")
+	// allow only npm|yarn|pnpm|bun start / run script-name, yarn and pnpm also run scripts without "run".
+	// Script names can not start with a dash, which would pass an option instead.
+	validPattern := regexp.MustCompile(`^(npm|yarn|pnpm|bun) +(start|run +[a-zA-Z0-9:_][a-zA-Z0-9:_-]*)$`)
+	shorthandPattern := regexp.MustCompile(`^(yarn|pnpm) +[a-zA-Z0-9:_][a-zA-Z0-9:_-]*$`)
+	if !validPattern.MatchString(command) && !shorthandPattern.MatchString(command) {
+		return errors.New("start command must be 'npm|yarn|pnpm|bun start', 'npm|yarn|pnpm|bun run <script>' or 'yarn|pnpm <script>'")
 	}
 
 	return nil
 
 }
+
+// accepts fully qualified host names like example.com or api.example.co.uk
+func ValidateDomain(domain string) error {
+	domain = strings.TrimSpace(domain)
+	if len(domain) > 253 {
+		return errors.New("domain must be at most 253 characters")
+	}
+	validPattern := regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,63}$`)
+	if !validPattern.MatchString(domain) {
+		return errors.New("invalid domain name: " + domain)
+	}
+	return nil
+}
+
+// accepts a relative path inside the repo like apps/api and returns it cleaned, "" for the repo root
+func CleanAppPath(appPath string) (string, error) {
+	appPath = strings.TrimSpace(appPath)
+	if appPath == "" {
+		return "", nil
+	}
+	if filepath.IsAbs(appPath) {
+		return "", errors.New("app path must be relative to the repo root: " + appPath)
+	}
+	cleaned := filepath.Clean(appPath)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", errors.New("app path must be inside the repo: " + appPath)
+	}
+	if cleaned == "." {
+		return "", nil
+	}
+	return cleaned, nil
+}
+
+// accepts header names made of letters, digits and dashes with a single line value
+func ValidateHeader(name string, value string) error {
+	if !regexp.MustCompile(`^[a-zA-Z0-9-]+$`).MatchString(name) {
+		return errors.New("invalid header name: " + name)
+	}
+	if strings.ContainsAny(value, "\r\n;{}") {
+		return errors.New("header value must not contain new lines, ';' or braces: " + name)
+	}
+	return nil
+}
+
+// CertificatePaths returns the full-chain certificate and private key paths of a domain
+func CertificatePaths(domain string) (string, string) {
+	dir := filepath.Join(pkg.Config().STACKJET_DIR, "certs", domain)
+	return filepath.Join(dir, "fullchain.pem"), filepath.Join(dir, "privkey.pem")
+}
@@ -0,0 +1,110 @@
+package helpers
+
+import "testing"
+
+func TestValidateNodeStartCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		valid   bool
+	}{
+		{"npm start", true},
+		{"  npm start  ", true},
+		{"bun start", true},
+		{"npm run start:prod", true},
+		{"yarn run serve", true},
+		{"pnpm run build_and-serve", true},
+		{"yarn serve", true},
+		{"pnpm start:prod", true},
+		{"npm serve", false},
+		{"bun serve", false},
+		{"npx serve", false},
+		{"node server.js", false},
+		{"npm run", false},
+		{"npm run start prod", false},
+		{"npm start && rm -rf /", false},
+		{"npm start; rm -rf /", false},
+		{"npm start | tee log", false},
+		{"npm run $(whoami)", false},
+		{"npm run `whoami`", false},
+		{"npm start > /tmp/log", false},
+		{"npm run --prefix /tmp", false},
+		{"yarn --cwd", false},
+		{"npm\nstart", false},
+		{"npm\tstart", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateNodeStartCommand(tt.command); (err == nil) != tt.valid {
+			t.Errorf("ValidateNodeStartCommand(%q) = %v, want valid %v", tt.command, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		valid  bool
+	}{
+		{"example.com", true},
+		{"api.example.co.uk", true},
+		{"xn--bcher-kva.example", true},
+		{"localhost", false},
+		{"-example.com", false},
+		{"example-.com", false},
+		{"example.com;", false},
+		{"example.com\nlisten 80", false},
+		{"*.example.com", false},
+		{"example.c0m", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateDomain(tt.domain); (err == nil) != tt.valid {
+			t.Errorf("ValidateDomain(%q) = %v, want valid %v", tt.domain, err, tt.valid)
+		}
+	}
+}
+
+func TestCleanAppPath(t *testing.T) {
+	tests := []struct {
+		path  string
+		want  string
+		valid bool
+	}{
+		{"", "", true},
+		{".", "", true},
+		{"apps/api", "apps/api", true},
+		{" apps//api/ ", "apps/api", true},
+		{"apps/../api", "api", true},
+		{"..", "", false},
+		{"../other", "", false},
+		{"apps/../../other", "", false},
+		{"/var/www", "", false},
+		{"..app", "..app", true},
+	}
+	for _, tt := range tests {
+		got, err := CleanAppPath(tt.path)
+		if got != tt.want || (err == nil) != tt.valid {
+			t.Errorf("CleanAppPath(%q) = %q, %v, want %q valid %v", tt.path, got, err, tt.want, tt.valid)
+		}
+	}
+}
+
+func TestValidateHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"X-Frame-Options", "DENY", true},
+		{"Content-Security-Policy", "default-src 'self'", true},
+		{"X Frame", "DENY", false},
+		{"X-Frame:", "DENY", false},
+		{"X-Test", "a\r\nSet-Cookie: x", false},
+		{"X-Test", "a; add_header X-Other b", false},
+		{"X-Test", "}", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateHeader(tt.name, tt.value); (err == nil) != tt.valid {
+			t.Errorf("ValidateHeader(%q, %q) = %v, want valid %v", tt.name, tt.value, err, tt.valid)
+		}
+	}
+}
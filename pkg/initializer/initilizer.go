@@ -14,8 +14,18 @@ import (
 	"github.com/satnamSandhu2001/stackjet/pkg"
 )
 
+// AdminSetup is the first admin account created by InitializeApp
+type AdminSetup struct {
+	Email string
+	// Password is generated as a one-time password when empty
+	Password string
+}
+
+// DefaultAdminEmail is used when no admin email is given
+const DefaultAdminEmail = "admin@stackjet.com"
+
 // InitApp initializes the app by creating the config directory and generating a JWT token and lock file
-func InitializeApp(forceRecreate bool) {
+func InitializeApp(forceRecreate bool, admin AdminSetup) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil || homeDir == "" {
 		log.Printf("Error: Unable to determine user home directory: %v", err)
@@ -30,6 +40,14 @@ func InitializeApp(forceRecreate bool) {
 
 	if _, err := os.Stat(lockFilePath); err == nil {
 		if !forceRecreate {
+			restrictConfigPermissions(stackjetDirPath)
+			// bring the database of an older version up to date
+			if err := database.MigrateSchema(); err != nil {
+				log.Printf("Error migrating database: %v", err)
+				fmt.Println("❌ StackJet Database Error")
+				fmt.Println("Unable to update the database tables.")
+				os.Exit(1)
+			}
 			return
 		}
 		fmt.Println("Recreating config forcefully...")
@@ -64,7 +82,59 @@ func InitializeApp(forceRecreate bool) {
 	}
 	dbConn := database.Connect()
 	defer dbConn.Close()
-	database.RunInitSQL()
+	if err := database.RunInitSQL(); err != nil {
+		log.Printf("Error initializing database: %v", err)
+		fmt.Println("❌ StackJet Database Error")
+		fmt.Println("Unable to create the database tables.")
+		os.Exit(1)
+	}
+	createAdmin(admin)
+}
+
+// createAdmin creates the first admin, with a generated one-time password unless one is given
+func createAdmin(admin AdminSetup) {
+	if admin.Email == "" {
+		admin.Email = DefaultAdminEmail
+	}
+	oneTime := admin.Password == ""
+	if oneTime {
+		password, err := generateRandomHex(8)
+		if err != nil {
+			fmt.Println("❌ StackJet Configuration Error")
+			fmt.Println("Unable to generate the admin password.")
+			os.Exit(1)
+		}
+		admin.Password = password
+	}
+
+	created, err := database.CreateAdmin(admin.Email, admin.Password, oneTime)
+	if err != nil {
+		log.Printf("Error creating admin: %v", err)
+		fmt.Println("❌ StackJet Database Error")
+		fmt.Println("Unable to create the admin user.")
+		os.Exit(1)
+	}
+	if !created {
+		return
+	}
+
+	fmt.Println("\033[1;34m🔐 Admin user created:\033[0m")
+	fmt.Printf("\033[34m      email:    %s\033[0m\n", admin.Email)
+	if oneTime {
+		fmt.Printf("\033[34m      password: %s\033[0m\n", admin.Password)
+		fmt.Println("\033[34m      This one-time password is shown only once and must be changed on first login.\033[0m")
+	}
+	fmt.Println()
+}
+
+// IsInitialized reports whether StackJet was initialized for the current user
+func IsInitialized() bool {
+	homeDir, err := os.UserHomeDir()
+	if err != nil || homeDir == "" {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(homeDir, ".stackjet", "init.lock"))
+	return err == nil
 }
 
 func createLockFile(lockFilePath string) {
@@ -80,6 +150,16 @@ func createLockFile(lockFilePath string) {
 	defer file.Close()
 }
 
+// restrictConfigPermissions makes the config of older installs, which was world readable, private
+func restrictConfigPermissions(stackjetDirPath string) {
+	if err := os.Chmod(stackjetDirPath, 0700); err != nil {
+		log.Printf("Error restricting stackjet directory: %v", err)
+	}
+	if err := os.Chmod(filepath.Join(stackjetDirPath, "config.json"), 0600); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error restricting stackjet config: %v", err)
+	}
+}
+
 func createStackJetDir() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -93,13 +173,17 @@ func createStackJetDir() (string, error) {
 		if !info.IsDir() {
 			return "", fmt.Errorf("config path exists but is not a directory: %s", stackjetDir)
 		}
+		// older versions created it world readable, the config holds secrets
+		if err := os.Chmod(stackjetDir, 0700); err != nil {
+			return "", fmt.Errorf("could not restrict config dir: %w", err)
+		}
 		return stackjetDir, nil // Directory already exists
 	} else if !os.IsNotExist(err) {
 		return "", fmt.Errorf("could not check config directory: %w", err)
 	}
 
 	// Only create if it doesn't exist
-	if err := os.MkdirAll(stackjetDir, 0755); err != nil {
+	if err := os.MkdirAll(stackjetDir, 0700); err != nil {
 		return "", fmt.Errorf("could not create config dir: %w", err)
 	}
 
@@ -109,10 +193,28 @@ func createStackJetDir() (string, error) {
 func createDefaultConfig(configPath string) {
 	defaultConfig := pkg.AppConfig{
 		PORT:                    8080,
+		ACCESS_TOKEN_MINUTES:    15,
+		REFRESH_TOKEN_DAYS:      30,
+		JWT_KEY_GRACE_MINUTES:   60,
+		RATE_LIMITS:             pkg.DefaultRateLimits,
+		LOGIN_LOCKOUT_ATTEMPTS:  5,
+		LOGIN_LOCKOUT_MINUTES:   15,
+		OIDC_SCOPES:             []string{"openid", "email", "profile"},
+		OIDC_GROUPS_CLAIM:       "groups",
+		OIDC_ROLE_MAPPING:       map[string]string{},
 		GIT_BRANCH:              "master",
 		GIT_REMOTE:              "origin",
 		GIT_RESET:               true,
 		DEFAULT_STACKS_BASE_DIR: "/var/www/sites",
+		BUILD_CACHE_KEEP:        5,
+		STEP_TIMEOUTS:           pkg.DefaultStepTimeouts,
+		SANDBOX_HOME_DIR:        "/var/lib/stackjet/home",
+		NGINX_SITES_AVAILABLE:   "/etc/nginx/sites-available",
+		NGINX_SITES_ENABLED:     "/etc/nginx/sites-enabled",
+		ACME_DIRECTORY_URL:      "https://acme-v02.api.letsencrypt.org/directory",
+		ACME_WEBROOT:            "/var/www/sites/.acme-challenge",
+		ACME_RENEW_BEFORE_DAYS:  30,
+		DNS_TTL:                 1,
 	}
 	data, err := json.MarshalIndent(defaultConfig, "", "  ")
 	if err != nil {
@@ -121,7 +223,11 @@ func createDefaultConfig(configPath string) {
 		fmt.Println("\nPlease check your system permissions and try again.")
 		os.Exit(1)
 	}
-	file, err := os.OpenFile(configPath, os.O_WRONLY|os.O_CREATE, 0644)
+	// config with permission 0600, it holds the oidc client secret
+	file, err := os.OpenFile(configPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err == nil {
+		err = file.Chmod(0600)
+	}
 	if err != nil {
 		fmt.Println("❌ StackJet Configuration Error")
 		fmt.Println("Unable to open the configuration file.")
@@ -1,37 +1,211 @@
 package pkg
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func GenerateToken(email string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": email,
-		"exp": time.Now().Add(time.Hour * 24 * 30).Unix(),
+// signingKey is a HS256 key, tokens name the key that signed them in their kid header
+type signingKey struct {
+	ID     string
+	Secret []byte
+}
+
+// AccessClaims are the claims of an access token, it is only valid while its session is.
+// Tokens with a purpose are not access tokens.
+type AccessClaims struct {
+	SessionID int64  `json:"sid,omitempty"`
+	Purpose   string `json:"purpose,omitempty"`
+	// AuthMethod is the method of the login a two-factor token continues
+	AuthMethod string `json:"amr,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// twoFactorPurpose marks tokens of a login waiting for its two-factor code
+const twoFactorPurpose = "2fa"
+
+// TwoFactorTokenTTL is how long a login can wait for its two-factor code
+const TwoFactorTokenTTL = 5 * time.Minute
+
+func keyID(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:4])
+}
+
+func signingKeyPaths() (string, string) {
+	current := filepath.Join(Config().STACKJET_DIR, "jwt.token")
+	return current, current + ".previous"
+}
+
+// signingKeys returns the current key and the previous key while it is in its grace period.
+// They are read on every call so that a rotation applies to a running server.
+func signingKeys() (signingKey, *signingKey, error) {
+	currentPath, previousPath := signingKeyPaths()
+	secret, err := os.ReadFile(currentPath)
+	if err != nil {
+		return signingKey{}, nil, fmt.Errorf("failed to read the signing key: %w", err)
+	}
+	secret = []byte(strings.TrimSpace(string(secret)))
+	current := signingKey{ID: keyID(secret), Secret: secret}
+
+	info, err := os.Stat(previousPath)
+	if err != nil || time.Since(info.ModTime()) > time.Duration(Config().JWT_KEY_GRACE_MINUTES)*time.Minute {
+		return current, nil, nil
+	}
+	secret, err = os.ReadFile(previousPath)
+	if err != nil {
+		return current, nil, nil
+	}
+	secret = []byte(strings.TrimSpace(string(secret)))
+	return current, &signingKey{ID: keyID(secret), Secret: secret}, nil
+}
+
+// RotateSigningKey replaces the signing key. Tokens of the previous key stay valid for the grace period.
+func RotateSigningKey() error {
+	currentPath, previousPath := signingKeyPaths()
+	secret, err := GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(currentPath, previousPath); err != nil {
+		return err
+	}
+	// the modification time of the previous key starts its grace period
+	now := time.Now()
+	if err := os.Chtimes(previousPath, now, now); err != nil {
+		return err
+	}
+	return os.WriteFile(currentPath, []byte(secret), 0600)
+}
+
+// GenerateToken returns a short-lived access token of a session
+func GenerateToken(email string, sessionID int64) (string, error) {
+	return signToken(AccessClaims{
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   email,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(Config().AccessTokenTTL())),
+		},
 	})
-	tokenString, err := token.SignedString([]byte(Config().JWT_TOKEN))
+}
 
+// ValidateToken checks an access token and returns its email and session
+func ValidateToken(tokenString string) (string, int64, error) {
+	claims, err := parseToken(tokenString)
 	if err != nil {
-		return "", err
+		return "", 0, err
+	}
+	if claims.Purpose != "" || claims.Subject == "" || claims.SessionID == 0 {
+		return "", 0, errors.New("token has no session")
+	}
+	return claims.Subject, claims.SessionID, nil
+}
+
+// GenerateTwoFactorToken returns the token of a login through authMethod waiting for its two-factor code
+func GenerateTwoFactorToken(email string, authMethod string) (string, error) {
+	return signToken(AccessClaims{
+		Purpose:    twoFactorPurpose,
+		AuthMethod: authMethod,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   email,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TwoFactorTokenTTL)),
+		},
+	})
+}
+
+// ValidateTwoFactorToken checks the token of a login waiting for its two-factor code and returns its email and auth method
+func ValidateTwoFactorToken(tokenString string) (string, string, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return "", "", err
+	}
+	if claims.Purpose != twoFactorPurpose || claims.Subject == "" {
+		return "", "", errors.New("not a two-factor token")
 	}
-	return tokenString, nil
+	return claims.Subject, claims.AuthMethod, nil
+}
 
+// oidcLoginPurpose marks tokens of a login waiting for the OIDC provider to redirect back
+const oidcLoginPurpose = "oidc"
+
+// OIDCLoginTTL is how long a login can take at the OIDC provider
+const OIDCLoginTTL = 10 * time.Minute
+
+// OIDCLoginClaims keep the state, nonce and PKCE verifier of an OIDC login between its redirects
+type OIDCLoginClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	// Redirect is the path the browser returns to after the login
+	Redirect string `json:"redirect,omitempty"`
+	Purpose  string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// GenerateOIDCLoginToken returns the token of an OIDC login waiting for the provider to redirect back
+func GenerateOIDCLoginToken(claims OIDCLoginClaims) (string, error) {
+	claims.Purpose = oidcLoginPurpose
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(OIDCLoginTTL)),
+	}
+	return signToken(claims)
 }
 
-func ValidateToken(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(Config().JWT_TOKEN), nil
-	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+// ValidateOIDCLoginToken checks the token of an OIDC login and returns its claims
+func ValidateOIDCLoginToken(tokenString string) (*OIDCLoginClaims, error) {
+	var claims OIDCLoginClaims
+	if err := parseClaims(tokenString, &claims); err != nil {
+		return nil, err
+	}
+	if claims.Purpose != oidcLoginPurpose || claims.State == "" {
+		return nil, errors.New("not an oidc login token")
+	}
+	return &claims, nil
+}
 
+func signToken(claims jwt.Claims) (string, error) {
+	key, _, err := signingKeys()
 	if err != nil {
 		return "", err
 	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Secret)
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		return claims["sub"].(string), nil
-	} else {
-		return "", err
+func parseToken(tokenString string) (*AccessClaims, error) {
+	var claims AccessClaims
+	if err := parseClaims(tokenString, &claims); err != nil {
+		return nil, err
 	}
+	return &claims, nil
+}
+
+func parseClaims(tokenString string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		current, previous, err := signingKeys()
+		if err != nil {
+			return nil, err
+		}
+		kid, _ := token.Header["kid"].(string)
+		switch {
+		case kid == current.ID:
+			return current.Secret, nil
+		case previous != nil && kid == previous.ID:
+			return previous.Secret, nil
+		}
+		return nil, errors.New("unknown signing key")
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	return err
 }
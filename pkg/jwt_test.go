@@ -0,0 +1,139 @@
+package pkg
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// tokenKeyID returns the kid header of a token without verifying it
+func tokenKeyID(t *testing.T, tokenString string) string {
+	t.Helper()
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &AccessClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+// restoreSigningKeys puts the signing keys of the test config back once a test rotated them
+func restoreSigningKeys(t *testing.T) {
+	t.Helper()
+	currentPath, previousPath := signingKeyPaths()
+	current, err := os.ReadFile(currentPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.WriteFile(currentPath, current, 0600)
+		os.Remove(previousPath)
+	})
+}
+
+func TestValidateToken(t *testing.T) {
+	token, err := GenerateToken("dev@example.com", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenKeyID(t, token); kid != keyID([]byte("test-signing-key")) {
+		t.Fatalf("kid = %q, want the id of the signing key", kid)
+	}
+	email, sessionID, err := ValidateToken(token)
+	if err != nil || email != "dev@example.com" || sessionID != 7 {
+		t.Fatalf("ValidateToken = %q, %d, %v", email, sessionID, err)
+	}
+
+	twoFactor, err := GenerateTwoFactorToken("dev@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ValidateToken(twoFactor); err == nil {
+		t.Fatal("a two-factor token was accepted as access token")
+	}
+	if _, _, err := ValidateTwoFactorToken(token); err == nil {
+		t.Fatal("an access token was accepted as two-factor token")
+	}
+}
+
+func TestValidateTokenRejectsForgedKeys(t *testing.T) {
+	claims := AccessClaims{
+		SessionID: 7,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "dev@example.com",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+	sign := func(kid string, secret string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	tests := map[string]string{
+		"no kid":                 sign("", "test-signing-key"),
+		"unknown kid":            sign(keyID([]byte("other-key")), "other-key"),
+		"kid of the current key": sign(keyID([]byte("test-signing-key")), "other-key"),
+	}
+	for name, token := range tests {
+		if _, _, err := ValidateToken(token); err == nil {
+			t.Errorf("%s: token was accepted", name)
+		}
+	}
+}
+
+func TestRotateSigningKey(t *testing.T) {
+	restoreSigningKeys(t)
+	before, err := GenerateToken("dev@example.com", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RotateSigningKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := GenerateToken("dev@example.com", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenKeyID(t, after) == tokenKeyID(t, before) {
+		t.Fatal("tokens are still signed by the previous key")
+	}
+	if _, _, err := ValidateToken(after); err != nil {
+		t.Fatalf("token of the new key: %v", err)
+	}
+	// the grace period of the previous key started with the rotation
+	if _, _, err := ValidateToken(before); err != nil {
+		t.Fatalf("token of the previous key in its grace period: %v", err)
+	}
+
+	_, previousPath := signingKeyPaths()
+	rotatedAt := time.Now().Add(-time.Duration(Config().JWT_KEY_GRACE_MINUTES+1) * time.Minute)
+	if err := os.Chtimes(previousPath, rotatedAt, rotatedAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ValidateToken(before); err == nil {
+		t.Fatal("token of the previous key was accepted after its grace period")
+	}
+	if _, _, err := ValidateToken(after); err != nil {
+		t.Fatalf("token of the new key after the grace period: %v", err)
+	}
+
+	// a second rotation retires the first key at once
+	if err := RotateSigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ValidateToken(before); err == nil {
+		t.Fatal("token of a key rotated twice was accepted")
+	}
+	if _, _, err := ValidateToken(after); err != nil {
+		t.Fatalf("token of the previous key after the second rotation: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"io"
+)
+
+// EventWriter is implemented by writers that send typed events next to log lines, like the SSE stream of the API
+type EventWriter interface {
+	WriteEvent(event string, data any) error
+}
+
+// EmitEvent sends an event to w if it supports events and drops it otherwise
+func EmitEvent(w io.Writer, event string, data any) error {
+	if ew, ok := w.(EventWriter); ok {
+		return ew.WriteEvent(event, data)
+	}
+	return nil
+}
+
+// StepRecorder is implemented by writers that record the steps of a deployment.
+// Starting a step finishes the running step successfully.
+type StepRecorder interface {
+	StartStep(name string)
+	SkipStep()
+	FinishStep(err error)
+}
+
+// StartStep starts a deployment step if w records steps
+func StartStep(w io.Writer, name string) {
+	if r, ok := w.(StepRecorder); ok {
+		r.StartStep(name)
+	}
+}
+
+// SkipStep marks the running step as skipped if w records steps
+func SkipStep(w io.Writer) {
+	if r, ok := w.(StepRecorder); ok {
+		r.SkipStep()
+	}
+}
+
+// FinishStep finishes the running step, failed if err is set, if w records steps
+func FinishStep(w io.Writer, err error) {
+	if r, ok := w.(StepRecorder); ok {
+		r.FinishStep(err)
+	}
+}
+
+// MultiWriter duplicates writes and events to all writers. Unlike io.MultiWriter it keeps writing
+// to the others when one fails, so logs are still collected after an SSE client disconnects.
+func MultiWriter(writers ...io.Writer) io.Writer {
+	return &multiWriter{writers: writers}
+}
+
+type multiWriter struct {
+	writers []io.Writer
+}
+
+func (m *multiWriter) Write(p []byte) (int, error) {
+	var firstErr error
+	for _, w := range m.writers {
+		if _, err := w.Write(p); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return len(p), firstErr
+}
+
+func (m *multiWriter) WriteEvent(event string, data any) error {
+	var firstErr error
+	for _, w := range m.writers {
+		if err := EmitEvent(w, event, data); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
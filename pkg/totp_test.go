@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+// the SHA1 secret of the RFC 6238 test vectors, "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 appendix B lists 8 digit codes, the 6 digit codes are their last digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if code := totpCode(key, tt.unix/totpPeriod); code != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+		step, ok := VerifyTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0))
+		if !ok || step != tt.unix/totpPeriod {
+			t.Errorf("VerifyTOTP at %d = %d %t, want step %d", tt.unix, step, ok, tt.unix/totpPeriod)
+		}
+	}
+}
+
+func TestVerifyTOTPSkew(t *testing.T) {
+	// 1111111111 is in step 37037037, which starts at 1111111110
+	const code, step = "050471", int64(37037037)
+	tests := []struct {
+		unix int64
+		ok   bool
+	}{
+		{1111111080 - 1, false}, // last second of two steps before
+		{1111111080, true},      // first second of the previous step
+		{1111111110, true},
+		{1111111139, true},
+		{1111111140, true},  // first second of the next step
+		{1111111169, true},  // last second of the next step
+		{1111111170, false}, // two steps after
+	}
+	for _, tt := range tests {
+		got, ok := VerifyTOTP(rfc6238Secret, code, time.Unix(tt.unix, 0))
+		if ok != tt.ok || (ok && got != step) {
+			t.Errorf("VerifyTOTP at %d = %d %t, want %t", tt.unix, got, ok, tt.ok)
+		}
+	}
+}
+
+func TestVerifyTOTPInput(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	tests := []struct {
+		secret string
+		code   string
+		ok     bool
+	}{
+		{rfc6238Secret, " 050 471 ", true},
+		{"gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "050471", true},
+		{rfc6238Secret, "050472", false},
+		{rfc6238Secret, "50471", false},
+		{rfc6238Secret, "0504710", false},
+		{rfc6238Secret, "", false},
+		{"not base32!", "050471", false},
+	}
+	for _, tt := range tests {
+		if _, ok := VerifyTOTP(tt.secret, tt.code, now); ok != tt.ok {
+			t.Errorf("VerifyTOTP(%q, %q) = %t, want %t", tt.secret, tt.code, ok, tt.ok)
+		}
+	}
+}
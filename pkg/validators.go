@@ -22,7 +22,7 @@ func TagValidationErrors(err error, obj any) map[string]string {
 			if commaIdx := strings.Index(jsonTag, ","); commaIdx != -1 {
 				jsonTag = jsonTag[:commaIdx]
 			}
-			if jsonTag == "" {
+			if jsonTag == "" || jsonTag == "-" {
 				jsonTag = e.Field()
 			}
 
@@ -35,6 +35,10 @@ func TagValidationErrors(err error, obj any) map[string]string {
 				errors[jsonTag] = jsonTag + " must be at least " + e.Param() + " characters"
 			case "max":
 				errors[jsonTag] = jsonTag + " must be at most " + e.Param() + " characters"
+			case "gitref":
+				errors[jsonTag] = jsonTag + " is not a valid git ref name"
+			case "githash":
+				errors[jsonTag] = jsonTag + " must be a commit hash of 7 to 40 lower case hex characters"
 			default:
 				errors[jsonTag] = jsonTag + " is invalid"
 			}